@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const rolePrefix = "role"
+
+// Roles known to the access control subsystem
+const roleRegulator = "regulator"
+const roleMinter = "minter"
+const roleAuditor = "auditor"
+const roleProsumer = "prosumer"
+
+// GrantRole assigns a role to an account. Roles are granted by the regulator;
+// members of Org1 can always grant so the first regulator can be bootstrapped
+func (s *SmartContract) GrantRole(ctx contractapi.TransactionContextInterface, account string, role string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if role != roleRegulator && role != roleMinter && role != roleAuditor && role != roleProsumer {
+		return fmt.Errorf("unknown role %v", role)
+	}
+
+	roleKey, err := ctx.GetStub().CreateCompositeKey(rolePrefix, []string{account, role})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", rolePrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(roleKey, []byte("true"))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", roleKey, err)
+	}
+
+	return nil
+}
+
+// RevokeRole removes a role from an account
+func (s *SmartContract) RevokeRole(ctx contractapi.TransactionContextInterface, account string, role string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	roleKey, err := ctx.GetStub().CreateCompositeKey(rolePrefix, []string{account, role})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", rolePrefix, err)
+	}
+
+	err = ctx.GetStub().DelState(roleKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete role: %v", err)
+	}
+
+	return nil
+}
+
+// HasRole returns whether an account holds a role
+func (s *SmartContract) HasRole(ctx contractapi.TransactionContextInterface, account string, role string) (bool, error) {
+	return hasRole(ctx, account, role)
+}
+
+// hasRole is an internal helper that checks an on-chain role assignment
+func hasRole(ctx contractapi.TransactionContextInterface, account string, role string) (bool, error) {
+
+	roleKey, err := ctx.GetStub().CreateCompositeKey(rolePrefix, []string{account, role})
+	if err != nil {
+		return false, fmt.Errorf("failed to create the composite key for prefix %s: %v", rolePrefix, err)
+	}
+
+	roleBytes, err := ctx.GetStub().GetState(roleKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read role from world state: %v", err)
+	}
+
+	return roleBytes != nil, nil
+}
+
+// requireRole verifies that the submitting client holds a role. It accepts an
+// on-chain role assignment, a matching "role" attribute in the client
+// certificate, or membership of Org1 (which keeps the previous hard-coded
+// Org1MSP behaviour working and lets the first regulator be bootstrapped)
+func requireRole(ctx contractapi.TransactionContextInterface, role string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	assigned, err := hasRole(ctx, clientID, role)
+	if err != nil {
+		return err
+	}
+	if assigned {
+		return nil
+	}
+
+	// attribute-based check against the client certificate
+	attrValue, found, err := ctx.GetClientIdentity().GetAttributeValue("role")
+	if err == nil && found && attrValue == role {
+		return nil
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get MSPID: %v", err)
+	}
+	if clientMSPID == "Org1MSP" {
+		return nil
+	}
+
+	return fmt.Errorf("client does not hold the %v role", role)
+}
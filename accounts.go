@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const accountPrefix = "account"
+const accountInfoPrefix = "accountInfo"
+
+// reservedPlainKeys lists every plain (non-composite) key the contract uses
+// for configuration and bookkeeping. The legacy migration must never mistake
+// one of these for an account balance, even when its value happens to be a
+// plain integer like the maker-checker threshold or the treasury
+var reservedPlainKeys = map[string]bool{
+	totalSupplyKey:           true,
+	nameKey:                  true,
+	symbolKey:                true,
+	decimalsKey:              true,
+	treasuryKey:              true,
+	transferFeeKey:           true,
+	makerCheckerThresholdKey: true,
+	feedInTariffKey:          true,
+	feedInDailyCapKey:        true,
+	demurragePolicyKey:       true,
+	depositPolicyKey:         true,
+	settlementChaincodeKey:   true,
+	pausedKey:                true,
+	priceBandKey:             true,
+	congestionRulesKey:       true,
+	slashingsKey:             true,
+	monitorsKey:              true,
+	erasuresKey:              true,
+	reconciliationKey:        true,
+	BurnKey:                  true,
+}
+
+// AccountInfo is the metadata record of an account: a display name, the
+// owning organization and the meters attached to it. The balance itself stays
+// a bare integer under the account key so the balance codec and the legacy
+// migration keep working; the metadata lives in its own record
+type AccountInfo struct {
+	ClientID    string    `json:"clientID"`
+	DisplayName string    `json:"displayName"`
+	Org         string    `json:"org"`
+	MeterIDs    []string  `json:"meterIDs"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// getAccountInfo is an internal helper that reads an account's metadata
+// record; a nil record means the account predates the metadata or was never
+// created
+func getAccountInfo(ctx contractapi.TransactionContextInterface, id string) (*AccountInfo, error) {
+
+	infoKey, err := ctx.GetStub().CreateCompositeKey(accountInfoPrefix, []string{id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", accountInfoPrefix, err)
+	}
+
+	infoBytes, err := ctx.GetStub().GetState(infoKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account info from world state: %v", err)
+	}
+	if infoBytes == nil {
+		return nil, nil
+	}
+
+	var info AccountInfo
+	err = json.Unmarshal(infoBytes, &info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create account info object JSON: %v", err)
+	}
+
+	return &info, nil
+}
+
+// putAccountInfo is an internal helper that writes an account's metadata
+// record
+func putAccountInfo(ctx contractapi.TransactionContextInterface, info *AccountInfo) error {
+
+	infoKey, err := ctx.GetStub().CreateCompositeKey(accountInfoPrefix, []string{info.ClientID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", accountInfoPrefix, err)
+	}
+
+	infoBytes, err := marshalCanonical(info)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(infoKey, infoBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", infoKey, err)
+	}
+
+	return nil
+}
+
+// Account balances used to be stored directly under the raw clientID, which
+// shares the keyspace with "totalSupply", auctionIDs and every other plain
+// key. Balances now live under the account~id composite key, so collisions
+// are impossible and range queries over accounts are cheap. Reads fall back
+// to the legacy raw key until MigrateAccounts has moved it
+
+// getBalanceBytes reads an account balance, preferring the namespaced key
+func getBalanceBytes(ctx contractapi.TransactionContextInterface, id string) ([]byte, error) {
+
+	accountKey, err := ctx.GetStub().CreateCompositeKey(accountPrefix, []string{id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", accountPrefix, err)
+	}
+
+	balanceBytes, err := ctx.GetStub().GetState(accountKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account %s from world state: %v", id, err)
+	}
+	if balanceBytes != nil {
+		return balanceBytes, nil
+	}
+
+	// fall back to the legacy raw key for balances that predate the migration
+	return ctx.GetStub().GetState(id)
+}
+
+// putBalanceBytes writes an account balance under the namespaced key
+func putBalanceBytes(ctx contractapi.TransactionContextInterface, id string, value []byte) error {
+
+	accountKey, err := ctx.GetStub().CreateCompositeKey(accountPrefix, []string{id})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", accountPrefix, err)
+	}
+
+	return ctx.GetStub().PutState(accountKey, value)
+}
+
+// MigrateAccounts moves every legacy raw-key balance under the account
+// namespace and deletes the raw key. Only the operator may run the
+// migration; it is idempotent and reports how many accounts moved
+func (s *SmartContract) MigrateAccounts(ctx contractapi.TransactionContextInterface) (int, error) {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return 0, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read accounts from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	migrated := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read accounts from world state: %v", err)
+		}
+
+		// composite keys and reserved configuration keys are not accounts;
+		// a legacy balance is a plain key holding a plain integer
+		if strings.ContainsRune(queryResponse.Key, rune(0)) {
+			continue
+		}
+		if reservedPlainKeys[queryResponse.Key] {
+			continue
+		}
+		if _, err := strconv.Atoi(string(queryResponse.Value)); err != nil {
+			continue
+		}
+
+		err = putBalanceBytes(ctx, queryResponse.Key, queryResponse.Value)
+		if err != nil {
+			return 0, err
+		}
+
+		err = ctx.GetStub().DelState(queryResponse.Key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete legacy account key: %v", err)
+		}
+
+		migrated++
+	}
+
+	return migrated, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const auctionArchivePrefix = "auctionArchive"
+
+// AuctionSnapshot is one historical revision of a live auction key, taken
+// from the ledger history of the auction before it moved into the archive
+type AuctionSnapshot struct {
+	TxID      string    `json:"txID"`
+	Timestamp time.Time `json:"timestamp"`
+	IsDelete  bool      `json:"isDelete"`
+	Auction   *Auction  `json:"auction,omitempty"`
+}
+
+// archiveAuction is an internal helper that moves an ended or cancelled
+// auction under the archive prefix so the record survives the deletion of
+// the live key
+func archiveAuction(ctx contractapi.TransactionContextInterface, auctionID string, auctionJSON Auction) error {
+
+	archiveKey, err := ctx.GetStub().CreateCompositeKey(auctionArchivePrefix, []string{auctionID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", auctionArchivePrefix, err)
+	}
+
+	archiveBytes, err := marshalCanonical(auctionJSON)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(archiveKey, archiveBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", archiveKey, err)
+	}
+
+	return nil
+}
+
+// GetArchivedAuction returns the final state of an ended or cancelled auction
+// from the archive
+func (s *SmartContract) GetArchivedAuction(ctx contractapi.TransactionContextInterface, auctionID string) (*Auction, error) {
+
+	archiveKey, err := ctx.GetStub().CreateCompositeKey(auctionArchivePrefix, []string{auctionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", auctionArchivePrefix, err)
+	}
+
+	archiveBytes, err := ctx.GetStub().GetState(archiveKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read auction archive from world state: %v", err)
+	}
+	if archiveBytes == nil {
+		return nil, fmt.Errorf("no archived auction %v exists", auctionID)
+	}
+
+	var auctionJSON Auction
+	err = json.Unmarshal(archiveBytes, &auctionJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create auction object JSON: %v", err)
+	}
+
+	return &auctionJSON, nil
+}
+
+// QueryArchivedAuctions returns the final states of all archived auctions,
+// so auditors can walk the completed market without knowing the IDs
+func (s *SmartContract) QueryArchivedAuctions(ctx contractapi.TransactionContextInterface) ([]Auction, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(auctionArchivePrefix, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read auction archive from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	auctions := []Auction{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read auction archive from world state: %v", err)
+		}
+
+		var auctionJSON Auction
+		err = json.Unmarshal(queryResponse.Value, &auctionJSON)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create auction object JSON: %v", err)
+		}
+
+		auctions = append(auctions, auctionJSON)
+	}
+
+	return auctions, nil
+}
+
+// GetAuctionHistory returns every ledger revision of an auction's live key,
+// including the final delete that moved it into the archive. Combined with
+// GetArchivedAuction this reconstructs the full life of an auction for audit
+func (s *SmartContract) GetAuctionHistory(ctx contractapi.TransactionContextInterface, auctionID string) ([]AuctionSnapshot, error) {
+
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(auctionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history of auction %s: %v", auctionID, err)
+	}
+	defer resultsIterator.Close()
+
+	snapshots := []AuctionSnapshot{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history of auction %s: %v", auctionID, err)
+		}
+
+		snapshot := AuctionSnapshot{
+			TxID:      queryResponse.TxId,
+			Timestamp: time.Unix(queryResponse.Timestamp.Seconds, int64(queryResponse.Timestamp.Nanos)),
+			IsDelete:  queryResponse.IsDelete,
+		}
+
+		if !queryResponse.IsDelete {
+			var auctionJSON Auction
+			err = json.Unmarshal(queryResponse.Value, &auctionJSON)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create auction object JSON: %v", err)
+			}
+			snapshot.Auction = &auctionJSON
+		}
+
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, nil
+}
@@ -3,46 +3,270 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"math/big"
+	"sort"
 	"time"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
 type Auction struct {
-	Type           string             `json:"objectType"`
-	ItemSold       string             `json:"item"`
-	Amount         int                `json:"amount"`
-	PricePerKWh    int                `json:"priceperkwh"`
-	Time_started   time.Time          `json:"time_started"`
-	Time_remaining int                `json:"time_remaining"`
-	Seller         string             `json:"seller"`
-	Orgs           []string           `json:"organizations"`
-	PrivateBids    map[string]BidHash `json:"privateBids"`
-	RevealedBids   map[string]FullBid `json:"revealedBids"`
-	Winner         string             `json:"winner"`
-	Price          int                `json:"price"`
-	Status         string             `json:"status"`
+	Type            string             `json:"objectType"`
+	ItemSold        string             `json:"item"`
+	Amount          int                `json:"amount"`
+	PricePerKWh     int                `json:"priceperkwh"`
+	Time_started    time.Time          `json:"time_started"`
+	Time_remaining  int                `json:"time_remaining"`
+	Deadline        time.Time          `json:"deadline"`
+	Seller          string             `json:"seller"`
+	Orgs            []string           `json:"organizations"`
+	PrivateBids     map[string]BidHash `json:"privateBids"`
+	RevealedBids    map[string]FullBid `json:"revealedBids"`
+	Winner          string             `json:"winner"`
+	Vickrey         bool               `json:"vickrey"`
+	Reserve         int                `json:"reserve"`
+	MinIncrement    int                `json:"minIncrement"`
+	Allocations     map[string]int     `json:"allocations"`
+	Zone            string             `json:"zone"`
+	CarbonIntensity int                `json:"carbonIntensity"`
+	Price           int                `json:"price"`
+	Unit            string             `json:"unit"`
+	Status          string             `json:"status"`
 }
 
-// FullBid is the structure of a revealed bid
+// FullBid is the structure of a revealed bid. Quantity is only set for
+// partial bids that ask for part of the auctioned amount
 type FullBid struct {
-	Type   string `json:"objectType"`
-	Price  int    `json:"price"`
-	Org    string `json:"org"`
-	Bidder string `json:"bidder"`
+	Type     string `json:"objectType"`
+	Price    int    `json:"price"`
+	Quantity int    `json:"quantity"`
+	// GreenPremium is the extra amount the bidder is willing to pay on top
+	// of their bid when the auctioned energy is low-carbon
+	GreenPremium int    `json:"greenPremium,omitempty"`
+	Org          string `json:"org"`
+	Bidder       string `json:"bidder"`
+	// SubmittedAt is the tx timestamp of the bid; it is part of the
+	// deterministic tie-break when two bids share the highest price
+	SubmittedAt time.Time `json:"submittedAt"`
 }
 
 // BidHash is the structure of a private bid
 type BidHash struct {
-	Org  string `json:"org"`
-	Hash string `json:"hash"`
+	Org    string `json:"org"`
+	Hash   string `json:"hash"`
+	Bidder string `json:"bidder"`
 }
 
 const bidKeyType = "bid"
 
+// energy at or below this carbon intensity (gCO2 per KWh) counts as green;
+// green premiums only apply to auctions tagged at or below the threshold
+const lowCarbonThreshold = 100
+
+// effectiveBid is the price a bid clears at: in an auction for low-carbon
+// energy the bidder's green premium is added on top of their bid, so bidders
+// who value clean energy win green auctions within their price tolerance
+func effectiveBid(auctionJSON *Auction, bid FullBid) int {
+
+	if auctionJSON.CarbonIntensity > 0 && auctionJSON.CarbonIntensity <= lowCarbonThreshold {
+		return bid.Price + bid.GreenPremium
+	}
+
+	return bid.Price
+}
+
+// computeClearing determines the winner and the clearing price from the
+// revealed bids and returns the winning bid amount. In a standard auction the
+// winner pays their own bid; in a Vickrey auction the winner pays the highest
+// losing price instead, falling back to the asking price when nobody else bid
+func computeClearing(auctionJSON *Auction) int {
+
+	// order the bids deterministically before picking the winner: price
+	// first, then earliest bid timestamp, then lexicographic bidder ID.
+	// Relying on map-iteration order would let endorsers diverge whenever
+	// two bids share the highest price
+	bids := make([]FullBid, 0, len(auctionJSON.RevealedBids))
+	for _, bid := range auctionJSON.RevealedBids {
+		bids = append(bids, bid)
+	}
+	sort.Slice(bids, func(i, j int) bool {
+		if effectiveBid(auctionJSON, bids[i]) != effectiveBid(auctionJSON, bids[j]) {
+			return effectiveBid(auctionJSON, bids[i]) > effectiveBid(auctionJSON, bids[j])
+		}
+		if !bids[i].SubmittedAt.Equal(bids[j].SubmittedAt) {
+			return bids[i].SubmittedAt.Before(bids[j].SubmittedAt)
+		}
+		return bids[i].Bidder < bids[j].Bidder
+	})
+
+	winningBid := auctionJSON.Price
+	second := auctionJSON.Price
+	if len(bids) > 0 && effectiveBid(auctionJSON, bids[0]) > winningBid && effectiveBid(auctionJSON, bids[0]) >= auctionJSON.Reserve {
+		auctionJSON.Winner = bids[0].Bidder
+		winningBid = effectiveBid(auctionJSON, bids[0])
+		if len(bids) > 1 && effectiveBid(auctionJSON, bids[1]) > second {
+			second = effectiveBid(auctionJSON, bids[1])
+		}
+	}
+
+	auctionJSON.Price = winningBid
+	if auctionJSON.Vickrey && auctionJSON.Winner != "" {
+		auctionJSON.Price = second
+	}
+
+	return winningBid
+}
+
+// auctionExpired compares the current tx timestamp against the auction's
+// absolute deadline. Auctions created before the deadline field existed fall
+// back to Time_started plus Time_remaining; either way the comparison only
+// uses the tx timestamp, never the peer's wall clock, so all endorsers agree
+func auctionExpired(ctx contractapi.TransactionContextInterface, auctionJSON Auction) (bool, error) {
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return false, fmt.Errorf("failed to get timestamp")
+	}
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	deadline := auctionJSON.Deadline
+	if deadline.IsZero() {
+		deadline = auctionJSON.Time_started.Add(time.Duration(auctionJSON.Time_remaining) * time.Minute)
+	}
+
+	return !now.Before(deadline), nil
+}
+
+// settlementEvent is the payload of the Settlement event emitted when an
+// auction ends and the held funds move
+type settlementEvent struct {
+	AuctionID string `json:"auctionID"`
+	Winner    string `json:"winner"`
+	Price     int    `json:"price"`
+}
+
+// settleAuction settles an ended auction using the held funds: the winner's
+// hold moves into escrow until delivery is confirmed and the losing bidders
+// get their holds back. A Settlement event is emitted with the clearing price
+func settleAuction(ctx contractapi.TransactionContextInterface, auctionJSON Auction, auctionID string) error {
+
+	settled := make(map[string]bool)
+	for _, bid := range auctionJSON.RevealedBids {
+		if settled[bid.Bidder] {
+			continue
+		}
+		settled[bid.Bidder] = true
+
+		if bid.Bidder == auctionJSON.Winner {
+			// the winning amount moves into escrow until delivery is
+			// confirmed; in a congestion zone the settled amount carries
+			// the zone multiplier
+			settledPrice, err := applyZoneMultiplier(ctx, auctionJSON.Zone, auctionJSON.Price)
+			if err != nil {
+				return err
+			}
+
+			// consuming the hold also returns whatever the winner held
+			// beyond the settled amount; in a Vickrey auction this is the
+			// gap to the second price
+			err = createEscrow(ctx, auctionID, bid.Bidder, auctionJSON.Seller, settledPrice)
+			if err != nil {
+				return fmt.Errorf("cannot escrow winner's hold: %v", err)
+			}
+		} else {
+			// losing bidders get the hold they placed for this auction back
+			// without having to call ReleaseHoldByID themselves
+			err := releaseHoldRecord(ctx, bid.Bidder, auctionID, holdReleased)
+			if err != nil {
+				return fmt.Errorf("cannot return hold: %v", err)
+			}
+
+			// emit a HoldReleased event per loser; Fabric only delivers the
+			// last event of a transaction, so each release is also written
+			// as a receipt for clients that need the complete list
+			meta, err := eventMeta(ctx)
+			if err != nil {
+				return err
+			}
+			err = emitEvent(ctx, "HoldReleased", HoldReleasedEvent{EventMeta: meta, Holder: bid.Bidder, AuctionID: auctionID})
+			if err != nil {
+				return err
+			}
+
+			err = recordReceipt(ctx, "hold", bid.Bidder, fmt.Sprintf("hold of %s released after auction %s ended", bid.Bidder, auctionID))
+			if err != nil {
+				return err
+			}
+
+			// losing bidders get their stake back with their hold
+			err = releaseStake(ctx, auctionID, bid.Bidder, bid.Bidder)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if auctionJSON.Winner == "" {
+		return nil
+	}
+
+	settlement := settlementEvent{
+		AuctionID: auctionID,
+		Winner:    auctionJSON.Winner,
+		Price:     auctionJSON.Price,
+	}
+	settlementJSON, err := json.Marshal(settlement)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("Settlement", settlementJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	// fold the clearing price into the on-chain benchmark indices
+	err = recordIndexSample(ctx, seriesAuctionAvg, auctionJSON.Price, 1)
+	if err != nil {
+		return err
+	}
+	if auctionJSON.Amount > 0 {
+		err = recordIndexSample(ctx, seriesVWAP, auctionJSON.Price, auctionJSON.Amount)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // CreateAuction creates on auction on the public channel. The identity that
 // submits the transacion becomes the seller of the auction
-func (s *SmartContract) CreateAuction(ctx contractapi.TransactionContextInterface, auctionID string, priceperkwh int, amount int, time_rem int) error { //amount = how many kwh
+func (s *SmartContract) CreateAuction(ctx contractapi.TransactionContextInterface, auctionID string, priceperkwh int, amount int, time_rem int, vickrey bool, reserve int, minIncrement int, zone string, carbonIntensity int) error { //amount = how many kwh
+
+	// only registered participants sell on the market
+	if err := requireRegistered(ctx); err != nil {
+		return err
+	}
+
+	// a reserve of 0 disables the reserve and an increment of 0 disables
+	// the minimum raise; both stay optional for existing client apps
+	if reserve < 0 || minIncrement < 0 {
+		return fmt.Errorf("reserve price and minimum increment cannot be negative")
+	}
+
+	// a carbon intensity of 0 leaves the auction untagged; tagged auctions
+	// at or below the low-carbon threshold collect green premiums from bids
+	if carbonIntensity < 0 {
+		return fmt.Errorf("carbon intensity cannot be negative")
+	}
+
+	// an empty zone means the auction settles without a congestion
+	// multiplier; a named zone has to exist in the zone registry
+	if zone != "" {
+		if _, err := getZone(ctx, zone); err != nil {
+			return err
+		}
+	}
 
 	// get ID of submitting client
 	clientID, err := ctx.GetClientIdentity().GetID()
@@ -64,25 +288,50 @@ func (s *SmartContract) CreateAuction(ctx contractapi.TransactionContextInterfac
 		return fmt.Errorf("failed to get timestamp")
 	}
 
+	// the expiry deadline is absolute and derived from the tx timestamp, so
+	// every endorser sees the same deadline regardless of its wall clock
+	deadline := time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).Add(time.Duration(time_rem) * time.Minute)
+
 	time := time.Unix(timestamp.Seconds, int64(timestamp.Nanos)) //.String()
 
+	// quantities are stored in Wh; the market precision says what unit the
+	// submitted amount is in, so precision stays consistent per namespace
+	unit, err := marketPrecision(ctx, defaultMarket)
+	if err != nil {
+		return err
+	}
+	amountWh, err := toWh(amount, unit)
+	if err != nil {
+		return err
+	}
+
 	auction := Auction{
 		Type:           "auction",
-		ItemSold:       "energy(KWh)",
-		Amount:         amount,
+		ItemSold:       "energy(Wh)",
+		Amount:         amountWh,
 		PricePerKWh:    priceperkwh,
 		Time_started:   time,
 		Time_remaining: time_rem,
-		Price:          amount * priceperkwh,
-		Seller:         clientID,
-		Orgs:           []string{clientOrgID},
-		PrivateBids:    bidders,
-		RevealedBids:   revealedBids,
-		Winner:         "",
-		Status:         "open",
-	}
-
-	auctionBytes, err := json.Marshal(auction)
+		Deadline:       deadline,
+		// the asking price is per-KWh price times the KWh quantity; the
+		// normalized Wh amount is converted back so a Wh-precision market
+		// does not inflate the price a thousandfold
+		Price:           amountWh / whPerKWh * priceperkwh,
+		Seller:          clientID,
+		Orgs:            []string{clientOrgID},
+		PrivateBids:     bidders,
+		RevealedBids:    revealedBids,
+		Winner:          "",
+		Vickrey:         vickrey,
+		Reserve:         reserve,
+		MinIncrement:    minIncrement,
+		Zone:            zone,
+		CarbonIntensity: carbonIntensity,
+		Unit:            unit,
+		Status:          "open",
+	}
+
+	auctionBytes, err := marshalCanonical(auction)
 	if err != nil {
 		return err
 	}
@@ -99,13 +348,35 @@ func (s *SmartContract) CreateAuction(ctx contractapi.TransactionContextInterfac
 		return fmt.Errorf("failed setting state based endorsement for new organization: %v", err)
 	}
 
+	// record the new auction for the transaction explorer
+	err = recordReceipt(ctx, "auction", auctionID, fmt.Sprintf("auction %s created for %d KWh", auctionID, amount))
+	if err != nil {
+		return err
+	}
+
+	// Emit the AuctionCreated event
+	meta, err := eventMeta(ctx)
+	if err != nil {
+		return err
+	}
+	err = emitEvent(ctx, "AuctionCreated", AuctionCreatedEvent{EventMeta: meta, AuctionID: auctionID, Seller: clientID, Amount: amount, PricePerKWh: priceperkwh})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
 // SubmitBid is used by the bidder to add the hash of that bid stored in private data to the
 // auction. Note that this function alters the auction in private state, and needs
 // to meet the auction endorsement policy. Transaction ID is used identify the bid
-func (s *SmartContract) Bid_Rev(ctx contractapi.TransactionContextInterface, auctionID string, amount int) error {
+func (s *SmartContract) SubmitBid(ctx contractapi.TransactionContextInterface, auctionID string, amount int, greenPremium int) error {
+
+	// only registered participants bid on the market
+	if err := requireRegistered(ctx); err != nil {
+		return err
+	}
+
 	clientID, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
 		return fmt.Errorf("failed to get client id: %v", err)
@@ -137,37 +408,106 @@ func (s *SmartContract) Bid_Rev(ctx contractapi.TransactionContextInterface, auc
 		return fmt.Errorf("cannot join closed or ended auction")
 	}
 
-	t := int(time.Since(auctionJSON.Time_started).Minutes())
-	if t >= auctionJSON.Time_remaining {
-		_ = CloseAuction(ctx, auctionID)
-		_ = EndAuction(ctx, auctionID)
+	// a green premium only makes sense on a low-carbon auction; it is the
+	// extra amount the bidder pays if their bid wins on the premium
+	if greenPremium < 0 {
+		return fmt.Errorf("green premium cannot be negative")
+	}
+
+	expired, err := auctionExpired(ctx, auctionJSON)
+	if err != nil {
+		return err
+	}
+	if expired {
+		_ = closeAuction(ctx, auctionID)
+		_ = endAuction(ctx, auctionID)
 		return fmt.Errorf("time is up")
 	}
 
+	// a winning green-premium bid settles at bid plus premium, so the
+	// premium is covered up front together with the bid
+	covered := amount
+	if auctionJSON.CarbonIntensity > 0 && auctionJSON.CarbonIntensity <= lowCarbonThreshold {
+		covered += greenPremium
+	}
+
+	// in a congestion zone the winner settles at the zone-adjusted price,
+	// so the bid has to be covered at the adjusted amount
+	held, err := applyZoneMultiplier(ctx, auctionJSON.Zone, covered)
+	if err != nil {
+		return err
+	}
+
 	balance, err := s.ClientAccountBalance(ctx)
 	if err != nil {
 		return fmt.Errorf("cannot get balance")
 	}
-	if balance < amount {
+	if balance < held {
 		return fmt.Errorf("balance is less than amount")
 	}
 
-	// use the transaction ID passed as a parameter to create composite bid key
-	bidKey, err := ctx.GetStub().CreateCompositeKey(bidKeyType, []string{auctionID})
+	// bids below the reserve price never win, so they are rejected up front
+	if auctionJSON.Reserve > 0 && amount < auctionJSON.Reserve {
+		return fmt.Errorf("bid of %d is below the reserve price of %d", amount, auctionJSON.Reserve)
+	}
+
+	// each new bid has to beat the current best by the minimum increment
+	if auctionJSON.MinIncrement > 0 {
+		best := 0
+		for _, bid := range auctionJSON.RevealedBids {
+			if bid.Price > best {
+				best = bid.Price
+			}
+		}
+		if best > 0 && amount < best+auctionJSON.MinIncrement {
+			return fmt.Errorf("bid of %d does not exceed the best bid of %d by the minimum increment of %d", amount, best, auctionJSON.MinIncrement)
+		}
+	}
+
+	// evaluate the rate-of-change monitors against the auction reference
+	// price; the auctioned amount is stored in Wh while the price is per KWh
+	err = checkPriceAlarm(ctx, auctionID, auctionJSON.Amount/whPerKWh*auctionJSON.PricePerKWh, amount)
+	if err != nil {
+		return err
+	}
+
+	// every bid gets its own key from the transaction ID, so bids of
+	// different bidders never overwrite each other and each revision of a
+	// bidder's bid stays on the ledger
+	bidKey, err := ctx.GetStub().CreateCompositeKey(bidKeyType, []string{auctionID, ctx.GetStub().GetTxID()})
 	if err != nil {
 		return fmt.Errorf("failed to create composite key: %v", err)
 	}
 
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
 	NewBid := FullBid{
-		Type:   auctionJSON.ItemSold,
-		Price:  amount,
-		Org:    clientOrgID,
-		Bidder: clientID,
+		Type:         auctionJSON.ItemSold,
+		Price:        amount,
+		GreenPremium: greenPremium,
+		Org:          clientOrgID,
+		Bidder:       clientID,
+		SubmittedAt:  time.Unix(timestamp.Seconds, int64(timestamp.Nanos)),
+	}
+
+	bidBytes, err := marshalCanonical(NewBid)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
 	}
 
+	err = ctx.GetStub().PutState(bidKey, bidBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put bid in public data: %v", err)
+	}
+
+	// the auction itself tracks the latest bid of each bidder by identity;
+	// a re-bid replaces the bidder's entry, not someone else's
 	bidders := make(map[string]FullBid)
 	bidders = auctionJSON.RevealedBids
-	bidders[bidKey] = NewBid
+	bidders[clientID] = NewBid
 	auctionJSON.RevealedBids = bidders
 
 	// Add the bidding organization to the list of participating organizations if it is not already
@@ -182,73 +522,72 @@ func (s *SmartContract) Bid_Rev(ctx contractapi.TransactionContextInterface, auc
 		}
 	}
 
-	newAuctionBytes, _ := json.Marshal(auctionJSON)
+	newAuctionBytes, _ := marshalCanonical(auctionJSON)
 
 	err = ctx.GetStub().PutState(auctionID, newAuctionBytes)
 	if err != nil {
 		return fmt.Errorf("failed to update auction: %v", err)
 	}
 
-	err = s.CreateHold(ctx, amount)
-	if err != nil {
-		return fmt.Errorf("cannot create hold: %v", err)
+	// the bid is backed by a hold record keyed by this auction, so bids on
+	// different auctions never touch each other's funds; a re-bid replaces
+	// the bidder's previous hold for this auction
+	available := balance
+	if existingHold, _, err := getHoldRecord(ctx, clientID, auctionID); err == nil && existingHold.Status == holdActive {
+		available += existingHold.Amount
+		err = releaseHoldRecord(ctx, clientID, auctionID, holdReleased)
+		if err != nil {
+			return fmt.Errorf("cannot release previous hold: %v", err)
+		}
 	}
 
-	return nil
-}
-
-// CloseAuction can be used by the seller to close the auction. This prevents
-// bids from being added to the auction, and allows users to reveal their bid
-func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface, auctionID string) error {
-
-	auctionBytes, err := ctx.GetStub().GetState(auctionID)
+	err = createHoldRecord(ctx, clientID, auctionID, held, "bid", auctionJSON.Time_remaining+disputeWindowMin)
 	if err != nil {
-		return fmt.Errorf("failed to get auction %v: %v", auctionID, err)
-	}
-
-	if auctionBytes == nil {
-		return fmt.Errorf("Auction interest object %v not found", auctionID)
+		return fmt.Errorf("cannot create hold: %v", err)
 	}
 
-	var auctionJSON Auction
-	err = json.Unmarshal(auctionBytes, &auctionJSON)
+	// the configured deposit percentage is staked on top of the hold, debited
+	// against the balance the hold already reduced
+	err = takeStake(ctx, auctionID, clientID, amount, big.NewInt(int64(available-held)))
 	if err != nil {
-		return fmt.Errorf("failed to create auction object JSON: %v", err)
+		return fmt.Errorf("cannot take stake: %v", err)
 	}
 
-	// the auction can only be closed by the seller
-
-	// get ID of submitting client
-	clientID, err := ctx.GetClientIdentity().GetID()
+	// Emit the BidSubmitted event
+	meta, err := eventMeta(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get client identity %v", err)
-	}
-
-	Seller := auctionJSON.Seller
-	if Seller != clientID {
-		return fmt.Errorf("auction can only be closed by seller: %v", err)
+		return err
 	}
-
-	Status := auctionJSON.Status
-	if Status != "open" {
-		return fmt.Errorf("cannot close auction that is not open")
+	err = emitEvent(ctx, "BidSubmitted", BidSubmittedEvent{EventMeta: meta, AuctionID: auctionID, Bidder: clientID})
+	if err != nil {
+		return err
 	}
 
-	auctionJSON.Status = string("closed")
-
-	closedAuction, _ := json.Marshal(auctionJSON)
+	return nil
+}
 
-	err = ctx.GetStub().PutState(auctionID, closedAuction)
+// Bid_Rev is the deprecated name of SubmitBid, kept as a thin shim so existing
+// client apps keep working across the upgrade window. It emits a Deprecated
+// event before forwarding to the new logic
+func (s *SmartContract) Bid_Rev(ctx contractapi.TransactionContextInterface, auctionID string, amount int) error {
+	err := emitDeprecationEvent(ctx, "Bid_Rev", "SubmitBid")
 	if err != nil {
-		return fmt.Errorf("failed to close auction: %v", err)
+		return err
 	}
 
-	return nil
+	return s.SubmitBid(ctx, auctionID, amount, 0)
 }
 
 // CloseAuction can be used by the seller to close the auction. This prevents
 // bids from being added to the auction, and allows users to reveal their bid
-func CloseAuction(ctx contractapi.TransactionContextInterface, auctionID string) error {
+func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface, auctionID string) error {
+
+	return closeAuction(ctx, auctionID)
+}
+
+// closeAuction is the internal close path, it is shared by CloseAuction and
+// the expiry sweeps in SubmitBid and CheckAuction
+func closeAuction(ctx contractapi.TransactionContextInterface, auctionID string) error {
 
 	auctionBytes, err := ctx.GetStub().GetState(auctionID)
 	if err != nil {
@@ -273,8 +612,7 @@ func CloseAuction(ctx contractapi.TransactionContextInterface, auctionID string)
 		return fmt.Errorf("failed to get client identity %v", err)
 	}
 
-	Seller := auctionJSON.Seller
-	if Seller != clientID {
+	if !isAuctionSeller(ctx, auctionJSON, auctionID, clientID) {
 		return fmt.Errorf("auction can only be closed by seller: %v", err)
 	}
 
@@ -285,7 +623,7 @@ func CloseAuction(ctx contractapi.TransactionContextInterface, auctionID string)
 
 	auctionJSON.Status = string("closed")
 
-	closedAuction, _ := json.Marshal(auctionJSON)
+	closedAuction, _ := marshalCanonical(auctionJSON)
 
 	err = ctx.GetStub().PutState(auctionID, closedAuction)
 	if err != nil {
@@ -295,9 +633,11 @@ func CloseAuction(ctx contractapi.TransactionContextInterface, auctionID string)
 	return nil
 }
 
-// EndAuction both changes the auction status to closed and calculates the winners
-// of the auction
-func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface, auctionID string) error {
+// CancelAuction cancels an auction that has not ended yet: the auction is
+// marked cancelled, every bidder's hold goes back to their balance, and an
+// AuctionCancelled event carries the reason. Only the seller or the
+// regulator may cancel
+func (s *SmartContract) CancelAuction(ctx contractapi.TransactionContextInterface, auctionID string, reason string) error {
 
 	auctionBytes, err := ctx.GetStub().GetState(auctionID)
 	if err != nil {
@@ -314,51 +654,57 @@ func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface,
 		return fmt.Errorf("failed to create auction object JSON: %v", err)
 	}
 
-	// Check that the auction is being ended by the seller
-
 	// get ID of submitting client
 	clientID, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
 		return fmt.Errorf("failed to get client identity %v", err)
 	}
 
-	Seller := auctionJSON.Seller
-	if Seller != clientID {
-		return fmt.Errorf("auction can only be ended by seller: %v", err)
+	if !isAuctionSeller(ctx, auctionJSON, auctionID, clientID) && requireRole(ctx, roleRegulator) != nil {
+		return fmt.Errorf("auction can only be cancelled by the seller or the regulator")
 	}
 
 	Status := auctionJSON.Status
-	if Status != "closed" {
-		return fmt.Errorf("can only end a closed auction")
+	if Status != "open" && Status != "closed" {
+		return fmt.Errorf("cannot cancel auction that has already ended")
 	}
 
-	// get the list of revealed bids
-	revealedBidMap := auctionJSON.RevealedBids
-	if len(auctionJSON.RevealedBids) == 0 {
-		return fmt.Errorf("no bids have been revealed, cannot end auction: %v", err)
-	}
+	// every bidder gets the hold they placed for this auction back in full
+	released := make(map[string]bool)
+	for _, bid := range auctionJSON.RevealedBids {
+		if released[bid.Bidder] {
+			continue
+		}
+		released[bid.Bidder] = true
 
-	// determine the highest bid
-	for _, bid := range revealedBidMap {
-		if bid.Price > auctionJSON.Price {
-			auctionJSON.Winner = bid.Bidder
-			auctionJSON.Price = bid.Price
+		err = releaseHoldRecord(ctx, bid.Bidder, auctionID, holdReleased)
+		if err != nil {
+			return fmt.Errorf("cannot return hold: %v", err)
 		}
-	}
 
-	// check if there is a winning bid that has yet to be revealed
-	err = queryAllBids(ctx, auctionJSON.Price, auctionJSON.RevealedBids, auctionJSON.PrivateBids)
-	if err != nil {
-		return fmt.Errorf("cannot close auction: %v", err)
+		err = recordReceipt(ctx, "hold", bid.Bidder, fmt.Sprintf("hold of %s released after auction %s was cancelled", bid.Bidder, auctionID))
+		if err != nil {
+			return err
+		}
+
+		err = releaseStake(ctx, auctionID, bid.Bidder, bid.Bidder)
+		if err != nil {
+			return err
+		}
 	}
 
-	auctionJSON.Status = string("ended")
+	auctionJSON.Status = string("cancelled")
 
-	closedAuction, _ := json.Marshal(auctionJSON)
+	// cancelled auctions move into the archive like ended ones
+	err = archiveAuction(ctx, auctionID, auctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to archive auction: %v", err)
+	}
 
-	err = ctx.GetStub().PutState(auctionID, closedAuction)
+	// drop the per-auction endorsement policy that accumulated as orgs bid
+	err = removeAssetStateBasedEndorsement(ctx, auctionID)
 	if err != nil {
-		return fmt.Errorf("failed to end auction: %v", err)
+		return err
 	}
 
 	err = ctx.GetStub().DelState(auctionID)
@@ -366,12 +712,24 @@ func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface,
 		return fmt.Errorf("failed to delete auction: %v", err)
 	}
 
-	return nil
+	// Emit the AuctionCancelled event
+	meta, err := eventMeta(ctx)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, "AuctionCancelled", AuctionCancelledEvent{EventMeta: meta, AuctionID: auctionID, Seller: auctionJSON.Seller, Reason: reason})
 }
 
 // EndAuction both changes the auction status to closed and calculates the winners
 // of the auction
-func EndAuction(ctx contractapi.TransactionContextInterface, auctionID string) error {
+func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface, auctionID string) error {
+
+	return endAuction(ctx, auctionID)
+}
+
+// endAuction is the internal settlement path, it is shared by EndAuction and
+// the expiry sweeps in SubmitBid and CheckAuction
+func endAuction(ctx contractapi.TransactionContextInterface, auctionID string) error {
 
 	auctionBytes, err := ctx.GetStub().GetState(auctionID)
 	if err != nil {
@@ -396,8 +754,7 @@ func EndAuction(ctx contractapi.TransactionContextInterface, auctionID string) e
 		return fmt.Errorf("failed to get client identity %v", err)
 	}
 
-	Seller := auctionJSON.Seller
-	if Seller != clientID {
+	if !isAuctionSeller(ctx, auctionJSON, auctionID, clientID) {
 		return fmt.Errorf("auction can only be ended by seller: %v", err)
 	}
 
@@ -407,32 +764,51 @@ func EndAuction(ctx contractapi.TransactionContextInterface, auctionID string) e
 	}
 
 	// get the list of revealed bids
-	revealedBidMap := auctionJSON.RevealedBids
 	if len(auctionJSON.RevealedBids) == 0 {
 		return fmt.Errorf("no bids have been revealed, cannot end auction: %v", err)
 	}
 
-	// determine the highest bid
-	for _, bid := range revealedBidMap {
-		if bid.Price > auctionJSON.Price {
-			auctionJSON.Winner = bid.Bidder
-			auctionJSON.Price = bid.Price
-		}
-	}
+	// determine the winner and the clearing price
+	winningBid := computeClearing(&auctionJSON)
 
 	// check if there is a winning bid that has yet to be revealed
-	err = queryAllBids(ctx, auctionJSON.Price, auctionJSON.RevealedBids, auctionJSON.PrivateBids)
+	err = queryAllBids(ctx, winningBid, auctionJSON.RevealedBids, auctionJSON.PrivateBids)
 	if err != nil {
 		return fmt.Errorf("cannot close auction: %v", err)
 	}
 
+	// a clearing price outside the configured band around the oracle
+	// reference price voids the sale
+	err = enforcePriceBand(ctx, auctionID, &auctionJSON)
+	if err != nil {
+		return err
+	}
+
 	auctionJSON.Status = string("ended")
 
-	closedAuction, _ := json.Marshal(auctionJSON)
+	// when the reserve is not met the auction ends with no sale; settling
+	// then only releases the bidders' holds
+	if auctionJSON.Reserve > 0 && auctionJSON.Winner == "" {
+		auctionJSON.Status = string("no sale")
+	}
 
-	err = ctx.GetStub().PutState(auctionID, closedAuction)
+	// settle the auction using the held funds
+	err = settleAuction(ctx, auctionJSON, auctionID)
 	if err != nil {
-		return fmt.Errorf("failed to close auction: %v", err)
+		return fmt.Errorf("cannot settle auction: %v", err)
+	}
+
+	// move the ended auction into the archive before the live key goes away,
+	// so the final record survives for audit
+	err = archiveAuction(ctx, auctionID, auctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to archive auction: %v", err)
+	}
+
+	// drop the per-auction endorsement policy that accumulated as orgs bid
+	err = removeAssetStateBasedEndorsement(ctx, auctionID)
+	if err != nil {
+		return err
 	}
 
 	err = ctx.GetStub().DelState(auctionID)
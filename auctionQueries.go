@@ -28,6 +28,149 @@ func (s *SmartContract) QueryAuction(ctx contractapi.TransactionContextInterface
 	return auction, nil
 }
 
+// AuctionPage is one page of auction summaries returned by QueryAuctions
+type AuctionPage struct {
+	Auctions []*Auction `json:"auctions"`
+	Bookmark string     `json:"bookmark"`
+}
+
+// QueryAuctions lists auctions with the given status ("open", "closed",
+// "ended" or "" for any) page by page. The returned bookmark is passed back in
+// the next call to fetch the following page
+func (s *SmartContract) QueryAuctions(ctx contractapi.TransactionContextInterface, status string, bookmark string, pageSize int) (*AuctionPage, error) {
+
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be a positive integer")
+	}
+
+	resultsIterator, metadata, err := ctx.GetStub().GetStateByRangeWithPagination("", "", int32(pageSize), bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read auctions from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	page := AuctionPage{
+		Auctions: []*Auction{},
+	}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read auctions from world state: %v", err)
+		}
+
+		// balances and other objects share the keyspace, only keep auctions
+		var auction Auction
+		err = json.Unmarshal(queryResponse.Value, &auction)
+		if err != nil || auction.Type != "auction" {
+			continue
+		}
+
+		if status != "" && auction.Status != status {
+			continue
+		}
+
+		page.Auctions = append(page.Auctions, &auction)
+	}
+
+	page.Bookmark = metadata.Bookmark
+
+	return &page, nil
+}
+
+// BidEvaluation is the what-if answer returned by EvaluateBid
+type BidEvaluation struct {
+	AuctionID       string `json:"auctionID"`
+	WouldWin        bool   `json:"wouldWin"`
+	CurrentBest     int    `json:"currentBest"`
+	MinWinningPrice int    `json:"minWinningPrice"`
+	RequiredHold    int    `json:"requiredHold"`
+}
+
+// EvaluateBid is a read-only what-if query: it reports whether a bid of
+// unitPrice per KWh for the given quantity would currently be winning, the
+// minimum winning price and the hold it would require, computed from the
+// asking price and the bids revealed so far. Unrevealed private bids are not
+// visible and can still outbid the evaluation
+func (s *SmartContract) EvaluateBid(ctx contractapi.TransactionContextInterface, auctionID string, unitPrice int, quantity int) (*BidEvaluation, error) {
+
+	if unitPrice <= 0 || quantity <= 0 {
+		return nil, fmt.Errorf("unit price and quantity must be positive integers")
+	}
+
+	auction, err := s.QueryAuction(ctx, auctionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if quantity > auction.Amount {
+		return nil, fmt.Errorf("auction only offers %d KWh", auction.Amount)
+	}
+
+	// the asking price is the floor; every revealed bid raises the bar
+	currentBest := auction.Price
+	for _, bid := range auction.RevealedBids {
+		if bid.Price > currentBest {
+			currentBest = bid.Price
+		}
+	}
+
+	minWinningPrice := currentBest
+	if len(auction.RevealedBids) > 0 {
+		minWinningPrice = currentBest + 1
+	}
+
+	evaluation := BidEvaluation{
+		AuctionID:       auctionID,
+		CurrentBest:     currentBest,
+		MinWinningPrice: minWinningPrice,
+		RequiredHold:    unitPrice * quantity,
+		WouldWin:        auction.Status == "open" && unitPrice*quantity >= minWinningPrice,
+	}
+
+	return &evaluation, nil
+}
+
+// AuctionBids is the answer returned by GetAuctionBids: every revealed bid
+// plus the hashes of the bids that have not been revealed yet
+type AuctionBids struct {
+	AuctionID    string             `json:"auctionID"`
+	RevealedBids map[string]FullBid `json:"revealedBids"`
+	PrivateBids  map[string]BidHash `json:"privateBids"`
+}
+
+// GetAuctionBids returns all bids of an auction so participants can verify
+// the winner determination: the revealed bids in full and the hashes of the
+// unrevealed ones. Access is restricted to the seller of the auction and the
+// regulator
+func (s *SmartContract) GetAuctionBids(ctx contractapi.TransactionContextInterface, auctionID string) (*AuctionBids, error) {
+
+	auction, err := s.QueryAuction(ctx, auctionID)
+	if err != nil {
+		return nil, err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if clientID != auction.Seller {
+		err = requireRole(ctx, roleRegulator)
+		if err != nil {
+			return nil, fmt.Errorf("only the seller or the regulator can list the bids of an auction")
+		}
+	}
+
+	bids := AuctionBids{
+		AuctionID:    auctionID,
+		RevealedBids: auction.RevealedBids,
+		PrivateBids:  auction.PrivateBids,
+	}
+
+	return &bids, nil
+}
+
 // QueryBid allows the submitter of the bid to read their bid from public state
 func (s *SmartContract) QueryBid(ctx contractapi.TransactionContextInterface, auctionID string, txID string) (*FullBid, error) {
 
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestAuctionHappyPath(t *testing.T) {
+	contract, stub, org1 := setupContract(t)
+
+	seller := testContext(stub, "seller", "Org2MSP")
+	alice := testContext(stub, "alice", "Org2MSP")
+	bob := testContext(stub, "bob", "Org3MSP")
+	registerAccount(t, contract, stub, seller)
+	registerAccount(t, contract, stub, alice)
+	registerAccount(t, contract, stub, bob)
+	fundAccount(t, contract, stub, alice, org1, 50)
+	fundAccount(t, contract, stub, bob, org1, 50)
+
+	// 2 kWh at an asking price of 5 per kWh, so bids have to beat 10
+	stub.tick()
+	err := contract.CreateAuction(seller, "a1", 5, 2, 10, false, 0, 0, "", 0)
+	if err != nil {
+		t.Fatalf("failed to create auction: %v", err)
+	}
+
+	// a bid moves the bid amount from the bidder's balance onto a hold
+	stub.tick()
+	err = contract.SubmitBid(alice, "a1", 12, 0)
+	if err != nil {
+		t.Fatalf("failed to submit alice's bid: %v", err)
+	}
+	stub.tick()
+	requireBalance(t, contract, org1, "alice", 38)
+
+	stub.tick()
+	err = contract.SubmitBid(bob, "a1", 15, 0)
+	if err != nil {
+		t.Fatalf("failed to submit bob's bid: %v", err)
+	}
+	stub.tick()
+	requireBalance(t, contract, org1, "bob", 35)
+
+	stub.tick()
+	err = contract.CloseAuction(seller, "a1")
+	if err != nil {
+		t.Fatalf("failed to close auction: %v", err)
+	}
+
+	// bids no longer land on a closed auction
+	stub.tick()
+	err = contract.SubmitBid(alice, "a1", 20, 0)
+	if err == nil {
+		t.Fatal("expected a bid on a closed auction to fail")
+	}
+
+	stub.tick()
+	err = contract.EndAuction(seller, "a1")
+	if err != nil {
+		t.Fatalf("failed to end auction: %v", err)
+	}
+
+	// the ended auction left the live state and moved into the archive
+	stub.tick()
+	_, err = contract.QueryAuction(org1, "a1")
+	if err == nil {
+		t.Fatal("expected the ended auction to be gone from the live state")
+	}
+
+	archived, err := contract.GetArchivedAuction(org1, "a1")
+	if err != nil {
+		t.Fatalf("failed to get archived auction: %v", err)
+	}
+	if archived.Winner != "bob" || archived.Price != 15 {
+		t.Fatalf("archived auction cleared for %s at %d, want bob at 15", archived.Winner, archived.Price)
+	}
+
+	// the loser got their hold back, the winner's amount sits in escrow
+	requireBalance(t, contract, org1, "alice", 50)
+	requireBalance(t, contract, org1, "bob", 35)
+
+	escrow, err := contract.GetEscrow(org1, "a1")
+	if err != nil {
+		t.Fatalf("failed to get escrow: %v", err)
+	}
+	if escrow.Buyer != "bob" || escrow.Seller != "seller" || escrow.Amount != 15 || escrow.Status != escrowHeld {
+		t.Fatalf("unexpected escrow %+v", escrow)
+	}
+
+	// the seller is only paid once the buyer confirms delivery
+	requireBalance(t, contract, org1, "seller", 0)
+
+	stub.tick()
+	err = contract.ConfirmDelivery(bob, "a1")
+	if err != nil {
+		t.Fatalf("failed to confirm delivery: %v", err)
+	}
+
+	stub.tick()
+	requireBalance(t, contract, org1, "seller", 15)
+
+	escrow, err = contract.GetEscrow(org1, "a1")
+	if err != nil {
+		t.Fatalf("failed to get escrow: %v", err)
+	}
+	if escrow.Status != escrowReleased {
+		t.Fatalf("escrow status is %s, want %s", escrow.Status, escrowReleased)
+	}
+}
+
+func TestSubmitBidFailures(t *testing.T) {
+	contract, stub, org1 := setupContract(t)
+
+	seller := testContext(stub, "seller", "Org2MSP")
+	alice := testContext(stub, "alice", "Org2MSP")
+	registerAccount(t, contract, stub, seller)
+	registerAccount(t, contract, stub, alice)
+	fundAccount(t, contract, stub, alice, org1, 10)
+
+	stub.tick()
+	err := contract.SubmitBid(alice, "missing", 5, 0)
+	if err == nil {
+		t.Fatal("expected a bid on a missing auction to fail")
+	}
+
+	stub.tick()
+	err = contract.CreateAuction(seller, "a1", 5, 2, 10, false, 0, 0, "", 0)
+	if err != nil {
+		t.Fatalf("failed to create auction: %v", err)
+	}
+
+	// a bid over the bidder's balance cannot be covered by a hold
+	stub.tick()
+	err = contract.SubmitBid(alice, "a1", 20, 0)
+	if err == nil {
+		t.Fatal("expected a bid over the balance to fail")
+	}
+	requireBalance(t, contract, org1, "alice", 10)
+
+	// an unregistered client cannot bid
+	stranger := testContext(stub, "stranger", "Org2MSP")
+	stub.tick()
+	err = contract.SubmitBid(stranger, "a1", 5, 0)
+	if err == nil {
+		t.Fatal("expected a bid by an unregistered client to fail")
+	}
+}
+
+func TestAuctionSellerOnly(t *testing.T) {
+	contract, stub, org1 := setupContract(t)
+
+	seller := testContext(stub, "seller", "Org2MSP")
+	alice := testContext(stub, "alice", "Org2MSP")
+	registerAccount(t, contract, stub, seller)
+	registerAccount(t, contract, stub, alice)
+	fundAccount(t, contract, stub, alice, org1, 50)
+
+	stub.tick()
+	err := contract.CreateAuction(seller, "a1", 5, 2, 10, false, 0, 0, "", 0)
+	if err != nil {
+		t.Fatalf("failed to create auction: %v", err)
+	}
+
+	stub.tick()
+	err = contract.SubmitBid(alice, "a1", 12, 0)
+	if err != nil {
+		t.Fatalf("failed to submit bid: %v", err)
+	}
+
+	// only the seller closes and ends the auction
+	stub.tick()
+	err = contract.CloseAuction(alice, "a1")
+	if err == nil {
+		t.Fatal("expected closing by a non-seller to fail")
+	}
+
+	// an open auction cannot be ended, it has to be closed first
+	stub.tick()
+	err = contract.EndAuction(seller, "a1")
+	if err == nil {
+		t.Fatal("expected ending an open auction to fail")
+	}
+
+	stub.tick()
+	err = contract.CloseAuction(seller, "a1")
+	if err != nil {
+		t.Fatalf("failed to close auction: %v", err)
+	}
+
+	stub.tick()
+	err = contract.EndAuction(alice, "a1")
+	if err == nil {
+		t.Fatal("expected ending by a non-seller to fail")
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const auctionHeaderPrefix = "auctionHeader"
+const auctionStatsPrefix = "auctionStats"
+const openBidPrefix = "openBid"
+
+// AuctionHeader is the restructured auction object. Under load every bid on
+// the original Auction rewrote the whole JSON including all other bids,
+// causing large writes and MVCC conflicts between concurrent bidders. The
+// header holds only the slow-changing fields; bids live under their own
+// per-bidder keys and the running aggregates under a separate small key
+type AuctionHeader struct {
+	ID             string    `json:"id"`
+	ItemSold       string    `json:"objectType"`
+	Amount         int       `json:"amount"`
+	PricePerKWh    int       `json:"priceperkwh"`
+	Price          int       `json:"price"`
+	Seller         string    `json:"seller"`
+	Orgs           []string  `json:"organizations"`
+	Time_started   time.Time `json:"time_st"`
+	Time_remaining int       `json:"time_rem"`
+	Winner         string    `json:"winner"`
+	Status         string    `json:"status"`
+}
+
+// AuctionStats are the maintained aggregates of an auction. Each bid only
+// rewrites this small object instead of the full bid set
+type AuctionStats struct {
+	BidCount   int    `json:"bidCount"`
+	HighBid    int    `json:"highBid"`
+	HighBidder string `json:"highBidder"`
+}
+
+// OpenBid is one bid stored under its own (auctionID, bidder) key
+type OpenBid struct {
+	Bidder string `json:"bidder"`
+	Amount int    `json:"amount"`
+}
+
+// CreateAuctionV2 creates an auction using the restructured key layout. The
+// identity that submits the transaction becomes the seller of the auction
+func (s *SmartContract) CreateAuctionV2(ctx contractapi.TransactionContextInterface, auctionID string, priceperkwh int, amount int, time_rem int) error {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	// get org of submitting client
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	headerKey, err := ctx.GetStub().CreateCompositeKey(auctionHeaderPrefix, []string{auctionID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", auctionHeaderPrefix, err)
+	}
+
+	headerBytes, err := ctx.GetStub().GetState(headerKey)
+	if err != nil {
+		return fmt.Errorf("failed to read auction header from world state: %v", err)
+	}
+	if headerBytes != nil {
+		return fmt.Errorf("auction %v already exists", auctionID)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	header := AuctionHeader{
+		ID:             auctionID,
+		ItemSold:       "energy(KWh)",
+		Amount:         amount,
+		PricePerKWh:    priceperkwh,
+		Price:          amount * priceperkwh,
+		Seller:         clientID,
+		Orgs:           []string{clientOrgID},
+		Time_started:   time.Unix(timestamp.Seconds, int64(timestamp.Nanos)),
+		Time_remaining: time_rem,
+		Winner:         "",
+		Status:         "open",
+	}
+
+	err = putAuctionHeader(ctx, auctionID, &header)
+	if err != nil {
+		return err
+	}
+
+	statsBytes, err := marshalCanonical(AuctionStats{})
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	statsKey, err := ctx.GetStub().CreateCompositeKey(auctionStatsPrefix, []string{auctionID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", auctionStatsPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(statsKey, statsBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", statsKey, err)
+	}
+
+	return nil
+}
+
+// SubmitBidV2 places a bid on a restructured auction. The bid writes only its
+// own key and the aggregates, never the other bids, so concurrent bidders no
+// longer conflict on the auction object
+func (s *SmartContract) SubmitBidV2(ctx contractapi.TransactionContextInterface, auctionID string, amount int) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	header, err := getAuctionHeader(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+
+	if header.Status != "open" {
+		return fmt.Errorf("cannot bid on auction that is not open")
+	}
+
+	if amount < header.Price {
+		return fmt.Errorf("the bid must at least match the asking price of %d", header.Price)
+	}
+
+	bidKey, err := ctx.GetStub().CreateCompositeKey(openBidPrefix, []string{auctionID, clientID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", openBidPrefix, err)
+	}
+
+	existingBidBytes, err := ctx.GetStub().GetState(bidKey)
+	if err != nil {
+		return fmt.Errorf("failed to read bid from world state: %v", err)
+	}
+	if existingBidBytes != nil {
+		return fmt.Errorf("client has already bid on auction %v", auctionID)
+	}
+
+	// place the bid amount on a hold record keyed by this auction so the
+	// winning bid can settle without touching holds on other auctions
+	err = createHoldRecord(ctx, clientID, auctionID, amount, "bid", header.Time_remaining+disputeWindowMin)
+	if err != nil {
+		return fmt.Errorf("cannot create hold: %v", err)
+	}
+
+	bid := OpenBid{
+		Bidder: clientID,
+		Amount: amount,
+	}
+
+	bidBytes, err := marshalCanonical(bid)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(bidKey, bidBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", bidKey, err)
+	}
+
+	stats, statsKey, err := getAuctionStats(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+
+	stats.BidCount++
+	if amount > stats.HighBid {
+		stats.HighBid = amount
+		stats.HighBidder = clientID
+	}
+
+	statsBytes, err := marshalCanonical(stats)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(statsKey, statsBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", statsKey, err)
+	}
+
+	return nil
+}
+
+// EndAuctionV2 ends a restructured auction. The winner comes straight from
+// the maintained aggregates; losing bids get their holds back
+func (s *SmartContract) EndAuctionV2(ctx contractapi.TransactionContextInterface, auctionID string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	header, err := getAuctionHeader(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+
+	if header.Seller != clientID {
+		return fmt.Errorf("auction can only be ended by seller: %v", err)
+	}
+
+	if header.Status != "open" {
+		return fmt.Errorf("auction is not open")
+	}
+
+	stats, _, err := getAuctionStats(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+
+	header.Winner = stats.HighBidder
+	header.Status = "ended"
+
+	err = putAuctionHeader(ctx, auctionID, header)
+	if err != nil {
+		return err
+	}
+
+	// settle the bids: the winning hold pays the seller, the rest return
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(openBidPrefix, []string{auctionID})
+	if err != nil {
+		return fmt.Errorf("failed to read bids from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return fmt.Errorf("failed to read bids from world state: %v", err)
+		}
+
+		var bid OpenBid
+		err = json.Unmarshal(queryResponse.Value, &bid)
+		if err != nil {
+			return fmt.Errorf("failed to create bid object JSON: %v", err)
+		}
+
+		if bid.Bidder == header.Winner {
+			err = executeHoldRecord(ctx, clientID, bid.Bidder, auctionID, bid.Amount)
+			if err != nil {
+				return fmt.Errorf("cannot execute hold: %v", err)
+			}
+		} else {
+			err = releaseHoldRecord(ctx, bid.Bidder, auctionID, holdReleased)
+			if err != nil {
+				return fmt.Errorf("cannot return hold: %v", err)
+			}
+		}
+	}
+
+	// Emit the AuctionEnded event
+	meta, err := eventMeta(ctx)
+	if err != nil {
+		return err
+	}
+	err = emitEvent(ctx, "AuctionEnded", AuctionEndedEvent{EventMeta: meta, AuctionID: auctionID, Winner: header.Winner, Price: stats.HighBid})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetAuctionHeader returns the header of a restructured auction
+func (s *SmartContract) GetAuctionHeader(ctx contractapi.TransactionContextInterface, auctionID string) (*AuctionHeader, error) {
+	return getAuctionHeader(ctx, auctionID)
+}
+
+// GetAuctionStats returns the maintained aggregates of a restructured auction
+func (s *SmartContract) GetAuctionStats(ctx contractapi.TransactionContextInterface, auctionID string) (*AuctionStats, error) {
+	stats, _, err := getAuctionStats(ctx, auctionID)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// getAuctionHeader is an internal helper that reads an auction header
+func getAuctionHeader(ctx contractapi.TransactionContextInterface, auctionID string) (*AuctionHeader, error) {
+
+	headerKey, err := ctx.GetStub().CreateCompositeKey(auctionHeaderPrefix, []string{auctionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", auctionHeaderPrefix, err)
+	}
+
+	headerBytes, err := ctx.GetStub().GetState(headerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read auction header from world state: %v", err)
+	}
+	if headerBytes == nil {
+		return nil, fmt.Errorf("auction %v does not exist", auctionID)
+	}
+
+	var header AuctionHeader
+	err = json.Unmarshal(headerBytes, &header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create auction header object JSON: %v", err)
+	}
+
+	return &header, nil
+}
+
+// putAuctionHeader is an internal helper that writes an auction header
+func putAuctionHeader(ctx contractapi.TransactionContextInterface, auctionID string, header *AuctionHeader) error {
+
+	headerKey, err := ctx.GetStub().CreateCompositeKey(auctionHeaderPrefix, []string{auctionID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", auctionHeaderPrefix, err)
+	}
+
+	headerBytes, err := marshalCanonical(header)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(headerKey, headerBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", headerKey, err)
+	}
+
+	return nil
+}
+
+// getAuctionStats is an internal helper that reads the aggregates of an
+// auction together with their key
+func getAuctionStats(ctx contractapi.TransactionContextInterface, auctionID string) (*AuctionStats, string, error) {
+
+	statsKey, err := ctx.GetStub().CreateCompositeKey(auctionStatsPrefix, []string{auctionID})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create the composite key for prefix %s: %v", auctionStatsPrefix, err)
+	}
+
+	statsBytes, err := ctx.GetStub().GetState(statsKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read auction stats from world state: %v", err)
+	}
+	if statsBytes == nil {
+		return nil, "", fmt.Errorf("auction %v does not exist", auctionID)
+	}
+
+	var stats AuctionStats
+	err = json.Unmarshal(statsBytes, &stats)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create auction stats object JSON: %v", err)
+	}
+
+	return &stats, statsKey, nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const readingPrefix = "reading"
+const baselinePrefix = "baseline"
+const baselineMethodPrefix = "baselineMethod"
+
+// Baseline methods selectable per program via governance
+const methodHigh4of5 = "high4of5"
+const methodAvg5of5 = "avg5of5"
+
+// Baseline is a computed consumption baseline, persisted so disputes about
+// flexibility and demand-response verification can be handled later
+type Baseline struct {
+	Program   string `json:"program"`
+	Asset     string `json:"asset"`
+	EventDate string `json:"eventDate"`
+	Method    string `json:"method"`
+	KWh       int    `json:"kWh"`
+}
+
+// RecordReading stores the daily consumption of an asset in KWh. The date is
+// passed as YYYY-MM-DD
+func (s *SmartContract) RecordReading(ctx contractapi.TransactionContextInterface, asset string, date string, kWh int) error {
+
+	if kWh < 0 {
+		return fmt.Errorf("reading cannot be negative")
+	}
+
+	_, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return fmt.Errorf("failed to parse reading date: %v", err)
+	}
+
+	readingKey, err := ctx.GetStub().CreateCompositeKey(readingPrefix, []string{asset, date})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", readingPrefix, err)
+	}
+
+	// readings are stored in Wh; the submitted value is in the market's unit
+	unit, err := marketPrecision(ctx, defaultMarket)
+	if err != nil {
+		return err
+	}
+	wh, err := toWh(kWh, unit)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(readingKey, []byte(strconv.Itoa(wh)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", readingKey, err)
+	}
+
+	return nil
+}
+
+// SetBaselineMethod selects the baseline method of a flexibility or
+// demand-response program. Only the regulator may change it
+func (s *SmartContract) SetBaselineMethod(ctx contractapi.TransactionContextInterface, program string, method string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if method != methodHigh4of5 && method != methodAvg5of5 {
+		return fmt.Errorf("unknown baseline method %v", method)
+	}
+
+	methodKey, err := ctx.GetStub().CreateCompositeKey(baselineMethodPrefix, []string{program})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", baselineMethodPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(methodKey, []byte(method))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", methodKey, err)
+	}
+
+	return nil
+}
+
+// ComputeBaseline computes the baseline of an asset for an event date with
+// the method configured for the program, using the stored readings of the
+// five days before the event. The result is persisted for dispute handling
+func (s *SmartContract) ComputeBaseline(ctx contractapi.TransactionContextInterface, program string, asset string, eventDate string) (*Baseline, error) {
+
+	methodKey, err := ctx.GetStub().CreateCompositeKey(baselineMethodPrefix, []string{program})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", baselineMethodPrefix, err)
+	}
+
+	methodBytes, err := ctx.GetStub().GetState(methodKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline method from world state: %v", err)
+	}
+	if methodBytes == nil {
+		return nil, fmt.Errorf("no baseline method is configured for program %v", program)
+	}
+	method := string(methodBytes)
+
+	event, err := time.Parse("2006-01-02", eventDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse event date: %v", err)
+	}
+
+	// collect the readings of the five days before the event
+	readings := []int{}
+	for i := 1; i <= 5; i++ {
+		date := event.AddDate(0, 0, -i).Format("2006-01-02")
+
+		readingKey, err := ctx.GetStub().CreateCompositeKey(readingPrefix, []string{asset, date})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", readingPrefix, err)
+		}
+
+		readingBytes, err := ctx.GetStub().GetState(readingKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read reading from world state: %v", err)
+		}
+		if readingBytes == nil {
+			return nil, fmt.Errorf("no reading is stored for asset %v on %v", asset, date)
+		}
+
+		kWh, _ := strconv.Atoi(string(readingBytes))
+		readings = append(readings, kWh)
+	}
+
+	var kWh int
+	switch method {
+	case methodHigh4of5:
+		// average of the highest four of the five days
+		sort.Sort(sort.Reverse(sort.IntSlice(readings)))
+		sum := 0
+		for _, reading := range readings[:4] {
+			sum += reading
+		}
+		kWh = sum / 4
+	case methodAvg5of5:
+		sum := 0
+		for _, reading := range readings {
+			sum += reading
+		}
+		kWh = sum / 5
+	default:
+		return nil, fmt.Errorf("unknown baseline method %v", method)
+	}
+
+	baseline := Baseline{
+		Program:   program,
+		Asset:     asset,
+		EventDate: eventDate,
+		Method:    method,
+		KWh:       kWh,
+	}
+
+	baselineBytes, err := marshalCanonical(baseline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	baselineKey, err := ctx.GetStub().CreateCompositeKey(baselinePrefix, []string{program, asset, eventDate})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", baselinePrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(baselineKey, baselineBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update state of smart contract for key %s: %v", baselineKey, err)
+	}
+
+	return &baseline, nil
+}
+
+// GetBaseline returns a previously computed baseline
+func (s *SmartContract) GetBaseline(ctx contractapi.TransactionContextInterface, program string, asset string, eventDate string) (*Baseline, error) {
+
+	baselineKey, err := ctx.GetStub().CreateCompositeKey(baselinePrefix, []string{program, asset, eventDate})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", baselinePrefix, err)
+	}
+
+	baselineBytes, err := ctx.GetStub().GetState(baselineKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline from world state: %v", err)
+	}
+	if baselineBytes == nil {
+		return nil, fmt.Errorf("no baseline has been computed for asset %v on %v", asset, eventDate)
+	}
+
+	var baseline Baseline
+	err = json.Unmarshal(baselineBytes, &baseline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create baseline object JSON: %v", err)
+	}
+
+	return &baseline, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// beforeExempt lists the functions the shared preamble does not apply to:
+// the bootstrap path (Initialize, participant onboarding and role grants run
+// before the registry is populated) and the emergency controls that have to
+// keep working while the contract is paused
+var beforeExempt = map[string]bool{
+	"Initialize":          true,
+	"Ping":                true,
+	"Info":                true,
+	"IsPaused":            true,
+	"PauseContract":       true,
+	"UnpauseContract":     true,
+	"RegisterParticipant": true,
+	"UpdateParticipant":   true,
+	"GetParticipant":      true,
+	"ListParticipants":    true,
+	"SetKYCStatus":        true,
+	"GrantRole":           true,
+	"RevokeRole":          true,
+	"HasRole":             true,
+}
+
+// beforeTransaction is the shared preamble that used to be pasted into every
+// entry point. It logs the invocation with its transaction ID and caller, and
+// enforces the global gates: the contract is initialized and not paused, the
+// caller is not KYC-rejected and the caller's account is not closed. The
+// positive registration requirement stays in the trading entry points via
+// requireRegistered, since regulator and operator identities legitimately
+// call the API without a participant profile
+func beforeTransaction(ctx contractapi.TransactionContextInterface) error {
+
+	fcn, _ := ctx.GetStub().GetFunctionAndParameters()
+	if i := strings.LastIndex(fcn, ":"); i >= 0 {
+		fcn = fcn[i+1:]
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	log.Printf("tx %s: %s invoked by %s", ctx.GetStub().GetTxID(), fcn, clientID)
+
+	if beforeExempt[fcn] {
+		return nil
+	}
+
+	err = checkInitialized(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = checkNotPaused(ctx)
+	if err != nil {
+		return err
+	}
+
+	// a caller whose KYC status the regulator rejected is locked out of the
+	// whole API, not just the entry points that require registration
+	participant, _ := getParticipant(ctx, clientID)
+	if participant != nil && participant.KYCStatus == kycRejected {
+		return fmt.Errorf("client's KYC status is rejected")
+	}
+
+	// a closed account stays locked out everywhere
+	return checkAccountOpen(ctx, clientID)
+}
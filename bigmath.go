@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Balances and the total supply are stored as decimal strings. Parsing them
+// into big.Int instead of int removes the silent overflow of strconv on
+// amounts past the platform int range; the string encoding on the ledger is
+// unchanged, so existing state stays readable
+
+// parseBalance decodes a stored balance. A missing value decodes as zero
+func parseBalance(balanceBytes []byte) (*big.Int, error) {
+
+	if balanceBytes == nil {
+		return big.NewInt(0), nil
+	}
+
+	balance, ok := new(big.Int).SetString(string(balanceBytes), 10)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse balance %s", string(balanceBytes))
+	}
+
+	return balance, nil
+}
+
+// formatBalance encodes a balance for storage
+func formatBalance(balance *big.Int) []byte {
+	return []byte(balance.String())
+}
+
+// addBalance returns a + b
+func addBalance(a *big.Int, b int) *big.Int {
+	return new(big.Int).Add(a, big.NewInt(int64(b)))
+}
+
+// subBalance returns a - b, or an error when the result would go negative
+func subBalance(a *big.Int, b int) (*big.Int, error) {
+
+	result := new(big.Int).Sub(a, big.NewInt(int64(b)))
+	if result.Sign() < 0 {
+		return nil, fmt.Errorf("insufficient funds: balance %s is less than %d", a.String(), b)
+	}
+
+	return result, nil
+}
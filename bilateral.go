@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const tradePrefix = "trade"
+
+// Trade statuses
+const tradeProposed = "proposed"
+const tradeAccepted = "accepted"
+const tradeRejected = "rejected"
+
+// Trade is a bilateral agreement struck outside the auctions: a buyer
+// proposes a quantity at a price to a named seller, the full amount goes on
+// hold at proposal time, and acceptance moves it into escrow until delivery
+// is confirmed. The escrow and delivery records are keyed by the trade ID,
+// so ConfirmDelivery, DisputeEscrow and the rest of the settlement machinery
+// work on trades exactly as on auctions
+type Trade struct {
+	ID                string    `json:"ID"`
+	Buyer             string    `json:"buyer"`
+	Seller            string    `json:"seller"`
+	KWh               int       `json:"kwh"`
+	PricePerKWh       int       `json:"priceperkwh"`
+	Amount            int       `json:"amount"`
+	DeliveryWindowMin int       `json:"deliveryWindowMin"`
+	ProposedAt        time.Time `json:"proposedAt"`
+	Status            string    `json:"status"`
+}
+
+// ProposeTrade proposes a bilateral trade to a counterparty. The calling
+// client is the buyer; the full trade amount moves onto their hold so the
+// offer is always funded. The trade ID is the transaction ID
+func (s *SmartContract) ProposeTrade(ctx contractapi.TransactionContextInterface, counterparty string, kwh int, pricePerKwh int, deliveryWindowMin int) (string, error) {
+
+	// only registered participants trade on the market
+	if err := requireRegistered(ctx); err != nil {
+		return "", err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if counterparty == clientID {
+		return "", fmt.Errorf("cannot propose a trade to yourself")
+	}
+	if kwh <= 0 || pricePerKwh <= 0 {
+		return "", fmt.Errorf("quantity and price must be positive integers")
+	}
+	if deliveryWindowMin <= 0 {
+		return "", fmt.Errorf("delivery window must be a positive number of minutes")
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("failed to get timestamp")
+	}
+
+	trade := Trade{
+		ID:                ctx.GetStub().GetTxID(),
+		Buyer:             clientID,
+		Seller:            counterparty,
+		KWh:               kwh,
+		PricePerKWh:       pricePerKwh,
+		Amount:            kwh * pricePerKwh,
+		DeliveryWindowMin: deliveryWindowMin,
+		ProposedAt:        time.Unix(timestamp.Seconds, int64(timestamp.Nanos)),
+		Status:            tradeProposed,
+	}
+
+	// the proposal is funded up front with a balance-checked hold record
+	// keyed by the trade ID, so acceptance can never fail on an empty
+	// account and rejection releases exactly this trade's amount
+	err = createHoldRecord(ctx, clientID, trade.ID, trade.Amount, "trade", deliveryWindowMin+disputeWindowMin)
+	if err != nil {
+		return "", fmt.Errorf("cannot create hold: %v", err)
+	}
+
+	err = putTrade(ctx, &trade)
+	if err != nil {
+		return "", err
+	}
+
+	err = recordReceipt(ctx, tradePrefix, trade.ID, fmt.Sprintf("trade of %d KWh at %d proposed by %s to %s", kwh, pricePerKwh, clientID, counterparty))
+	if err != nil {
+		return "", err
+	}
+
+	return trade.ID, nil
+}
+
+// AcceptTrade accepts a proposed trade. Only the named counterparty accepts;
+// the buyer's held amount moves into escrow and a delivery record is
+// scheduled, so the seller is paid through ConfirmDelivery like an auction
+// winner's seller
+func (s *SmartContract) AcceptTrade(ctx contractapi.TransactionContextInterface, tradeID string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	trade, err := getTrade(ctx, tradeID)
+	if err != nil {
+		return err
+	}
+
+	if clientID != trade.Seller {
+		return fmt.Errorf("only the proposed counterparty can accept the trade")
+	}
+
+	if trade.Status != tradeProposed {
+		return fmt.Errorf("trade %v is not proposed", tradeID)
+	}
+
+	err = createEscrow(ctx, tradeID, trade.Buyer, trade.Seller, trade.Amount)
+	if err != nil {
+		return fmt.Errorf("cannot escrow buyer's hold: %v", err)
+	}
+
+	trade.Status = tradeAccepted
+
+	err = putTrade(ctx, trade)
+	if err != nil {
+		return err
+	}
+
+	return recordReceipt(ctx, tradePrefix, tradeID, fmt.Sprintf("trade %s accepted by %s", tradeID, clientID))
+}
+
+// RejectTrade declines a proposed trade and returns the held amount to the
+// buyer. The counterparty rejects an unwanted offer; the buyer can also
+// reject to withdraw their own proposal
+func (s *SmartContract) RejectTrade(ctx contractapi.TransactionContextInterface, tradeID string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	trade, err := getTrade(ctx, tradeID)
+	if err != nil {
+		return err
+	}
+
+	if clientID != trade.Seller && clientID != trade.Buyer {
+		return fmt.Errorf("only the buyer or the proposed counterparty can reject the trade")
+	}
+
+	if trade.Status != tradeProposed {
+		return fmt.Errorf("trade %v is not proposed", tradeID)
+	}
+
+	// release exactly this trade's hold record; holds backing other
+	// proposals or bids are untouched
+	err = releaseHoldRecord(ctx, trade.Buyer, trade.ID, holdReleased)
+	if err != nil {
+		return fmt.Errorf("cannot return hold: %v", err)
+	}
+
+	trade.Status = tradeRejected
+
+	err = putTrade(ctx, trade)
+	if err != nil {
+		return err
+	}
+
+	return recordReceipt(ctx, tradePrefix, tradeID, fmt.Sprintf("trade %s rejected by %s", tradeID, clientID))
+}
+
+// GetTrade returns a bilateral trade
+func (s *SmartContract) GetTrade(ctx contractapi.TransactionContextInterface, tradeID string) (*Trade, error) {
+	return getTrade(ctx, tradeID)
+}
+
+// getTrade is an internal helper that reads a bilateral trade
+func getTrade(ctx contractapi.TransactionContextInterface, tradeID string) (*Trade, error) {
+
+	tradeKey, err := ctx.GetStub().CreateCompositeKey(tradePrefix, []string{tradeID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", tradePrefix, err)
+	}
+
+	tradeBytes, err := ctx.GetStub().GetState(tradeKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trade from world state: %v", err)
+	}
+	if tradeBytes == nil {
+		return nil, fmt.Errorf("no trade %v exists", tradeID)
+	}
+
+	var trade Trade
+	err = json.Unmarshal(tradeBytes, &trade)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trade object JSON: %v", err)
+	}
+
+	return &trade, nil
+}
+
+// putTrade is an internal helper that writes a bilateral trade
+func putTrade(ctx contractapi.TransactionContextInterface, trade *Trade) error {
+
+	tradeKey, err := ctx.GetStub().CreateCompositeKey(tradePrefix, []string{trade.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", tradePrefix, err)
+	}
+
+	tradeBytes, err := marshalCanonical(trade)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(tradeKey, tradeBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", tradeKey, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const bondPrefix = "bond"
+
+// Define key names for options
+const treasuryKey = "treasury"
+const slashingsKey = "Slashings"
+
+// Slashing records a bond that was forfeited because the bidder never revealed
+type Slashing struct {
+	AuctionID string `json:"auctionID"`
+	Bidder    string `json:"bidder"`
+	Amount    int    `json:"amount"`
+}
+
+// Slashings keeps all slashing records so they can be queried later
+type Slashings struct {
+	Records []Slashing `json:"records"`
+}
+
+// CommitBid stores the hash of a sealed bid on the auction and takes a bond
+// from the bidder's balance. The bond is returned when the bid is revealed and
+// slashed to the treasury if it never is
+func (s *SmartContract) CommitBid(ctx contractapi.TransactionContextInterface, auctionID string, hash string, bond int) error {
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	// get the MSP ID of the bidder's org
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+
+	if bond <= 0 {
+		return fmt.Errorf("bond amount must be a positive integer")
+	}
+
+	// get the auction from state
+	auctionBytes, err := ctx.GetStub().GetState(auctionID)
+	if err != nil {
+		return fmt.Errorf("couldn't get auction from global state")
+	}
+
+	if auctionBytes == nil {
+		return fmt.Errorf("Auction not found: %v", auctionID)
+	}
+
+	var auctionJSON Auction
+	err = json.Unmarshal(auctionBytes, &auctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to create auction object JSON: %v", err)
+	}
+
+	// the auction needs to be open for users to commit their bid
+	Status := auctionJSON.Status
+	if Status != "open" {
+		return fmt.Errorf("cannot join closed or ended auction")
+	}
+
+	balance, err := s.ClientAccountBalance(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot get balance")
+	}
+	if balance < bond {
+		return fmt.Errorf("balance is less than bond")
+	}
+
+	// use the bidder identity to create the composite bid key
+	bidKey, err := ctx.GetStub().CreateCompositeKey(bidKeyType, []string{auctionID, clientID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	NewHash := BidHash{
+		Org:    clientOrgID,
+		Hash:   hash,
+		Bidder: clientID,
+	}
+
+	bidders := auctionJSON.PrivateBids
+	bidders[bidKey] = NewHash
+	auctionJSON.PrivateBids = bidders
+
+	newAuctionBytes, _ := marshalCanonical(auctionJSON)
+
+	err = ctx.GetStub().PutState(auctionID, newAuctionBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update auction: %v", err)
+	}
+
+	// move the bond out of the bidder's balance
+	updatedBalance := balance - bond
+	err = putBalanceBytes(ctx, clientID, []byte(strconv.Itoa(updatedBalance)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", clientID, err)
+	}
+
+	bondKey, err := ctx.GetStub().CreateCompositeKey(bondPrefix, []string{auctionID, clientID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", bondPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(bondKey, []byte(strconv.Itoa(bond)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", bondKey, err)
+	}
+
+	return nil
+}
+
+// ReturnBond gives the bond back to a bidder that revealed their bid
+func (s *SmartContract) ReturnBond(ctx contractapi.TransactionContextInterface, auctionID string) error {
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	// get the auction from state
+	auctionBytes, err := ctx.GetStub().GetState(auctionID)
+	if err != nil {
+		return fmt.Errorf("couldn't get auction from global state")
+	}
+
+	if auctionBytes == nil {
+		return fmt.Errorf("Auction not found: %v", auctionID)
+	}
+
+	var auctionJSON Auction
+	err = json.Unmarshal(auctionBytes, &auctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to create auction object JSON: %v", err)
+	}
+
+	// the bond is only returned once the bid was revealed
+	revealed := false
+	for _, bid := range auctionJSON.RevealedBids {
+		if bid.Bidder == clientID {
+			revealed = true
+		}
+	}
+	if !revealed {
+		return fmt.Errorf("bid has not been revealed, bond cannot be returned")
+	}
+
+	bondKey, err := ctx.GetStub().CreateCompositeKey(bondPrefix, []string{auctionID, clientID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", bondPrefix, err)
+	}
+
+	bondBytes, _ := ctx.GetStub().GetState(bondKey)
+	if bondBytes == nil {
+		return fmt.Errorf("there is no bond for auction %v", auctionID)
+	}
+	bond, _ := strconv.Atoi(string(bondBytes))
+
+	currentBalanceBytes, err := getBalanceBytes(ctx, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to read client's account %s from world state: %v", clientID, err)
+	}
+
+	// Check if bidder current balance exists
+	if currentBalanceBytes == nil {
+		return fmt.Errorf("the balance does not exist")
+	}
+
+	currentBalance, _ := strconv.Atoi(string(currentBalanceBytes))
+
+	updatedBalance := currentBalance + bond
+	err = putBalanceBytes(ctx, clientID, []byte(strconv.Itoa(updatedBalance)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", clientID, err)
+	}
+
+	err = ctx.GetStub().DelState(bondKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete bond: %v", err)
+	}
+
+	return nil
+}
+
+// SlashUnrevealedBids is used by the seller after the auction closed to move
+// the bonds of bidders that never revealed to the treasury. Every slashing is
+// recorded so it can be queried later
+func (s *SmartContract) SlashUnrevealedBids(ctx contractapi.TransactionContextInterface, auctionID string) error {
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	// get the auction from state
+	auctionBytes, err := ctx.GetStub().GetState(auctionID)
+	if err != nil {
+		return fmt.Errorf("couldn't get auction from global state")
+	}
+
+	if auctionBytes == nil {
+		return fmt.Errorf("Auction not found: %v", auctionID)
+	}
+
+	var auctionJSON Auction
+	err = json.Unmarshal(auctionBytes, &auctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to create auction object JSON: %v", err)
+	}
+
+	// bonds can only be slashed by the seller
+	if !isAuctionSeller(ctx, auctionJSON, auctionID, clientID) {
+		return fmt.Errorf("bonds can only be slashed by seller: %v", err)
+	}
+
+	// bids can still be revealed while the auction is open
+	Status := auctionJSON.Status
+	if Status == "open" {
+		return fmt.Errorf("cannot slash bonds of an open auction")
+	}
+
+	slashings, err := getSlashings(ctx)
+	if err != nil {
+		return err
+	}
+
+	for bidKey, privateBid := range auctionJSON.PrivateBids {
+
+		if _, bidInAuction := auctionJSON.RevealedBids[bidKey]; bidInAuction {
+			// bid was revealed, the bond is returned through ReturnBond
+			continue
+		}
+
+		bondKey, err := ctx.GetStub().CreateCompositeKey(bondPrefix, []string{auctionID, privateBid.Bidder})
+		if err != nil {
+			return fmt.Errorf("failed to create the composite key for prefix %s: %v", bondPrefix, err)
+		}
+
+		bondBytes, _ := ctx.GetStub().GetState(bondKey)
+		if bondBytes == nil {
+			// no bond was taken for this commitment
+			continue
+		}
+		bond, _ := strconv.Atoi(string(bondBytes))
+
+		// add the bond to the treasury
+		treasuryBytes, err := ctx.GetStub().GetState(treasuryKey)
+		if err != nil {
+			return fmt.Errorf("failed to read treasury from world state: %v", err)
+		}
+
+		var treasury int
+		if treasuryBytes == nil {
+			treasury = 0
+		} else {
+			treasury, _ = strconv.Atoi(string(treasuryBytes))
+		}
+
+		treasury += bond
+		err = ctx.GetStub().PutState(treasuryKey, []byte(strconv.Itoa(treasury)))
+		if err != nil {
+			return fmt.Errorf("failed to update state of smart contract for key %s: %v", treasuryKey, err)
+		}
+
+		err = ctx.GetStub().DelState(bondKey)
+		if err != nil {
+			return fmt.Errorf("failed to delete bond: %v", err)
+		}
+
+		slashings.Records = append(slashings.Records, Slashing{
+			AuctionID: auctionID,
+			Bidder:    privateBid.Bidder,
+			Amount:    bond,
+		})
+	}
+
+	slashingsBytes, err := marshalCanonical(slashings)
+	if err != nil {
+		return fmt.Errorf("failed to get bytes")
+	}
+
+	err = ctx.GetStub().PutState(slashingsKey, slashingsBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state %v", err)
+	}
+
+	return nil
+}
+
+// GetSlashings returns all slashing records
+func (s *SmartContract) GetSlashings(ctx contractapi.TransactionContextInterface) (*Slashings, error) {
+	slashings, err := getSlashings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return slashings, nil
+}
+
+// getSlashings is an internal helper that reads the slashing records from state
+func getSlashings(ctx contractapi.TransactionContextInterface) (*Slashings, error) {
+	slashingsBytes, err := ctx.GetStub().GetState(slashingsKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read slashings from world state: %v", err)
+	}
+
+	var slashings Slashings
+	if slashingsBytes != nil {
+		err = json.Unmarshal(slashingsBytes, &slashings)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create slashings object JSON: %v", err)
+		}
+	}
+
+	return &slashings, nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const importBatchPrefix = "importBatch"
+
+// ImportRecord is one historical record of a migration batch. Type selects
+// which fields apply: "balance" (account, amount), "meter" (meterID, account,
+// publicKey) or "reading" (asset, date, amount)
+type ImportRecord struct {
+	Type      string `json:"type"`
+	Account   string `json:"account"`
+	Amount    int    `json:"amount"`
+	MeterID   string `json:"meterID"`
+	PublicKey string `json:"publicKey"`
+	Asset     string `json:"asset"`
+	Date      string `json:"date"`
+}
+
+// ImportReport is the validation report and audit record of one import batch
+type ImportReport struct {
+	BatchID  string   `json:"batchID"`
+	Imported int      `json:"imported"`
+	Rejected int      `json:"rejected"`
+	Errors   []string `json:"errors"`
+}
+
+// BulkImport imports a batch of historical balances, meters and readings in
+// one transaction, for migrating existing community records. Batches are
+// idempotent per batch ID: re-submitting a processed batch returns the stored
+// report instead of importing twice. Only the regulator may import
+func (s *SmartContract) BulkImport(ctx contractapi.TransactionContextInterface, batchID string, recordsJSON string) (*ImportReport, error) {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return nil, err
+	}
+
+	batchKey, err := ctx.GetStub().CreateCompositeKey(importBatchPrefix, []string{batchID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", importBatchPrefix, err)
+	}
+
+	// an already processed batch is returned as-is so re-submits are harmless
+	reportBytes, err := ctx.GetStub().GetState(batchKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read import batch from world state: %v", err)
+	}
+	if reportBytes != nil {
+		var report ImportReport
+		err = json.Unmarshal(reportBytes, &report)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create import report object JSON: %v", err)
+		}
+		return &report, nil
+	}
+
+	var records []ImportRecord
+	err = json.Unmarshal([]byte(recordsJSON), &records)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create import records object JSON: %v", err)
+	}
+
+	report := ImportReport{
+		BatchID: batchID,
+		Errors:  []string{},
+	}
+
+	for i, record := range records {
+		err = importRecord(ctx, record)
+		if err != nil {
+			report.Rejected++
+			report.Errors = append(report.Errors, fmt.Sprintf("record %d: %v", i, err))
+			continue
+		}
+		report.Imported++
+	}
+
+	reportBytes, err = marshalCanonical(report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(batchKey, reportBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update state of smart contract for key %s: %v", batchKey, err)
+	}
+
+	return &report, nil
+}
+
+// GetImportReport returns the audit report of a processed import batch
+func (s *SmartContract) GetImportReport(ctx contractapi.TransactionContextInterface, batchID string) (*ImportReport, error) {
+
+	batchKey, err := ctx.GetStub().CreateCompositeKey(importBatchPrefix, []string{batchID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", importBatchPrefix, err)
+	}
+
+	reportBytes, err := ctx.GetStub().GetState(batchKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read import batch from world state: %v", err)
+	}
+	if reportBytes == nil {
+		return nil, fmt.Errorf("import batch %v has not been processed", batchID)
+	}
+
+	var report ImportReport
+	err = json.Unmarshal(reportBytes, &report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create import report object JSON: %v", err)
+	}
+
+	return &report, nil
+}
+
+// importRecord is an internal helper that validates and applies one record
+func importRecord(ctx contractapi.TransactionContextInterface, record ImportRecord) error {
+
+	switch record.Type {
+	case "balance":
+		if record.Account == "" {
+			return fmt.Errorf("balance record needs an account")
+		}
+		if record.Amount < 0 {
+			return fmt.Errorf("balance cannot be negative")
+		}
+
+		balanceBytes, err := getBalanceBytes(ctx, record.Account)
+		if err != nil {
+			return fmt.Errorf("failed to read account %s from world state: %v", record.Account, err)
+		}
+		if balanceBytes != nil {
+			return fmt.Errorf("account %s already exists", record.Account)
+		}
+
+		err = putBalanceBytes(ctx, record.Account, []byte(strconv.Itoa(record.Amount)))
+		if err != nil {
+			return err
+		}
+
+		// an imported balance is new supply, so the total supply grows by
+		// the same amount to keep the supply invariant intact
+		totalSupplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve total token supply: %v", err)
+		}
+
+		totalSupply, err := parseBalance(totalSupplyBytes)
+		if err != nil {
+			return err
+		}
+
+		return ctx.GetStub().PutState(totalSupplyKey, formatBalance(addBalance(totalSupply, record.Amount)))
+
+	case "meter":
+		if record.MeterID == "" {
+			return fmt.Errorf("meter record needs a meterID")
+		}
+
+		_, err := parseMeterPublicKey(record.PublicKey)
+		if err != nil {
+			return err
+		}
+
+		meter := Meter{
+			ID:        record.MeterID,
+			Owner:     record.Account,
+			PublicKey: record.PublicKey,
+		}
+
+		meterBytes, err := marshalCanonical(meter)
+		if err != nil {
+			return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+		}
+
+		meterKey, err := ctx.GetStub().CreateCompositeKey(meterPrefix, []string{record.MeterID})
+		if err != nil {
+			return fmt.Errorf("failed to create the composite key for prefix %s: %v", meterPrefix, err)
+		}
+
+		return ctx.GetStub().PutState(meterKey, meterBytes)
+
+	case "reading":
+		if record.Asset == "" {
+			return fmt.Errorf("reading record needs an asset")
+		}
+		if record.Amount < 0 {
+			return fmt.Errorf("reading cannot be negative")
+		}
+
+		_, err := time.Parse("2006-01-02", record.Date)
+		if err != nil {
+			return fmt.Errorf("failed to parse reading date: %v", err)
+		}
+
+		readingKey, err := ctx.GetStub().CreateCompositeKey(readingPrefix, []string{record.Asset, record.Date})
+		if err != nil {
+			return fmt.Errorf("failed to create the composite key for prefix %s: %v", readingPrefix, err)
+		}
+
+		return ctx.GetStub().PutState(readingKey, []byte(strconv.Itoa(record.Amount)))
+
+	default:
+		return fmt.Errorf("unknown record type %v", record.Type)
+	}
+}
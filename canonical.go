@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// marshalCanonical serializes an object into canonical JSON: object keys are
+// sorted, numbers keep their original formatting and no HTML escaping is
+// applied. Objects that carry maps (such as Auction) and anything that gets
+// hashed or compared byte-for-byte should be stored through this helper so
+// the encoding stays stable across Go versions
+func marshalCanonical(v interface{}) ([]byte, error) {
+
+	rawBytes, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(rawBytes))
+	decoder.UseNumber()
+
+	var decoded interface{}
+	err = decoder.Decode(&decoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = writeCanonical(&buf, decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeCanonical is an internal helper that writes one decoded JSON value in
+// canonical form
+func writeCanonical(buf *bytes.Buffer, v interface{}) error {
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			keyBytes, err := json.Marshal(key)
+			if err != nil {
+				return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+			}
+			buf.Write(keyBytes)
+			buf.WriteByte(':')
+			err = writeCanonical(buf, value[key])
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, element := range value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			err := writeCanonical(buf, element)
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+
+	case json.Number:
+		buf.WriteString(value.String())
+		return nil
+
+	default:
+		encoder := json.NewEncoder(buf)
+		encoder.SetEscapeHTML(false)
+		err := encoder.Encode(value)
+		if err != nil {
+			return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+		}
+		// Encode appends a newline that has no place inside a document
+		buf.Truncate(buf.Len() - 1)
+		return nil
+	}
+}
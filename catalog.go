@@ -0,0 +1,63 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// schema version of the event payloads and error families listed in the
+// catalog; bump it whenever a payload shape or error wording changes
+const catalogSchemaVersion = "1"
+
+// CatalogEntry describes one event type or error family the deployed
+// contract version can produce
+type CatalogEntry struct {
+	Name          string `json:"name"`
+	SchemaVersion string `json:"schemaVersion"`
+	Description   string `json:"description"`
+}
+
+// Catalog is the machine-readable list of every event and error family of
+// this contract version, so client teams and the REST gateway can validate
+// their handling programmatically instead of scraping the source
+type Catalog struct {
+	SchemaVersion string         `json:"schemaVersion"`
+	Events        []CatalogEntry `json:"events"`
+	Errors        []CatalogEntry `json:"errors"`
+}
+
+// GetCatalog returns the consolidated error-and-event catalog of the
+// deployed contract version. The catalog is maintained by hand next to the
+// code that emits each entry; a missing entry here is a bug
+func (s *SmartContract) GetCatalog(ctx contractapi.TransactionContextInterface) (*Catalog, error) {
+
+	catalog := Catalog{
+		SchemaVersion: catalogSchemaVersion,
+		Events: []CatalogEntry{
+			{Name: "Mint", SchemaVersion: catalogSchemaVersion, Description: "tokens were minted to the minter's account"},
+			{Name: "Burn", SchemaVersion: catalogSchemaVersion, Description: "tokens were burned from the burner's account"},
+			{Name: "Transfer", SchemaVersion: catalogSchemaVersion, Description: "tokens moved between two accounts"},
+			{Name: "Approval", SchemaVersion: catalogSchemaVersion, Description: "an owner granted a spender a withdrawal allowance"},
+			{Name: "AuctionCreated", SchemaVersion: catalogSchemaVersion, Description: "a new auction was opened by a seller"},
+			{Name: "BidSubmitted", SchemaVersion: catalogSchemaVersion, Description: "a bid was added to an open auction"},
+			{Name: "AuctionEnded", SchemaVersion: catalogSchemaVersion, Description: "an auction closed with a winner and clearing price"},
+			{Name: "HoldCreated", SchemaVersion: catalogSchemaVersion, Description: "funds moved from a balance onto a hold"},
+			{Name: "HoldReleased", SchemaVersion: catalogSchemaVersion, Description: "a losing bidder's hold was returned after an auction ended"},
+			{Name: "Settlement", SchemaVersion: catalogSchemaVersion, Description: "an ended auction settled the held funds at the clearing price"},
+			{Name: "Notice", SchemaVersion: catalogSchemaVersion, Description: "a registered account was notified of a balance, hold or obligation condition"},
+			{Name: "Alert", SchemaVersion: catalogSchemaVersion, Description: "a rate-of-change monitor tripped on a supply or price write path"},
+			{Name: "Intervention", SchemaVersion: catalogSchemaVersion, Description: "an approved regulator intervention was executed"},
+			{Name: "Deprecated", SchemaVersion: catalogSchemaVersion, Description: "a deprecated function name was called and forwarded to its replacement"},
+		},
+		Errors: []CatalogEntry{
+			{Name: "not-initialized", SchemaVersion: catalogSchemaVersion, Description: "contract options need to be set before calling any function"},
+			{Name: "unauthorized", SchemaVersion: catalogSchemaVersion, Description: "the client lacks the role or org membership the function requires"},
+			{Name: "not-found", SchemaVersion: catalogSchemaVersion, Description: "the referenced account, auction, order, hold or record does not exist"},
+			{Name: "insufficient-funds", SchemaVersion: catalogSchemaVersion, Description: "the balance, hold or allowance does not cover the requested amount"},
+			{Name: "invalid-amount", SchemaVersion: catalogSchemaVersion, Description: "an amount, price or size argument must be a positive integer"},
+			{Name: "wrong-state", SchemaVersion: catalogSchemaVersion, Description: "the record is not in the state the transition requires"},
+			{Name: "window-closed", SchemaVersion: catalogSchemaVersion, Description: "a deadline, dispute window or appeal window has passed"},
+		},
+	}
+
+	return &catalog, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const certificatePrefix = "certificate"
+const certIssuedPrefix = "certIssued"
+
+// Certificate is a non-fungible, non-transferable participation record of a
+// completed green-energy purchase. There is deliberately no transfer
+// function: the certificate proves that this buyer consumed this energy, so
+// it stays bound to the buyer forever. Anyone can verify it by its ID
+type Certificate struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	AuctionID string    `json:"auctionID"`
+	KWh       int       `json:"kWh"`
+	Period    string    `json:"period"`
+	EnergyMix string    `json:"energyMix"`
+	IssuedAt  time.Time `json:"issuedAt"`
+}
+
+// IssueCertificate issues a participation certificate for a completed
+// purchase. The escrow of the auction must have been released, which proves
+// delivery was confirmed; the buyer on the escrow becomes the owner. Only the
+// regulator may issue, and at most one certificate is issued per auction.
+// The transaction ID becomes the certificate ID
+func (s *SmartContract) IssueCertificate(ctx contractapi.TransactionContextInterface, auctionID string, kWh int, period string, energyMix string) (string, error) {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return "", err
+	}
+
+	if kWh <= 0 {
+		return "", fmt.Errorf("certificate kWh must be a positive integer")
+	}
+
+	escrow, err := getEscrow(ctx, auctionID)
+	if err != nil {
+		return "", err
+	}
+	if escrow.Status != escrowReleased {
+		return "", fmt.Errorf("the purchase for auction %v has not completed", auctionID)
+	}
+
+	// at most one certificate per auction
+	issuedKey, err := ctx.GetStub().CreateCompositeKey(certIssuedPrefix, []string{auctionID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create the composite key for prefix %s: %v", certIssuedPrefix, err)
+	}
+
+	issuedBytes, err := ctx.GetStub().GetState(issuedKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read certificate marker from world state: %v", err)
+	}
+	if issuedBytes != nil {
+		return "", fmt.Errorf("a certificate was already issued for auction %v", auctionID)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("failed to get timestamp")
+	}
+
+	certificate := Certificate{
+		ID:        ctx.GetStub().GetTxID(),
+		Owner:     escrow.Buyer,
+		AuctionID: auctionID,
+		KWh:       kWh,
+		Period:    period,
+		EnergyMix: energyMix,
+		IssuedAt:  time.Unix(timestamp.Seconds, int64(timestamp.Nanos)),
+	}
+
+	certificateKey, err := ctx.GetStub().CreateCompositeKey(certificatePrefix, []string{certificate.ID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create the composite key for prefix %s: %v", certificatePrefix, err)
+	}
+
+	certificateBytes, err := marshalCanonical(certificate)
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(certificateKey, certificateBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to update state of smart contract for key %s: %v", certificateKey, err)
+	}
+
+	err = ctx.GetStub().PutState(issuedKey, []byte(certificate.ID))
+	if err != nil {
+		return "", fmt.Errorf("failed to update state of smart contract for key %s: %v", issuedKey, err)
+	}
+
+	return certificate.ID, nil
+}
+
+// VerifyCertificate is the public verification query: given a certificate ID
+// it returns the full participation record, or an error if no such
+// certificate was ever issued
+func (s *SmartContract) VerifyCertificate(ctx contractapi.TransactionContextInterface, certificateID string) (*Certificate, error) {
+
+	certificateKey, err := ctx.GetStub().CreateCompositeKey(certificatePrefix, []string{certificateID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", certificatePrefix, err)
+	}
+
+	certificateBytes, err := ctx.GetStub().GetState(certificateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate from world state: %v", err)
+	}
+	if certificateBytes == nil {
+		return nil, fmt.Errorf("certificate %v does not exist", certificateID)
+	}
+
+	var certificate Certificate
+	err = json.Unmarshal(certificateBytes, &certificate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate object JSON: %v", err)
+	}
+
+	return &certificate, nil
+}
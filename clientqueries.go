@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const allowanceBySpenderPrefix = "allowanceBySpender"
+
+// AllowanceView is one (spender, remaining allowance) pair of an owner,
+// returned by the owner-side allowance enumeration
+type AllowanceView struct {
+	Spender string `json:"spender"`
+	Value   int    `json:"value"`
+}
+
+// ApprovalView is one (owner, remaining allowance) pair of a spender,
+// returned by the spender-side allowance enumeration
+type ApprovalView struct {
+	Owner string `json:"owner"`
+	Value int    `json:"value"`
+}
+
+// GetClientHolds returns every hold record of the calling client, so a
+// client can see what is held without knowing the hold IDs in advance
+func (s *SmartContract) GetClientHolds(ctx contractapi.TransactionContextInterface) ([]Hold, error) {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(holdRecordPrefix, []string{clientID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read holds from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	holds := []Hold{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read holds from world state: %v", err)
+		}
+
+		var hold Hold
+		err = json.Unmarshal(queryResponse.Value, &hold)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create hold object JSON: %v", err)
+		}
+
+		holds = append(holds, hold)
+	}
+
+	return holds, nil
+}
+
+// GetClientAllowances returns every spender the calling client has approved
+// together with the remaining allowance, so owners can review their open
+// approvals without knowing the counterparties in advance
+func (s *SmartContract) GetClientAllowances(ctx contractapi.TransactionContextInterface) ([]AllowanceView, error) {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(allowancePrefix, []string{clientID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read allowances from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	allowances := []AllowanceView{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read allowances from world state: %v", err)
+		}
+
+		// the second attribute of the allowance key is the spender
+		_, attrs, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil || len(attrs) != 2 {
+			continue
+		}
+
+		value, _ := strconv.Atoi(string(queryResponse.Value))
+
+		allowances = append(allowances, AllowanceView{
+			Spender: attrs[1],
+			Value:   value,
+		})
+	}
+
+	return allowances, nil
+}
+
+// GetApprovalsForSpender returns every owner that has approved the calling
+// client as a spender together with the remaining allowance. The allowance
+// composite key leads with the owner, so the spender side reads a secondary
+// index keyed spender first
+func (s *SmartContract) GetApprovalsForSpender(ctx contractapi.TransactionContextInterface) ([]ApprovalView, error) {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(allowanceBySpenderPrefix, []string{clientID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read allowances from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	approvals := []ApprovalView{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read allowances from world state: %v", err)
+		}
+
+		// the second attribute of the index key is the owner
+		_, attrs, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil || len(attrs) != 2 {
+			continue
+		}
+
+		value, _ := strconv.Atoi(string(queryResponse.Value))
+
+		approvals = append(approvals, ApprovalView{
+			Owner: attrs[1],
+			Value: value,
+		})
+	}
+
+	return approvals, nil
+}
+
+// putAllowanceIndex is an internal helper that mirrors an allowance write
+// into the spender-keyed secondary index, so every update of an allowance
+// keeps both key orders in sync
+func putAllowanceIndex(ctx contractapi.TransactionContextInterface, owner string, spender string, value int) error {
+
+	indexKey, err := ctx.GetStub().CreateCompositeKey(allowanceBySpenderPrefix, []string{spender, owner})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", allowanceBySpenderPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(indexKey, []byte(strconv.Itoa(value)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", indexKey, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const closedAccountPrefix = "closedAccount"
+
+// CloseAccount off-boards the calling client: any remaining active balance
+// is swept to the designated account and the account is marked closed, which
+// blocks further transfers in and out. Closing is refused while funds are on
+// hold, since a hold means an open bid or pending settlement
+func (s *SmartContract) CloseAccount(ctx contractapi.TransactionContextInterface, sweepTo string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if sweepTo == clientID {
+		return fmt.Errorf("the sweep account cannot be the account being closed")
+	}
+
+	err = checkAccountOpen(ctx, clientID)
+	if err != nil {
+		return err
+	}
+
+	err = checkAccountOpen(ctx, sweepTo)
+	if err != nil {
+		return err
+	}
+
+	// funds on hold mean an open bid or a settlement still in flight
+	holdkey, err := ctx.GetStub().CreateCompositeKey(holdPrefix, []string{clientID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", holdPrefix, err)
+	}
+
+	holdBytes, err := ctx.GetStub().GetState(holdkey)
+	if err != nil {
+		return fmt.Errorf("failed to read hold from world state: %v", err)
+	}
+	if holdBytes != nil {
+		hold_amount, _ := strconv.Atoi(string(holdBytes))
+		if hold_amount > 0 {
+			return fmt.Errorf("cannot close the account while funds are on hold")
+		}
+	}
+
+	balanceBytes, err := getBalanceBytes(ctx, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to read account %s from world state: %v", clientID, err)
+	}
+	if balanceBytes == nil {
+		return fmt.Errorf("the account %s does not exist", clientID)
+	}
+
+	balance, err := parseBalance(balanceBytes)
+	if err != nil {
+		return err
+	}
+
+	if int(balance.Int64()) > 0 {
+		_, err = transferHelper(ctx, clientID, sweepTo, int(balance.Int64()))
+		if err != nil {
+			return fmt.Errorf("failed to sweep the remaining balance: %v", err)
+		}
+	}
+
+	closedKey, err := ctx.GetStub().CreateCompositeKey(closedAccountPrefix, []string{clientID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", closedAccountPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(closedKey, []byte("true"))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", closedKey, err)
+	}
+
+	return recordReceipt(ctx, closedAccountPrefix, clientID, fmt.Sprintf("account %s closed, balance swept to %s", clientID, sweepTo))
+}
+
+// IsAccountClosed returns whether an account has been closed
+func (s *SmartContract) IsAccountClosed(ctx contractapi.TransactionContextInterface, account string) (bool, error) {
+
+	closedKey, err := ctx.GetStub().CreateCompositeKey(closedAccountPrefix, []string{account})
+	if err != nil {
+		return false, fmt.Errorf("failed to create the composite key for prefix %s: %v", closedAccountPrefix, err)
+	}
+
+	closedBytes, err := ctx.GetStub().GetState(closedKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read closed state from world state: %v", err)
+	}
+
+	return closedBytes != nil, nil
+}
+
+// checkAccountOpen is an internal helper that rejects operations on a closed
+// account
+func checkAccountOpen(ctx contractapi.TransactionContextInterface, account string) error {
+
+	closedKey, err := ctx.GetStub().CreateCompositeKey(closedAccountPrefix, []string{account})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", closedAccountPrefix, err)
+	}
+
+	closedBytes, err := ctx.GetStub().GetState(closedKey)
+	if err != nil {
+		return fmt.Errorf("failed to read closed state from world state: %v", err)
+	}
+	if closedBytes != nil {
+		return fmt.Errorf("the account %s is closed", account)
+	}
+
+	return nil
+}
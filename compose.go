@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Composed convenience transactions. The gateway used to drive these flows
+// as separate invokes, which left users in intermediate states (a dangling
+// allowance, a hold without a bid) whenever the client crashed in between.
+// Bundling the steps into one invoke makes each flow atomic: either every
+// step commits or none does
+
+// ApproveAndTransferFrom approves the spender and executes the approved
+// transfer to the recipient in the same transaction. The allowance never
+// dangles: it is consumed immediately, so a crashed client cannot leave an
+// open approval behind. The operator uses this to pull a payment the owner
+// signed off on in one step
+func (s *SmartContract) ApproveAndTransferFrom(ctx contractapi.TransactionContextInterface, spender string, to string, value int) error {
+
+	owner, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	// record the approval so the allowance events and audit trail line up
+	err = s.Approve(ctx, spender, value)
+	if err != nil {
+		return err
+	}
+
+	_, err = transferHelper(ctx, owner, to, value)
+	if err != nil {
+		return fmt.Errorf("failed to transfer: %v", err)
+	}
+
+	// the approved amount is spent; close the allowance back down to zero
+	err = s.Approve(ctx, spender, 0)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// BidWithTopUpOrder submits a bid when the balance covers it; otherwise it
+// places a mint order for the shortfall in the same transaction so the
+// account is already queued for a top-up. The returned string reports which
+// of the two happened
+func (s *SmartContract) BidWithTopUpOrder(ctx contractapi.TransactionContextInterface, auctionID string, amount int) (string, error) {
+
+	balance, err := s.ClientAccountBalance(ctx)
+	if err != nil {
+		return "", fmt.Errorf("cannot get balance")
+	}
+
+	if balance >= amount {
+		err = s.SubmitBid(ctx, auctionID, amount, 0)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("bid of %d submitted on auction %s", amount, auctionID), nil
+	}
+
+	shortfall := amount - balance
+	orderID, err := s.OrderMint(ctx, shortfall)
+	if err != nil {
+		return "", fmt.Errorf("balance is less than amount and the top-up order failed: %v", err)
+	}
+
+	return fmt.Sprintf("balance is short by %d, mint order %s placed; bid again once approved", shortfall, orderID), nil
+}
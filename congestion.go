@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const congestionPrefix = "congestion"
+
+// Define key names for options
+const congestionRulesKey = "CongestionRules"
+
+// CongestionForecast is the congestion the DSO expects on a feeder during a
+// market window, expressed as a percentage of the feeder capacity
+type CongestionForecast struct {
+	Feeder  string `json:"feeder"`
+	Window  string `json:"window"`
+	Percent int    `json:"percent"`
+}
+
+// CongestionRules maps congestion thresholds to price signals in basis
+// points: trades in windows above a threshold carry the premium (positive) or
+// discount (negative) so trading shifts away from constrained hours
+type CongestionRules struct {
+	Thresholds []CongestionThreshold `json:"thresholds"`
+}
+
+// CongestionThreshold is one governed rule: at or above Percent congestion
+// the market signal is SignalBp basis points
+type CongestionThreshold struct {
+	Percent  int `json:"percent"`
+	SignalBp int `json:"signalBp"`
+}
+
+// PublishCongestionForecast publishes the forecast congestion of a feeder for
+// a market window. Only the regulator may publish forecasts
+func (s *SmartContract) PublishCongestionForecast(ctx contractapi.TransactionContextInterface, feeder string, window string, percent int) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if percent < 0 {
+		return fmt.Errorf("congestion percent cannot be negative")
+	}
+
+	// the feeder must exist in the topology
+	_, err = getTopologyNode(ctx, feeder)
+	if err != nil {
+		return err
+	}
+
+	forecast := CongestionForecast{
+		Feeder:  feeder,
+		Window:  window,
+		Percent: percent,
+	}
+
+	forecastBytes, err := marshalCanonical(forecast)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	forecastKey, err := ctx.GetStub().CreateCompositeKey(congestionPrefix, []string{feeder, window})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", congestionPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(forecastKey, forecastBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", forecastKey, err)
+	}
+
+	return nil
+}
+
+// SetCongestionRules configures the governed mapping from congestion levels
+// to market signals. The rules are passed as a JSON array of objects with
+// percent and signalBp fields, ordered by percent ascending
+func (s *SmartContract) SetCongestionRules(ctx contractapi.TransactionContextInterface, rulesJSON string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	var rules CongestionRules
+	err = json.Unmarshal([]byte(rulesJSON), &rules.Thresholds)
+	if err != nil {
+		return fmt.Errorf("failed to create congestion rules object JSON: %v", err)
+	}
+
+	rulesBytes, err := marshalCanonical(rules)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(congestionRulesKey, rulesBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state %v", err)
+	}
+
+	return nil
+}
+
+// GetCongestionForecast returns the published forecast of a feeder and window
+func (s *SmartContract) GetCongestionForecast(ctx contractapi.TransactionContextInterface, feeder string, window string) (*CongestionForecast, error) {
+
+	forecastKey, err := ctx.GetStub().CreateCompositeKey(congestionPrefix, []string{feeder, window})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", congestionPrefix, err)
+	}
+
+	forecastBytes, err := ctx.GetStub().GetState(forecastKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read congestion forecast from world state: %v", err)
+	}
+	if forecastBytes == nil {
+		return nil, fmt.Errorf("no congestion forecast is published for feeder %v and window %v", feeder, window)
+	}
+
+	var forecast CongestionForecast
+	err = json.Unmarshal(forecastBytes, &forecast)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create congestion forecast object JSON: %v", err)
+	}
+
+	return &forecast, nil
+}
+
+// GetMarketSignal resolves the price signal (in basis points) that applies to
+// trades on a feeder during a window, from the published congestion forecast
+// and the governed rules. It returns 0 when no forecast or rule applies
+func (s *SmartContract) GetMarketSignal(ctx contractapi.TransactionContextInterface, feeder string, window string) (int, error) {
+
+	forecast, err := s.GetCongestionForecast(ctx, feeder, window)
+	if err != nil {
+		return 0, nil
+	}
+
+	rulesBytes, err := ctx.GetStub().GetState(congestionRulesKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read CongestionRules from world state: %v", err)
+	}
+	if rulesBytes == nil {
+		return 0, nil
+	}
+
+	var rules CongestionRules
+	err = json.Unmarshal(rulesBytes, &rules)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create congestion rules object JSON: %v", err)
+	}
+
+	signal := 0
+	for _, threshold := range rules.Thresholds {
+		if forecast.Percent >= threshold.Percent {
+			signal = threshold.SignalBp
+		}
+	}
+
+	return signal, nil
+}
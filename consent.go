@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const consentPrefix = "consent"
+
+// Consent records that a household granted a specific party access to its
+// reading-derived queries for a period and purpose
+type Consent struct {
+	Owner      string    `json:"owner"`
+	Party      string    `json:"party"`
+	Purpose    string    `json:"purpose"`
+	Granted    time.Time `json:"granted"`
+	ValidUntil time.Time `json:"validUntil"`
+}
+
+// GrantConsent lets the submitting client grant a party access to its data
+// for the given purpose and duration in minutes
+func (s *SmartContract) GrantConsent(ctx contractapi.TransactionContextInterface, party string, purpose string, duration_min int) error {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if party == "" {
+		return fmt.Errorf("party cannot be empty")
+	}
+
+	if duration_min <= 0 {
+		return fmt.Errorf("consent duration must be a positive integer")
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	granted := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	consent := Consent{
+		Owner:      clientID,
+		Party:      party,
+		Purpose:    purpose,
+		Granted:    granted,
+		ValidUntil: granted.Add(time.Duration(duration_min) * time.Minute),
+	}
+
+	consentBytes, err := marshalCanonical(consent)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	consentKey, err := ctx.GetStub().CreateCompositeKey(consentPrefix, []string{clientID, party, purpose})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", consentPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(consentKey, consentBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", consentKey, err)
+	}
+
+	return nil
+}
+
+// RevokeConsent withdraws a consent immediately. Only the owner can revoke it
+func (s *SmartContract) RevokeConsent(ctx contractapi.TransactionContextInterface, party string, purpose string) error {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	consentKey, err := ctx.GetStub().CreateCompositeKey(consentPrefix, []string{clientID, party, purpose})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", consentPrefix, err)
+	}
+
+	consentBytes, err := ctx.GetStub().GetState(consentKey)
+	if err != nil {
+		return fmt.Errorf("failed to read consent from world state: %v", err)
+	}
+	if consentBytes == nil {
+		return fmt.Errorf("consent for party %v does not exist", party)
+	}
+
+	err = ctx.GetStub().DelState(consentKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete consent: %v", err)
+	}
+
+	return nil
+}
+
+// QueryConsent lets the owner or the granted party read a consent record
+func (s *SmartContract) QueryConsent(ctx contractapi.TransactionContextInterface, owner string, party string, purpose string) (*Consent, error) {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if clientID != owner && clientID != party {
+		return nil, fmt.Errorf("Permission denied, client id %v is not part of the consent", clientID)
+	}
+
+	consentKey, err := ctx.GetStub().CreateCompositeKey(consentPrefix, []string{owner, party, purpose})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", consentPrefix, err)
+	}
+
+	consentBytes, err := ctx.GetStub().GetState(consentKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read consent from world state: %v", err)
+	}
+	if consentBytes == nil {
+		return nil, fmt.Errorf("consent does not exist")
+	}
+
+	var consent Consent
+	err = json.Unmarshal(consentBytes, &consent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consent object JSON: %v", err)
+	}
+
+	return &consent, nil
+}
+
+// hasConsent is an internal helper used by data queries to check that the
+// owner granted the calling party access for the given purpose. Revoked
+// consents are deleted from state so they fail this check immediately
+func hasConsent(ctx contractapi.TransactionContextInterface, owner string, party string, purpose string) (bool, error) {
+
+	consentKey, err := ctx.GetStub().CreateCompositeKey(consentPrefix, []string{owner, party, purpose})
+	if err != nil {
+		return false, fmt.Errorf("failed to create the composite key for prefix %s: %v", consentPrefix, err)
+	}
+
+	consentBytes, err := ctx.GetStub().GetState(consentKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read consent from world state: %v", err)
+	}
+	if consentBytes == nil {
+		return false, nil
+	}
+
+	var consent Consent
+	err = json.Unmarshal(consentBytes, &consent)
+	if err != nil {
+		return false, fmt.Errorf("failed to create consent object JSON: %v", err)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return false, fmt.Errorf("failed to get timestamp")
+	}
+
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+	if now.After(consent.ValidUntil) {
+		return false, nil
+	}
+
+	return true, nil
+}
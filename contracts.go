@@ -0,0 +1,128 @@
+package main
+
+// Named sub-contracts over the one SmartContract. Each embeds the full
+// contract, so behaviour and state keys stay identical, but registers under
+// its own namespace ("Token:Transfer", "Auction:SubmitBid", "Gov:ApproveMint")
+// and tags its query functions as evaluate-only, so peers answer them without
+// ordering a transaction. The unnamed SmartContract stays the default
+// contract, keeping every existing unqualified invocation working
+
+// TokenContract is the token surface: balances, transfers, allowances, holds
+// and the mint/burn order lifecycle
+type TokenContract struct {
+	SmartContract
+}
+
+// NewTokenContract creates the token sub-contract under the Token namespace
+func NewTokenContract() *TokenContract {
+	contract := &TokenContract{}
+	contract.Contract.Name = "Token"
+	contract.BeforeTransaction = beforeTransaction
+	contract.TransactionContextHandler = &TransactionContext{}
+	return contract
+}
+
+// GetEvaluateTransactions names the token functions that only read state
+func (tc *TokenContract) GetEvaluateTransactions() []string {
+	return []string{
+		"Name",
+		"Symbol",
+		"Decimals",
+		"TotalSupply",
+		"TotalSupplyOf",
+		"BalanceOf",
+		"BalanceOfClass",
+		"ClientAccountBalance",
+		"ClientAccountID",
+		"Allowance",
+		"GetAccount",
+		"GetAccountHistory",
+		"GetAccountLimits",
+		"GetHold",
+		"GetClientHolds",
+		"GetClientAllowances",
+		"GetApprovalsForSpender",
+		"GetMintOrder",
+		"GetBurnOrder",
+		"GetOrderHistory",
+		"GetPendingTransfer",
+		"IsAccountClosed",
+		"ListAccounts",
+	}
+}
+
+// AuctionContract is the market surface: auctions, bids, settlement, escrow
+// and delivery
+type AuctionContract struct {
+	SmartContract
+}
+
+// NewAuctionContract creates the auction sub-contract under the Auction
+// namespace
+func NewAuctionContract() *AuctionContract {
+	contract := &AuctionContract{}
+	contract.Contract.Name = "Auction"
+	contract.BeforeTransaction = beforeTransaction
+	contract.TransactionContextHandler = &TransactionContext{}
+	return contract
+}
+
+// GetEvaluateTransactions names the auction functions that only read state
+func (ac *AuctionContract) GetEvaluateTransactions() []string {
+	return []string{
+		"QueryAuction",
+		"QueryAuctions",
+		"QueryBid",
+		"EvaluateBid",
+		"GetAuctionBids",
+		"GetAuctionHeader",
+		"GetAuctionStats",
+		"GetArchivedAuction",
+		"QueryArchivedAuctions",
+		"GetAuctionHistory",
+		"GetEscrow",
+		"GetDelivery",
+		"GetDispute",
+		"GetTrade",
+		"GetStake",
+		"GetZone",
+		"ListZones",
+		"GetLatestPrice",
+		"GetPriceFeedHistory",
+		"GetPriceIndex",
+	}
+}
+
+// GovernanceContract is the oversight surface: roles, participant KYC, order
+// decisions, pausing and market configuration
+type GovernanceContract struct {
+	SmartContract
+}
+
+// NewGovernanceContract creates the governance sub-contract under the Gov
+// namespace
+func NewGovernanceContract() *GovernanceContract {
+	contract := &GovernanceContract{}
+	contract.Contract.Name = "Gov"
+	contract.BeforeTransaction = beforeTransaction
+	contract.TransactionContextHandler = &TransactionContext{}
+	return contract
+}
+
+// GetEvaluateTransactions names the governance functions that only read state
+func (gc *GovernanceContract) GetEvaluateTransactions() []string {
+	return []string{
+		"HasRole",
+		"GetParticipant",
+		"ListParticipants",
+		"GetMintOrders",
+		"GetBurnOrders",
+		"GetOrdersByState",
+		"GetCatalog",
+		"GetSlashings",
+		"GetTreasuryBalance",
+		"IsPaused",
+		"ListReceipts",
+		"ExplainTransaction",
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define key names for options
+const settlementChaincodeKey = "settlementChaincode"
+
+// SettlementTarget points settlement at a token contract deployed on another
+// chaincode or channel. When a target is configured, escrow payouts invoke
+// the remote Transfer instead of crediting the local balance, so the auction
+// module can run on a separate channel from the token
+type SettlementTarget struct {
+	Name    string `json:"name"`
+	Channel string `json:"channel"`
+}
+
+// SetSettlementChaincode configures the external token chaincode settlement
+// pays out against. An empty name reverts to local settlement. Only the
+// regulator changes the settlement target
+func (s *SmartContract) SetSettlementChaincode(ctx contractapi.TransactionContextInterface, name string, channel string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if name == "" {
+		err = ctx.GetStub().DelState(settlementChaincodeKey)
+		if err != nil {
+			return fmt.Errorf("failed to delete state of smart contract for key %s: %v", settlementChaincodeKey, err)
+		}
+		return nil
+	}
+
+	target := SettlementTarget{
+		Name:    name,
+		Channel: channel,
+	}
+
+	targetBytes, err := marshalCanonical(target)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(settlementChaincodeKey, targetBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", settlementChaincodeKey, err)
+	}
+
+	return nil
+}
+
+// GetSettlementChaincode returns the configured settlement target, or nil
+// when settlement is local
+func (s *SmartContract) GetSettlementChaincode(ctx contractapi.TransactionContextInterface) (*SettlementTarget, error) {
+	return getSettlementTarget(ctx)
+}
+
+// getSettlementTarget is an internal helper that reads the settlement
+// target; a nil target means settlement stays on this chaincode
+func getSettlementTarget(ctx contractapi.TransactionContextInterface) (*SettlementTarget, error) {
+
+	targetBytes, err := ctx.GetStub().GetState(settlementChaincodeKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read settlement target from world state: %v", err)
+	}
+	if targetBytes == nil {
+		return nil, nil
+	}
+
+	var target SettlementTarget
+	err = json.Unmarshal(targetBytes, &target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create settlement target object JSON: %v", err)
+	}
+
+	return &target, nil
+}
+
+// invokeSettlementChaincode is an internal adapter around InvokeChaincode
+// that calls one function of the configured settlement target. A call into
+// another channel only yields a read of that channel's state, so the remote
+// contract has to commit its own transaction; within the same channel the
+// write sets merge
+func invokeSettlementChaincode(ctx contractapi.TransactionContextInterface, target *SettlementTarget, function string, args ...string) error {
+
+	invokeArgs := make([][]byte, 0, len(args)+1)
+	invokeArgs = append(invokeArgs, []byte(function))
+	for _, arg := range args {
+		invokeArgs = append(invokeArgs, []byte(arg))
+	}
+
+	response := ctx.GetStub().InvokeChaincode(target.Name, invokeArgs, target.Channel)
+	if response.Status != shim.OK {
+		return fmt.Errorf("failed to invoke %s on chaincode %s: %s", function, target.Name, response.Message)
+	}
+
+	return nil
+}
+
+// settleRemotely is an internal helper that pays a settlement amount to a
+// recipient through the configured external token contract. It reports
+// whether a remote target was configured, so callers fall back to local
+// crediting when it is not
+func settleRemotely(ctx contractapi.TransactionContextInterface, recipient string, amount int) (bool, error) {
+
+	target, err := getSettlementTarget(ctx)
+	if err != nil {
+		return false, err
+	}
+	if target == nil {
+		return false, nil
+	}
+
+	err = invokeSettlementChaincode(ctx, target, "Transfer", recipient, strconv.Itoa(amount))
+	if err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
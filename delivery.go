@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const deliveryPrefix = "delivery"
+
+// Delivery states
+const deliveryScheduled = "Scheduled"
+const deliveryInProgress = "InProgress"
+const deliveryDelivered = "Delivered"
+const deliveryFailed = "Failed"
+
+// Delivery tracks whether the energy of a settled auction was actually
+// delivered. The record is scheduled when the auction settles, the seller
+// starts the delivery, and confirmation or failure closes it; a failure
+// refunds the escrow to the buyer
+type Delivery struct {
+	AuctionID   string    `json:"auctionID"`
+	Seller      string    `json:"seller"`
+	Buyer       string    `json:"buyer"`
+	ScheduledAt time.Time `json:"scheduledAt"`
+	StartedAt   time.Time `json:"startedAt"`
+	CompletedAt time.Time `json:"completedAt"`
+	Reason      string    `json:"reason"`
+	Status      string    `json:"status"`
+}
+
+// StartDelivery marks a scheduled delivery as in progress. Only the seller
+// starts the delivery
+func (s *SmartContract) StartDelivery(ctx contractapi.TransactionContextInterface, auctionID string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	delivery, err := getDelivery(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+
+	if clientID != delivery.Seller {
+		return fmt.Errorf("only the seller can start the delivery")
+	}
+
+	if delivery.Status != deliveryScheduled {
+		return fmt.Errorf("delivery for auction %v is not scheduled", auctionID)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	delivery.StartedAt = time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+	delivery.Status = deliveryInProgress
+
+	return putDelivery(ctx, delivery)
+}
+
+// ReportDeliveryFailure records that the energy of a settled auction was not
+// delivered and refunds the escrow to the buyer. The buyer or the meter
+// oracle can report the failure
+func (s *SmartContract) ReportDeliveryFailure(ctx contractapi.TransactionContextInterface, auctionID string, reason string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	delivery, err := getDelivery(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+
+	if clientID != delivery.Buyer && requireRole(ctx, roleRegulator) != nil {
+		return fmt.Errorf("only the buyer or the meter oracle can report a delivery failure")
+	}
+
+	if delivery.Status != deliveryScheduled && delivery.Status != deliveryInProgress {
+		return fmt.Errorf("delivery for auction %v is already closed", auctionID)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	delivery.CompletedAt = time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+	delivery.Reason = reason
+	delivery.Status = deliveryFailed
+
+	err = putDelivery(ctx, delivery)
+	if err != nil {
+		return err
+	}
+
+	// a failed delivery sends the escrowed funds back to the buyer
+	escrow, err := getEscrow(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+	if escrow.Status != escrowHeld && escrow.Status != escrowDisputed {
+		return fmt.Errorf("escrow for auction %v was already paid out", auctionID)
+	}
+
+	return payOutEscrow(ctx, escrow, escrow.Buyer, escrowRefunded)
+}
+
+// GetDelivery returns the delivery record of a settled auction
+func (s *SmartContract) GetDelivery(ctx contractapi.TransactionContextInterface, auctionID string) (*Delivery, error) {
+	return getDelivery(ctx, auctionID)
+}
+
+// createDelivery is an internal helper that schedules the delivery record
+// when an auction settles into escrow
+func createDelivery(ctx contractapi.TransactionContextInterface, auctionID string, buyer string, seller string) error {
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	delivery := Delivery{
+		AuctionID:   auctionID,
+		Seller:      seller,
+		Buyer:       buyer,
+		ScheduledAt: time.Unix(timestamp.Seconds, int64(timestamp.Nanos)),
+		Status:      deliveryScheduled,
+	}
+
+	return putDelivery(ctx, &delivery)
+}
+
+// markDelivered is an internal helper that closes the delivery record when
+// the buyer confirms. Escrows that predate delivery tracking have no record
+// and are left alone
+func markDelivered(ctx contractapi.TransactionContextInterface, auctionID string) error {
+
+	delivery, err := getDelivery(ctx, auctionID)
+	if err != nil {
+		return nil
+	}
+
+	if delivery.Status == deliveryDelivered || delivery.Status == deliveryFailed {
+		return nil
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	delivery.CompletedAt = time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+	delivery.Status = deliveryDelivered
+
+	return putDelivery(ctx, delivery)
+}
+
+// getDelivery is an internal helper that reads a delivery record
+func getDelivery(ctx contractapi.TransactionContextInterface, auctionID string) (*Delivery, error) {
+
+	deliveryKey, err := ctx.GetStub().CreateCompositeKey(deliveryPrefix, []string{auctionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", deliveryPrefix, err)
+	}
+
+	deliveryBytes, err := ctx.GetStub().GetState(deliveryKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read delivery from world state: %v", err)
+	}
+	if deliveryBytes == nil {
+		return nil, fmt.Errorf("no delivery exists for auction %v", auctionID)
+	}
+
+	var delivery Delivery
+	err = json.Unmarshal(deliveryBytes, &delivery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create delivery object JSON: %v", err)
+	}
+
+	return &delivery, nil
+}
+
+// putDelivery is an internal helper that writes a delivery record
+func putDelivery(ctx contractapi.TransactionContextInterface, delivery *Delivery) error {
+
+	deliveryKey, err := ctx.GetStub().CreateCompositeKey(deliveryPrefix, []string{delivery.AuctionID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", deliveryPrefix, err)
+	}
+
+	deliveryBytes, err := marshalCanonical(delivery)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(deliveryKey, deliveryBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", deliveryKey, err)
+	}
+
+	return nil
+}
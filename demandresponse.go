@@ -0,0 +1,462 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const drProgramPrefix = "drProgram"
+const drParticipationPrefix = "drParticipation"
+
+// Demand-response program statuses
+const drOpen = "open"
+const drClosed = "closed"
+
+// Demand-response participation statuses
+const drOptedIn = "optedIn"
+const drRewarded = "rewarded"
+
+// DRProgram is a demand-response event posted by the grid operator: a target
+// reduction in KW, a reward rate per KWh reduced, and the window in which
+// reductions count. The pool holds the operator's funding that rewards are
+// paid from
+type DRProgram struct {
+	ID         string    `json:"ID"`
+	TargetKW   int       `json:"targetKW"`
+	RewardRate int       `json:"rewardRate"`
+	StartAt    time.Time `json:"startAt"`
+	EndAt      time.Time `json:"endAt"`
+	Pool       int       `json:"pool"`
+	Status     string    `json:"status"`
+}
+
+// DRParticipation records one prosumer's opt-in to a program: the meter that
+// proves the reduction, the declared baseline consumption, and the verified
+// reduction and reward once the operator has checked the readings
+type DRParticipation struct {
+	ProgramID   string `json:"programID"`
+	Participant string `json:"participant"`
+	MeterID     string `json:"meterID"`
+	BaselineKWh int    `json:"baselineKWh"`
+	ReducedKWh  int    `json:"reducedKWh"`
+	Reward      int    `json:"reward"`
+	Status      string `json:"status"`
+}
+
+// CreateDRProgram posts a new demand-response event. Only the grid operator
+// posts programs; the reward pool starts empty and is funded separately
+func (s *SmartContract) CreateDRProgram(ctx contractapi.TransactionContextInterface, programID string, targetKW int, rewardRate int, startAt string, endAt string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if targetKW <= 0 || rewardRate <= 0 {
+		return fmt.Errorf("target reduction and reward rate must be positive integers")
+	}
+
+	start, err := time.Parse(time.RFC3339, startAt)
+	if err != nil {
+		return fmt.Errorf("failed to parse start time %v: %v", startAt, err)
+	}
+	end, err := time.Parse(time.RFC3339, endAt)
+	if err != nil {
+		return fmt.Errorf("failed to parse end time %v: %v", endAt, err)
+	}
+	if !end.After(start) {
+		return fmt.Errorf("program end must be after its start")
+	}
+
+	existing, _ := getDRProgram(ctx, programID)
+	if existing != nil {
+		return fmt.Errorf("demand-response program %v already exists", programID)
+	}
+
+	program := DRProgram{
+		ID:         programID,
+		TargetKW:   targetKW,
+		RewardRate: rewardRate,
+		StartAt:    start,
+		EndAt:      end,
+		Pool:       0,
+		Status:     drOpen,
+	}
+
+	return putDRProgram(ctx, &program)
+}
+
+// FundDRProgram moves tokens from the operator's account into a program's
+// reward pool
+func (s *SmartContract) FundDRProgram(ctx contractapi.TransactionContextInterface, programID string, amount int) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if amount <= 0 {
+		return fmt.Errorf("funding amount must be a positive integer")
+	}
+
+	program, err := getDRProgram(ctx, programID)
+	if err != nil {
+		return err
+	}
+	if program.Status != drOpen {
+		return fmt.Errorf("demand-response program %v is not open", programID)
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	balanceBytes, err := getBalanceBytes(ctx, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to read account %s from world state: %v", clientID, err)
+	}
+	if balanceBytes == nil {
+		return fmt.Errorf("the account %s does not exist", clientID)
+	}
+
+	balance, err := parseBalance(balanceBytes)
+	if err != nil {
+		return err
+	}
+
+	newBalance, err := subBalance(balance, amount)
+	if err != nil {
+		return fmt.Errorf("funding amount %d exceeds the balance of account %s", amount, clientID)
+	}
+
+	err = putBalanceBytes(ctx, clientID, formatBalance(newBalance))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", clientID, err)
+	}
+
+	program.Pool += amount
+
+	return putDRProgram(ctx, program)
+}
+
+// OptInDR enrols the calling prosumer in a program with one of their
+// registered meters and a declared baseline consumption in KWh. The baseline
+// is what the operator verifies the in-window readings against
+func (s *SmartContract) OptInDR(ctx contractapi.TransactionContextInterface, programID string, meterID string, baselineKWh int) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if baselineKWh <= 0 {
+		return fmt.Errorf("baseline must be a positive integer")
+	}
+
+	program, err := getDRProgram(ctx, programID)
+	if err != nil {
+		return err
+	}
+	if program.Status != drOpen {
+		return fmt.Errorf("demand-response program %v is not open", programID)
+	}
+
+	// opting in closes when the program window starts
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+	if time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).After(program.StartAt) {
+		return fmt.Errorf("demand-response program %v has already started", programID)
+	}
+
+	// only the owner of the meter can pledge its readings
+	meter, err := getMeter(ctx, meterID)
+	if err != nil {
+		return err
+	}
+	if meter.Owner != clientID {
+		return fmt.Errorf("client does not own meter %v", meterID)
+	}
+
+	existing, _ := getDRParticipation(ctx, programID, clientID)
+	if existing != nil {
+		return fmt.Errorf("client already opted into program %v", programID)
+	}
+
+	participation := DRParticipation{
+		ProgramID:   programID,
+		Participant: clientID,
+		MeterID:     meterID,
+		BaselineKWh: baselineKWh,
+		Status:      drOptedIn,
+	}
+
+	return putDRParticipation(ctx, &participation)
+}
+
+// VerifyReduction checks a participant's in-window meter reading against
+// their baseline and pays the reward for the verified reduction from the
+// program pool. Only the grid operator verifies reductions
+func (s *SmartContract) VerifyReduction(ctx contractapi.TransactionContextInterface, programID string, participant string, readingTimestamp string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	program, err := getDRProgram(ctx, programID)
+	if err != nil {
+		return err
+	}
+	if program.Status != drOpen {
+		return fmt.Errorf("demand-response program %v is not open", programID)
+	}
+
+	participation, err := getDRParticipation(ctx, programID, participant)
+	if err != nil {
+		return err
+	}
+	if participation.Status != drOptedIn {
+		return fmt.Errorf("participation of %v in program %v was already rewarded", participant, programID)
+	}
+
+	// the reading must be signature-verified and fall inside the window
+	readingKey, err := ctx.GetStub().CreateCompositeKey(meterReadingPrefix, []string{participation.MeterID, readingTimestamp})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", meterReadingPrefix, err)
+	}
+
+	readingBytes, err := ctx.GetStub().GetState(readingKey)
+	if err != nil {
+		return fmt.Errorf("failed to read meter reading from world state: %v", err)
+	}
+	if readingBytes == nil {
+		return fmt.Errorf("no reading of meter %v exists for %v", participation.MeterID, readingTimestamp)
+	}
+
+	var reading MeterReading
+	err = json.Unmarshal(readingBytes, &reading)
+	if err != nil {
+		return fmt.Errorf("failed to create meter reading object JSON: %v", err)
+	}
+
+	readAt, err := time.Parse(time.RFC3339, readingTimestamp)
+	if err != nil {
+		return fmt.Errorf("failed to parse reading timestamp %v: %v", readingTimestamp, err)
+	}
+	if readAt.Before(program.StartAt) || readAt.After(program.EndAt) {
+		return fmt.Errorf("reading at %v is outside the program window", readingTimestamp)
+	}
+
+	if reading.KWh >= participation.BaselineKWh {
+		return fmt.Errorf("reading of %d KWh shows no reduction below the baseline of %d", reading.KWh, participation.BaselineKWh)
+	}
+
+	reduced := participation.BaselineKWh - reading.KWh
+	reward := reduced * program.RewardRate
+	if reward > program.Pool {
+		return fmt.Errorf("reward of %d exceeds the remaining program pool of %d", reward, program.Pool)
+	}
+
+	// pay the reward from the pool
+	balanceBytes, err := getBalanceBytes(ctx, participant)
+	if err != nil {
+		return fmt.Errorf("failed to read account %s from world state: %v", participant, err)
+	}
+	if balanceBytes == nil {
+		return fmt.Errorf("the account %s does not exist", participant)
+	}
+
+	balance, err := parseBalance(balanceBytes)
+	if err != nil {
+		return err
+	}
+
+	err = putBalanceBytes(ctx, participant, formatBalance(addBalance(balance, reward)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", participant, err)
+	}
+
+	program.Pool -= reward
+	err = putDRProgram(ctx, program)
+	if err != nil {
+		return err
+	}
+
+	participation.ReducedKWh = reduced
+	participation.Reward = reward
+	participation.Status = drRewarded
+
+	err = putDRParticipation(ctx, participation)
+	if err != nil {
+		return err
+	}
+
+	return recordReceipt(ctx, drProgramPrefix, programID, fmt.Sprintf("rewarded %d to %s for reducing %d KWh", reward, participant, reduced))
+}
+
+// CloseDRProgram closes a program and returns the unspent pool to the
+// operator's account. Only the grid operator closes programs, and only once
+// the window has passed
+func (s *SmartContract) CloseDRProgram(ctx contractapi.TransactionContextInterface, programID string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	program, err := getDRProgram(ctx, programID)
+	if err != nil {
+		return err
+	}
+	if program.Status != drOpen {
+		return fmt.Errorf("demand-response program %v is not open", programID)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+	if !time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).After(program.EndAt) {
+		return fmt.Errorf("demand-response program %v has not ended yet", programID)
+	}
+
+	if program.Pool > 0 {
+		clientID, err := ctx.GetClientIdentity().GetID()
+		if err != nil {
+			return fmt.Errorf("failed to get client id: %v", err)
+		}
+
+		balanceBytes, err := getBalanceBytes(ctx, clientID)
+		if err != nil {
+			return fmt.Errorf("failed to read account %s from world state: %v", clientID, err)
+		}
+		if balanceBytes == nil {
+			return fmt.Errorf("the account %s does not exist", clientID)
+		}
+
+		balance, err := parseBalance(balanceBytes)
+		if err != nil {
+			return err
+		}
+
+		err = putBalanceBytes(ctx, clientID, formatBalance(addBalance(balance, program.Pool)))
+		if err != nil {
+			return fmt.Errorf("failed to update state of smart contract for key %s: %v", clientID, err)
+		}
+
+		program.Pool = 0
+	}
+
+	program.Status = drClosed
+
+	return putDRProgram(ctx, program)
+}
+
+// GetDRProgram returns a demand-response program
+func (s *SmartContract) GetDRProgram(ctx contractapi.TransactionContextInterface, programID string) (*DRProgram, error) {
+	return getDRProgram(ctx, programID)
+}
+
+// GetDRParticipation returns one participant's record in a program
+func (s *SmartContract) GetDRParticipation(ctx contractapi.TransactionContextInterface, programID string, participant string) (*DRParticipation, error) {
+	return getDRParticipation(ctx, programID, participant)
+}
+
+// getDRProgram is an internal helper that reads a demand-response program
+func getDRProgram(ctx contractapi.TransactionContextInterface, programID string) (*DRProgram, error) {
+
+	programKey, err := ctx.GetStub().CreateCompositeKey(drProgramPrefix, []string{programID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", drProgramPrefix, err)
+	}
+
+	programBytes, err := ctx.GetStub().GetState(programKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read demand-response program from world state: %v", err)
+	}
+	if programBytes == nil {
+		return nil, fmt.Errorf("no demand-response program %v exists", programID)
+	}
+
+	var program DRProgram
+	err = json.Unmarshal(programBytes, &program)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create demand-response program object JSON: %v", err)
+	}
+
+	return &program, nil
+}
+
+// putDRProgram is an internal helper that writes a demand-response program
+func putDRProgram(ctx contractapi.TransactionContextInterface, program *DRProgram) error {
+
+	programKey, err := ctx.GetStub().CreateCompositeKey(drProgramPrefix, []string{program.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", drProgramPrefix, err)
+	}
+
+	programBytes, err := marshalCanonical(program)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(programKey, programBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", programKey, err)
+	}
+
+	return nil
+}
+
+// getDRParticipation is an internal helper that reads a participation record
+func getDRParticipation(ctx contractapi.TransactionContextInterface, programID string, participant string) (*DRParticipation, error) {
+
+	participationKey, err := ctx.GetStub().CreateCompositeKey(drParticipationPrefix, []string{programID, participant})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", drParticipationPrefix, err)
+	}
+
+	participationBytes, err := ctx.GetStub().GetState(participationKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read participation from world state: %v", err)
+	}
+	if participationBytes == nil {
+		return nil, fmt.Errorf("no participation of %v in program %v exists", participant, programID)
+	}
+
+	var participation DRParticipation
+	err = json.Unmarshal(participationBytes, &participation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create participation object JSON: %v", err)
+	}
+
+	return &participation, nil
+}
+
+// putDRParticipation is an internal helper that writes a participation record
+func putDRParticipation(ctx contractapi.TransactionContextInterface, participation *DRParticipation) error {
+
+	participationKey, err := ctx.GetStub().CreateCompositeKey(drParticipationPrefix, []string{participation.ProgramID, participation.Participant})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", drParticipationPrefix, err)
+	}
+
+	participationBytes, err := marshalCanonical(participation)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(participationKey, participationBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", participationKey, err)
+	}
+
+	return nil
+}
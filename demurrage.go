@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define key names for options
+const demurragePolicyKey = "demurragePolicy"
+
+// Define objectType names for prefix
+const lastActivityPrefix = "lastActivity"
+
+// DemurragePolicy configures negative interest on idle balances to
+// discourage hoarding: every full period an account sits without transfer
+// activity costs the configured percentage of its balance. Charges go to the
+// treasury like fees and slashed bonds
+type DemurragePolicy struct {
+	Percent   int `json:"percent"`
+	PeriodMin int `json:"periodMin"`
+}
+
+// SetDemurragePolicy configures the demurrage accrual. Only the regulator
+// sets the policy; a percentage of zero disables demurrage
+func (s *SmartContract) SetDemurragePolicy(ctx contractapi.TransactionContextInterface, percent int, periodMin int) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("demurrage percentage must be between 0 and 100")
+	}
+	if periodMin <= 0 {
+		return fmt.Errorf("accrual period must be a positive number of minutes")
+	}
+
+	policy := DemurragePolicy{
+		Percent:   percent,
+		PeriodMin: periodMin,
+	}
+
+	policyBytes, err := marshalCanonical(policy)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(demurragePolicyKey, policyBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", demurragePolicyKey, err)
+	}
+
+	return nil
+}
+
+// ApplyDemurrage charges every idle account the accrued demurrage and
+// returns how many accounts were adjusted. Only the regulator runs the
+// accrual. The charge is derived entirely from stored activity markers, the
+// policy and the tx timestamp, so every endorser computes the same
+// adjustments; each adjustment is emitted as an event and written as a
+// receipt, since Fabric only delivers the last event of a transaction
+func (s *SmartContract) ApplyDemurrage(ctx contractapi.TransactionContextInterface) (int, error) {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return 0, err
+	}
+
+	policy, err := getDemurragePolicy(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if policy == nil || policy.Percent == 0 {
+		return 0, fmt.Errorf("no demurrage policy has been set")
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get timestamp")
+	}
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(accountPrefix, []string{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read accounts from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	// charges are summed up in memory and credited to the treasury once
+	// after the loop; crediting it per account would re-read a treasury
+	// balance the earlier credits have not committed yet and keep only the
+	// last charge
+	adjusted := 0
+	collected := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read accounts from world state: %v", err)
+		}
+
+		_, attrs, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil || len(attrs) != 1 {
+			continue
+		}
+		account := attrs[0]
+
+		// the treasury is not a participant account and never accrues
+		if account == treasuryKey {
+			continue
+		}
+
+		lastActivity, err := getLastActivity(ctx, account)
+		if err != nil {
+			return 0, err
+		}
+		if lastActivity.IsZero() {
+			// accounts without a marker start their idle clock now
+			err = putLastActivity(ctx, account, now)
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		periods := int(now.Sub(lastActivity) / (time.Duration(policy.PeriodMin) * time.Minute))
+		if periods <= 0 {
+			continue
+		}
+
+		balance, err := parseBalance(queryResponse.Value)
+		if err != nil {
+			return 0, err
+		}
+
+		charge := int(balance.Int64()) * policy.Percent * periods / 100
+		if charge > int(balance.Int64()) {
+			charge = int(balance.Int64())
+		}
+
+		// the idle clock only advances by the charged periods, so partial
+		// periods carry over to the next accrual
+		err = putLastActivity(ctx, account, lastActivity.Add(time.Duration(periods*policy.PeriodMin)*time.Minute))
+		if err != nil {
+			return 0, err
+		}
+
+		if charge == 0 {
+			continue
+		}
+
+		newBalance, err := subBalance(balance, charge)
+		if err != nil {
+			return 0, fmt.Errorf("demurrage of %d exceeds the balance of account %s", charge, account)
+		}
+
+		err = putBalanceBytes(ctx, account, formatBalance(newBalance))
+		if err != nil {
+			return 0, fmt.Errorf("failed to update state of smart contract for key %s: %v", account, err)
+		}
+
+		collected += charge
+
+		meta, err := eventMeta(ctx)
+		if err != nil {
+			return 0, err
+		}
+		err = emitEvent(ctx, "DemurrageCharged", DemurrageEvent{EventMeta: meta, Account: account, Amount: charge, Periods: periods})
+		if err != nil {
+			return 0, err
+		}
+
+		err = recordReceipt(ctx, lastActivityPrefix, account, fmt.Sprintf("demurrage of %d charged to %s for %d idle periods", charge, account, periods))
+		if err != nil {
+			return 0, err
+		}
+
+		adjusted++
+	}
+
+	if collected > 0 {
+		treasuryBytes, err := ctx.GetStub().GetState(treasuryKey)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read treasury from world state: %v", err)
+		}
+
+		treasury, err := parseBalance(treasuryBytes)
+		if err != nil {
+			return 0, err
+		}
+
+		err = ctx.GetStub().PutState(treasuryKey, formatBalance(addBalance(treasury, collected)))
+		if err != nil {
+			return 0, fmt.Errorf("failed to update state of smart contract for key %s: %v", treasuryKey, err)
+		}
+	}
+
+	return adjusted, nil
+}
+
+// getDemurragePolicy is an internal helper that reads the demurrage policy;
+// a nil policy means no demurrage accrues
+func getDemurragePolicy(ctx contractapi.TransactionContextInterface) (*DemurragePolicy, error) {
+
+	policyBytes, err := ctx.GetStub().GetState(demurragePolicyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read demurrage policy from world state: %v", err)
+	}
+	if policyBytes == nil {
+		return nil, nil
+	}
+
+	var policy DemurragePolicy
+	err = json.Unmarshal(policyBytes, &policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create demurrage policy object JSON: %v", err)
+	}
+
+	return &policy, nil
+}
+
+// getLastActivity is an internal helper that reads an account's activity
+// marker; a zero time means the account has no marker yet
+func getLastActivity(ctx contractapi.TransactionContextInterface, account string) (time.Time, error) {
+
+	activityKey, err := ctx.GetStub().CreateCompositeKey(lastActivityPrefix, []string{account})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to create the composite key for prefix %s: %v", lastActivityPrefix, err)
+	}
+
+	activityBytes, err := ctx.GetStub().GetState(activityKey)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read activity marker from world state: %v", err)
+	}
+	if activityBytes == nil {
+		return time.Time{}, nil
+	}
+
+	seconds, err := strconv.ParseInt(string(activityBytes), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse activity marker: %v", err)
+	}
+
+	return time.Unix(seconds, 0), nil
+}
+
+// putLastActivity is an internal helper that writes an account's activity
+// marker
+func putLastActivity(ctx contractapi.TransactionContextInterface, account string, at time.Time) error {
+
+	activityKey, err := ctx.GetStub().CreateCompositeKey(lastActivityPrefix, []string{account})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", lastActivityPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(activityKey, []byte(strconv.FormatInt(at.Unix(), 10)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", activityKey, err)
+	}
+
+	return nil
+}
+
+// touchActivity is an internal helper that resets the idle clock of an
+// account when it takes part in a transfer
+func touchActivity(ctx contractapi.TransactionContextInterface, account string) error {
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	return putLastActivity(ctx, account, time.Unix(timestamp.Seconds, int64(timestamp.Nanos)))
+}
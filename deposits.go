@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const stakePrefix = "stake"
+
+// Define key names for options
+const depositPolicyKey = "depositPolicy"
+
+// DepositPolicy makes bidders put skin in the game: every bid stakes the
+// configured percentage of the bid amount on top of the hold. Losing bidders
+// and confirming winners get their stake back; a winner who lets the payment
+// window pass without confirming delivery is slashed to the seller
+type DepositPolicy struct {
+	Percent   int `json:"percent"`
+	WindowMin int `json:"windowMin"`
+}
+
+// SetDepositPolicy configures the bid deposit. Only the regulator sets the
+// policy; a percentage of zero disables deposits
+func (s *SmartContract) SetDepositPolicy(ctx contractapi.TransactionContextInterface, percent int, windowMin int) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("deposit percentage must be between 0 and 100")
+	}
+	if windowMin <= 0 {
+		return fmt.Errorf("payment window must be a positive number of minutes")
+	}
+
+	policy := DepositPolicy{
+		Percent:   percent,
+		WindowMin: windowMin,
+	}
+
+	policyBytes, err := marshalCanonical(policy)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(depositPolicyKey, policyBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", depositPolicyKey, err)
+	}
+
+	return nil
+}
+
+// GetStake returns a bidder's staked deposit on an auction
+func (s *SmartContract) GetStake(ctx contractapi.TransactionContextInterface, auctionID string, bidder string) (int, error) {
+
+	stakeKey, err := ctx.GetStub().CreateCompositeKey(stakePrefix, []string{auctionID, bidder})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create the composite key for prefix %s: %v", stakePrefix, err)
+	}
+
+	stakeBytes, err := ctx.GetStub().GetState(stakeKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read stake from world state: %v", err)
+	}
+	if stakeBytes == nil {
+		return 0, nil
+	}
+
+	stake, _ := strconv.Atoi(string(stakeBytes))
+	return stake, nil
+}
+
+// SlashStake forfeits the winner's stake to the seller when the payment
+// window has passed without the winner confirming delivery payment. Only the
+// seller of the escrowed auction slashes
+func (s *SmartContract) SlashStake(ctx contractapi.TransactionContextInterface, auctionID string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	escrow, err := getEscrow(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+
+	if clientID != escrow.Seller {
+		return fmt.Errorf("only the seller can slash the winner's stake")
+	}
+
+	// a confirmed or refunded escrow means the winner acted; only an escrow
+	// still held past the window forfeits the stake
+	if escrow.Status != escrowHeld {
+		return fmt.Errorf("escrow for auction %v is not held", auctionID)
+	}
+
+	policy, err := getDepositPolicy(ctx)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		return fmt.Errorf("no deposit policy has been set")
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+	deadline := escrow.CreatedAt.Add(time.Duration(policy.WindowMin) * time.Minute)
+	if !time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).After(deadline) {
+		return fmt.Errorf("the payment window has not passed yet")
+	}
+
+	err = releaseStake(ctx, auctionID, escrow.Buyer, escrow.Seller)
+	if err != nil {
+		return err
+	}
+
+	return recordReceipt(ctx, stakePrefix, auctionID, fmt.Sprintf("stake of %s slashed to %s on auction %s", escrow.Buyer, escrow.Seller, auctionID))
+}
+
+// getDepositPolicy is an internal helper that reads the deposit policy; a
+// nil policy or a zero percentage means bids need no deposit
+func getDepositPolicy(ctx contractapi.TransactionContextInterface) (*DepositPolicy, error) {
+
+	policyBytes, err := ctx.GetStub().GetState(depositPolicyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deposit policy from world state: %v", err)
+	}
+	if policyBytes == nil {
+		return nil, nil
+	}
+
+	var policy DepositPolicy
+	err = json.Unmarshal(policyBytes, &policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create deposit policy object JSON: %v", err)
+	}
+
+	return &policy, nil
+}
+
+// takeStake is an internal helper that moves the configured percentage of a
+// bid from the bidder's balance onto their stake for the auction. The caller
+// passes the bidder's balance as it stands after the bid hold's own debit:
+// re-reading it here would not see the hold's write during simulation and the
+// stake debit would silently undo it. Re-bids add to the existing stake
+func takeStake(ctx contractapi.TransactionContextInterface, auctionID string, bidder string, bidAmount int, balance *big.Int) error {
+
+	policy, err := getDepositPolicy(ctx)
+	if err != nil {
+		return err
+	}
+	if policy == nil || policy.Percent == 0 {
+		return nil
+	}
+
+	stake := bidAmount * policy.Percent / 100
+	if stake == 0 {
+		return nil
+	}
+
+	newBalance, err := subBalance(balance, stake)
+	if err != nil {
+		return fmt.Errorf("stake of %d exceeds the balance of account %s", stake, bidder)
+	}
+
+	err = putBalanceBytes(ctx, bidder, formatBalance(newBalance))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", bidder, err)
+	}
+
+	stakeKey, err := ctx.GetStub().CreateCompositeKey(stakePrefix, []string{auctionID, bidder})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", stakePrefix, err)
+	}
+
+	existing := 0
+	stakeBytes, err := ctx.GetStub().GetState(stakeKey)
+	if err != nil {
+		return fmt.Errorf("failed to read stake from world state: %v", err)
+	}
+	if stakeBytes != nil {
+		existing, _ = strconv.Atoi(string(stakeBytes))
+	}
+
+	err = ctx.GetStub().PutState(stakeKey, []byte(strconv.Itoa(existing+stake)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", stakeKey, err)
+	}
+
+	return nil
+}
+
+// releaseStake is an internal helper that pays a bidder's stake on an
+// auction out to a recipient - the bidder themselves on return, the seller
+// on slashing. A missing stake is a no-op, since deposits may be disabled
+func releaseStake(ctx contractapi.TransactionContextInterface, auctionID string, bidder string, recipient string) error {
+
+	stakeKey, err := ctx.GetStub().CreateCompositeKey(stakePrefix, []string{auctionID, bidder})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", stakePrefix, err)
+	}
+
+	stakeBytes, err := ctx.GetStub().GetState(stakeKey)
+	if err != nil {
+		return fmt.Errorf("failed to read stake from world state: %v", err)
+	}
+	if stakeBytes == nil {
+		return nil
+	}
+
+	stake, _ := strconv.Atoi(string(stakeBytes))
+
+	balanceBytes, err := getBalanceBytes(ctx, recipient)
+	if err != nil {
+		return fmt.Errorf("failed to read account %s from world state: %v", recipient, err)
+	}
+	if balanceBytes == nil {
+		return fmt.Errorf("the account %s does not exist", recipient)
+	}
+
+	balance, err := parseBalance(balanceBytes)
+	if err != nil {
+		return err
+	}
+
+	err = putBalanceBytes(ctx, recipient, formatBalance(addBalance(balance, stake)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", recipient, err)
+	}
+
+	return ctx.GetStub().DelState(stakeKey)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const deviceKeyPrefix = "deviceKey"
+
+// Households can register the public key of an end-user device (a home
+// energy box or metering gateway). A bid or order submitted through an
+// aggregator can then carry the device's signature over the economic terms:
+// the chaincode verifies the signature against the registered key, so the
+// aggregator cannot submit different terms than the ones the customer's
+// device authorized. The mode is optional - the unsigned entry points keep
+// working for participants who submit directly
+
+// RegisterDeviceKey registers or replaces the device public key of the
+// submitting client. The key is passed as a PEM-encoded PKIX ECDSA public key
+func (s *SmartContract) RegisterDeviceKey(ctx contractapi.TransactionContextInterface, publicKeyPem string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	// reject anything that does not parse as an ECDSA public key up front
+	_, err = parseDeviceKey(publicKeyPem)
+	if err != nil {
+		return err
+	}
+
+	deviceKey, err := ctx.GetStub().CreateCompositeKey(deviceKeyPrefix, []string{clientID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", deviceKeyPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(deviceKey, []byte(publicKeyPem))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", deviceKey, err)
+	}
+
+	return nil
+}
+
+// SubmitSignedBid submits a bid whose economic terms were signed by the
+// device of the named customer. The signature is a base64 ASN.1 ECDSA
+// signature over "bid|auctionID|amount"; if it does not verify against the
+// customer's registered device key the bid is rejected before any state
+// changes
+func (s *SmartContract) SubmitSignedBid(ctx contractapi.TransactionContextInterface, auctionID string, amount int, customer string, signature string) error {
+
+	err := verifyDeviceSignature(ctx, customer, fmt.Sprintf("bid|%s|%d", auctionID, amount), signature)
+	if err != nil {
+		return err
+	}
+
+	return s.SubmitBid(ctx, auctionID, amount, 0)
+}
+
+// OrderMintSigned places a mint order whose amount was signed by the device
+// of the named customer. The signature is a base64 ASN.1 ECDSA signature
+// over "mint|amount"
+func (s *SmartContract) OrderMintSigned(ctx contractapi.TransactionContextInterface, amount int, customer string, signature string) (string, error) {
+
+	err := verifyDeviceSignature(ctx, customer, fmt.Sprintf("mint|%d", amount), signature)
+	if err != nil {
+		return "", err
+	}
+
+	return s.OrderMint(ctx, amount)
+}
+
+// verifyDeviceSignature is an internal helper that checks a device signature
+// over a message against the registered key of an account
+func verifyDeviceSignature(ctx contractapi.TransactionContextInterface, account string, message string, signature string) error {
+
+	deviceKey, err := ctx.GetStub().CreateCompositeKey(deviceKeyPrefix, []string{account})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", deviceKeyPrefix, err)
+	}
+
+	keyBytes, err := ctx.GetStub().GetState(deviceKey)
+	if err != nil {
+		return fmt.Errorf("failed to read device key from world state: %v", err)
+	}
+	if keyBytes == nil {
+		return fmt.Errorf("no device key is registered for %v", account)
+	}
+
+	publicKey, err := parseDeviceKey(string(keyBytes))
+	if err != nil {
+		return err
+	}
+
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode device signature: %v", err)
+	}
+
+	digest := sha256.Sum256([]byte(message))
+	if !ecdsa.VerifyASN1(publicKey, digest[:], signatureBytes) {
+		return fmt.Errorf("device signature does not match the submitted terms")
+	}
+
+	return nil
+}
+
+// parseDeviceKey is an internal helper that decodes a PEM-encoded PKIX ECDSA
+// public key
+func parseDeviceKey(publicKeyPem string) (*ecdsa.PublicKey, error) {
+
+	block, _ := pem.Decode([]byte(publicKeyPem))
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode device key PEM")
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse device key: %v", err)
+	}
+
+	publicKey, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("device key must be an ECDSA public key")
+	}
+
+	return publicKey, nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const disputePrefix = "dispute"
+
+// Dispute statuses
+const disputeOpen = "open"
+const disputeResolved = "resolved"
+
+// Dispute outcomes
+const outcomeRefund = "refund"
+const outcomePartial = "partial"
+const outcomeUphold = "uphold"
+
+// Dispute is the record of a contested settlement: who opened it and why,
+// and how the regulator resolved it. The settlement ID is the auction or
+// trade ID whose escrow is contested
+type Dispute struct {
+	SettlementID string    `json:"settlementID"`
+	OpenedBy     string    `json:"openedBy"`
+	Reason       string    `json:"reason"`
+	OpenedAt     time.Time `json:"openedAt"`
+	Status       string    `json:"status"`
+	Outcome      string    `json:"outcome,omitempty"`
+	RefundAmount int       `json:"refundAmount,omitempty"`
+}
+
+// OpenDispute contests a settlement within the dispute window. The buyer or
+// the seller of the escrow can open; the escrow freezes until the regulator
+// resolves
+func (s *SmartContract) OpenDispute(ctx contractapi.TransactionContextInterface, settlementID string, reason string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	escrow, err := getEscrow(ctx, settlementID)
+	if err != nil {
+		return err
+	}
+
+	if clientID != escrow.Buyer && clientID != escrow.Seller {
+		return fmt.Errorf("only the buyer or the seller can open a dispute")
+	}
+
+	if escrow.Status != escrowHeld {
+		return fmt.Errorf("escrow for settlement %v is not held", settlementID)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+	if now.After(escrow.DisputeUntil) {
+		return fmt.Errorf("the dispute window has closed")
+	}
+
+	escrow.Status = escrowDisputed
+
+	err = putEscrow(ctx, escrow)
+	if err != nil {
+		return err
+	}
+
+	dispute := Dispute{
+		SettlementID: settlementID,
+		OpenedBy:     clientID,
+		Reason:       reason,
+		OpenedAt:     now,
+		Status:       disputeOpen,
+	}
+
+	err = putDispute(ctx, &dispute)
+	if err != nil {
+		return err
+	}
+
+	meta, err := eventMeta(ctx)
+	if err != nil {
+		return err
+	}
+	err = emitEvent(ctx, "DisputeOpened", DisputeEvent{EventMeta: meta, SettlementID: settlementID, Party: clientID, Reason: reason})
+	if err != nil {
+		return err
+	}
+
+	return recordReceipt(ctx, disputePrefix, settlementID, fmt.Sprintf("dispute opened on settlement %s by %s", settlementID, clientID))
+}
+
+// ResolveDispute settles a disputed escrow with one of three outcomes: a
+// refund returns everything to the buyer, uphold pays the seller in full,
+// and a partial refund splits the escrow at the given refund amount. Only
+// the regulator resolves
+func (s *SmartContract) ResolveDispute(ctx contractapi.TransactionContextInterface, settlementID string, outcome string, refundAmount int) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	escrow, err := getEscrow(ctx, settlementID)
+	if err != nil {
+		return err
+	}
+
+	if escrow.Status != escrowDisputed {
+		return fmt.Errorf("escrow for settlement %v is not disputed", settlementID)
+	}
+
+	dispute, err := getDispute(ctx, settlementID)
+	if err != nil {
+		return err
+	}
+
+	switch outcome {
+	case outcomeRefund:
+		refundAmount = escrow.Amount
+		err = payOutEscrow(ctx, escrow, escrow.Buyer, escrowRefunded)
+	case outcomeUphold:
+		refundAmount = 0
+		err = payOutEscrow(ctx, escrow, escrow.Seller, escrowReleased)
+	case outcomePartial:
+		if refundAmount <= 0 || refundAmount >= escrow.Amount {
+			return fmt.Errorf("a partial refund must be between 1 and %d", escrow.Amount-1)
+		}
+		err = splitEscrow(ctx, escrow, refundAmount)
+	default:
+		return fmt.Errorf("outcome must be %s, %s or %s", outcomeRefund, outcomePartial, outcomeUphold)
+	}
+	if err != nil {
+		return err
+	}
+
+	dispute.Status = disputeResolved
+	dispute.Outcome = outcome
+	dispute.RefundAmount = refundAmount
+
+	err = putDispute(ctx, dispute)
+	if err != nil {
+		return err
+	}
+
+	meta, err := eventMeta(ctx)
+	if err != nil {
+		return err
+	}
+	err = emitEvent(ctx, "DisputeResolved", DisputeEvent{EventMeta: meta, SettlementID: settlementID, Party: dispute.OpenedBy, Outcome: outcome, RefundAmount: refundAmount})
+	if err != nil {
+		return err
+	}
+
+	return recordReceipt(ctx, disputePrefix, settlementID, fmt.Sprintf("dispute on settlement %s resolved as %s with a refund of %d", settlementID, outcome, refundAmount))
+}
+
+// GetDispute returns the dispute record of a settlement
+func (s *SmartContract) GetDispute(ctx contractapi.TransactionContextInterface, settlementID string) (*Dispute, error) {
+	return getDispute(ctx, settlementID)
+}
+
+// splitEscrow is an internal helper for partial refunds: the refund goes
+// back to the buyer, the remainder is paid to the seller and the escrow
+// closes as released
+func splitEscrow(ctx contractapi.TransactionContextInterface, escrow *Escrow, refundAmount int) error {
+
+	for _, payout := range []struct {
+		recipient string
+		amount    int
+	}{
+		{escrow.Buyer, refundAmount},
+		{escrow.Seller, escrow.Amount - refundAmount},
+	} {
+		balanceBytes, err := getBalanceBytes(ctx, payout.recipient)
+		if err != nil {
+			return fmt.Errorf("failed to read account %s from world state: %v", payout.recipient, err)
+		}
+		if balanceBytes == nil {
+			return fmt.Errorf("the account %s does not exist", payout.recipient)
+		}
+
+		balance, err := parseBalance(balanceBytes)
+		if err != nil {
+			return err
+		}
+
+		err = putBalanceBytes(ctx, payout.recipient, formatBalance(addBalance(balance, payout.amount)))
+		if err != nil {
+			return fmt.Errorf("failed to update state of smart contract for key %s: %v", payout.recipient, err)
+		}
+	}
+
+	escrow.Status = escrowReleased
+
+	err := putEscrow(ctx, escrow)
+	if err != nil {
+		return err
+	}
+
+	// the buyer acted by disputing, so their stake comes back with the split
+	return releaseStake(ctx, escrow.AuctionID, escrow.Buyer, escrow.Buyer)
+}
+
+// getDispute is an internal helper that reads a dispute record
+func getDispute(ctx contractapi.TransactionContextInterface, settlementID string) (*Dispute, error) {
+
+	disputeKey, err := ctx.GetStub().CreateCompositeKey(disputePrefix, []string{settlementID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", disputePrefix, err)
+	}
+
+	disputeBytes, err := ctx.GetStub().GetState(disputeKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dispute from world state: %v", err)
+	}
+	if disputeBytes == nil {
+		return nil, fmt.Errorf("no dispute exists for settlement %v", settlementID)
+	}
+
+	var dispute Dispute
+	err = json.Unmarshal(disputeBytes, &dispute)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dispute object JSON: %v", err)
+	}
+
+	return &dispute, nil
+}
+
+// putDispute is an internal helper that writes a dispute record
+func putDispute(ctx contractapi.TransactionContextInterface, dispute *Dispute) error {
+
+	disputeKey, err := ctx.GetStub().CreateCompositeKey(disputePrefix, []string{dispute.SettlementID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", disputePrefix, err)
+	}
+
+	disputeBytes, err := marshalCanonical(dispute)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(disputeKey, disputeBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", disputeKey, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const energyAssetPrefix = "energyAsset"
+
+// EnergyAsset is a production certificate for generated KWh, registered by
+// the producer with the source type and the meter that measured it
+type EnergyAsset struct {
+	ID    string `json:"id"`
+	Owner string `json:"owner"`
+	KWh   int    `json:"kWh"`
+	Wh    int    `json:"wh"`
+	// CarbonIntensity is the certified emission factor of the production in
+	// gCO2 per KWh; auctions backed by the asset inherit it
+	CarbonIntensity int       `json:"carbonIntensity"`
+	Source          string    `json:"source"`
+	MeterID         string    `json:"meterID"`
+	ProducedAt      time.Time `json:"producedAt"`
+}
+
+// RegisterEnergyProduction registers generated KWh as an on-chain energy
+// asset owned by the submitting producer
+func (s *SmartContract) RegisterEnergyProduction(ctx contractapi.TransactionContextInterface, assetID string, kWh int, source string, carbonIntensity int, meterID string) error {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if kWh <= 0 {
+		return fmt.Errorf("produced KWh must be a positive integer")
+	}
+	if carbonIntensity < 0 {
+		return fmt.Errorf("carbon intensity cannot be negative")
+	}
+
+	assetKey, err := ctx.GetStub().CreateCompositeKey(energyAssetPrefix, []string{assetID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", energyAssetPrefix, err)
+	}
+
+	assetBytes, err := ctx.GetStub().GetState(assetKey)
+	if err != nil {
+		return fmt.Errorf("failed to read energy asset from world state: %v", err)
+	}
+	if assetBytes != nil {
+		return fmt.Errorf("energy asset %v already exists", assetID)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	unit, err := marketPrecision(ctx, defaultMarket)
+	if err != nil {
+		return err
+	}
+	wh, err := toWh(kWh, unit)
+	if err != nil {
+		return err
+	}
+
+	asset := EnergyAsset{
+		ID:              assetID,
+		Owner:           clientID,
+		KWh:             kWh,
+		Wh:              wh,
+		CarbonIntensity: carbonIntensity,
+		Source:          source,
+		MeterID:         meterID,
+		ProducedAt:      time.Unix(timestamp.Seconds, int64(timestamp.Nanos)),
+	}
+
+	assetBytes, err = marshalCanonical(asset)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(assetKey, assetBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", assetKey, err)
+	}
+
+	return nil
+}
+
+// GetEnergyAsset returns a registered energy asset
+func (s *SmartContract) GetEnergyAsset(ctx contractapi.TransactionContextInterface, assetID string) (*EnergyAsset, error) {
+	asset, _, err := getEnergyAsset(ctx, assetID)
+	if err != nil {
+		return nil, err
+	}
+	return asset, nil
+}
+
+// TransferEnergyAsset transfers an energy asset to a new owner. Only the
+// current owner may transfer it
+func (s *SmartContract) TransferEnergyAsset(ctx contractapi.TransactionContextInterface, assetID string, newOwner string) error {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	asset, assetKey, err := getEnergyAsset(ctx, assetID)
+	if err != nil {
+		return err
+	}
+
+	if asset.Owner != clientID {
+		return fmt.Errorf("Permission denied, client id %v is not the owner of the asset", clientID)
+	}
+
+	asset.Owner = newOwner
+
+	assetBytes, err := marshalCanonical(asset)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(assetKey, assetBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", assetKey, err)
+	}
+
+	return nil
+}
+
+// CreateAuctionForAsset creates an auction backed by a registered energy
+// asset instead of an arbitrary amount parameter. The seller must own the
+// asset, and the auctioned amount is the certified KWh
+func (s *SmartContract) CreateAuctionForAsset(ctx contractapi.TransactionContextInterface, auctionID string, assetID string, priceperkwh int, time_rem int) error {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	asset, _, err := getEnergyAsset(ctx, assetID)
+	if err != nil {
+		return err
+	}
+
+	if asset.Owner != clientID {
+		return fmt.Errorf("Permission denied, client id %v is not the owner of the asset", clientID)
+	}
+
+	return s.CreateAuction(ctx, auctionID, priceperkwh, asset.KWh, time_rem, false, 0, 0, "", asset.CarbonIntensity)
+}
+
+// getEnergyAsset is an internal helper that reads an energy asset together
+// with its state key
+func getEnergyAsset(ctx contractapi.TransactionContextInterface, assetID string) (*EnergyAsset, string, error) {
+
+	assetKey, err := ctx.GetStub().CreateCompositeKey(energyAssetPrefix, []string{assetID})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create the composite key for prefix %s: %v", energyAssetPrefix, err)
+	}
+
+	assetBytes, err := ctx.GetStub().GetState(assetKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read energy asset from world state: %v", err)
+	}
+	if assetBytes == nil {
+		return nil, "", fmt.Errorf("energy asset %v does not exist", assetID)
+	}
+
+	var asset EnergyAsset
+	err = json.Unmarshal(assetBytes, &asset)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create energy asset object JSON: %v", err)
+	}
+
+	return &asset, assetKey, nil
+}
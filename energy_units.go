@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const precisionPrefix = "precision"
+
+// Energy units known to the market layer. Quantities are stored in Wh on the
+// ledger; kWh markets convert on the way in so household trades can settle
+// fractions of a kWh without floating point
+const unitKWh = "kWh"
+const unitWh = "Wh"
+const whPerKWh = 1000
+
+// the market namespace used when none is specified
+const defaultMarket = "default"
+
+// SetMarketPrecision declares the unit quantities are submitted in within a
+// market namespace. Only the operator may set it, and it cannot change once
+// trades exist under the old precision without a coordinated migration, so
+// the value is write-once
+func (s *SmartContract) SetMarketPrecision(ctx contractapi.TransactionContextInterface, namespace string, unit string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if unit != unitKWh && unit != unitWh {
+		return fmt.Errorf("unknown unit %v, must be %v or %v", unit, unitKWh, unitWh)
+	}
+
+	precisionKey, err := ctx.GetStub().CreateCompositeKey(precisionPrefix, []string{namespace})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", precisionPrefix, err)
+	}
+
+	existing, err := ctx.GetStub().GetState(precisionKey)
+	if err != nil {
+		return fmt.Errorf("failed to read market precision from world state: %v", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("market %v already trades in %s", namespace, string(existing))
+	}
+
+	err = ctx.GetStub().PutState(precisionKey, []byte(unit))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", precisionKey, err)
+	}
+
+	return nil
+}
+
+// GetMarketPrecision returns the unit of a market namespace
+func (s *SmartContract) GetMarketPrecision(ctx contractapi.TransactionContextInterface, namespace string) (string, error) {
+	return marketPrecision(ctx, namespace)
+}
+
+// marketPrecision is an internal helper; markets without a declared
+// precision trade in whole kWh, which matches the historic behaviour
+func marketPrecision(ctx contractapi.TransactionContextInterface, namespace string) (string, error) {
+
+	precisionKey, err := ctx.GetStub().CreateCompositeKey(precisionPrefix, []string{namespace})
+	if err != nil {
+		return "", fmt.Errorf("failed to create the composite key for prefix %s: %v", precisionPrefix, err)
+	}
+
+	precisionBytes, err := ctx.GetStub().GetState(precisionKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read market precision from world state: %v", err)
+	}
+	if precisionBytes == nil {
+		return unitKWh, nil
+	}
+
+	return string(precisionBytes), nil
+}
+
+// toWh converts a submitted quantity into the Wh stored on the ledger
+func toWh(amount int, unit string) (int, error) {
+
+	switch unit {
+	case unitWh:
+		return amount, nil
+	case unitKWh:
+		return amount * whPerKWh, nil
+	default:
+		return 0, fmt.Errorf("unknown unit %v", unit)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define key names for options
+const erasuresKey = "Erasures"
+
+// redactionMarker replaces personal metadata once an erasure is executed
+const redactionMarker = "REDACTED"
+
+const stateErased = "Erased"
+
+// Erasures keeps the right-to-erasure orders per participant, following the
+// same order/approve/execute workflow as mint and burn orders
+type Erasures struct {
+	State map[string]string `json:"state"`
+}
+
+// RequestErasure is used by a departing participant to ask for the erasure of
+// their personal metadata. The request has to be approved by the regulator
+func (s *SmartContract) RequestErasure(ctx contractapi.TransactionContextInterface) error {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	erasures, err := getErasures(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, exists := erasures.State[clientID]; exists {
+		return fmt.Errorf("an erasure order for %v already exists", clientID)
+	}
+
+	erasures.State[clientID] = stateOrder
+
+	return putErasures(ctx, erasures)
+}
+
+// ApproveErasure is used by the regulator to approve an erasure order
+func (s *SmartContract) ApproveErasure(ctx contractapi.TransactionContextInterface, erase_acc string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	erasures, err := getErasures(ctx)
+	if err != nil {
+		return err
+	}
+
+	state, exists := erasures.State[erase_acc]
+	if !exists {
+		return fmt.Errorf("there is no erasure order for %v", erase_acc)
+	}
+	if state != stateOrder {
+		return fmt.Errorf("erasure is not in order stage")
+	}
+
+	erasures.State[erase_acc] = stateApproved
+
+	return putErasures(ctx, erasures)
+}
+
+// ExecuteErasure tombstones the personal metadata of an approved participant.
+// The salted hashes, salts and off-chain pointers are replaced with redaction
+// markers and consents are deleted, while balances and other financial
+// aggregates are preserved. Where private data collections hold copies, the
+// purge has to be coordinated off-chain by the collection owners
+func (s *SmartContract) ExecuteErasure(ctx contractapi.TransactionContextInterface, erase_acc string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	erasures, err := getErasures(ctx)
+	if err != nil {
+		return err
+	}
+
+	state, exists := erasures.State[erase_acc]
+	if !exists {
+		return fmt.Errorf("there is no erasure order for %v", erase_acc)
+	}
+	if state != stateApproved {
+		return fmt.Errorf("erasure is not approved")
+	}
+
+	// tombstone all personal metadata records of the participant
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(personalDataPrefix, []string{erase_acc})
+	if err != nil {
+		return fmt.Errorf("failed to read personal data from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return fmt.Errorf("failed to read personal data from world state: %v", err)
+		}
+
+		var personal PersonalData
+		err = json.Unmarshal(queryResponse.Value, &personal)
+		if err != nil {
+			return fmt.Errorf("failed to create personal data object JSON: %v", err)
+		}
+
+		personal.Hash = redactionMarker
+		personal.Salt = redactionMarker
+		personal.Pointer = redactionMarker
+
+		personalBytes, err := marshalCanonical(personal)
+		if err != nil {
+			return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+		}
+
+		err = ctx.GetStub().PutState(queryResponse.Key, personalBytes)
+		if err != nil {
+			return fmt.Errorf("failed to update state of smart contract for key %s: %v", queryResponse.Key, err)
+		}
+	}
+
+	// delete all consents granted by the participant
+	consentIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(consentPrefix, []string{erase_acc})
+	if err != nil {
+		return fmt.Errorf("failed to read consents from world state: %v", err)
+	}
+	defer consentIterator.Close()
+
+	for consentIterator.HasNext() {
+		queryResponse, err := consentIterator.Next()
+		if err != nil {
+			return fmt.Errorf("failed to read consents from world state: %v", err)
+		}
+
+		err = ctx.GetStub().DelState(queryResponse.Key)
+		if err != nil {
+			return fmt.Errorf("failed to delete consent: %v", err)
+		}
+	}
+
+	erasures.State[erase_acc] = stateErased
+
+	return putErasures(ctx, erasures)
+}
+
+// GetErasureOrders returns all erasure orders so the regulator can review them
+func (s *SmartContract) GetErasureOrders(ctx contractapi.TransactionContextInterface) (map[string]string, error) {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return nil, err
+	}
+
+	erasures, err := getErasures(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return erasures.State, nil
+}
+
+// getErasures is an internal helper that reads the erasure orders from state
+func getErasures(ctx contractapi.TransactionContextInterface) (*Erasures, error) {
+	erasuresBytes, err := ctx.GetStub().GetState(erasuresKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Erasures from world state: %v", err)
+	}
+
+	erasures := Erasures{
+		State: make(map[string]string),
+	}
+	if erasuresBytes != nil {
+		err = json.Unmarshal(erasuresBytes, &erasures)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create erasures object JSON: %v", err)
+		}
+	}
+
+	return &erasures, nil
+}
+
+// putErasures is an internal helper that writes the erasure orders to state
+func putErasures(ctx contractapi.TransactionContextInterface, erasures *Erasures) error {
+	erasuresBytes, err := marshalCanonical(erasures)
+	if err != nil {
+		return fmt.Errorf("failed to get bytes")
+	}
+
+	err = ctx.GetStub().PutState(erasuresKey, erasuresBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const escrowPrefix = "escrow"
+
+// Escrow statuses
+const escrowHeld = "held"
+const escrowReleased = "released"
+const escrowRefunded = "refunded"
+const escrowDisputed = "disputed"
+
+// dispute window in minutes after settlement during which the buyer can
+// dispute instead of confirm
+const disputeWindowMin = 1440
+
+// Escrow holds the winning amount of an ended auction until the buyer (or
+// the meter oracle) confirms delivery. The seller is only paid on
+// confirmation; a dispute within the window freezes the funds until the
+// regulator resolves it
+type Escrow struct {
+	AuctionID    string    `json:"auctionID"`
+	Buyer        string    `json:"buyer"`
+	Seller       string    `json:"seller"`
+	Amount       int       `json:"amount"`
+	CreatedAt    time.Time `json:"createdAt"`
+	DisputeUntil time.Time `json:"disputeUntil"`
+	Status       string    `json:"status"`
+}
+
+// createEscrow is an internal helper that consumes the buyer's hold record
+// for the auction into a new escrow record when an auction settles. Only the
+// hold the buyer placed for this auction is touched, never funds held for
+// other auctions or transfers
+func createEscrow(ctx contractapi.TransactionContextInterface, auctionID string, buyer string, seller string, amount int) error {
+
+	// consume the buyer's hold without paying anyone yet; the funds now
+	// live on the escrow record
+	err := consumeHoldRecord(ctx, buyer, auctionID, amount)
+	if err != nil {
+		return fmt.Errorf("cannot consume hold of %v: %v", buyer, err)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	escrow := Escrow{
+		AuctionID:    auctionID,
+		Buyer:        buyer,
+		Seller:       seller,
+		Amount:       amount,
+		CreatedAt:    now,
+		DisputeUntil: now.Add(disputeWindowMin * time.Minute),
+		Status:       escrowHeld,
+	}
+
+	err = putEscrow(ctx, &escrow)
+	if err != nil {
+		return err
+	}
+
+	// schedule the delivery record that tracks whether the energy arrives
+	return createDelivery(ctx, auctionID, buyer, seller)
+}
+
+// ConfirmDelivery releases an escrow to the seller. The buyer confirms after
+// the energy is delivered; the operator org can confirm on behalf of the
+// meter oracle
+func (s *SmartContract) ConfirmDelivery(ctx contractapi.TransactionContextInterface, auctionID string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	escrow, err := getEscrow(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+
+	if clientID != escrow.Buyer && requireRole(ctx, roleRegulator) != nil {
+		return fmt.Errorf("only the buyer or the meter oracle can confirm delivery")
+	}
+
+	if escrow.Status != escrowHeld {
+		return fmt.Errorf("escrow for auction %v is not held", auctionID)
+	}
+
+	err = markDelivered(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+
+	return payOutEscrow(ctx, escrow, escrow.Seller, escrowReleased)
+}
+
+// DisputeEscrow is the deprecated name of OpenDispute, kept as a thin shim
+// so existing client apps keep working across the upgrade window. It emits a
+// Deprecated event before forwarding to the new logic
+func (s *SmartContract) DisputeEscrow(ctx contractapi.TransactionContextInterface, auctionID string) error {
+	err := emitDeprecationEvent(ctx, "DisputeEscrow", "OpenDispute")
+	if err != nil {
+		return err
+	}
+
+	return s.OpenDispute(ctx, auctionID, "")
+}
+
+// ReleaseEscrow lets the seller collect an unconfirmed escrow once the
+// dispute window has passed without a dispute
+func (s *SmartContract) ReleaseEscrow(ctx contractapi.TransactionContextInterface, auctionID string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	escrow, err := getEscrow(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+
+	if clientID != escrow.Seller {
+		return fmt.Errorf("only the seller can release the escrow")
+	}
+
+	if escrow.Status != escrowHeld {
+		return fmt.Errorf("escrow for auction %v is not held", auctionID)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+	if !time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).After(escrow.DisputeUntil) {
+		return fmt.Errorf("the dispute window is still open")
+	}
+
+	return payOutEscrow(ctx, escrow, escrow.Seller, escrowReleased)
+}
+
+// GetEscrow returns the escrow record of an auction
+func (s *SmartContract) GetEscrow(ctx contractapi.TransactionContextInterface, auctionID string) (*Escrow, error) {
+	return getEscrow(ctx, auctionID)
+}
+
+// payOutEscrow is an internal helper that credits the escrowed amount to a
+// recipient and closes the record with the given status
+func payOutEscrow(ctx contractapi.TransactionContextInterface, escrow *Escrow, recipient string, status string) error {
+
+	// when a settlement chaincode is configured the tokens live on another
+	// contract, so the payout is an InvokeChaincode there instead of a
+	// local balance credit
+	remote, err := settleRemotely(ctx, recipient, escrow.Amount)
+	if err != nil {
+		return err
+	}
+	if remote {
+		escrow.Status = status
+		err = putEscrow(ctx, escrow)
+		if err != nil {
+			return err
+		}
+		return releaseStake(ctx, escrow.AuctionID, escrow.Buyer, escrow.Buyer)
+	}
+
+	balanceBytes, err := getBalanceBytes(ctx, recipient)
+	if err != nil {
+		return fmt.Errorf("failed to read account %s from world state: %v", recipient, err)
+	}
+	if balanceBytes == nil {
+		return fmt.Errorf("the account %s does not exist", recipient)
+	}
+
+	balance, err := parseBalance(balanceBytes)
+	if err != nil {
+		return err
+	}
+
+	err = putBalanceBytes(ctx, recipient, formatBalance(addBalance(balance, escrow.Amount)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", recipient, err)
+	}
+
+	escrow.Status = status
+
+	err = putEscrow(ctx, escrow)
+	if err != nil {
+		return err
+	}
+
+	// a paid-out escrow means the winner acted, so their stake comes back
+	return releaseStake(ctx, escrow.AuctionID, escrow.Buyer, escrow.Buyer)
+}
+
+// getEscrow is an internal helper that reads the escrow record of an auction
+func getEscrow(ctx contractapi.TransactionContextInterface, auctionID string) (*Escrow, error) {
+
+	escrowKey, err := ctx.GetStub().CreateCompositeKey(escrowPrefix, []string{auctionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", escrowPrefix, err)
+	}
+
+	escrowBytes, err := ctx.GetStub().GetState(escrowKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read escrow from world state: %v", err)
+	}
+	if escrowBytes == nil {
+		return nil, fmt.Errorf("no escrow exists for auction %v", auctionID)
+	}
+
+	var escrow Escrow
+	err = json.Unmarshal(escrowBytes, &escrow)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create escrow object JSON: %v", err)
+	}
+
+	return &escrow, nil
+}
+
+// putEscrow is an internal helper that writes an escrow record
+func putEscrow(ctx contractapi.TransactionContextInterface, escrow *Escrow) error {
+
+	escrowKey, err := ctx.GetStub().CreateCompositeKey(escrowPrefix, []string{escrow.AuctionID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", escrowPrefix, err)
+	}
+
+	escrowBytes, err := marshalCanonical(escrow)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(escrowKey, escrowBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", escrowKey, err)
+	}
+
+	return nil
+}
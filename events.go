@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Event payloads for clients listening on the chaincode. The old `event`
+// struct had unexported fields, so json.Marshal emitted {} and clients got
+// empty Transfer/Approval events. Every payload now has exported fields and
+// carries the transaction ID and timestamp
+
+// EventMeta is embedded in every event payload
+type EventMeta struct {
+	TxID      string    `json:"txID"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// TransferEvent is emitted on every token transfer
+type TransferEvent struct {
+	EventMeta
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Value int    `json:"value"`
+}
+
+// ApprovalEvent is emitted when an allowance is set
+type ApprovalEvent struct {
+	EventMeta
+	Owner   string `json:"owner"`
+	Spender string `json:"spender"`
+	Value   int    `json:"value"`
+}
+
+// MintEvent is emitted when new tokens enter the supply
+type MintEvent struct {
+	EventMeta
+	Minter string `json:"minter"`
+	Amount int    `json:"amount"`
+}
+
+// BurnEvent is emitted when tokens leave the supply
+type BurnEvent struct {
+	EventMeta
+	Burner string `json:"burner"`
+	Amount int    `json:"amount"`
+}
+
+// AuctionCreatedEvent is emitted when a new auction opens
+type AuctionCreatedEvent struct {
+	EventMeta
+	AuctionID   string `json:"auctionID"`
+	Seller      string `json:"seller"`
+	Amount      int    `json:"amount"`
+	PricePerKWh int    `json:"priceperkwh"`
+}
+
+// BidSubmittedEvent is emitted when a bid lands on an auction
+type BidSubmittedEvent struct {
+	EventMeta
+	AuctionID string `json:"auctionID"`
+	Bidder    string `json:"bidder"`
+}
+
+// AuctionEndedEvent is emitted when an auction ends
+type AuctionEndedEvent struct {
+	EventMeta
+	AuctionID string `json:"auctionID"`
+	Winner    string `json:"winner"`
+	Price     int    `json:"price"`
+}
+
+// OrderDecisionEvent is the payload of the MintOrderApproved,
+// BurnOrderApproved, MintOrderRejected and BurnOrderRejected events, so
+// client applications can subscribe instead of polling for a decision
+type OrderDecisionEvent struct {
+	EventMeta
+	OrderID string `json:"orderID"`
+	Client  string `json:"client"`
+	Amount  int    `json:"amount"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// OrderExpiredEvent is emitted when a mint or burn order passes its TTL
+// without being executed
+type OrderExpiredEvent struct {
+	EventMeta
+	OrderID string `json:"orderID"`
+	Client  string `json:"client"`
+	Type    string `json:"type"`
+	Amount  int    `json:"amount"`
+}
+
+// AuctionCancelledEvent is emitted when the seller or the regulator cancels
+// an auction before it ends
+type AuctionCancelledEvent struct {
+	EventMeta
+	AuctionID string `json:"auctionID"`
+	Seller    string `json:"seller"`
+	Reason    string `json:"reason"`
+}
+
+// DisputeEvent is the payload of the DisputeOpened and DisputeResolved
+// events emitted as a settlement dispute moves through its stages
+type DisputeEvent struct {
+	EventMeta
+	SettlementID string `json:"settlementID"`
+	Party        string `json:"party"`
+	Reason       string `json:"reason,omitempty"`
+	Outcome      string `json:"outcome,omitempty"`
+	RefundAmount int    `json:"refundAmount,omitempty"`
+}
+
+// DemurrageEvent is emitted per account when the demurrage accrual charges
+// an idle balance
+type DemurrageEvent struct {
+	EventMeta
+	Account string `json:"account"`
+	Amount  int    `json:"amount"`
+	Periods int    `json:"periods"`
+}
+
+// HoldCreatedEvent is emitted when funds move onto a hold
+type HoldCreatedEvent struct {
+	EventMeta
+	Holder string `json:"holder"`
+	Amount int    `json:"amount"`
+}
+
+// HoldReleasedEvent is emitted when a losing bidder's hold goes back to
+// their balance at the end of an auction
+type HoldReleasedEvent struct {
+	EventMeta
+	Holder    string `json:"holder"`
+	AuctionID string `json:"auctionID"`
+}
+
+// eventMeta is an internal helper that stamps a payload with the running
+// transaction's ID and timestamp
+func eventMeta(ctx contractapi.TransactionContextInterface) (EventMeta, error) {
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return EventMeta{}, fmt.Errorf("failed to get timestamp")
+	}
+
+	return EventMeta{
+		TxID:      ctx.GetStub().GetTxID(),
+		Timestamp: time.Unix(timestamp.Seconds, int64(timestamp.Nanos)),
+	}, nil
+}
+
+// emitEvent is an internal helper that marshals a payload and sets it as the
+// chaincode event of the running transaction
+func emitEvent(ctx contractapi.TransactionContextInterface, name string, payload interface{}) error {
+
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent(name, payloadJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
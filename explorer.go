@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const receiptPrefix = "receipt"
+
+// receiptSequencer is implemented by transaction contexts that hand out the
+// receipt sequence numbers of the running invocation
+type receiptSequencer interface {
+	nextReceiptSeq() int
+}
+
+// TransactionContext is the chaincode's transaction context: the default
+// context plus a per-invocation receipt counter. The sequence cannot be
+// derived by counting committed receipts, because reads during simulation
+// never see the transaction's own writes — every receipt would get sequence
+// zero and overwrite the previous one
+type TransactionContext struct {
+	contractapi.TransactionContext
+	receiptSeq int
+}
+
+// nextReceiptSeq returns the next free receipt sequence of this invocation
+func (c *TransactionContext) nextReceiptSeq() int {
+	seq := c.receiptSeq
+	c.receiptSeq++
+	return seq
+}
+
+// Receipt links a transaction to one domain object it touched, so support
+// staff can resolve a customer query from a txID without a block explorer
+// that understands our state layout
+type Receipt struct {
+	TxID       string `json:"txID"`
+	ObjectType string `json:"objectType"`
+	Key        string `json:"key"`
+	Summary    string `json:"summary"`
+}
+
+// ExplainTransaction returns the domain objects a transaction touched
+// (payments, auctions, order decisions), as recorded in its receipts
+func (s *SmartContract) ExplainTransaction(ctx contractapi.TransactionContextInterface, txID string) ([]Receipt, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(receiptPrefix, []string{txID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read receipts from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	receipts := []Receipt{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read receipts from world state: %v", err)
+		}
+
+		var receipt Receipt
+		err = json.Unmarshal(queryResponse.Value, &receipt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create receipt object JSON: %v", err)
+		}
+
+		receipts = append(receipts, receipt)
+	}
+
+	if len(receipts) == 0 {
+		return nil, fmt.Errorf("no receipts recorded for transaction %v", txID)
+	}
+
+	return receipts, nil
+}
+
+// recordReceipt is an internal helper that writes one receipt line for the
+// running transaction. Receipts are keyed (txID, sequence) so a transaction
+// touching several objects keeps one receipt per object
+func recordReceipt(ctx contractapi.TransactionContextInterface, objectType string, key string, summary string) error {
+
+	txID := ctx.GetStub().GetTxID()
+
+	// the sequence comes from the per-invocation counter on the transaction
+	// context, so receipts written in the same transaction never collide
+	seqCtx, ok := ctx.(receiptSequencer)
+	if !ok {
+		return fmt.Errorf("transaction context does not allocate receipt sequences")
+	}
+	sequence := seqCtx.nextReceiptSeq()
+
+	receipt := Receipt{
+		TxID:       txID,
+		ObjectType: objectType,
+		Key:        key,
+		Summary:    summary,
+	}
+
+	receiptBytes, err := marshalCanonical(receipt)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	receiptKey, err := ctx.GetStub().CreateCompositeKey(receiptPrefix, []string{txID, fmt.Sprintf("%d", sequence)})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", receiptPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(receiptKey, receiptBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", receiptKey, err)
+	}
+
+	return nil
+}
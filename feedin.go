@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define key names for options
+const feedInTariffKey = "feedInTariff"
+const feedInDailyCapKey = "feedInDailyCap"
+
+// Define objectType names for prefix
+const feedInMintedPrefix = "feedInMinted"
+const feedInCreditedPrefix = "feedInCredited"
+
+// The feed-in tariff automatically turns validated production readings into
+// token credits: the regulator sets a price per KWh and a daily mint cap,
+// and CreditProduction mints the credit to the meter's owner. Every credit
+// is minted supply, so the cap bounds how much new supply a day of readings
+// can create
+
+// SetFeedInTariff sets the feed-in price per KWh paid for validated
+// production. Only the regulator sets the tariff
+func (s *SmartContract) SetFeedInTariff(ctx contractapi.TransactionContextInterface, pricePerKWh int) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if pricePerKWh <= 0 {
+		return fmt.Errorf("feed-in tariff must be a positive integer")
+	}
+
+	err = ctx.GetStub().PutState(feedInTariffKey, []byte(strconv.Itoa(pricePerKWh)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", feedInTariffKey, err)
+	}
+
+	return nil
+}
+
+// SetFeedInDailyCap caps how many tokens the feed-in tariff may mint per
+// day. Only the regulator sets the cap
+func (s *SmartContract) SetFeedInDailyCap(ctx contractapi.TransactionContextInterface, cap int) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if cap <= 0 {
+		return fmt.Errorf("feed-in daily cap must be a positive integer")
+	}
+
+	err = ctx.GetStub().PutState(feedInDailyCapKey, []byte(strconv.Itoa(cap)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", feedInDailyCapKey, err)
+	}
+
+	return nil
+}
+
+// CreditProduction credits the owner of a meter for a validated production
+// reading at the current feed-in tariff. The reading must have been pushed
+// and signature-verified by SubmitMeterReading; each reading is credited at
+// most once and the day's total minted credit never exceeds the cap
+// This function triggers a Mint event
+func (s *SmartContract) CreditProduction(ctx contractapi.TransactionContextInterface, meterID string, timestamp string) error {
+
+	tariffBytes, err := ctx.GetStub().GetState(feedInTariffKey)
+	if err != nil {
+		return fmt.Errorf("failed to read feed-in tariff from world state: %v", err)
+	}
+	if tariffBytes == nil {
+		return fmt.Errorf("no feed-in tariff has been set")
+	}
+	tariff, _ := strconv.Atoi(string(tariffBytes))
+
+	// the reading must exist, which means its meter signature verified
+	readingKey, err := ctx.GetStub().CreateCompositeKey(meterReadingPrefix, []string{meterID, timestamp})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", meterReadingPrefix, err)
+	}
+
+	readingBytes, err := ctx.GetStub().GetState(readingKey)
+	if err != nil {
+		return fmt.Errorf("failed to read meter reading from world state: %v", err)
+	}
+	if readingBytes == nil {
+		return fmt.Errorf("no reading of meter %v exists for %v", meterID, timestamp)
+	}
+
+	var reading MeterReading
+	err = json.Unmarshal(readingBytes, &reading)
+	if err != nil {
+		return fmt.Errorf("failed to create meter reading object JSON: %v", err)
+	}
+
+	// a reading is credited at most once
+	creditedKey, err := ctx.GetStub().CreateCompositeKey(feedInCreditedPrefix, []string{meterID, timestamp})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", feedInCreditedPrefix, err)
+	}
+
+	creditedBytes, err := ctx.GetStub().GetState(creditedKey)
+	if err != nil {
+		return fmt.Errorf("failed to read credit marker from world state: %v", err)
+	}
+	if creditedBytes != nil {
+		return fmt.Errorf("reading of meter %v for %v was already credited", meterID, timestamp)
+	}
+
+	credit := reading.KWh * tariff
+	if credit <= 0 {
+		return fmt.Errorf("reading of meter %v for %v yields no credit", meterID, timestamp)
+	}
+
+	// enforce the daily mint cap against the aggregate of the credit's day
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+	day := time.Unix(txTimestamp.Seconds, int64(txTimestamp.Nanos)).UTC().Format("2006-01-02")
+
+	mintedKey, err := ctx.GetStub().CreateCompositeKey(feedInMintedPrefix, []string{day})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", feedInMintedPrefix, err)
+	}
+
+	var minted int
+	mintedBytes, err := ctx.GetStub().GetState(mintedKey)
+	if err != nil {
+		return fmt.Errorf("failed to read minted aggregate from world state: %v", err)
+	}
+	if mintedBytes != nil {
+		minted, _ = strconv.Atoi(string(mintedBytes))
+	}
+
+	capBytes, err := ctx.GetStub().GetState(feedInDailyCapKey)
+	if err != nil {
+		return fmt.Errorf("failed to read feed-in daily cap from world state: %v", err)
+	}
+	if capBytes != nil {
+		cap, _ := strconv.Atoi(string(capBytes))
+		if minted+credit > cap {
+			return fmt.Errorf("crediting %d would exceed the remaining daily feed-in cap of %d", credit, cap-minted)
+		}
+	}
+
+	// look up the producer and credit the new tokens to their account
+	meter, err := getMeter(ctx, meterID)
+	if err != nil {
+		return err
+	}
+
+	balanceBytes, err := getBalanceBytes(ctx, meter.Owner)
+	if err != nil {
+		return fmt.Errorf("failed to read account %s from world state: %v", meter.Owner, err)
+	}
+	if balanceBytes == nil {
+		return fmt.Errorf("the account %s does not exist", meter.Owner)
+	}
+
+	balance, err := parseBalance(balanceBytes)
+	if err != nil {
+		return err
+	}
+
+	err = putBalanceBytes(ctx, meter.Owner, formatBalance(addBalance(balance, credit)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", meter.Owner, err)
+	}
+
+	// the credit is minted supply
+	totalSupplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve total token supply: %v", err)
+	}
+
+	totalSupply, err := parseBalance(totalSupplyBytes)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(totalSupplyKey, formatBalance(addBalance(totalSupply, credit)))
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(mintedKey, []byte(strconv.Itoa(minted+credit)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", mintedKey, err)
+	}
+
+	err = ctx.GetStub().PutState(creditedKey, []byte(ctx.GetStub().GetTxID()))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", creditedKey, err)
+	}
+
+	// Emit the Mint event and leave a receipt for the explorer
+	meta, err := eventMeta(ctx)
+	if err != nil {
+		return err
+	}
+	err = emitEvent(ctx, "Mint", MintEvent{EventMeta: meta, Minter: meter.Owner, Amount: credit})
+	if err != nil {
+		return err
+	}
+
+	return recordReceipt(ctx, "feedIn", meterID, fmt.Sprintf("credited %d to %s for %d KWh produced at %s", credit, meter.Owner, reading.KWh, timestamp))
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const flexOfferPrefix = "flexoffer"
+
+// Flexibility offer statuses
+const flexOffered = "offered"
+const flexAccepted = "accepted"
+const flexActivated = "activated"
+const flexSettled = "settled"
+
+// FlexOffer is a load flexibility offer made by a prosumer to the DSO,
+// distinct from the energy auction flows
+type FlexOffer struct {
+	ID              string    `json:"id"`
+	Prosumer        string    `json:"prosumer"`
+	KW              int       `json:"kW"`
+	WindowStart     time.Time `json:"windowStart"`
+	WindowEnd       time.Time `json:"windowEnd"`
+	ActivationPrice int       `json:"activationPrice"`
+	DSO             string    `json:"dso"`
+	Status          string    `json:"status"`
+}
+
+// SubmitFlexOffer lets a prosumer offer load flexibility (kW over a window at
+// an activation price). The window times are passed in RFC3339 format
+func (s *SmartContract) SubmitFlexOffer(ctx contractapi.TransactionContextInterface, offerID string, kW int, windowStart string, windowEnd string, activationPrice int) error {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if kW <= 0 {
+		return fmt.Errorf("offered kW must be a positive integer")
+	}
+
+	if activationPrice <= 0 {
+		return fmt.Errorf("activation price must be a positive integer")
+	}
+
+	start, err := time.Parse(time.RFC3339, windowStart)
+	if err != nil {
+		return fmt.Errorf("failed to parse window start: %v", err)
+	}
+
+	end, err := time.Parse(time.RFC3339, windowEnd)
+	if err != nil {
+		return fmt.Errorf("failed to parse window end: %v", err)
+	}
+
+	if !end.After(start) {
+		return fmt.Errorf("window end must be after window start")
+	}
+
+	offerKey, err := ctx.GetStub().CreateCompositeKey(flexOfferPrefix, []string{offerID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", flexOfferPrefix, err)
+	}
+
+	offerBytes, err := ctx.GetStub().GetState(offerKey)
+	if err != nil {
+		return fmt.Errorf("failed to read flexibility offer from world state: %v", err)
+	}
+	if offerBytes != nil {
+		return fmt.Errorf("flexibility offer %v already exists", offerID)
+	}
+
+	offer := FlexOffer{
+		ID:              offerID,
+		Prosumer:        clientID,
+		KW:              kW,
+		WindowStart:     start,
+		WindowEnd:       end,
+		ActivationPrice: activationPrice,
+		DSO:             "",
+		Status:          flexOffered,
+	}
+
+	return putFlexOffer(ctx, offerKey, &offer)
+}
+
+// AcceptFlexOffer is used by the DSO to accept an offer up to its need. The
+// accepting identity pays the activation price at settlement
+func (s *SmartContract) AcceptFlexOffer(ctx contractapi.TransactionContextInterface, offerID string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	offer, offerKey, err := getFlexOffer(ctx, offerID)
+	if err != nil {
+		return err
+	}
+
+	if offer.Status != flexOffered {
+		return fmt.Errorf("flexibility offer %v is not open for acceptance", offerID)
+	}
+
+	offer.DSO = clientID
+	offer.Status = flexAccepted
+
+	return putFlexOffer(ctx, offerKey, offer)
+}
+
+// ActivateFlexOffer instructs the activation of an accepted offer within its
+// window. Only the accepting DSO identity may instruct it
+func (s *SmartContract) ActivateFlexOffer(ctx contractapi.TransactionContextInterface, offerID string) error {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	offer, offerKey, err := getFlexOffer(ctx, offerID)
+	if err != nil {
+		return err
+	}
+
+	if offer.DSO != clientID {
+		return fmt.Errorf("Permission denied, client id %v did not accept the offer", clientID)
+	}
+
+	if offer.Status != flexAccepted {
+		return fmt.Errorf("flexibility offer %v has not been accepted", offerID)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+	if now.Before(offer.WindowStart) || now.After(offer.WindowEnd) {
+		return fmt.Errorf("flexibility offer %v can only be activated within its window", offerID)
+	}
+
+	offer.Status = flexActivated
+
+	return putFlexOffer(ctx, offerKey, offer)
+}
+
+// SettleFlexOffer verifies the delivered flexibility against the offer and
+// pays the prosumer the activation price from the DSO's account. Verification
+// against meter readings happens off the hot path; the DSO submits the
+// delivered kW it measured
+func (s *SmartContract) SettleFlexOffer(ctx contractapi.TransactionContextInterface, offerID string, deliveredKW int) error {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	offer, offerKey, err := getFlexOffer(ctx, offerID)
+	if err != nil {
+		return err
+	}
+
+	if offer.DSO != clientID {
+		return fmt.Errorf("Permission denied, client id %v did not accept the offer", clientID)
+	}
+
+	if offer.Status != flexActivated {
+		return fmt.Errorf("flexibility offer %v has not been activated", offerID)
+	}
+
+	if deliveredKW < offer.KW {
+		return fmt.Errorf("delivered %d kW is less than the offered %d kW", deliveredKW, offer.KW)
+	}
+
+	_, err = transferHelper(ctx, offer.DSO, offer.Prosumer, offer.ActivationPrice)
+	if err != nil {
+		return fmt.Errorf("failed to transfer: %v", err)
+	}
+
+	offer.Status = flexSettled
+
+	return putFlexOffer(ctx, offerKey, offer)
+}
+
+// QueryFlexOffer returns a flexibility offer
+func (s *SmartContract) QueryFlexOffer(ctx contractapi.TransactionContextInterface, offerID string) (*FlexOffer, error) {
+	offer, _, err := getFlexOffer(ctx, offerID)
+	if err != nil {
+		return nil, err
+	}
+	return offer, nil
+}
+
+// getFlexOffer is an internal helper that reads a flexibility offer together
+// with its state key
+func getFlexOffer(ctx contractapi.TransactionContextInterface, offerID string) (*FlexOffer, string, error) {
+
+	offerKey, err := ctx.GetStub().CreateCompositeKey(flexOfferPrefix, []string{offerID})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create the composite key for prefix %s: %v", flexOfferPrefix, err)
+	}
+
+	offerBytes, err := ctx.GetStub().GetState(offerKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read flexibility offer from world state: %v", err)
+	}
+	if offerBytes == nil {
+		return nil, "", fmt.Errorf("flexibility offer %v does not exist", offerID)
+	}
+
+	var offer FlexOffer
+	err = json.Unmarshal(offerBytes, &offer)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create flexibility offer object JSON: %v", err)
+	}
+
+	return &offer, offerKey, nil
+}
+
+// putFlexOffer is an internal helper that writes a flexibility offer to state
+func putFlexOffer(ctx contractapi.TransactionContextInterface, offerKey string, offer *FlexOffer) error {
+	offerBytes, err := marshalCanonical(offer)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(offerKey, offerBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", offerKey, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const forecastPrefix = "forecast"
+const gateClosurePrefix = "gate"
+
+// Forecast is one submitted version of a production/consumption forecast for
+// an asset and market slot
+type Forecast struct {
+	Asset       string    `json:"asset"`
+	Slot        string    `json:"slot"`
+	KWh         int       `json:"kWh"`
+	Version     int       `json:"version"`
+	Submitter   string    `json:"submitter"`
+	SubmittedAt time.Time `json:"submittedAt"`
+}
+
+// ForecastHistory keeps every version submitted for an asset and slot. The
+// last version before gate closure is the baseline for imbalance settlement
+type ForecastHistory struct {
+	Versions []Forecast `json:"versions"`
+}
+
+// SetGateClosure publishes the gate closure time of a market slot from the
+// market calendar. The time is passed in RFC3339 format. Only the operator
+// maintains the calendar
+func (s *SmartContract) SetGateClosure(ctx contractapi.TransactionContextInterface, slot string, closure string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	_, err = time.Parse(time.RFC3339, closure)
+	if err != nil {
+		return fmt.Errorf("failed to parse gate closure time: %v", err)
+	}
+
+	gateKey, err := ctx.GetStub().CreateCompositeKey(gateClosurePrefix, []string{slot})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", gateClosurePrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(gateKey, []byte(closure))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", gateKey, err)
+	}
+
+	return nil
+}
+
+// SubmitForecast submits or revises the forecast of an asset for a market
+// slot. Revisions are allowed until gate closure, after which the forecast is
+// locked and becomes the baseline for imbalance settlement
+func (s *SmartContract) SubmitForecast(ctx contractapi.TransactionContextInterface, asset string, slot string, kWh int) error {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if kWh < 0 {
+		return fmt.Errorf("forecast cannot be negative")
+	}
+
+	closed, err := gateClosed(ctx, slot)
+	if err != nil {
+		return err
+	}
+	if closed {
+		return fmt.Errorf("gate for slot %v has closed, forecast is locked", slot)
+	}
+
+	history, forecastKey, err := getForecastHistory(ctx, asset, slot)
+	if err != nil {
+		return err
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	forecast := Forecast{
+		Asset:       asset,
+		Slot:        slot,
+		KWh:         kWh,
+		Version:     len(history.Versions) + 1,
+		Submitter:   clientID,
+		SubmittedAt: time.Unix(timestamp.Seconds, int64(timestamp.Nanos)),
+	}
+
+	history.Versions = append(history.Versions, forecast)
+
+	historyBytes, err := marshalCanonical(history)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(forecastKey, historyBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", forecastKey, err)
+	}
+
+	return nil
+}
+
+// GetForecastHistory returns every forecast version of an asset and slot
+func (s *SmartContract) GetForecastHistory(ctx contractapi.TransactionContextInterface, asset string, slot string) (*ForecastHistory, error) {
+	history, _, err := getForecastHistory(ctx, asset, slot)
+	if err != nil {
+		return nil, err
+	}
+	if len(history.Versions) == 0 {
+		return nil, fmt.Errorf("no forecast has been submitted for asset %v and slot %v", asset, slot)
+	}
+
+	return history, nil
+}
+
+// GetForecastBaseline returns the locked forecast used as the baseline for
+// imbalance settlement. It is only available once the gate has closed
+func (s *SmartContract) GetForecastBaseline(ctx contractapi.TransactionContextInterface, asset string, slot string) (*Forecast, error) {
+
+	closed, err := gateClosed(ctx, slot)
+	if err != nil {
+		return nil, err
+	}
+	if !closed {
+		return nil, fmt.Errorf("gate for slot %v has not closed, forecast is not locked yet", slot)
+	}
+
+	history, _, err := getForecastHistory(ctx, asset, slot)
+	if err != nil {
+		return nil, err
+	}
+	if len(history.Versions) == 0 {
+		return nil, fmt.Errorf("no forecast has been submitted for asset %v and slot %v", asset, slot)
+	}
+
+	baseline := history.Versions[len(history.Versions)-1]
+	return &baseline, nil
+}
+
+// gateClosed is an internal helper that checks the market calendar for a slot
+func gateClosed(ctx contractapi.TransactionContextInterface, slot string) (bool, error) {
+
+	gateKey, err := ctx.GetStub().CreateCompositeKey(gateClosurePrefix, []string{slot})
+	if err != nil {
+		return false, fmt.Errorf("failed to create the composite key for prefix %s: %v", gateClosurePrefix, err)
+	}
+
+	gateBytes, err := ctx.GetStub().GetState(gateKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read gate closure from world state: %v", err)
+	}
+	if gateBytes == nil {
+		return false, fmt.Errorf("slot %v is not in the market calendar", slot)
+	}
+
+	closure, err := time.Parse(time.RFC3339, string(gateBytes))
+	if err != nil {
+		return false, fmt.Errorf("failed to parse gate closure time: %v", err)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return false, fmt.Errorf("failed to get timestamp")
+	}
+
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+	return !now.Before(closure), nil
+}
+
+// getForecastHistory is an internal helper that reads the forecast history of
+// an asset and slot together with its state key
+func getForecastHistory(ctx contractapi.TransactionContextInterface, asset string, slot string) (*ForecastHistory, string, error) {
+
+	forecastKey, err := ctx.GetStub().CreateCompositeKey(forecastPrefix, []string{asset, slot})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create the composite key for prefix %s: %v", forecastPrefix, err)
+	}
+
+	historyBytes, err := ctx.GetStub().GetState(forecastKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read forecast history from world state: %v", err)
+	}
+
+	history := ForecastHistory{
+		Versions: []Forecast{},
+	}
+	if historyBytes != nil {
+		err = json.Unmarshal(historyBytes, &history)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create forecast history object JSON: %v", err)
+		}
+	}
+
+	return &history, forecastKey, nil
+}
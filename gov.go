@@ -3,275 +3,136 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"time"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
-func (s *SmartContract) GetMintOrders(ctx contractapi.TransactionContextInterface) (map[string]St_am, error) {
-	var mo map[string]St_am
-	// Check minter authorization - this sample assumes Org1 is the central banker with privilege to mint new tokens
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+// GetMintOrders lists the pending mint orders awaiting a decision
+func (s *SmartContract) GetMintOrders(ctx contractapi.TransactionContextInterface) ([]Order, error) {
+	err := requireRole(ctx, roleRegulator)
 	if err != nil {
-		return mo, fmt.Errorf("failed to get MSPID: %v", err)
+		return nil, err
 	}
-	if clientMSPID != "Org1MSP" {
-		return mo, fmt.Errorf("client is not authorized to get mint orders")
-	}
-
-	mintburnBytes, err := ctx.GetStub().GetState(MintBurnKey)
-	if err != nil {
-		return mo, fmt.Errorf("failed to read MintBurn from world state: %v", err)
-	}
-
-	var mintburn MintBurn
-	err = json.Unmarshal(mintburnBytes, &mintburn)
-	if err != nil {
-		return mo, fmt.Errorf("there are no Mint Orders")
-	}
-
-	mo = mintburn.State
 
-	for key, value := range mo {
-		if value.MintBurn != "Mint" {
-			delete(mo, key)
-		} else if value.State != stateOrder {
-			delete(mo, key)
-		}
-	}
-
-	return mo, nil
+	return listOrders(ctx, "Mint", stateOrder, "")
 }
 
-func (s *SmartContract) GetBurnOrders(ctx contractapi.TransactionContextInterface) (map[string]St_am, error) {
-	var mo map[string]St_am
-	// Check minter authorization - this sample assumes Org1 is the central banker with privilege to mint new tokens
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
-	if err != nil {
-		return mo, fmt.Errorf("failed to get MSPID: %v", err)
-	}
-	if clientMSPID != "Org1MSP" {
-		return mo, fmt.Errorf("client is not authorized to get burn orders")
-	}
-
-	mintburnBytes, err := ctx.GetStub().GetState(MintBurnKey)
-	if err != nil {
-		return mo, fmt.Errorf("failed to read MintBurn from world state: %v", err)
-	}
-
-	var mintburn MintBurn
-	err = json.Unmarshal(mintburnBytes, &mintburn)
+// GetBurnOrders lists the pending burn orders awaiting a decision
+func (s *SmartContract) GetBurnOrders(ctx contractapi.TransactionContextInterface) ([]Order, error) {
+	err := requireRole(ctx, roleRegulator)
 	if err != nil {
-		return mo, fmt.Errorf("there are no Burn Orders")
-	}
-
-	mo = mintburn.State
-
-	for key, value := range mo {
-		if value.MintBurn != "Burn" {
-			delete(mo, key)
-		} else if value.State != stateOrder {
-			delete(mo, key)
-		}
+		return nil, err
 	}
 
-	return mo, nil
+	return listOrders(ctx, "Burn", stateOrder, "")
 }
 
-func (s *SmartContract) ApproveMint(ctx contractapi.TransactionContextInterface, mint_acc string) error {
-	var mo St_am
-	// Check minter authorization - this sample assumes Org1 is the central banker with privilege to mint new tokens
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+func (s *SmartContract) ApproveMint(ctx contractapi.TransactionContextInterface, orderID string) error {
+	err := requireRole(ctx, roleRegulator)
 	if err != nil {
-		return fmt.Errorf("failed to get MSPID: %v", err)
-	}
-	if clientMSPID != "Org1MSP" {
-		return fmt.Errorf("client is not authorized to get burn orders")
+		return err
 	}
 
-	mintburnBytes, err := ctx.GetStub().GetState(MintBurnKey)
+	order, err := decideOrder(ctx, orderID, "Mint", stateApproved, "")
 	if err != nil {
-		return fmt.Errorf("failed to read MintBurn from world state: %v", err)
+		return err
 	}
 
-	var mintburn MintBurn
-	err = json.Unmarshal(mintburnBytes, &mintburn)
+	// record the decision for the transaction explorer
+	err = recordReceipt(ctx, "order", orderID, fmt.Sprintf("mint order %s of %s approved for %d", orderID, order.Client, order.Amount))
 	if err != nil {
-		return fmt.Errorf("there are no Burn Orders")
+		return err
 	}
 
-	mo = mintburn.State[mint_acc]
-
-	if mo.MintBurn != "Mint" {
-		return fmt.Errorf("there are no Mint Orders")
-	} else if mo.State != stateOrder {
-		return fmt.Errorf("mint is not in order stage")
-	}
-
-	mo.State = stateApproved
-	mintburn.State[mint_acc] = mo
-
-	upd_mintburnBytes, err := json.Marshal(mintburn)
+	// Emit the MintOrderApproved event
+	meta, err := eventMeta(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get bytes")
+		return err
 	}
-
-	err = ctx.GetStub().PutState(MintBurnKey, upd_mintburnBytes)
-	if err != nil {
-		return fmt.Errorf("failed to update state %v", err)
-	}
-
-	return nil
+	return emitEvent(ctx, "MintOrderApproved", OrderDecisionEvent{EventMeta: meta, OrderID: orderID, Client: order.Client, Amount: order.Amount})
 }
 
-func (s *SmartContract) ApproveBurn(ctx contractapi.TransactionContextInterface, burn_acc string) error {
-	var mo St_am
-	// Check minter authorization - this sample assumes Org1 is the central banker with privilege to mint new tokens
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+func (s *SmartContract) ApproveBurn(ctx contractapi.TransactionContextInterface, orderID string) error {
+	err := requireRole(ctx, roleRegulator)
 	if err != nil {
-		return fmt.Errorf("failed to get MSPID: %v", err)
-	}
-	if clientMSPID != "Org1MSP" {
-		return fmt.Errorf("client is not authorized to get burn orders")
+		return err
 	}
 
-	mintburnBytes, err := ctx.GetStub().GetState(MintBurnKey)
+	order, err := decideOrder(ctx, orderID, "Burn", stateApproved, "")
 	if err != nil {
-		return fmt.Errorf("failed to read MintBurn from world state: %v", err)
+		return err
 	}
 
-	var mintburn MintBurn
-	err = json.Unmarshal(mintburnBytes, &mintburn)
+	// record the decision for the transaction explorer
+	err = recordReceipt(ctx, "order", orderID, fmt.Sprintf("burn order %s of %s approved for %d", orderID, order.Client, order.Amount))
 	if err != nil {
-		return fmt.Errorf("there are no Burn Orders")
+		return err
 	}
 
-	mo = mintburn.State[burn_acc]
-
-	if mo.MintBurn != "Burn" {
-		return fmt.Errorf("there are no Burn Orders")
-	} else if mo.State != stateOrder {
-		return fmt.Errorf("mint is not in order stage")
-	}
-
-	mo.State = stateApproved
-	mintburn.State[burn_acc] = mo
-
-	upd_mintburnBytes, err := json.Marshal(mintburn)
+	// Emit the BurnOrderApproved event
+	meta, err := eventMeta(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get bytes")
+		return err
 	}
-
-	err = ctx.GetStub().PutState(MintBurnKey, upd_mintburnBytes)
-	if err != nil {
-		return fmt.Errorf("failed to update state %v", err)
-	}
-
-	return nil
+	return emitEvent(ctx, "BurnOrderApproved", OrderDecisionEvent{EventMeta: meta, OrderID: orderID, Client: order.Client, Amount: order.Amount})
 }
 
-func (s *SmartContract) RejectMint(ctx contractapi.TransactionContextInterface, mint_acc string) error {
-	var mo St_am
-	// Check minter authorization - this sample assumes Org1 is the central banker with privilege to mint new tokens
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+func (s *SmartContract) RejectMint(ctx contractapi.TransactionContextInterface, orderID string, reason string) error {
+	err := requireRole(ctx, roleRegulator)
 	if err != nil {
-		return fmt.Errorf("failed to get MSPID: %v", err)
-	}
-	if clientMSPID != "Org1MSP" {
-		return fmt.Errorf("client is not authorized to get burn orders")
+		return err
 	}
 
-	mintburnBytes, err := ctx.GetStub().GetState(MintBurnKey)
+	order, err := decideOrder(ctx, orderID, "Mint", stateRejected, reason)
 	if err != nil {
-		return fmt.Errorf("failed to read MintBurn from world state: %v", err)
+		return err
 	}
 
-	var mintburn MintBurn
-	err = json.Unmarshal(mintburnBytes, &mintburn)
+	// record the decision for the transaction explorer
+	err = recordReceipt(ctx, "order", orderID, fmt.Sprintf("mint order %s of %s rejected: %s", orderID, order.Client, reason))
 	if err != nil {
-		return fmt.Errorf("there are no Burn Orders")
-	}
-
-	mo = mintburn.State[mint_acc]
-
-	if mo.MintBurn != "Mint" {
-		return fmt.Errorf("there are no Mint Orders")
-	} else if mo.State != stateOrder {
-		return fmt.Errorf("mint is not in order stage")
+		return err
 	}
 
-	mo.State = stateRejected
-	mintburn.State[mint_acc] = mo
-
-	upd_mintburnBytes, err := json.Marshal(mintburn)
+	// Emit the MintOrderRejected event
+	meta, err := eventMeta(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get bytes")
+		return err
 	}
-
-	err = ctx.GetStub().PutState(MintBurnKey, upd_mintburnBytes)
-	if err != nil {
-		return fmt.Errorf("failed to update state %v", err)
-	}
-
-	return nil
+	return emitEvent(ctx, "MintOrderRejected", OrderDecisionEvent{EventMeta: meta, OrderID: orderID, Client: order.Client, Amount: order.Amount, Reason: reason})
 }
 
-func (s *SmartContract) RejectBurn(ctx contractapi.TransactionContextInterface, burn_acc string) error {
-	var mo St_am
-	// Check minter authorization - this sample assumes Org1 is the central banker with privilege to mint new tokens
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+func (s *SmartContract) RejectBurn(ctx contractapi.TransactionContextInterface, orderID string, reason string) error {
+	err := requireRole(ctx, roleRegulator)
 	if err != nil {
-		return fmt.Errorf("failed to get MSPID: %v", err)
-	}
-	if clientMSPID != "Org1MSP" {
-		return fmt.Errorf("client is not authorized to get burn orders")
+		return err
 	}
 
-	mintburnBytes, err := ctx.GetStub().GetState(MintBurnKey)
+	order, err := decideOrder(ctx, orderID, "Burn", stateRejected, reason)
 	if err != nil {
-		return fmt.Errorf("failed to read MintBurn from world state: %v", err)
-	}
-
-	var mintburn MintBurn
-	err = json.Unmarshal(mintburnBytes, &mintburn)
-	if err != nil {
-		return fmt.Errorf("there are no Burn Orders")
-	}
-
-	mo = mintburn.State[burn_acc]
-
-	if mo.MintBurn != "Burn" {
-		return fmt.Errorf("there are no Burn Orders")
-	} else if mo.State != stateOrder {
-		return fmt.Errorf("mint is not in order stage")
+		return err
 	}
 
-	mo.State = stateRejected
-	mintburn.State[burn_acc] = mo
-
-	upd_mintburnBytes, err := json.Marshal(mintburn)
+	// record the decision for the transaction explorer
+	err = recordReceipt(ctx, "order", orderID, fmt.Sprintf("burn order %s of %s rejected: %s", orderID, order.Client, reason))
 	if err != nil {
-		return fmt.Errorf("failed to get bytes")
+		return err
 	}
 
-	err = ctx.GetStub().PutState(MintBurnKey, upd_mintburnBytes)
+	// Emit the BurnOrderRejected event
+	meta, err := eventMeta(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to update state %v", err)
+		return err
 	}
-
-	return nil
+	return emitEvent(ctx, "BurnOrderRejected", OrderDecisionEvent{EventMeta: meta, OrderID: orderID, Client: order.Client, Amount: order.Amount, Reason: reason})
 }
 
-//check auction, if open and time is up then close it and end it
+// check auction, if open and time is up then close it and end it
 func (s *SmartContract) CheckAuction(ctx contractapi.TransactionContextInterface, auctionID string) (*Auction, error) {
 	var auctionJSON Auction
-	// Check authorization - this sample assumes Org1 is the central banker with privilege to mint new tokens
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	err := requireRole(ctx, roleRegulator)
 	if err != nil {
-		return &auctionJSON, fmt.Errorf("failed to get MSPID: %v", err)
-	}
-	if clientMSPID != "Org1MSP" {
-		return &auctionJSON, fmt.Errorf("client is not authorized to check auctions")
+		return &auctionJSON, err
 	}
 
 	// get the auction from state
@@ -293,10 +154,13 @@ func (s *SmartContract) CheckAuction(ctx contractapi.TransactionContextInterface
 		return &auctionJSON, fmt.Errorf("auction closed or ended auction")
 	}
 
-	t := int(time.Since(auctionJSON.Time_started).Minutes())
-	if t >= auctionJSON.Time_remaining {
-		_ = CloseAuction(ctx, auctionID)
-		_ = EndAuction(ctx, auctionID)
+	expired, err := auctionExpired(ctx, auctionJSON)
+	if err != nil {
+		return &auctionJSON, err
+	}
+	if expired {
+		_ = closeAuction(ctx, auctionID)
+		_ = endAuction(ctx, auctionID)
 		return &auctionJSON, fmt.Errorf("auction closed and ended")
 	}
 
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// BalanceChange is one entry of an account's balance history
+type BalanceChange struct {
+	TxID      string    `json:"txID"`
+	Timestamp time.Time `json:"timestamp"`
+	Balance   int       `json:"balance"`
+	Delta     int       `json:"delta"`
+	IsDelete  bool      `json:"isDelete"`
+}
+
+// GetAccountHistory returns the chronological list of balance changes of an
+// account with txID, timestamp and delta, so users and auditors can
+// reconstruct how a balance evolved without scraping block events
+func (s *SmartContract) GetAccountHistory(ctx contractapi.TransactionContextInterface, account string) ([]BalanceChange, error) {
+
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history of account %s: %v", account, err)
+	}
+	defer resultsIterator.Close()
+
+	changes := []BalanceChange{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history of account %s: %v", account, err)
+		}
+
+		change := BalanceChange{
+			TxID:      queryResponse.TxId,
+			Timestamp: time.Unix(queryResponse.Timestamp.Seconds, int64(queryResponse.Timestamp.Nanos)),
+			IsDelete:  queryResponse.IsDelete,
+		}
+
+		if !queryResponse.IsDelete {
+			balance, err := strconv.Atoi(string(queryResponse.Value))
+			if err != nil {
+				return nil, fmt.Errorf("key %s does not hold a balance", account)
+			}
+			change.Balance = balance
+		}
+
+		changes = append(changes, change)
+	}
+
+	if len(changes) == 0 {
+		return nil, fmt.Errorf("the account %s does not exist", account)
+	}
+
+	// the iterator returns newest first; reverse into chronological order
+	// and derive the delta of each change from its predecessor
+	for i, j := 0, len(changes)-1; i < j; i, j = i+1, j-1 {
+		changes[i], changes[j] = changes[j], changes[i]
+	}
+
+	for i := range changes {
+		if i == 0 {
+			changes[i].Delta = changes[i].Balance
+		} else {
+			changes[i].Delta = changes[i].Balance - changes[i-1].Balance
+		}
+	}
+
+	return changes, nil
+}
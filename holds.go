@@ -0,0 +1,493 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const holdRecordPrefix = "holdRecord"
+
+// Hold statuses
+const holdActive = "active"
+const holdExecuted = "executed"
+const holdReleased = "released"
+const holdExpired = "expired"
+
+// Hold is an individual hold record keyed by (holder, holdID). Unlike the
+// old aggregate hold integer, holds on different auctions no longer clobber
+// each other and execution can tell which hold belongs to which purpose
+type Hold struct {
+	ID      string    `json:"id"`
+	Holder  string    `json:"holder"`
+	Amount  int       `json:"amount"`
+	Purpose string    `json:"purpose"`
+	Expiry  time.Time `json:"expiry"`
+	Status  string    `json:"status"`
+}
+
+// CreateHoldByID places a hold with its own ID, purpose and expiry (in
+// minutes) on the submitting client's balance
+func (s *SmartContract) CreateHoldByID(ctx contractapi.TransactionContextInterface, holdID string, amount int, purpose string, expiry_min int) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	return createHoldRecord(ctx, clientID, holdID, amount, purpose, expiry_min)
+}
+
+// ExecuteHoldByID pays the submitting client part or all of a hold. A partial
+// execution leaves the remainder on the hold; executing the full remaining
+// amount completes it
+func (s *SmartContract) ExecuteHoldByID(ctx contractapi.TransactionContextInterface, holder string, holdID string, amount int) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	return executeHoldRecord(ctx, clientID, holder, holdID, amount)
+}
+
+// ReleaseHoldByID gives the remaining held amount back to the holder. The
+// holder can always release their own hold
+func (s *SmartContract) ReleaseHoldByID(ctx contractapi.TransactionContextInterface, holdID string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	return releaseHoldRecord(ctx, clientID, holdID, holdReleased)
+}
+
+// SweepExpiredHolds releases all expired holds of a holder back to their
+// balance. Anyone may run the sweep since it only returns funds to the owner
+func (s *SmartContract) SweepExpiredHolds(ctx contractapi.TransactionContextInterface, holder string) (int, error) {
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get timestamp")
+	}
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(holdRecordPrefix, []string{holder})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read holds from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	// expired holds are marked as they are found and their amounts summed
+	// up in memory; releasing each one separately would re-read a balance
+	// the previous release has not committed yet and lose all but the last
+	// refund
+	swept := 0
+	total := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read holds from world state: %v", err)
+		}
+
+		var hold Hold
+		err = json.Unmarshal(queryResponse.Value, &hold)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create hold object JSON: %v", err)
+		}
+
+		if hold.Status != holdActive || !now.After(hold.Expiry) {
+			continue
+		}
+
+		total += hold.Amount
+		hold.Amount = 0
+		hold.Status = holdExpired
+
+		err = putHoldRecord(ctx, queryResponse.Key, &hold)
+		if err != nil {
+			return 0, err
+		}
+
+		err = notifyAccount(ctx, holder, noticeHoldExpiring, fmt.Sprintf("hold %s expired and was released", hold.ID))
+		if err != nil {
+			return 0, err
+		}
+		swept++
+	}
+
+	// the holder's balance and the aggregate hold total move once, by the
+	// combined amount of every hold swept above
+	if total > 0 {
+		currentBalanceBytes, err := getBalanceBytes(ctx, holder)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read client's account %s from world state: %v", holder, err)
+		}
+		if currentBalanceBytes == nil {
+			return 0, fmt.Errorf("the balance does not exist")
+		}
+
+		currentBalance, _ := strconv.Atoi(string(currentBalanceBytes))
+
+		err = putBalanceBytes(ctx, holder, []byte(strconv.Itoa(currentBalance+total)))
+		if err != nil {
+			return 0, fmt.Errorf("failed to update state of smart contract for key %s: %v", holder, err)
+		}
+
+		err = bumpAggregateHold(ctx, holder, -total)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return swept, nil
+}
+
+// GetHold returns one hold record of a holder
+func (s *SmartContract) GetHold(ctx contractapi.TransactionContextInterface, holder string, holdID string) (*Hold, error) {
+	hold, _, err := getHoldRecord(ctx, holder, holdID)
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// createHoldRecord moves an amount from the holder's balance onto a new hold
+// record and keeps the aggregate hold total in sync for GetAccount
+func createHoldRecord(ctx contractapi.TransactionContextInterface, holder string, holdID string, amount int, purpose string, expiry_min int) error {
+
+	if amount <= 0 {
+		return fmt.Errorf("hold amount must be a positive integer")
+	}
+
+	if expiry_min <= 0 {
+		return fmt.Errorf("hold expiry must be a positive integer")
+	}
+
+	holdKey, err := ctx.GetStub().CreateCompositeKey(holdRecordPrefix, []string{holder, holdID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", holdRecordPrefix, err)
+	}
+
+	holdBytes, err := ctx.GetStub().GetState(holdKey)
+	if err != nil {
+		return fmt.Errorf("failed to read hold from world state: %v", err)
+	}
+	if holdBytes != nil {
+		return fmt.Errorf("hold %v already exists for holder %v", holdID, holder)
+	}
+
+	currentBalanceBytes, err := getBalanceBytes(ctx, holder)
+	if err != nil {
+		return fmt.Errorf("failed to read client's account %s from world state: %v", holder, err)
+	}
+	if currentBalanceBytes == nil {
+		return fmt.Errorf("the balance does not exist")
+	}
+
+	currentBalance, _ := strconv.Atoi(string(currentBalanceBytes))
+	if currentBalance < amount {
+		return fmt.Errorf("client account %s has insufficient funds", holder)
+	}
+
+	err = putBalanceBytes(ctx, holder, []byte(strconv.Itoa(currentBalance-amount)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", holder, err)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	hold := Hold{
+		ID:      holdID,
+		Holder:  holder,
+		Amount:  amount,
+		Purpose: purpose,
+		Expiry:  time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).Add(time.Duration(expiry_min) * time.Minute),
+		Status:  holdActive,
+	}
+
+	err = putHoldRecord(ctx, holdKey, &hold)
+	if err != nil {
+		return err
+	}
+
+	err = bumpAggregateHold(ctx, holder, amount)
+	if err != nil {
+		return err
+	}
+
+	// Emit the HoldCreated event
+	meta, err := eventMeta(ctx)
+	if err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, "HoldCreated", HoldCreatedEvent{EventMeta: meta, Holder: holder, Amount: amount})
+}
+
+// executeHoldRecord pays the payee part or all of a hold
+func executeHoldRecord(ctx contractapi.TransactionContextInterface, payee string, holder string, holdID string, amount int) error {
+
+	if amount <= 0 {
+		return fmt.Errorf("hold amount must be a positive integer")
+	}
+
+	hold, holdKey, err := getHoldRecord(ctx, holder, holdID)
+	if err != nil {
+		return err
+	}
+
+	if hold.Status != holdActive {
+		return fmt.Errorf("hold %v is not active", holdID)
+	}
+
+	if hold.Amount < amount {
+		return fmt.Errorf("hold %v only has %d left", holdID, hold.Amount)
+	}
+
+	payeeBalanceBytes, err := getBalanceBytes(ctx, payee)
+	if err != nil {
+		return fmt.Errorf("failed to read client's account %s from world state: %v", payee, err)
+	}
+	if payeeBalanceBytes == nil {
+		return fmt.Errorf("the balance does not exist")
+	}
+
+	payeeBalance, _ := strconv.Atoi(string(payeeBalanceBytes))
+
+	err = putBalanceBytes(ctx, payee, []byte(strconv.Itoa(payeeBalance+amount)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", payee, err)
+	}
+
+	hold.Amount -= amount
+	if hold.Amount == 0 {
+		hold.Status = holdExecuted
+	}
+
+	err = putHoldRecord(ctx, holdKey, hold)
+	if err != nil {
+		return err
+	}
+
+	return bumpAggregateHold(ctx, holder, -amount)
+}
+
+// consumeHoldRecord takes part of a hold out of circulation without paying a
+// payee, for funds that move onto an escrow record instead of to an account.
+// Whatever the hold carried beyond the consumed amount — the gap to the
+// second price in a Vickrey auction — goes straight back to the holder and
+// the hold completes, all against the one record read here: a separate
+// release afterwards would re-read the hold as still active and refund the
+// holder in full
+func consumeHoldRecord(ctx contractapi.TransactionContextInterface, holder string, holdID string, amount int) error {
+
+	if amount <= 0 {
+		return fmt.Errorf("hold amount must be a positive integer")
+	}
+
+	hold, holdKey, err := getHoldRecord(ctx, holder, holdID)
+	if err != nil {
+		return err
+	}
+
+	if hold.Status != holdActive {
+		return fmt.Errorf("hold %v is not active", holdID)
+	}
+
+	if hold.Amount < amount {
+		return fmt.Errorf("hold %v only has %d left", holdID, hold.Amount)
+	}
+
+	remainder := hold.Amount - amount
+	if remainder > 0 {
+		currentBalanceBytes, err := getBalanceBytes(ctx, holder)
+		if err != nil {
+			return fmt.Errorf("failed to read client's account %s from world state: %v", holder, err)
+		}
+		if currentBalanceBytes == nil {
+			return fmt.Errorf("the balance does not exist")
+		}
+
+		currentBalance, _ := strconv.Atoi(string(currentBalanceBytes))
+
+		err = putBalanceBytes(ctx, holder, []byte(strconv.Itoa(currentBalance+remainder)))
+		if err != nil {
+			return fmt.Errorf("failed to update state of smart contract for key %s: %v", holder, err)
+		}
+	}
+
+	released := hold.Amount
+	hold.Amount = 0
+	hold.Status = holdExecuted
+
+	err = putHoldRecord(ctx, holdKey, hold)
+	if err != nil {
+		return err
+	}
+
+	return bumpAggregateHold(ctx, holder, -released)
+}
+
+// releaseActiveHolds returns every active hold of a holder to their balance:
+// first the ID-keyed records, then any residual legacy aggregate hold that
+// predates them. Account closure and regulator interventions use it to clear
+// all open obligations at once
+func releaseActiveHolds(ctx contractapi.TransactionContextInterface, holder string) error {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(holdRecordPrefix, []string{holder})
+	if err != nil {
+		return fmt.Errorf("failed to read holds from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return fmt.Errorf("failed to read holds from world state: %v", err)
+		}
+
+		var hold Hold
+		err = json.Unmarshal(queryResponse.Value, &hold)
+		if err != nil {
+			return fmt.Errorf("failed to create hold object JSON: %v", err)
+		}
+
+		if hold.Status != holdActive {
+			continue
+		}
+
+		err = releaseHoldRecord(ctx, holder, hold.ID, holdReleased)
+		if err != nil {
+			return err
+		}
+	}
+
+	// a legacy aggregate hold without records still returns through the old path
+	holdkey, err := ctx.GetStub().CreateCompositeKey(holdPrefix, []string{holder})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", holdPrefix, err)
+	}
+
+	holdBytes, err := ctx.GetStub().GetState(holdkey)
+	if err != nil {
+		return fmt.Errorf("failed to read hold from world state: %v", err)
+	}
+	if residual, _ := strconv.Atoi(string(holdBytes)); holdBytes != nil && residual > 0 {
+		return returnHold(ctx, holder)
+	}
+
+	return nil
+}
+
+// releaseHoldRecord gives the remaining held amount back to the holder
+func releaseHoldRecord(ctx contractapi.TransactionContextInterface, holder string, holdID string, status string) error {
+
+	hold, holdKey, err := getHoldRecord(ctx, holder, holdID)
+	if err != nil {
+		return err
+	}
+
+	if hold.Status != holdActive {
+		return fmt.Errorf("hold %v is not active", holdID)
+	}
+
+	currentBalanceBytes, err := getBalanceBytes(ctx, holder)
+	if err != nil {
+		return fmt.Errorf("failed to read client's account %s from world state: %v", holder, err)
+	}
+	if currentBalanceBytes == nil {
+		return fmt.Errorf("the balance does not exist")
+	}
+
+	currentBalance, _ := strconv.Atoi(string(currentBalanceBytes))
+
+	err = putBalanceBytes(ctx, holder, []byte(strconv.Itoa(currentBalance+hold.Amount)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", holder, err)
+	}
+
+	released := hold.Amount
+	hold.Amount = 0
+	hold.Status = status
+
+	err = putHoldRecord(ctx, holdKey, hold)
+	if err != nil {
+		return err
+	}
+
+	return bumpAggregateHold(ctx, holder, -released)
+}
+
+// bumpAggregateHold keeps the old aggregate hold integer in sync so
+// GetAccount still reports the total amount on hold
+func bumpAggregateHold(ctx contractapi.TransactionContextInterface, holder string, delta int) error {
+
+	holdkey, err := ctx.GetStub().CreateCompositeKey(holdPrefix, []string{holder})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", holdPrefix, err)
+	}
+
+	holdBytes, _ := ctx.GetStub().GetState(holdkey)
+
+	var hold_amount int
+	if holdBytes != nil {
+		hold_amount, _ = strconv.Atoi(string(holdBytes))
+	}
+	hold_amount += delta
+
+	err = ctx.GetStub().PutState(holdkey, []byte(strconv.Itoa(hold_amount)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", holdkey, err)
+	}
+
+	return nil
+}
+
+// getHoldRecord is an internal helper that reads a hold together with its key
+func getHoldRecord(ctx contractapi.TransactionContextInterface, holder string, holdID string) (*Hold, string, error) {
+
+	holdKey, err := ctx.GetStub().CreateCompositeKey(holdRecordPrefix, []string{holder, holdID})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create the composite key for prefix %s: %v", holdRecordPrefix, err)
+	}
+
+	holdBytes, err := ctx.GetStub().GetState(holdKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read hold from world state: %v", err)
+	}
+	if holdBytes == nil {
+		return nil, "", fmt.Errorf("hold %v does not exist for holder %v", holdID, holder)
+	}
+
+	var hold Hold
+	err = json.Unmarshal(holdBytes, &hold)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create hold object JSON: %v", err)
+	}
+
+	return &hold, holdKey, nil
+}
+
+// putHoldRecord is an internal helper that writes a hold record to state
+func putHoldRecord(ctx contractapi.TransactionContextInterface, holdKey string, hold *Hold) error {
+	holdBytes, err := marshalCanonical(hold)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(holdKey, holdBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", holdKey, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"runtime"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// chaincodeVersion is the semantic version of this chaincode build
+const chaincodeVersion = "1.1.0"
+
+// schemaVersion is bumped whenever the shape of stored state changes
+const schemaVersion = "1"
+
+// Info describes the deployed chaincode so operators and clients can verify
+// which capabilities a channel deployment supports before invoking them
+type Info struct {
+	Version       string   `json:"version"`
+	SchemaVersion string   `json:"schemaVersion"`
+	Features      []string `json:"features"`
+	GoVersion     string   `json:"goVersion"`
+}
+
+// Ping is a cheap liveness check for operators
+func (s *SmartContract) Ping(ctx contractapi.TransactionContextInterface) (string, error) {
+	return "pong", nil
+}
+
+// Info returns the chaincode version, schema version and enabled features
+func (s *SmartContract) Info(ctx contractapi.TransactionContextInterface) (*Info, error) {
+	info := Info{
+		Version:       chaincodeVersion,
+		SchemaVersion: schemaVersion,
+		Features: []string{
+			"token",
+			"auction",
+			"gov",
+			"bid-bonds",
+			"pseudonymous-auctions",
+			"consent",
+			"erasure",
+		},
+		GoVersion: runtime.Version(),
+	}
+
+	return &info, nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const interventionPrefix = "intervention"
+
+// Intervention actions
+const actionReleaseHold = "release-hold"
+const actionCancelOrder = "cancel-order"
+const actionEndAuction = "end-auction"
+
+// Intervention is a pending operator intervention. Every forced action needs
+// a case reference and approval by a second admin before it can run, so a
+// single operator can never rewrite a stuck workflow alone
+type Intervention struct {
+	CaseRef  string `json:"caseRef"`
+	Action   string `json:"action"`
+	Target   string `json:"target"`
+	Approver string `json:"approver"`
+}
+
+// interventionEvent is the audit payload emitted for every executed
+// intervention
+type interventionEvent struct {
+	CaseRef  string `json:"caseRef"`
+	Action   string `json:"action"`
+	Target   string `json:"target"`
+	Approver string `json:"approver"`
+	Executor string `json:"executor"`
+}
+
+// ApproveIntervention records a second admin's approval of a forced action
+// against a target, under a case reference. The approver cannot execute the
+// intervention themselves
+func (s *SmartContract) ApproveIntervention(ctx contractapi.TransactionContextInterface, caseRef string, action string, target string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if caseRef == "" {
+		return fmt.Errorf("a case reference is required")
+	}
+
+	if action != actionReleaseHold && action != actionCancelOrder && action != actionEndAuction {
+		return fmt.Errorf("unknown intervention action %v", action)
+	}
+
+	intervention := Intervention{
+		CaseRef:  caseRef,
+		Action:   action,
+		Target:   target,
+		Approver: clientID,
+	}
+
+	interventionBytes, err := marshalCanonical(intervention)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	interventionKey, err := ctx.GetStub().CreateCompositeKey(interventionPrefix, []string{caseRef})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", interventionPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(interventionKey, interventionBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", interventionKey, err)
+	}
+
+	return nil
+}
+
+// ForceReleaseHold returns every stuck hold of a holder under an approved case
+func (s *SmartContract) ForceReleaseHold(ctx contractapi.TransactionContextInterface, caseRef string, holder string) error {
+
+	err := consumeIntervention(ctx, caseRef, actionReleaseHold, holder)
+	if err != nil {
+		return err
+	}
+
+	err = releaseActiveHolds(ctx, holder)
+	if err != nil {
+		return fmt.Errorf("cannot return holds: %v", err)
+	}
+
+	return nil
+}
+
+// ForceCancelOrder rejects a stuck mint or burn order under an approved case
+func (s *SmartContract) ForceCancelOrder(ctx contractapi.TransactionContextInterface, caseRef string, orderID string) error {
+
+	err := consumeIntervention(ctx, caseRef, actionCancelOrder, orderID)
+	if err != nil {
+		return err
+	}
+
+	order, err := getOrder(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	if order.State != stateOrder && order.State != stateApproved {
+		return fmt.Errorf("order %v is already decided", orderID)
+	}
+
+	order.State = stateRejected
+
+	return putOrder(ctx, order)
+}
+
+// ForceEndAuction ends a stuck auction under an approved case and settles the
+// held funds
+func (s *SmartContract) ForceEndAuction(ctx contractapi.TransactionContextInterface, caseRef string, auctionID string) error {
+
+	err := consumeIntervention(ctx, caseRef, actionEndAuction, auctionID)
+	if err != nil {
+		return err
+	}
+
+	auctionBytes, err := ctx.GetStub().GetState(auctionID)
+	if err != nil {
+		return fmt.Errorf("failed to get auction %v: %v", auctionID, err)
+	}
+	if auctionBytes == nil {
+		return fmt.Errorf("auction %v does not exist", auctionID)
+	}
+
+	var auctionJSON Auction
+	err = json.Unmarshal(auctionBytes, &auctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to create auction object JSON: %v", err)
+	}
+
+	if auctionJSON.Status == "ended" {
+		return fmt.Errorf("auction is already ended")
+	}
+
+	auctionJSON.Status = "ended"
+
+	endedAuction, err := marshalCanonical(auctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(auctionID, endedAuction)
+	if err != nil {
+		return fmt.Errorf("failed to end auction: %v", err)
+	}
+
+	err = settleAuction(ctx, auctionJSON, auctionID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// consumeIntervention verifies and consumes the approval of a forced action:
+// the executor must hold the regulator role, must not be the approver, and
+// the recorded action and target must match. A prominent audit event is
+// emitted before the approval is deleted
+func consumeIntervention(ctx contractapi.TransactionContextInterface, caseRef string, action string, target string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	interventionKey, err := ctx.GetStub().CreateCompositeKey(interventionPrefix, []string{caseRef})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", interventionPrefix, err)
+	}
+
+	interventionBytes, err := ctx.GetStub().GetState(interventionKey)
+	if err != nil {
+		return fmt.Errorf("failed to read intervention from world state: %v", err)
+	}
+	if interventionBytes == nil {
+		return fmt.Errorf("case %v has no approved intervention", caseRef)
+	}
+
+	var intervention Intervention
+	err = json.Unmarshal(interventionBytes, &intervention)
+	if err != nil {
+		return fmt.Errorf("failed to create intervention object JSON: %v", err)
+	}
+
+	if intervention.Action != action || intervention.Target != target {
+		return fmt.Errorf("case %v approves a different action or target", caseRef)
+	}
+
+	if intervention.Approver == clientID {
+		return fmt.Errorf("intervention must be executed by a different admin than the approver")
+	}
+
+	audit := interventionEvent{
+		CaseRef:  caseRef,
+		Action:   action,
+		Target:   target,
+		Approver: intervention.Approver,
+		Executor: clientID,
+	}
+
+	auditJSON, err := json.Marshal(audit)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("Intervention", auditJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	// approvals are one-shot; delete so the case cannot be replayed
+	err = ctx.GetStub().DelState(interventionKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete intervention: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const islandPrefix = "island"
+const islandMemberPrefix = "islandMember"
+
+// Island statuses
+const islandActive = "islanded"
+const islandReconnected = "reconnected"
+
+// Island is a DSO-declared islanding event for a microgrid. While the island
+// is active only intra-island trades settle and grid fees are suspended; the
+// recorded trades reconcile with the main market at reconnection
+type Island struct {
+	ID            string        `json:"id"`
+	Members       []string      `json:"members"`
+	Status        string        `json:"status"`
+	DeclaredAt    time.Time     `json:"declaredAt"`
+	ReconnectedAt time.Time     `json:"reconnectedAt"`
+	Trades        []IslandTrade `json:"trades"`
+}
+
+// IslandTrade is one trade settled while the island was active
+type IslandTrade struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Amount int    `json:"amount"`
+	TxID   string `json:"txID"`
+}
+
+// DeclareIslanding is used by the DSO to declare that a microgrid has
+// islanded. The affected participants are passed as a JSON array and switch
+// into islanding accounting mode
+func (s *SmartContract) DeclareIslanding(ctx contractapi.TransactionContextInterface, islandID string, membersJSON string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	var members []string
+	err = json.Unmarshal([]byte(membersJSON), &members)
+	if err != nil {
+		return fmt.Errorf("failed to create members object JSON: %v", err)
+	}
+
+	if len(members) == 0 {
+		return fmt.Errorf("an island needs at least one member")
+	}
+
+	islandKey, err := ctx.GetStub().CreateCompositeKey(islandPrefix, []string{islandID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", islandPrefix, err)
+	}
+
+	islandBytes, err := ctx.GetStub().GetState(islandKey)
+	if err != nil {
+		return fmt.Errorf("failed to read island from world state: %v", err)
+	}
+	if islandBytes != nil {
+		return fmt.Errorf("island %v has already been declared", islandID)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	island := Island{
+		ID:         islandID,
+		Members:    members,
+		Status:     islandActive,
+		DeclaredAt: time.Unix(timestamp.Seconds, int64(timestamp.Nanos)),
+		Trades:     []IslandTrade{},
+	}
+
+	err = putIsland(ctx, islandKey, &island)
+	if err != nil {
+		return err
+	}
+
+	// flag every member so transfers can resolve their island quickly
+	for _, member := range members {
+		memberKey, err := ctx.GetStub().CreateCompositeKey(islandMemberPrefix, []string{member})
+		if err != nil {
+			return fmt.Errorf("failed to create the composite key for prefix %s: %v", islandMemberPrefix, err)
+		}
+
+		err = ctx.GetStub().PutState(memberKey, []byte(islandID))
+		if err != nil {
+			return fmt.Errorf("failed to update state of smart contract for key %s: %v", memberKey, err)
+		}
+	}
+
+	return nil
+}
+
+// DeclareReconnection is used by the DSO to declare that an island has been
+// reconnected. The members return to normal accounting and the recorded
+// trades remain on the island for reconciliation with the main market
+func (s *SmartContract) DeclareReconnection(ctx contractapi.TransactionContextInterface, islandID string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	island, islandKey, err := getIsland(ctx, islandID)
+	if err != nil {
+		return err
+	}
+
+	if island.Status != islandActive {
+		return fmt.Errorf("island %v is not active", islandID)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	island.Status = islandReconnected
+	island.ReconnectedAt = time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	err = putIsland(ctx, islandKey, island)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range island.Members {
+		memberKey, err := ctx.GetStub().CreateCompositeKey(islandMemberPrefix, []string{member})
+		if err != nil {
+			return fmt.Errorf("failed to create the composite key for prefix %s: %v", islandMemberPrefix, err)
+		}
+
+		err = ctx.GetStub().DelState(memberKey)
+		if err != nil {
+			return fmt.Errorf("failed to delete island member flag: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// GetIsland returns an island with its recorded trades, for reconciliation
+// with the main market after reconnection
+func (s *SmartContract) GetIsland(ctx contractapi.TransactionContextInterface, islandID string) (*Island, error) {
+	island, _, err := getIsland(ctx, islandID)
+	if err != nil {
+		return nil, err
+	}
+	return island, nil
+}
+
+// checkIslandTransfer verifies that a transfer is allowed under islanding
+// rules: while a participant is islanded only intra-island trades settle.
+// It records the trade on the island so it can be reconciled later
+func checkIslandTransfer(ctx contractapi.TransactionContextInterface, from string, to string, amount int) error {
+
+	fromIsland, err := memberIsland(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	toIsland, err := memberIsland(ctx, to)
+	if err != nil {
+		return err
+	}
+
+	if fromIsland == "" && toIsland == "" {
+		return nil
+	}
+
+	if fromIsland != toIsland {
+		return fmt.Errorf("only intra-island trades settle while a participant is islanded")
+	}
+
+	island, islandKey, err := getIsland(ctx, fromIsland)
+	if err != nil {
+		return err
+	}
+
+	island.Trades = append(island.Trades, IslandTrade{
+		From:   from,
+		To:     to,
+		Amount: amount,
+		TxID:   ctx.GetStub().GetTxID(),
+	})
+
+	return putIsland(ctx, islandKey, island)
+}
+
+// memberIsland is an internal helper that returns the active island of a
+// participant, or "" when they are not islanded
+func memberIsland(ctx contractapi.TransactionContextInterface, member string) (string, error) {
+
+	memberKey, err := ctx.GetStub().CreateCompositeKey(islandMemberPrefix, []string{member})
+	if err != nil {
+		return "", fmt.Errorf("failed to create the composite key for prefix %s: %v", islandMemberPrefix, err)
+	}
+
+	islandBytes, err := ctx.GetStub().GetState(memberKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read island member flag from world state: %v", err)
+	}
+	if islandBytes == nil {
+		return "", nil
+	}
+
+	return string(islandBytes), nil
+}
+
+// getIsland is an internal helper that reads an island together with its key
+func getIsland(ctx contractapi.TransactionContextInterface, islandID string) (*Island, string, error) {
+
+	islandKey, err := ctx.GetStub().CreateCompositeKey(islandPrefix, []string{islandID})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create the composite key for prefix %s: %v", islandPrefix, err)
+	}
+
+	islandBytes, err := ctx.GetStub().GetState(islandKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read island from world state: %v", err)
+	}
+	if islandBytes == nil {
+		return nil, "", fmt.Errorf("island %v does not exist", islandID)
+	}
+
+	var island Island
+	err = json.Unmarshal(islandBytes, &island)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create island object JSON: %v", err)
+	}
+
+	return &island, islandKey, nil
+}
+
+// putIsland is an internal helper that writes an island to state
+func putIsland(ctx contractapi.TransactionContextInterface, islandKey string, island *Island) error {
+	islandBytes, err := marshalCanonical(island)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(islandKey, islandBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", islandKey, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const accountLimitsPrefix = "accountLimits"
+const outflowWindowPrefix = "outflowWindow"
+
+// length of the rolling outflow window in minutes
+const outflowWindowMin = 1440
+
+// AccountLimits are the regulator-configured spending limits of one account:
+// a cap on the size of a single transfer and a cap on the total outflow
+// within the rolling daily window. A zero field means that limit is not
+// enforced. E-money regulation requires both controls on retail accounts
+type AccountLimits struct {
+	Account         string `json:"account"`
+	MaxTransfer     int    `json:"maxTransfer"`
+	MaxDailyOutflow int    `json:"maxDailyOutflow"`
+}
+
+// OutflowWindow tracks how much an account has paid out since the window
+// started. The window resets once it is older than a day, so the counter
+// rolls instead of growing forever
+type OutflowWindow struct {
+	Account     string    `json:"account"`
+	WindowStart time.Time `json:"windowStart"`
+	Outflow     int       `json:"outflow"`
+}
+
+// SetAccountLimits configures the spending limits of an account. Only the
+// regulator sets limits; setting both to zero disables them
+func (s *SmartContract) SetAccountLimits(ctx contractapi.TransactionContextInterface, account string, maxTransfer int, maxDailyOutflow int) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if maxTransfer < 0 || maxDailyOutflow < 0 {
+		return fmt.Errorf("limits cannot be negative")
+	}
+
+	limits := AccountLimits{
+		Account:         account,
+		MaxTransfer:     maxTransfer,
+		MaxDailyOutflow: maxDailyOutflow,
+	}
+
+	limitsBytes, err := marshalCanonical(limits)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	limitsKey, err := ctx.GetStub().CreateCompositeKey(accountLimitsPrefix, []string{account})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", accountLimitsPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(limitsKey, limitsBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", limitsKey, err)
+	}
+
+	return recordReceipt(ctx, accountLimitsPrefix, account, fmt.Sprintf("limits of %s set to %d per transfer and %d per day", account, maxTransfer, maxDailyOutflow))
+}
+
+// GetAccountLimits returns the configured limits of an account
+func (s *SmartContract) GetAccountLimits(ctx contractapi.TransactionContextInterface, account string) (*AccountLimits, error) {
+
+	limits, err := getAccountLimits(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	if limits == nil {
+		return nil, fmt.Errorf("no limits configured for account %v", account)
+	}
+
+	return limits, nil
+}
+
+// validateSpendingLimits is an internal helper that enforces an account's
+// configured limits on an outgoing payment without writing anything. It
+// returns the key and encoding of the rolled-forward outflow window for the
+// caller to write once the rest of the payment has validated, so a payment
+// refused later on leaves no partial writes behind. An empty key means there
+// is no window to update
+func validateSpendingLimits(ctx contractapi.TransactionContextInterface, account string, value int) (string, []byte, error) {
+
+	limits, err := getAccountLimits(ctx, account)
+	if err != nil {
+		return "", nil, err
+	}
+	if limits == nil {
+		return "", nil, nil
+	}
+
+	if limits.MaxTransfer > 0 && value > limits.MaxTransfer {
+		return "", nil, fmt.Errorf("transfer of %d exceeds the per-transfer limit of %d for account %s", value, limits.MaxTransfer, account)
+	}
+
+	if limits.MaxDailyOutflow == 0 {
+		return "", nil, nil
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get timestamp")
+	}
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	windowKey, err := ctx.GetStub().CreateCompositeKey(outflowWindowPrefix, []string{account})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", outflowWindowPrefix, err)
+	}
+
+	windowBytes, err := ctx.GetStub().GetState(windowKey)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read outflow window from world state: %v", err)
+	}
+
+	window := OutflowWindow{Account: account, WindowStart: now}
+	if windowBytes != nil {
+		err = json.Unmarshal(windowBytes, &window)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to create outflow window object JSON: %v", err)
+		}
+	}
+
+	// an aged-out window starts over at the current payment
+	if now.Sub(window.WindowStart) >= outflowWindowMin*time.Minute {
+		window.WindowStart = now
+		window.Outflow = 0
+	}
+
+	if window.Outflow+value > limits.MaxDailyOutflow {
+		return "", nil, fmt.Errorf("transfer of %d would exceed the daily outflow limit of %d for account %s, %d already paid out in the window", value, limits.MaxDailyOutflow, account, window.Outflow)
+	}
+
+	window.Outflow += value
+
+	windowBytes, err = marshalCanonical(window)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	return windowKey, windowBytes, nil
+}
+
+// checkSpendingLimits is an internal helper that enforces an account's
+// configured limits on an outgoing payment and rolls the amount into the
+// outflow window. With no limits configured it is a no-op
+func checkSpendingLimits(ctx contractapi.TransactionContextInterface, account string, value int) error {
+
+	windowKey, windowBytes, err := validateSpendingLimits(ctx, account, value)
+	if err != nil {
+		return err
+	}
+	if windowKey == "" {
+		return nil
+	}
+
+	err = ctx.GetStub().PutState(windowKey, windowBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", windowKey, err)
+	}
+
+	return nil
+}
+
+// getAccountLimits is an internal helper; a nil result without error means
+// no limits are configured for the account
+func getAccountLimits(ctx contractapi.TransactionContextInterface, account string) (*AccountLimits, error) {
+
+	limitsKey, err := ctx.GetStub().CreateCompositeKey(accountLimitsPrefix, []string{account})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", accountLimitsPrefix, err)
+	}
+
+	limitsBytes, err := ctx.GetStub().GetState(limitsKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account limits from world state: %v", err)
+	}
+	if limitsBytes == nil {
+		return nil, nil
+	}
+
+	var limits AccountLimits
+	err = json.Unmarshal(limitsBytes, &limits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create account limits object JSON: %v", err)
+	}
+
+	return &limits, nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const priorityPrefix = "priority"
+const sheddingPrefix = "shedding"
+
+// Priority classes of connection points, from most protected to least.
+// Hospitals shed last, standard residential connections shed first
+const classHospital = "hospital"
+const classCritical = "critical"
+const classStandard = "standard"
+
+// name of the governed tariff that sets the compensation per kW shed for
+// standard participants
+const sheddingCompensationTariff = "sheddingCompensation"
+
+// PriorityRecord classifies one connection point for emergency load shedding
+type PriorityRecord struct {
+	Point  string `json:"point"`
+	Class  string `json:"class"`
+	LoadKW int    `json:"loadKW"`
+}
+
+// SheddingEntry is one connection point of a shedding plan in shedding order
+type SheddingEntry struct {
+	Point        string `json:"point"`
+	Class        string `json:"class"`
+	LoadKW       int    `json:"loadKW"`
+	Compensation int    `json:"compensation"`
+}
+
+// SheddingPlan is the recorded shedding order computed for one emergency
+type SheddingPlan struct {
+	ID         string          `json:"id"`
+	RequiredKW int             `json:"requiredKW"`
+	ShedKW     int             `json:"shedKW"`
+	Order      []SheddingEntry `json:"order"`
+	CreatedAt  time.Time       `json:"createdAt"`
+}
+
+// SetPriority classifies a connection point for emergency load shedding.
+// Only the DSO maintains the registry
+func (s *SmartContract) SetPriority(ctx contractapi.TransactionContextInterface, point string, class string, loadKW int) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if class != classHospital && class != classCritical && class != classStandard {
+		return fmt.Errorf("unknown priority class %v", class)
+	}
+	if loadKW <= 0 {
+		return fmt.Errorf("connection point load must be a positive integer")
+	}
+
+	record := PriorityRecord{
+		Point:  point,
+		Class:  class,
+		LoadKW: loadKW,
+	}
+
+	recordBytes, err := marshalCanonical(record)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	priorityKey, err := ctx.GetStub().CreateCompositeKey(priorityPrefix, []string{point})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", priorityPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(priorityKey, recordBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", priorityKey, err)
+	}
+
+	return nil
+}
+
+// OrderShedding computes and records the shedding order for an emergency
+// requiring the given load reduction. Standard connections shed first, then
+// critical infrastructure; hospitals shed last and only if unavoidable.
+// Within a class, points shed in lexicographic order so every endorser
+// computes the same plan. Standard participants are compensated per the
+// governed shedding tariff. Only the DSO may order shedding
+func (s *SmartContract) OrderShedding(ctx contractapi.TransactionContextInterface, requiredKW int) (*SheddingPlan, error) {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return nil, err
+	}
+
+	if requiredKW <= 0 {
+		return nil, fmt.Errorf("required load reduction must be a positive integer")
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(priorityPrefix, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read priority registry from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	records := []PriorityRecord{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read priority registry from world state: %v", err)
+		}
+
+		var record PriorityRecord
+		err = json.Unmarshal(queryResponse.Value, &record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create priority record object JSON: %v", err)
+		}
+		records = append(records, record)
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("no connection points are classified")
+	}
+
+	// shed standard first, then critical, then hospitals; lexicographic by
+	// point within a class keeps the plan deterministic across endorsers
+	rank := map[string]int{classStandard: 0, classCritical: 1, classHospital: 2}
+	sort.Slice(records, func(i, j int) bool {
+		if rank[records[i].Class] != rank[records[j].Class] {
+			return rank[records[i].Class] < rank[records[j].Class]
+		}
+		return records[i].Point < records[j].Point
+	})
+
+	// the compensation tariff may not be scheduled yet; shedding must not
+	// fail on that, standard participants then get a zero entry to settle
+	// later
+	compensationPerKW := 0
+	if tariff, err := currentTariff(ctx, sheddingCompensationTariff); err == nil {
+		compensationPerKW = tariff
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timestamp")
+	}
+
+	plan := SheddingPlan{
+		ID:         ctx.GetStub().GetTxID(),
+		RequiredKW: requiredKW,
+		Order:      []SheddingEntry{},
+		CreatedAt:  time.Unix(timestamp.Seconds, int64(timestamp.Nanos)),
+	}
+
+	for _, record := range records {
+		if plan.ShedKW >= requiredKW {
+			break
+		}
+
+		entry := SheddingEntry{
+			Point:  record.Point,
+			Class:  record.Class,
+			LoadKW: record.LoadKW,
+		}
+		if record.Class == classStandard {
+			entry.Compensation = record.LoadKW * compensationPerKW
+		}
+
+		plan.Order = append(plan.Order, entry)
+		plan.ShedKW += record.LoadKW
+
+		// credit the compensation if the point has a token account
+		if entry.Compensation > 0 {
+			balanceBytes, err := getBalanceBytes(ctx, record.Point)
+			if err == nil && balanceBytes != nil {
+				balance, err := parseBalance(balanceBytes)
+				if err != nil {
+					return nil, err
+				}
+				err = putBalanceBytes(ctx, record.Point, formatBalance(addBalance(balance, entry.Compensation)))
+				if err != nil {
+					return nil, fmt.Errorf("failed to update state of smart contract for key %s: %v", record.Point, err)
+				}
+			}
+		}
+	}
+
+	if plan.ShedKW < requiredKW {
+		return nil, fmt.Errorf("classified connection points only cover %d of the required %d kW", plan.ShedKW, requiredKW)
+	}
+
+	planBytes, err := marshalCanonical(plan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	planKey, err := ctx.GetStub().CreateCompositeKey(sheddingPrefix, []string{plan.ID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", sheddingPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(planKey, planBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update state of smart contract for key %s: %v", planKey, err)
+	}
+
+	return &plan, nil
+}
+
+// GetSheddingPlan returns one recorded shedding plan
+func (s *SmartContract) GetSheddingPlan(ctx contractapi.TransactionContextInterface, planID string) (*SheddingPlan, error) {
+
+	planKey, err := ctx.GetStub().CreateCompositeKey(sheddingPrefix, []string{planID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", sheddingPrefix, err)
+	}
+
+	planBytes, err := ctx.GetStub().GetState(planKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shedding plan from world state: %v", err)
+	}
+	if planBytes == nil {
+		return nil, fmt.Errorf("shedding plan %v does not exist", planID)
+	}
+
+	var plan SheddingPlan
+	err = json.Unmarshal(planBytes, &plan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create shedding plan object JSON: %v", err)
+	}
+
+	return &plan, nil
+}
+
+// GetPriority returns the classification of a connection point
+func (s *SmartContract) GetPriority(ctx contractapi.TransactionContextInterface, point string) (*PriorityRecord, error) {
+
+	priorityKey, err := ctx.GetStub().CreateCompositeKey(priorityPrefix, []string{point})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", priorityPrefix, err)
+	}
+
+	recordBytes, err := ctx.GetStub().GetState(priorityKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read priority record from world state: %v", err)
+	}
+	if recordBytes == nil {
+		return nil, fmt.Errorf("connection point %v is not classified", point)
+	}
+
+	var record PriorityRecord
+	err = json.Unmarshal(recordBytes, &record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create priority record object JSON: %v", err)
+	}
+
+	return &record, nil
+}
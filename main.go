@@ -7,7 +7,15 @@ import (
 )
 
 func main() {
-	e_moneySmartContract, err := contractapi.NewChaincode(&SmartContract{})
+	// the unnamed SmartContract comes first so it stays the default contract
+	// and unqualified invocations keep working; the named sub-contracts route
+	// the same functions under the Token, Auction and Gov namespaces with
+	// evaluate-only hints on their queries
+	smartContract := &SmartContract{}
+	smartContract.BeforeTransaction = beforeTransaction
+	smartContract.TransactionContextHandler = &TransactionContext{}
+
+	e_moneySmartContract, err := contractapi.NewChaincode(smartContract, NewTokenContract(), NewAuctionContract(), NewGovernanceContract())
 	if err != nil {
 		log.Panicf("Error creating auction chaincode: %v", err)
 	}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const pendingPaymentPrefix = "pendingPayment"
+
+// Define key names for options
+const makerCheckerThresholdKey = "makerCheckerThreshold"
+
+// Pending payment statuses
+const paymentPending = "pending"
+const paymentReleased = "released"
+const paymentCancelled = "cancelled"
+
+// pending payments expire after this many minutes if no checker releases them
+const paymentExpiryMin = 1440
+
+// PendingPayment is a high-value transfer by an organization account awaiting
+// release by a second identity of the same org. The funds leave the maker's
+// balance at initiation so a pending payment cannot be double spent
+type PendingPayment struct {
+	ID        string    `json:"id"`
+	Org       string    `json:"org"`
+	Maker     string    `json:"maker"`
+	To        string    `json:"to"`
+	Amount    int       `json:"amount"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Status    string    `json:"status"`
+}
+
+// SetMakerCheckerThreshold configures the transfer amount above which a
+// second identity must release the payment. A threshold of 0 disables the
+// maker-checker requirement. Only the operator maintains the threshold
+func (s *SmartContract) SetMakerCheckerThreshold(ctx contractapi.TransactionContextInterface, threshold int) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if threshold < 0 {
+		return fmt.Errorf("threshold cannot be negative")
+	}
+
+	err = ctx.GetStub().PutState(makerCheckerThresholdKey, []byte(strconv.Itoa(threshold)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", makerCheckerThresholdKey, err)
+	}
+
+	return nil
+}
+
+// InitiateTransfer starts a maker-checker transfer: the amount leaves the
+// maker's balance into a pending payment that a different identity of the
+// same org must release. The transaction ID becomes the payment ID
+func (s *SmartContract) InitiateTransfer(ctx contractapi.TransactionContextInterface, recipient string, amount int) (string, error) {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get MSPID: %v", err)
+	}
+
+	if amount <= 0 {
+		return "", fmt.Errorf("transfer amount must be a positive integer")
+	}
+
+	// a maker-checker transfer obeys the same rules as a direct Transfer,
+	// apart from the threshold check it exists to satisfy
+	if err := checkAccountOpen(ctx, clientID); err != nil {
+		return "", err
+	}
+	if err := checkAccountOpen(ctx, recipient); err != nil {
+		return "", err
+	}
+	err = checkIslandTransfer(ctx, clientID, recipient, amount)
+	if err != nil {
+		return "", err
+	}
+	err = checkSpendingLimits(ctx, clientID, amount)
+	if err != nil {
+		return "", err
+	}
+
+	// debit the maker up front so the pending amount cannot be spent twice
+	balanceBytes, err := getBalanceBytes(ctx, clientID)
+	if err != nil {
+		return "", fmt.Errorf("failed to read client's account %s from world state: %v", clientID, err)
+	}
+	if balanceBytes == nil {
+		return "", fmt.Errorf("the account %s does not exist", clientID)
+	}
+
+	balance, err := parseBalance(balanceBytes)
+	if err != nil {
+		return "", err
+	}
+
+	updatedBalance, err := subBalance(balance, amount)
+	if err != nil {
+		return "", fmt.Errorf("client account %s has insufficient funds", clientID)
+	}
+
+	err = putBalanceBytes(ctx, clientID, formatBalance(updatedBalance))
+	if err != nil {
+		return "", fmt.Errorf("failed to update state of smart contract for key %s: %v", clientID, err)
+	}
+
+	// the platform fee is charged at initiation like on a direct Transfer;
+	// it is not refunded if the payment is later cancelled
+	_, err = chargeTransferFee(ctx, clientID, amount, updatedBalance)
+	if err != nil {
+		return "", err
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("failed to get timestamp")
+	}
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	payment := PendingPayment{
+		ID:        ctx.GetStub().GetTxID(),
+		Org:       clientMSPID,
+		Maker:     clientID,
+		To:        recipient,
+		Amount:    amount,
+		CreatedAt: now,
+		ExpiresAt: now.Add(paymentExpiryMin * time.Minute),
+		Status:    paymentPending,
+	}
+
+	err = putPendingPayment(ctx, &payment)
+	if err != nil {
+		return "", err
+	}
+
+	return payment.ID, nil
+}
+
+// ReleaseTransfer completes a pending payment. The checker must belong to the
+// same org as the maker but be a different identity; the four-eyes split is
+// verified against the certificates, not against anything the maker submits
+func (s *SmartContract) ReleaseTransfer(ctx contractapi.TransactionContextInterface, paymentID string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get MSPID: %v", err)
+	}
+
+	payment, err := getPendingPayment(ctx, paymentID)
+	if err != nil {
+		return err
+	}
+
+	if payment.Status != paymentPending {
+		return fmt.Errorf("payment %v is not pending", paymentID)
+	}
+
+	if clientMSPID != payment.Org {
+		return fmt.Errorf("payment can only be released by a member of org %v", payment.Org)
+	}
+	if clientID == payment.Maker {
+		return fmt.Errorf("payment must be released by a different identity than the maker")
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+	if time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).After(payment.ExpiresAt) {
+		return fmt.Errorf("payment %v has expired, cancel it to return the funds", paymentID)
+	}
+
+	// the recipient may have been frozen since initiation
+	if err := checkAccountOpen(ctx, payment.To); err != nil {
+		return err
+	}
+
+	// credit the recipient; the maker was already debited at initiation
+	recipientBytes, err := getBalanceBytes(ctx, payment.To)
+	if err != nil {
+		return fmt.Errorf("failed to read account %s from world state: %v", payment.To, err)
+	}
+
+	recipientBalance, err := parseBalance(recipientBytes)
+	if err != nil {
+		return err
+	}
+
+	err = putBalanceBytes(ctx, payment.To, formatBalance(addBalance(recipientBalance, payment.Amount)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", payment.To, err)
+	}
+
+	payment.Status = paymentReleased
+
+	err = putPendingPayment(ctx, payment)
+	if err != nil {
+		return err
+	}
+
+	// Emit the Transfer event
+	meta, err := eventMeta(ctx)
+	if err != nil {
+		return err
+	}
+	err = emitEvent(ctx, "Transfer", TransferEvent{EventMeta: meta, From: payment.Maker, To: payment.To, Value: payment.Amount})
+	if err != nil {
+		return err
+	}
+
+	return recordReceipt(ctx, "payment", paymentID, fmt.Sprintf("pending payment %s of %d released to %s", paymentID, payment.Amount, payment.To))
+}
+
+// CancelTransfer returns the funds of a pending payment to the maker. The
+// maker can always cancel; anyone of the org can cancel an expired payment
+func (s *SmartContract) CancelTransfer(ctx contractapi.TransactionContextInterface, paymentID string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get MSPID: %v", err)
+	}
+
+	payment, err := getPendingPayment(ctx, paymentID)
+	if err != nil {
+		return err
+	}
+
+	if payment.Status != paymentPending {
+		return fmt.Errorf("payment %v is not pending", paymentID)
+	}
+
+	if clientID != payment.Maker {
+		timestamp, err := ctx.GetStub().GetTxTimestamp()
+		if err != nil {
+			return fmt.Errorf("failed to get timestamp")
+		}
+		expired := time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).After(payment.ExpiresAt)
+		if clientMSPID != payment.Org || !expired {
+			return fmt.Errorf("only the maker can cancel a payment before it expires")
+		}
+	}
+
+	makerBytes, err := getBalanceBytes(ctx, payment.Maker)
+	if err != nil {
+		return fmt.Errorf("failed to read account %s from world state: %v", payment.Maker, err)
+	}
+
+	makerBalance, err := parseBalance(makerBytes)
+	if err != nil {
+		return err
+	}
+
+	err = putBalanceBytes(ctx, payment.Maker, formatBalance(addBalance(makerBalance, payment.Amount)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", payment.Maker, err)
+	}
+
+	payment.Status = paymentCancelled
+
+	return putPendingPayment(ctx, payment)
+}
+
+// GetPendingPayments lists the pending payments of an org awaiting release
+func (s *SmartContract) GetPendingPayments(ctx contractapi.TransactionContextInterface, org string) ([]PendingPayment, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(pendingPaymentPrefix, []string{org})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending payments from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	payments := []PendingPayment{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pending payments from world state: %v", err)
+		}
+
+		var payment PendingPayment
+		err = json.Unmarshal(queryResponse.Value, &payment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create pending payment object JSON: %v", err)
+		}
+
+		if payment.Status == paymentPending {
+			payments = append(payments, payment)
+		}
+	}
+
+	return payments, nil
+}
+
+// checkMakerChecker rejects a direct transfer over the configured threshold
+// so it goes through the maker-checker flow instead
+func checkMakerChecker(ctx contractapi.TransactionContextInterface, amount int) error {
+
+	thresholdBytes, err := ctx.GetStub().GetState(makerCheckerThresholdKey)
+	if err != nil {
+		return fmt.Errorf("failed to read maker-checker threshold from world state: %v", err)
+	}
+	if thresholdBytes == nil {
+		return nil
+	}
+
+	threshold, _ := strconv.Atoi(string(thresholdBytes))
+	if threshold > 0 && amount > threshold {
+		return fmt.Errorf("transfers over %d require a second identity, use InitiateTransfer and ReleaseTransfer", threshold)
+	}
+
+	return nil
+}
+
+// getPendingPayment is an internal helper that reads a pending payment. The
+// payment ID alone is enough: the org is recovered by scanning its keyspace
+func getPendingPayment(ctx contractapi.TransactionContextInterface, paymentID string) (*PendingPayment, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(pendingPaymentPrefix, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending payments from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pending payments from world state: %v", err)
+		}
+
+		var payment PendingPayment
+		err = json.Unmarshal(queryResponse.Value, &payment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create pending payment object JSON: %v", err)
+		}
+
+		if payment.ID == paymentID {
+			return &payment, nil
+		}
+	}
+
+	return nil, fmt.Errorf("payment %v does not exist", paymentID)
+}
+
+// putPendingPayment is an internal helper that writes a pending payment
+func putPendingPayment(ctx contractapi.TransactionContextInterface, payment *PendingPayment) error {
+
+	paymentKey, err := ctx.GetStub().CreateCompositeKey(pendingPaymentPrefix, []string{payment.Org, payment.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", pendingPaymentPrefix, err)
+	}
+
+	paymentBytes, err := marshalCanonical(payment)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(paymentKey, paymentBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", paymentKey, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const personalDataPrefix = "personal"
+
+// PersonalData keeps a salted hash of a piece of personal metadata plus an
+// off-chain pointer, so the plaintext never reaches the immutable ledger
+type PersonalData struct {
+	Owner   string `json:"owner"`
+	Field   string `json:"field"`
+	Hash    string `json:"hash"`
+	Salt    string `json:"salt"`
+	Pointer string `json:"pointer"`
+}
+
+// PutPersonalData stores the salted hash of a personal metadata field
+// (e.g. name, address) together with an off-chain pointer. The client computes
+// the hash as sha256(salt + plaintext) so the plaintext is never submitted
+func (s *SmartContract) PutPersonalData(ctx contractapi.TransactionContextInterface, field string, hash string, salt string, pointer string) error {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if field == "" {
+		return fmt.Errorf("field cannot be empty")
+	}
+
+	if hash == "" {
+		return fmt.Errorf("hash cannot be empty")
+	}
+
+	personal := PersonalData{
+		Owner:   clientID,
+		Field:   field,
+		Hash:    hash,
+		Salt:    salt,
+		Pointer: pointer,
+	}
+
+	personalBytes, err := marshalCanonical(personal)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	personalKey, err := ctx.GetStub().CreateCompositeKey(personalDataPrefix, []string{clientID, field})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", personalDataPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(personalKey, personalBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", personalKey, err)
+	}
+
+	return nil
+}
+
+// VerifyPersonalData checks a presented plaintext against the stored salted
+// hash and returns true when they match
+func (s *SmartContract) VerifyPersonalData(ctx contractapi.TransactionContextInterface, owner string, field string, plaintext string) (bool, error) {
+
+	personal, err := getPersonalData(ctx, owner, field)
+	if err != nil {
+		return false, err
+	}
+
+	sum := sha256.Sum256([]byte(personal.Salt + plaintext))
+	return hex.EncodeToString(sum[:]) == personal.Hash, nil
+}
+
+// GetPersonalDataPointer returns the off-chain pointer of a personal metadata
+// field. Other parties than the owner need consent for purpose "personal-data"
+func (s *SmartContract) GetPersonalDataPointer(ctx contractapi.TransactionContextInterface, owner string, field string) (string, error) {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if clientID != owner {
+		allowed, err := hasConsent(ctx, owner, clientID, "personal-data")
+		if err != nil {
+			return "", err
+		}
+		if !allowed {
+			return "", fmt.Errorf("Permission denied, client id %v has no consent from owner", clientID)
+		}
+	}
+
+	personal, err := getPersonalData(ctx, owner, field)
+	if err != nil {
+		return "", err
+	}
+
+	return personal.Pointer, nil
+}
+
+// getPersonalData is an internal helper that reads a personal metadata record
+func getPersonalData(ctx contractapi.TransactionContextInterface, owner string, field string) (*PersonalData, error) {
+
+	personalKey, err := ctx.GetStub().CreateCompositeKey(personalDataPrefix, []string{owner, field})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", personalDataPrefix, err)
+	}
+
+	personalBytes, err := ctx.GetStub().GetState(personalKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read personal data from world state: %v", err)
+	}
+	if personalBytes == nil {
+		return nil, fmt.Errorf("personal data field %v does not exist", field)
+	}
+
+	var personal PersonalData
+	err = json.Unmarshal(personalBytes, &personal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create personal data object JSON: %v", err)
+	}
+
+	return &personal, nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const meterPrefix = "meter"
+const meterReadingPrefix = "meterReading"
+
+// Meter is a registered smart meter with the public key its readings are
+// signed with
+type Meter struct {
+	ID        string `json:"id"`
+	Owner     string `json:"owner"`
+	PublicKey string `json:"publicKey"`
+}
+
+// MeterReading is one consumption/production reading pushed by a registered
+// smart meter. Readings later drive automatic energy credits
+type MeterReading struct {
+	MeterID   string `json:"meterID"`
+	KWh       int    `json:"kWh"`
+	Timestamp string `json:"timestamp"`
+	TxID      string `json:"txID"`
+}
+
+// RegisterMeter registers a smart meter for an owner together with the
+// PEM-encoded ECDSA public key its readings are signed with. Only the
+// regulator registers meters
+func (s *SmartContract) RegisterMeter(ctx contractapi.TransactionContextInterface, meterID string, owner string, publicKeyPEM string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	// the key must parse to an ECDSA public key
+	_, err = parseMeterPublicKey(publicKeyPEM)
+	if err != nil {
+		return err
+	}
+
+	meter := Meter{
+		ID:        meterID,
+		Owner:     owner,
+		PublicKey: publicKeyPEM,
+	}
+
+	meterBytes, err := marshalCanonical(meter)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	meterKey, err := ctx.GetStub().CreateCompositeKey(meterPrefix, []string{meterID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", meterPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(meterKey, meterBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", meterKey, err)
+	}
+
+	return nil
+}
+
+// GetMeter returns a registered meter
+func (s *SmartContract) GetMeter(ctx contractapi.TransactionContextInterface, meterID string) (*Meter, error) {
+	return getMeter(ctx, meterID)
+}
+
+// SubmitMeterReading stores a reading pushed by a registered smart meter. The
+// signature is the base64-encoded ECDSA (ASN.1) signature over
+// "meterID|kwh|timestamp" and is verified against the meter's registered
+// public key. The timestamp is passed in RFC3339 format
+func (s *SmartContract) SubmitMeterReading(ctx contractapi.TransactionContextInterface, meterID string, kwh int, timestamp string, signature string) error {
+
+	if kwh < 0 {
+		return fmt.Errorf("reading cannot be negative")
+	}
+
+	_, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return fmt.Errorf("failed to parse reading timestamp: %v", err)
+	}
+
+	meter, err := getMeter(ctx, meterID)
+	if err != nil {
+		return err
+	}
+
+	publicKey, err := parseMeterPublicKey(meter.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode reading signature: %v", err)
+	}
+
+	message := fmt.Sprintf("%s|%d|%s", meterID, kwh, timestamp)
+	digest := sha256.Sum256([]byte(message))
+
+	if !ecdsa.VerifyASN1(publicKey, digest[:], signatureBytes) {
+		return fmt.Errorf("reading signature does not verify against the key of meter %v", meterID)
+	}
+
+	reading := MeterReading{
+		MeterID:   meterID,
+		KWh:       kwh,
+		Timestamp: timestamp,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	readingBytes, err := marshalCanonical(reading)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	readingKey, err := ctx.GetStub().CreateCompositeKey(meterReadingPrefix, []string{meterID, timestamp})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", meterReadingPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(readingKey, readingBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", readingKey, err)
+	}
+
+	return nil
+}
+
+// GetMeterReadings returns all readings of a meter
+func (s *SmartContract) GetMeterReadings(ctx contractapi.TransactionContextInterface, meterID string) ([]MeterReading, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(meterReadingPrefix, []string{meterID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read meter readings from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	readings := []MeterReading{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read meter readings from world state: %v", err)
+		}
+
+		var reading MeterReading
+		err = json.Unmarshal(queryResponse.Value, &reading)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create meter reading object JSON: %v", err)
+		}
+
+		readings = append(readings, reading)
+	}
+
+	return readings, nil
+}
+
+// getMeter is an internal helper that reads a registered meter from state
+func getMeter(ctx contractapi.TransactionContextInterface, meterID string) (*Meter, error) {
+
+	meterKey, err := ctx.GetStub().CreateCompositeKey(meterPrefix, []string{meterID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", meterPrefix, err)
+	}
+
+	meterBytes, err := ctx.GetStub().GetState(meterKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read meter from world state: %v", err)
+	}
+	if meterBytes == nil {
+		return nil, fmt.Errorf("meter %v is not registered", meterID)
+	}
+
+	var meter Meter
+	err = json.Unmarshal(meterBytes, &meter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create meter object JSON: %v", err)
+	}
+
+	return &meter, nil
+}
+
+// parseMeterPublicKey is an internal helper that parses the PEM-encoded
+// ECDSA public key of a meter
+func parseMeterPublicKey(publicKeyPEM string) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block of meter public key")
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse meter public key: %v", err)
+	}
+
+	ecdsaKey, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("meter public key is not an ECDSA key")
+	}
+
+	return ecdsaKey, nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+)
+
+// Hand-written mocks for the shim interfaces. The mock stub keeps the world
+// state in a map and implements only the subset of ChaincodeStubInterface
+// the contract actually calls; the embedded interface satisfies the rest,
+// and an unexpected call into it panics, which is exactly what a test wants
+
+// composite keys use the same null-byte framing as the real stub, so keys
+// built by the contract split back into the same attributes
+const mockCompositeKeyNamespace = "\x00"
+
+// The mock mirrors the peer's read-your-writes rule: state holds what past
+// transactions committed and is all that GetState and range queries serve,
+// while PutState and DelState only collect into the write set of the
+// transaction in flight. A contract function that re-reads a key it just
+// wrote therefore sees the stale committed value here exactly as it would
+// on a real channel
+type mockStub struct {
+	shim.ChaincodeStubInterface
+	state            map[string][]byte
+	writes           map[string][]byte
+	dels             map[string]bool
+	validationParams map[string][]byte
+	lastEventName    string
+	lastEventPayload []byte
+	txCounter        int
+	receiptSeq       int
+	now              time.Time
+}
+
+func newMockStub() *mockStub {
+	return &mockStub{
+		state:            map[string][]byte{},
+		writes:           map[string][]byte{},
+		dels:             map[string]bool{},
+		validationParams: map[string][]byte{},
+		now:              time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+// tick starts a new transaction: the write set of the previous one is
+// committed so the new transaction reads it, and a fresh tx ID with a
+// timestamp one second later keeps records keyed by tx ID from colliding.
+// Tests tick before every invocation, including queries that want to see
+// what the last invocation wrote
+func (m *mockStub) tick() {
+	for key, value := range m.writes {
+		m.state[key] = value
+	}
+	for key := range m.dels {
+		delete(m.state, key)
+	}
+	m.writes = map[string][]byte{}
+	m.dels = map[string]bool{}
+	m.txCounter++
+	m.receiptSeq = 0
+	m.now = m.now.Add(time.Second)
+}
+
+// advance moves the mock clock, e.g. past an auction deadline
+func (m *mockStub) advance(d time.Duration) {
+	m.now = m.now.Add(d)
+}
+
+func (m *mockStub) GetState(key string) ([]byte, error) {
+	return m.state[key], nil
+}
+
+func (m *mockStub) PutState(key string, value []byte) error {
+	m.writes[key] = append([]byte(nil), value...)
+	delete(m.dels, key)
+	return nil
+}
+
+func (m *mockStub) DelState(key string) error {
+	m.dels[key] = true
+	delete(m.writes, key)
+	return nil
+}
+
+func (m *mockStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	key := mockCompositeKeyNamespace + objectType + mockCompositeKeyNamespace
+	for _, attr := range attributes {
+		key += attr + mockCompositeKeyNamespace
+	}
+	return key, nil
+}
+
+func (m *mockStub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	components := strings.Split(strings.TrimPrefix(compositeKey, mockCompositeKeyNamespace), mockCompositeKeyNamespace)
+	if len(components) < 2 {
+		return "", nil, fmt.Errorf("invalid composite key %q", compositeKey)
+	}
+	return components[0], components[1 : len(components)-1], nil
+}
+
+func (m *mockStub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	prefix, err := m.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := []string{}
+	for key := range m.state {
+		if strings.HasPrefix(key, prefix) {
+			matching = append(matching, key)
+		}
+	}
+	sort.Strings(matching)
+
+	kvs := make([]*queryresult.KV, 0, len(matching))
+	for _, key := range matching {
+		kvs = append(kvs, &queryresult.KV{Key: key, Value: m.state[key]})
+	}
+
+	return &mockIterator{kvs: kvs}, nil
+}
+
+func (m *mockStub) GetTxID() string {
+	return fmt.Sprintf("tx%04d", m.txCounter)
+}
+
+func (m *mockStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: m.now.Unix(), Nanos: int32(m.now.Nanosecond())}, nil
+}
+
+func (m *mockStub) SetEvent(name string, payload []byte) error {
+	m.lastEventName = name
+	m.lastEventPayload = payload
+	return nil
+}
+
+func (m *mockStub) GetStateValidationParameter(key string) ([]byte, error) {
+	return m.validationParams[key], nil
+}
+
+func (m *mockStub) SetStateValidationParameter(key string, ep []byte) error {
+	if ep == nil {
+		delete(m.validationParams, key)
+		return nil
+	}
+	m.validationParams[key] = ep
+	return nil
+}
+
+type mockIterator struct {
+	kvs []*queryresult.KV
+	pos int
+}
+
+func (it *mockIterator) HasNext() bool {
+	return it.pos < len(it.kvs)
+}
+
+func (it *mockIterator) Next() (*queryresult.KV, error) {
+	if !it.HasNext() {
+		return nil, fmt.Errorf("no more items")
+	}
+	kv := it.kvs[it.pos]
+	it.pos++
+	return kv, nil
+}
+
+func (it *mockIterator) Close() error {
+	return nil
+}
+
+type mockClientIdentity struct {
+	cid.ClientIdentity
+	id    string
+	mspID string
+}
+
+func (m *mockClientIdentity) GetID() (string, error) {
+	return m.id, nil
+}
+
+func (m *mockClientIdentity) GetMSPID() (string, error) {
+	return m.mspID, nil
+}
+
+func (m *mockClientIdentity) GetAttributeValue(attrName string) (string, bool, error) {
+	return "", false, nil
+}
+
+// mockContext satisfies contractapi.TransactionContextInterface. Several
+// contexts can share one stub, which models several identities submitting
+// transactions against the same world state
+type mockContext struct {
+	stub     *mockStub
+	identity *mockClientIdentity
+}
+
+func testContext(stub *mockStub, clientID string, mspID string) *mockContext {
+	return &mockContext{
+		stub:     stub,
+		identity: &mockClientIdentity{id: clientID, mspID: mspID},
+	}
+}
+
+func (m *mockContext) GetStub() shim.ChaincodeStubInterface {
+	return m.stub
+}
+
+func (m *mockContext) GetClientIdentity() cid.ClientIdentity {
+	return m.identity
+}
+
+// nextReceiptSeq mirrors the chaincode's TransactionContext counter. It lives
+// on the stub rather than the context so it resets with every tick and is
+// shared by all identities submitting within the same transaction
+func (m *mockContext) nextReceiptSeq() int {
+	seq := m.stub.receiptSeq
+	m.stub.receiptSeq++
+	return seq
+}
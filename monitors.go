@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define key names for options
+const monitorsKey = "Monitors"
+
+// Define objectType names for prefix
+const inflowPrefix = "inflow"
+
+// Monitors holds the governance-configured alarm thresholds. A zero threshold
+// disables the corresponding monitor
+type Monitors struct {
+	SupplyChangePerDay   int `json:"supplyChangePerDay"`
+	AccountInflowPerHour int `json:"accountInflowPerHour"`
+	PriceMultiple        int `json:"priceMultiple"`
+}
+
+// rateWindow accumulates an amount within one time bucket (day or hour)
+type rateWindow struct {
+	Bucket string `json:"bucket"`
+	Amount int    `json:"amount"`
+}
+
+// alertEvent is the payload of the Alert event consumed by the operator's
+// monitoring stack
+type alertEvent struct {
+	Monitor string `json:"monitor"`
+	Subject string `json:"subject"`
+	Value   int    `json:"value"`
+	Limit   int    `json:"limit"`
+}
+
+// SetMonitors configures the alarm thresholds. Only the regulator may
+// change them
+func (s *SmartContract) SetMonitors(ctx contractapi.TransactionContextInterface, supplyChangePerDay int, accountInflowPerHour int, priceMultiple int) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	monitors := Monitors{
+		SupplyChangePerDay:   supplyChangePerDay,
+		AccountInflowPerHour: accountInflowPerHour,
+		PriceMultiple:        priceMultiple,
+	}
+
+	monitorsBytes, err := marshalCanonical(monitors)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(monitorsKey, monitorsBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state %v", err)
+	}
+
+	return nil
+}
+
+// GetMonitors returns the configured alarm thresholds
+func (s *SmartContract) GetMonitors(ctx contractapi.TransactionContextInterface) (*Monitors, error) {
+	return getMonitors(ctx)
+}
+
+// getMonitors is an internal helper that reads the monitor configuration
+func getMonitors(ctx contractapi.TransactionContextInterface) (*Monitors, error) {
+	monitorsBytes, err := ctx.GetStub().GetState(monitorsKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Monitors from world state: %v", err)
+	}
+
+	var monitors Monitors
+	if monitorsBytes != nil {
+		err = json.Unmarshal(monitorsBytes, &monitors)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create monitors object JSON: %v", err)
+		}
+	}
+
+	return &monitors, nil
+}
+
+// emitAlert emits an Alert event for the operator's monitoring stack
+func emitAlert(ctx contractapi.TransactionContextInterface, monitor string, subject string, value int, limit int) error {
+	alert := alertEvent{
+		Monitor: monitor,
+		Subject: subject,
+		Value:   value,
+		Limit:   limit,
+	}
+	alertJSON, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("Alert", alertJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
+
+// bumpRateWindow adds an amount to the rate window stored under key, resetting
+// the accumulated amount when the time bucket changed, and returns the total
+func bumpRateWindow(ctx contractapi.TransactionContextInterface, key string, bucket string, amount int) (int, error) {
+	windowBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read rate window from world state: %v", err)
+	}
+
+	var window rateWindow
+	if windowBytes != nil {
+		err = json.Unmarshal(windowBytes, &window)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create rate window object JSON: %v", err)
+		}
+	}
+
+	if window.Bucket != bucket {
+		window.Bucket = bucket
+		window.Amount = 0
+	}
+	window.Amount += amount
+
+	windowBytes, err = marshalCanonical(window)
+	if err != nil {
+		return 0, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(key, windowBytes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update state of smart contract for key %s: %v", key, err)
+	}
+
+	return window.Amount, nil
+}
+
+// checkSupplyAlarm tracks the absolute totalSupply change per day and emits an
+// Alert event once it exceeds the configured threshold
+func checkSupplyAlarm(ctx contractapi.TransactionContextInterface, amount int) error {
+	monitors, err := getMonitors(ctx)
+	if err != nil {
+		return err
+	}
+	if monitors.SupplyChangePerDay <= 0 {
+		return nil
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+	day := time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).UTC().Format("2006-01-02")
+
+	total, err := bumpRateWindow(ctx, "supplyWindow", day, amount)
+	if err != nil {
+		return err
+	}
+
+	if total > monitors.SupplyChangePerDay {
+		return emitAlert(ctx, "supplyChangePerDay", totalSupplyKey, total, monitors.SupplyChangePerDay)
+	}
+
+	return nil
+}
+
+// checkInflowAlarm tracks how much a single account received per hour and
+// emits an Alert event once it exceeds the configured threshold
+func checkInflowAlarm(ctx contractapi.TransactionContextInterface, account string, amount int) error {
+	monitors, err := getMonitors(ctx)
+	if err != nil {
+		return err
+	}
+	if monitors.AccountInflowPerHour <= 0 {
+		return nil
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+	hour := time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).UTC().Format("2006-01-02T15")
+
+	inflowKey, err := ctx.GetStub().CreateCompositeKey(inflowPrefix, []string{account})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", inflowPrefix, err)
+	}
+
+	total, err := bumpRateWindow(ctx, inflowKey, hour, amount)
+	if err != nil {
+		return err
+	}
+
+	if total > monitors.AccountInflowPerHour {
+		return emitAlert(ctx, "accountInflowPerHour", account, total, monitors.AccountInflowPerHour)
+	}
+
+	return nil
+}
+
+// checkPriceAlarm compares a bid against the auction's reference price and
+// emits an Alert event when it exceeds the configured multiple
+func checkPriceAlarm(ctx contractapi.TransactionContextInterface, auctionID string, referencePrice int, bid int) error {
+	monitors, err := getMonitors(ctx)
+	if err != nil {
+		return err
+	}
+	if monitors.PriceMultiple <= 0 || referencePrice <= 0 {
+		return nil
+	}
+
+	if bid > monitors.PriceMultiple*referencePrice {
+		return emitAlert(ctx, "priceMultiple", auctionID, bid, monitors.PriceMultiple*referencePrice)
+	}
+
+	return nil
+}
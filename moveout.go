@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const statementPrefix = "statement"
+
+// FinalStatement is generated for the leaving party when a property changes
+// occupants
+type FinalStatement struct {
+	Account           string   `json:"account"`
+	NewOccupant       string   `json:"newOccupant"`
+	EffectiveDate     string   `json:"effectiveDate"`
+	FinalBalance      int      `json:"finalBalance"`
+	TransferredMeters []string `json:"transferredMeters"`
+	TransferredAssets []string `json:"transferredAssets"`
+}
+
+// TransferHousehold moves the meters, generation assets and open obligations
+// of the submitting occupant to the new occupant, effective from the given
+// date (YYYY-MM-DD), and generates a final statement for the leaving party.
+// This replaces the previous ad-hoc re-registration of every asset
+func (s *SmartContract) TransferHousehold(ctx contractapi.TransactionContextInterface, newOccupant string, effectiveDate string) (*FinalStatement, error) {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if newOccupant == "" || newOccupant == clientID {
+		return nil, fmt.Errorf("a different new occupant is required")
+	}
+
+	_, err = time.Parse("2006-01-02", effectiveDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse effective date: %v", err)
+	}
+
+	// the new occupant needs an account for obligations to land on
+	newOccupantBytes, err := getBalanceBytes(ctx, newOccupant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account %s from world state: %v", newOccupant, err)
+	}
+	if newOccupantBytes == nil {
+		return nil, fmt.Errorf("the account %s does not exist", newOccupant)
+	}
+
+	statement := FinalStatement{
+		Account:           clientID,
+		NewOccupant:       newOccupant,
+		EffectiveDate:     effectiveDate,
+		TransferredMeters: []string{},
+		TransferredAssets: []string{},
+	}
+
+	// transfer the meters registered to the leaving occupant
+	meterIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(meterPrefix, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read meters from world state: %v", err)
+	}
+	defer meterIterator.Close()
+
+	for meterIterator.HasNext() {
+		queryResponse, err := meterIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read meters from world state: %v", err)
+		}
+
+		var meter Meter
+		err = json.Unmarshal(queryResponse.Value, &meter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create meter object JSON: %v", err)
+		}
+
+		if meter.Owner != clientID {
+			continue
+		}
+
+		meter.Owner = newOccupant
+
+		meterBytes, err := marshalCanonical(meter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+		}
+
+		err = ctx.GetStub().PutState(queryResponse.Key, meterBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update state of smart contract for key %s: %v", queryResponse.Key, err)
+		}
+
+		statement.TransferredMeters = append(statement.TransferredMeters, meter.ID)
+	}
+
+	// transfer the generation assets owned by the leaving occupant
+	assetIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(energyAssetPrefix, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read energy assets from world state: %v", err)
+	}
+	defer assetIterator.Close()
+
+	for assetIterator.HasNext() {
+		queryResponse, err := assetIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read energy assets from world state: %v", err)
+		}
+
+		var asset EnergyAsset
+		err = json.Unmarshal(queryResponse.Value, &asset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create energy asset object JSON: %v", err)
+		}
+
+		if asset.Owner != clientID {
+			continue
+		}
+
+		asset.Owner = newOccupant
+
+		assetBytes, err := marshalCanonical(asset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+		}
+
+		err = ctx.GetStub().PutState(queryResponse.Key, assetBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update state of smart contract for key %s: %v", queryResponse.Key, err)
+		}
+
+		statement.TransferredAssets = append(statement.TransferredAssets, asset.ID)
+	}
+
+	// any held amount is an open obligation and returns before the statement
+	err = releaseActiveHolds(ctx, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot return holds: %v", err)
+	}
+
+	balance, err := s.ClientAccountBalance(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get balance")
+	}
+	statement.FinalBalance = balance
+
+	statementBytes, err := marshalCanonical(statement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	statementKey, err := ctx.GetStub().CreateCompositeKey(statementPrefix, []string{clientID, effectiveDate})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", statementPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(statementKey, statementBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update state of smart contract for key %s: %v", statementKey, err)
+	}
+
+	return &statement, nil
+}
+
+// GetFinalStatement returns the final statement generated for a leaving party
+func (s *SmartContract) GetFinalStatement(ctx contractapi.TransactionContextInterface, account string, effectiveDate string) (*FinalStatement, error) {
+
+	statementKey, err := ctx.GetStub().CreateCompositeKey(statementPrefix, []string{account, effectiveDate})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", statementPrefix, err)
+	}
+
+	statementBytes, err := ctx.GetStub().GetState(statementKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read statement from world state: %v", err)
+	}
+	if statementBytes == nil {
+		return nil, fmt.Errorf("no final statement exists for account %v on %v", account, effectiveDate)
+	}
+
+	var statement FinalStatement
+	err = json.Unmarshal(statementBytes, &statement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create statement object JSON: %v", err)
+	}
+
+	return &statement, nil
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// perKWhPrice normalizes a bid to a per-KWh value: partial bids already
+// carry one while full bids quote a total price for the whole auctioned
+// amount. Both the allocation and the bid validation compare bids this way
+func perKWhPrice(auctionJSON *Auction, bid FullBid) int {
+	if bid.Quantity > 0 {
+		return bid.Price
+	}
+	return bid.Price * whPerKWh / auctionJSON.Amount
+}
+
+// SubmitPartialBid submits a bid for part of the auctioned energy: quantity
+// KWh at the given price per KWh. The total bid value is held from the
+// bidder's balance like a full bid, and the bid passes the same checks a
+// full bid does
+func (s *SmartContract) SubmitPartialBid(ctx contractapi.TransactionContextInterface, auctionID string, quantity int, priceperkwh int) error {
+
+	// only registered participants bid on the market
+	if err := requireRegistered(ctx); err != nil {
+		return err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+	// get the MSP ID of the bidder's org
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+
+	if quantity <= 0 {
+		return fmt.Errorf("bid quantity must be a positive integer")
+	}
+
+	if priceperkwh <= 0 {
+		return fmt.Errorf("bid price must be a positive integer")
+	}
+
+	// get the auction from state
+	auctionBytes, err := ctx.GetStub().GetState(auctionID)
+	if err != nil {
+		return fmt.Errorf("couldn't get auction from global state")
+	}
+
+	if auctionBytes == nil {
+		return fmt.Errorf("Auction not found: %v", auctionID)
+	}
+
+	var auctionJSON Auction
+	err = json.Unmarshal(auctionBytes, &auctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to create auction object JSON: %v", err)
+	}
+
+	// the auction needs to be open for users to add their bid
+	Status := auctionJSON.Status
+	if Status != "open" {
+		return fmt.Errorf("cannot join closed or ended auction")
+	}
+
+	expired, err := auctionExpired(ctx, auctionJSON)
+	if err != nil {
+		return err
+	}
+	if expired {
+		_ = closeAuction(ctx, auctionID)
+		_ = endAuction(ctx, auctionID)
+		return fmt.Errorf("time is up")
+	}
+
+	// the auctioned amount is stored in Wh, so the KWh quantity is
+	// normalized before the comparison and kept in Wh on the bid
+	quantityWh := quantity * whPerKWh
+	if quantityWh > auctionJSON.Amount {
+		return fmt.Errorf("bid quantity is more than the auctioned amount")
+	}
+
+	value := quantity * priceperkwh
+
+	balance, err := s.ClientAccountBalance(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot get balance")
+	}
+	if balance < value {
+		return fmt.Errorf("balance is less than bid value")
+	}
+
+	// bids below the reserve price never win, so they are rejected up front;
+	// the reserve is quoted for the whole auctioned amount while a partial
+	// bid is per KWh, so the reserve is normalized before the comparison
+	if auctionJSON.Reserve > 0 && priceperkwh < auctionJSON.Reserve*whPerKWh/auctionJSON.Amount {
+		return fmt.Errorf("bid of %d per KWh is below the reserve price of %d", priceperkwh, auctionJSON.Reserve*whPerKWh/auctionJSON.Amount)
+	}
+
+	// each new bid has to beat the current best per-KWh price by the minimum
+	// increment, normalized to per KWh the same way as the reserve
+	if auctionJSON.MinIncrement > 0 {
+		best := 0
+		for _, bid := range auctionJSON.RevealedBids {
+			if price := perKWhPrice(&auctionJSON, bid); price > best {
+				best = price
+			}
+		}
+		incrementPerKWh := auctionJSON.MinIncrement * whPerKWh / auctionJSON.Amount
+		if best > 0 && priceperkwh < best+incrementPerKWh {
+			return fmt.Errorf("bid of %d per KWh does not exceed the best bid of %d by the minimum increment of %d", priceperkwh, best, incrementPerKWh)
+		}
+	}
+
+	// evaluate the rate-of-change monitors; a partial bid is compared
+	// against the asking price per KWh rather than the total
+	err = checkPriceAlarm(ctx, auctionID, auctionJSON.PricePerKWh, priceperkwh)
+	if err != nil {
+		return err
+	}
+
+	// use the bidder identity to create the composite bid key
+	bidKey, err := ctx.GetStub().CreateCompositeKey(bidKeyType, []string{auctionID, clientID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	NewBid := FullBid{
+		Type:        auctionJSON.ItemSold,
+		Price:       priceperkwh,
+		Quantity:    quantityWh,
+		Org:         clientOrgID,
+		Bidder:      clientID,
+		SubmittedAt: time.Unix(timestamp.Seconds, int64(timestamp.Nanos)),
+	}
+
+	bidders := auctionJSON.RevealedBids
+	bidders[bidKey] = NewBid
+	auctionJSON.RevealedBids = bidders
+
+	// Add the bidding organization to the list of participating organizations if it is not already
+	Orgs := auctionJSON.Orgs
+	if !(contains(Orgs, clientOrgID)) {
+		newOrgs := append(Orgs, clientOrgID)
+		auctionJSON.Orgs = newOrgs
+
+		err = addAssetStateBasedEndorsement(ctx, auctionID, clientOrgID)
+		if err != nil {
+			return fmt.Errorf("failed setting state based endorsement for new organization: %v", err)
+		}
+	}
+
+	newAuctionBytes, _ := marshalCanonical(auctionJSON)
+
+	err = ctx.GetStub().PutState(auctionID, newAuctionBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update auction: %v", err)
+	}
+
+	// the bid value is backed by a hold record keyed by this auction; a
+	// re-bid replaces the bidder's previous hold for this auction
+	available := balance
+	if existingHold, _, err := getHoldRecord(ctx, clientID, auctionID); err == nil && existingHold.Status == holdActive {
+		available += existingHold.Amount
+		err = releaseHoldRecord(ctx, clientID, auctionID, holdReleased)
+		if err != nil {
+			return fmt.Errorf("cannot release previous hold: %v", err)
+		}
+	}
+
+	err = createHoldRecord(ctx, clientID, auctionID, value, "bid", auctionJSON.Time_remaining+disputeWindowMin)
+	if err != nil {
+		return fmt.Errorf("cannot create hold: %v", err)
+	}
+
+	// the configured deposit percentage is staked on top of the hold, debited
+	// against the balance the hold already reduced
+	err = takeStake(ctx, auctionID, clientID, value, big.NewInt(int64(available-value)))
+	if err != nil {
+		return fmt.Errorf("cannot take stake: %v", err)
+	}
+
+	return nil
+}
+
+// EndAuctionMultiWinner ends a closed auction by allocating the auctioned
+// energy across the bidders in price order instead of picking a single
+// winner. Partial bids are filled up to their quantity; full bids take
+// whatever remains. The per-winner allocations are recorded on the auction
+// and each winner's hold pays the seller for their share
+func (s *SmartContract) EndAuctionMultiWinner(ctx contractapi.TransactionContextInterface, auctionID string) error {
+
+	auctionBytes, err := ctx.GetStub().GetState(auctionID)
+	if err != nil {
+		return fmt.Errorf("failed to get auction %v: %v", auctionID, err)
+	}
+
+	if auctionBytes == nil {
+		return fmt.Errorf("Auction interest object %v not found", auctionID)
+	}
+
+	var auctionJSON Auction
+	err = json.Unmarshal(auctionBytes, &auctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to create auction object JSON: %v", err)
+	}
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if !isAuctionSeller(ctx, auctionJSON, auctionID, clientID) {
+		return fmt.Errorf("auction can only be ended by seller: %v", err)
+	}
+
+	Status := auctionJSON.Status
+	if Status != "closed" {
+		return fmt.Errorf("can only end a closed auction")
+	}
+
+	if len(auctionJSON.RevealedBids) == 0 {
+		return fmt.Errorf("no bids have been revealed, cannot end auction: %v", err)
+	}
+
+	// sort the bids by price per KWh, highest first; ties resolve by bid key
+	// so every peer computes the same allocation
+	bidKeys := make([]string, 0, len(auctionJSON.RevealedBids))
+	for bidKey := range auctionJSON.RevealedBids {
+		bidKeys = append(bidKeys, bidKey)
+	}
+	sort.Slice(bidKeys, func(i, j int) bool {
+		priceI := perKWhPrice(&auctionJSON, auctionJSON.RevealedBids[bidKeys[i]])
+		priceJ := perKWhPrice(&auctionJSON, auctionJSON.RevealedBids[bidKeys[j]])
+		if priceI != priceJ {
+			return priceI > priceJ
+		}
+		return bidKeys[i] < bidKeys[j]
+	})
+
+	// allocate the auctioned Wh in price order and work out what every
+	// bidder owes for their allocation
+	allocations := make(map[string]int)
+	payments := make(map[string]int)
+	remaining := auctionJSON.Amount
+	for _, bidKey := range bidKeys {
+		if remaining == 0 {
+			break
+		}
+
+		bid := auctionJSON.RevealedBids[bidKey]
+
+		allocated := bid.Quantity
+		if allocated == 0 || allocated > remaining {
+			// a full bid, or a partial bid larger than what is left,
+			// takes whatever remains
+			allocated = remaining
+		}
+
+		// a partial bid pays its per-KWh price on the allocated Wh; a full
+		// bid pays its total price pro rata to the share it received
+		if bid.Quantity > 0 {
+			payments[bid.Bidder] = payments[bid.Bidder] + allocated*bid.Price/whPerKWh
+		} else {
+			payments[bid.Bidder] = payments[bid.Bidder] + bid.Price*allocated/auctionJSON.Amount
+		}
+
+		allocations[bid.Bidder] = allocations[bid.Bidder] + allocated
+		remaining -= allocated
+	}
+
+	auctionJSON.Allocations = allocations
+	auctionJSON.Status = string("ended")
+
+	// settle the holds: every allocated bidder pays the seller their share
+	// out of the hold they placed for this auction, with the remainder
+	// returned by the same consume; bidders who received nothing get their
+	// full hold back. The seller is credited once with the combined
+	// proceeds at the end — crediting them per winner would re-read a
+	// balance the earlier credits have not committed yet
+	proceeds := 0
+	settled := make(map[string]bool)
+	for _, bidKey := range bidKeys {
+		bid := auctionJSON.RevealedBids[bidKey]
+		if settled[bid.Bidder] {
+			continue
+		}
+		settled[bid.Bidder] = true
+
+		payment := payments[bid.Bidder]
+		if payment > 0 {
+			err = consumeHoldRecord(ctx, bid.Bidder, auctionID, payment)
+			if err != nil {
+				return fmt.Errorf("cannot consume hold: %v", err)
+			}
+			proceeds += payment
+		} else {
+			err = releaseHoldRecord(ctx, bid.Bidder, auctionID, holdReleased)
+			if err != nil {
+				return fmt.Errorf("cannot return hold: %v", err)
+			}
+		}
+
+		// every bidder gets their deposit back when the auction settles
+		err = releaseStake(ctx, auctionID, bid.Bidder, bid.Bidder)
+		if err != nil {
+			return err
+		}
+	}
+
+	if proceeds > 0 {
+		balanceBytes, err := getBalanceBytes(ctx, clientID)
+		if err != nil {
+			return fmt.Errorf("failed to read account %s from world state: %v", clientID, err)
+		}
+		if balanceBytes == nil {
+			return fmt.Errorf("the account %s does not exist", clientID)
+		}
+
+		sellerBalance, err := parseBalance(balanceBytes)
+		if err != nil {
+			return err
+		}
+
+		err = putBalanceBytes(ctx, clientID, formatBalance(addBalance(sellerBalance, proceeds)))
+		if err != nil {
+			return fmt.Errorf("failed to update state of smart contract for key %s: %v", clientID, err)
+		}
+	}
+
+	// move the ended auction into the archive before the live key goes away,
+	// so the final record survives for audit
+	err = archiveAuction(ctx, auctionID, auctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to archive auction: %v", err)
+	}
+
+	// drop the per-auction endorsement policy that accumulated as orgs bid
+	err = removeAssetStateBasedEndorsement(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().DelState(auctionID)
+	if err != nil {
+		return fmt.Errorf("failed to delete auction: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const portfolioPrefix = "portfolio"
+const nettingPrefix = "netting"
+
+// Portfolio groups the assets of an aggregator within a grid zone so their
+// imbalance can be settled at the portfolio level
+type Portfolio struct {
+	ID         string   `json:"id"`
+	Aggregator string   `json:"aggregator"`
+	Zone       string   `json:"zone"`
+	Members    []string `json:"members"`
+}
+
+// NettingRecord is the result of netting the over- and under-delivery of the
+// portfolio members for one slot. The member allocation is recorded for
+// transparency
+type NettingRecord struct {
+	PortfolioID string         `json:"portfolioID"`
+	Slot        string         `json:"slot"`
+	NetKWh      int            `json:"netKWh"`
+	Allocations map[string]int `json:"allocations"`
+	TxID        string         `json:"txID"`
+}
+
+// RegisterPortfolio registers an aggregator portfolio for a zone. The members
+// are passed as a JSON array of member IDs. The submitting client becomes the
+// aggregator of the portfolio
+func (s *SmartContract) RegisterPortfolio(ctx contractapi.TransactionContextInterface, portfolioID string, zone string, membersJSON string) error {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	var members []string
+	err = json.Unmarshal([]byte(membersJSON), &members)
+	if err != nil {
+		return fmt.Errorf("failed to create members object JSON: %v", err)
+	}
+
+	if len(members) == 0 {
+		return fmt.Errorf("portfolio needs at least one member")
+	}
+
+	portfolioKey, err := ctx.GetStub().CreateCompositeKey(portfolioPrefix, []string{portfolioID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", portfolioPrefix, err)
+	}
+
+	portfolioBytes, err := ctx.GetStub().GetState(portfolioKey)
+	if err != nil {
+		return fmt.Errorf("failed to read portfolio from world state: %v", err)
+	}
+	if portfolioBytes != nil {
+		return fmt.Errorf("portfolio %v already exists", portfolioID)
+	}
+
+	portfolio := Portfolio{
+		ID:         portfolioID,
+		Aggregator: clientID,
+		Zone:       zone,
+		Members:    members,
+	}
+
+	portfolioBytes, err = marshalCanonical(portfolio)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(portfolioKey, portfolioBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", portfolioKey, err)
+	}
+
+	return nil
+}
+
+// SettlePortfolioImbalance nets the per-member deviations of a portfolio for
+// a slot. Deviations are passed as a JSON object mapping member IDs to signed
+// kWh (positive = over-delivery, negative = under-delivery). Only the
+// aggregator of the portfolio may settle, and only for registered members.
+// The per-member allocation is recorded alongside the netted total
+func (s *SmartContract) SettlePortfolioImbalance(ctx contractapi.TransactionContextInterface, portfolioID string, slot string, deviationsJSON string) (*NettingRecord, error) {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	portfolio, err := getPortfolio(ctx, portfolioID)
+	if err != nil {
+		return nil, err
+	}
+
+	if portfolio.Aggregator != clientID {
+		return nil, fmt.Errorf("Permission denied, client id %v is not the aggregator of the portfolio", clientID)
+	}
+
+	deviations := make(map[string]int)
+	err = json.Unmarshal([]byte(deviationsJSON), &deviations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create deviations object JSON: %v", err)
+	}
+
+	net := 0
+	for member, deviation := range deviations {
+		if !contains(portfolio.Members, member) {
+			return nil, fmt.Errorf("member %v is not part of portfolio %v", member, portfolioID)
+		}
+		net += deviation
+	}
+
+	nettingKey, err := ctx.GetStub().CreateCompositeKey(nettingPrefix, []string{portfolioID, slot})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", nettingPrefix, err)
+	}
+
+	nettingBytes, err := ctx.GetStub().GetState(nettingKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read netting record from world state: %v", err)
+	}
+	if nettingBytes != nil {
+		return nil, fmt.Errorf("portfolio %v has already been settled for slot %v", portfolioID, slot)
+	}
+
+	record := NettingRecord{
+		PortfolioID: portfolioID,
+		Slot:        slot,
+		NetKWh:      net,
+		Allocations: deviations,
+		TxID:        ctx.GetStub().GetTxID(),
+	}
+
+	nettingBytes, err = marshalCanonical(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(nettingKey, nettingBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update state of smart contract for key %s: %v", nettingKey, err)
+	}
+
+	return &record, nil
+}
+
+// GetPortfolio returns a registered portfolio
+func (s *SmartContract) GetPortfolio(ctx contractapi.TransactionContextInterface, portfolioID string) (*Portfolio, error) {
+	return getPortfolio(ctx, portfolioID)
+}
+
+// GetNettingRecord returns the netting result of a portfolio and slot
+func (s *SmartContract) GetNettingRecord(ctx contractapi.TransactionContextInterface, portfolioID string, slot string) (*NettingRecord, error) {
+
+	nettingKey, err := ctx.GetStub().CreateCompositeKey(nettingPrefix, []string{portfolioID, slot})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", nettingPrefix, err)
+	}
+
+	nettingBytes, err := ctx.GetStub().GetState(nettingKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read netting record from world state: %v", err)
+	}
+	if nettingBytes == nil {
+		return nil, fmt.Errorf("portfolio %v has not been settled for slot %v", portfolioID, slot)
+	}
+
+	var record NettingRecord
+	err = json.Unmarshal(nettingBytes, &record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create netting record object JSON: %v", err)
+	}
+
+	return &record, nil
+}
+
+// getPortfolio is an internal helper that reads a portfolio from state
+func getPortfolio(ctx contractapi.TransactionContextInterface, portfolioID string) (*Portfolio, error) {
+
+	portfolioKey, err := ctx.GetStub().CreateCompositeKey(portfolioPrefix, []string{portfolioID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", portfolioPrefix, err)
+	}
+
+	portfolioBytes, err := ctx.GetStub().GetState(portfolioKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read portfolio from world state: %v", err)
+	}
+	if portfolioBytes == nil {
+		return nil, fmt.Errorf("portfolio %v does not exist", portfolioID)
+	}
+
+	var portfolio Portfolio
+	err = json.Unmarshal(portfolioBytes, &portfolio)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create portfolio object JSON: %v", err)
+	}
+
+	return &portfolio, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const noncePrefix = "nonce"
+
+// Client-supplied idempotency nonces. A gateway that retries a timed-out
+// submission can double-spend a transfer, bid or order; the *WithNonce entry
+// points record each consumed nonce per account and reject a replay, so the
+// retried transaction fails instead of applying twice. The plain entry points
+// stay nonce-free for clients that handle retries themselves
+
+// TransferWithNonce is Transfer with a client-supplied idempotency nonce; a
+// nonce the caller has used before is rejected as a replay
+func (s *SmartContract) TransferWithNonce(ctx contractapi.TransactionContextInterface, recipient string, amount int, nonce string) error {
+
+	err := consumeNonce(ctx, nonce)
+	if err != nil {
+		return err
+	}
+
+	return s.Transfer(ctx, recipient, amount)
+}
+
+// SubmitBidWithNonce is SubmitBid with a client-supplied idempotency nonce
+func (s *SmartContract) SubmitBidWithNonce(ctx contractapi.TransactionContextInterface, auctionID string, amount int, greenPremium int, nonce string) error {
+
+	err := consumeNonce(ctx, nonce)
+	if err != nil {
+		return err
+	}
+
+	return s.SubmitBid(ctx, auctionID, amount, greenPremium)
+}
+
+// OrderMintWithNonce is OrderMint with a client-supplied idempotency nonce
+func (s *SmartContract) OrderMintWithNonce(ctx contractapi.TransactionContextInterface, amount int, nonce string) (string, error) {
+
+	err := consumeNonce(ctx, nonce)
+	if err != nil {
+		return "", err
+	}
+
+	return s.OrderMint(ctx, amount)
+}
+
+// OrderBurnWithNonce is OrderBurn with a client-supplied idempotency nonce
+func (s *SmartContract) OrderBurnWithNonce(ctx contractapi.TransactionContextInterface, amount int, nonce string) (string, error) {
+
+	err := consumeNonce(ctx, nonce)
+	if err != nil {
+		return "", err
+	}
+
+	return s.OrderBurn(ctx, amount)
+}
+
+// consumeNonce is an internal helper that marks a nonce of the calling client
+// as used. A nonce that was already consumed means the submission is a
+// gateway retry of an applied transaction, so it fails instead of re-applying
+func consumeNonce(ctx contractapi.TransactionContextInterface, nonce string) error {
+
+	if nonce == "" {
+		return fmt.Errorf("an idempotency nonce is required")
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	nonceKey, err := ctx.GetStub().CreateCompositeKey(noncePrefix, []string{clientID, nonce})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", noncePrefix, err)
+	}
+
+	nonceBytes, err := ctx.GetStub().GetState(nonceKey)
+	if err != nil {
+		return fmt.Errorf("failed to read nonce from world state: %v", err)
+	}
+	if nonceBytes != nil {
+		return fmt.Errorf("nonce %v was already used by transaction %s, the submission is a replay", nonce, string(nonceBytes))
+	}
+
+	// the consuming transaction's ID is stored so a rejected retry can be
+	// traced back to the submission that went through
+	err = ctx.GetStub().PutState(nonceKey, []byte(ctx.GetStub().GetTxID()))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", nonceKey, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const notificationPrefix = "notification"
+
+// Notification categories accounts can subscribe to
+const noticeLowBalance = "low-balance"
+const noticeHoldExpiring = "hold-expiring"
+const noticeObligationDue = "obligation-due"
+
+// NotificationPrefs are the notification preferences of one account. The
+// gateway service listens for Notice events and pushes them to the account;
+// the chaincode only emits for categories the account registered for
+type NotificationPrefs struct {
+	Account             string `json:"account"`
+	LowBalanceThreshold int    `json:"lowBalanceThreshold"`
+	HoldExpiring        bool   `json:"holdExpiring"`
+	ObligationDue       bool   `json:"obligationDue"`
+}
+
+// noticeEvent is the payload of the Notice event pushed to the gateway
+type noticeEvent struct {
+	Account  string `json:"account"`
+	Category string `json:"category"`
+	Detail   string `json:"detail"`
+}
+
+// RegisterNotifications stores the notification preferences of the submitting
+// client. A zero threshold disables the low balance notice
+func (s *SmartContract) RegisterNotifications(ctx contractapi.TransactionContextInterface, lowBalanceThreshold int, holdExpiring bool, obligationDue bool) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if lowBalanceThreshold < 0 {
+		return fmt.Errorf("low balance threshold cannot be negative")
+	}
+
+	prefs := NotificationPrefs{
+		Account:             clientID,
+		LowBalanceThreshold: lowBalanceThreshold,
+		HoldExpiring:        holdExpiring,
+		ObligationDue:       obligationDue,
+	}
+
+	prefsBytes, err := marshalCanonical(prefs)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	prefsKey, err := ctx.GetStub().CreateCompositeKey(notificationPrefix, []string{clientID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", notificationPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(prefsKey, prefsBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", prefsKey, err)
+	}
+
+	return nil
+}
+
+// GetNotifications returns the stored preferences of the submitting client
+func (s *SmartContract) GetNotifications(ctx contractapi.TransactionContextInterface) (*NotificationPrefs, error) {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	prefs, err := getNotificationPrefs(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if prefs == nil {
+		return nil, fmt.Errorf("no notification preferences registered for account %v", clientID)
+	}
+
+	return prefs, nil
+}
+
+// notifyAccount emits a Notice event for an account if, and only if, the
+// account registered for that category
+func notifyAccount(ctx contractapi.TransactionContextInterface, account string, category string, detail string) error {
+
+	prefs, err := getNotificationPrefs(ctx, account)
+	if err != nil {
+		return err
+	}
+	if prefs == nil {
+		return nil
+	}
+
+	switch category {
+	case noticeLowBalance:
+		if prefs.LowBalanceThreshold == 0 {
+			return nil
+		}
+	case noticeHoldExpiring:
+		if !prefs.HoldExpiring {
+			return nil
+		}
+	case noticeObligationDue:
+		if !prefs.ObligationDue {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unknown notification category %v", category)
+	}
+
+	notice := noticeEvent{
+		Account:  account,
+		Category: category,
+		Detail:   detail,
+	}
+
+	noticeJSON, err := json.Marshal(notice)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent("Notice", noticeJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
+
+// checkLowBalanceNotice emits a low balance notice when an account's balance
+// drops below its registered threshold
+func checkLowBalanceNotice(ctx contractapi.TransactionContextInterface, account string, balance int) error {
+
+	prefs, err := getNotificationPrefs(ctx, account)
+	if err != nil {
+		return err
+	}
+	if prefs == nil || prefs.LowBalanceThreshold == 0 || balance >= prefs.LowBalanceThreshold {
+		return nil
+	}
+
+	return notifyAccount(ctx, account, noticeLowBalance, fmt.Sprintf("balance %d is below threshold %d", balance, prefs.LowBalanceThreshold))
+}
+
+// getNotificationPrefs is an internal helper; a nil result without error
+// means the account never registered
+func getNotificationPrefs(ctx contractapi.TransactionContextInterface, account string) (*NotificationPrefs, error) {
+
+	prefsKey, err := ctx.GetStub().CreateCompositeKey(notificationPrefix, []string{account})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", notificationPrefix, err)
+	}
+
+	prefsBytes, err := ctx.GetStub().GetState(prefsKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notification preferences from world state: %v", err)
+	}
+	if prefsBytes == nil {
+		return nil, nil
+	}
+
+	var prefs NotificationPrefs
+	err = json.Unmarshal(prefsBytes, &prefs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notification preferences object JSON: %v", err)
+	}
+
+	return &prefs, nil
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const oracleIdentityPrefix = "oracleIdentity"
+const priceFeedPrefix = "priceFeed"
+const priceFeedValuePrefix = "priceFeedValue"
+
+// Define key names for options
+const priceBandKey = "priceBand"
+
+// PriceFeed is a registered reference price series: a description of what
+// the feed quotes and the maximum age in minutes before the latest point
+// counts as stale
+type PriceFeed struct {
+	ID          string `json:"ID"`
+	Description string `json:"description"`
+	MaxAgeMin   int    `json:"maxAgeMin"`
+}
+
+// PricePoint is one submitted reference price. ObservedAt is the oracle's
+// own reading time; SubmittedAt is the tx timestamp, which the staleness
+// check uses so every endorser agrees
+type PricePoint struct {
+	FeedID      string    `json:"feedID"`
+	Price       int       `json:"price"`
+	Oracle      string    `json:"oracle"`
+	ObservedAt  time.Time `json:"observedAt"`
+	SubmittedAt time.Time `json:"submittedAt"`
+}
+
+// PriceBand ties auction clearing to a feed: a clearing price per KWh more
+// than the configured percentage away from the latest feed price voids the
+// winner and the auction ends with no sale
+type PriceBand struct {
+	FeedID  string `json:"feedID"`
+	Percent int    `json:"percent"`
+}
+
+// RegisterOracle whitelists an identity as a price oracle. Only the
+// regulator manages the whitelist
+func (s *SmartContract) RegisterOracle(ctx contractapi.TransactionContextInterface, oracleID string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	oracleKey, err := ctx.GetStub().CreateCompositeKey(oracleIdentityPrefix, []string{oracleID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", oracleIdentityPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(oracleKey, []byte("true"))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", oracleKey, err)
+	}
+
+	return nil
+}
+
+// RemoveOracle removes an identity from the oracle whitelist
+func (s *SmartContract) RemoveOracle(ctx contractapi.TransactionContextInterface, oracleID string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	oracleKey, err := ctx.GetStub().CreateCompositeKey(oracleIdentityPrefix, []string{oracleID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", oracleIdentityPrefix, err)
+	}
+
+	err = ctx.GetStub().DelState(oracleKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete state of smart contract for key %s: %v", oracleKey, err)
+	}
+
+	return nil
+}
+
+// RegisterPriceFeed defines a reference price feed. Only the regulator
+// registers feeds
+func (s *SmartContract) RegisterPriceFeed(ctx contractapi.TransactionContextInterface, feedID string, description string, maxAgeMin int) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if maxAgeMin <= 0 {
+		return fmt.Errorf("maximum feed age must be a positive number of minutes")
+	}
+
+	feedKey, err := ctx.GetStub().CreateCompositeKey(priceFeedPrefix, []string{feedID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", priceFeedPrefix, err)
+	}
+
+	feed := PriceFeed{
+		ID:          feedID,
+		Description: description,
+		MaxAgeMin:   maxAgeMin,
+	}
+
+	feedBytes, err := marshalCanonical(feed)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(feedKey, feedBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", feedKey, err)
+	}
+
+	return nil
+}
+
+// SubmitPriceFeed pushes a new reference price onto a feed. Only
+// whitelisted oracles submit; every submission is a new revision of the feed
+// value key, so the full price history stays on the ledger
+func (s *SmartContract) SubmitPriceFeed(ctx contractapi.TransactionContextInterface, feedID string, price int, observedAt string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	oracleKey, err := ctx.GetStub().CreateCompositeKey(oracleIdentityPrefix, []string{clientID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", oracleIdentityPrefix, err)
+	}
+
+	oracleBytes, err := ctx.GetStub().GetState(oracleKey)
+	if err != nil {
+		return fmt.Errorf("failed to read oracle whitelist from world state: %v", err)
+	}
+	if oracleBytes == nil {
+		return fmt.Errorf("client is not a whitelisted oracle")
+	}
+
+	if _, err := getPriceFeed(ctx, feedID); err != nil {
+		return err
+	}
+
+	if price <= 0 {
+		return fmt.Errorf("reference price must be a positive integer")
+	}
+
+	observed, err := time.Parse(time.RFC3339, observedAt)
+	if err != nil {
+		return fmt.Errorf("failed to parse observation time: %v", err)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	point := PricePoint{
+		FeedID:      feedID,
+		Price:       price,
+		Oracle:      clientID,
+		ObservedAt:  observed,
+		SubmittedAt: time.Unix(timestamp.Seconds, int64(timestamp.Nanos)),
+	}
+
+	valueKey, err := ctx.GetStub().CreateCompositeKey(priceFeedValuePrefix, []string{feedID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", priceFeedValuePrefix, err)
+	}
+
+	pointBytes, err := marshalCanonical(point)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(valueKey, pointBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", valueKey, err)
+	}
+
+	return nil
+}
+
+// GetLatestPrice returns the latest point of a feed, rejecting a point older
+// than the feed's maximum age
+func (s *SmartContract) GetLatestPrice(ctx contractapi.TransactionContextInterface, feedID string) (*PricePoint, error) {
+
+	point, feed, err := latestPricePoint(ctx, feedID)
+	if err != nil {
+		return nil, err
+	}
+	if point == nil {
+		return nil, fmt.Errorf("feed %v has no submitted price yet", feedID)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timestamp")
+	}
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	if now.Sub(point.SubmittedAt) > time.Duration(feed.MaxAgeMin)*time.Minute {
+		return nil, fmt.Errorf("the latest price of feed %v is stale", feedID)
+	}
+
+	return point, nil
+}
+
+// GetPriceFeedHistory returns every submitted point of a feed in ledger
+// order, reconstructed from the revisions of the feed value key
+func (s *SmartContract) GetPriceFeedHistory(ctx contractapi.TransactionContextInterface, feedID string) ([]PricePoint, error) {
+
+	valueKey, err := ctx.GetStub().CreateCompositeKey(priceFeedValuePrefix, []string{feedID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", priceFeedValuePrefix, err)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(valueKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history of feed %s: %v", feedID, err)
+	}
+	defer resultsIterator.Close()
+
+	points := []PricePoint{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history of feed %s: %v", feedID, err)
+		}
+
+		if queryResponse.IsDelete {
+			continue
+		}
+
+		var point PricePoint
+		err = json.Unmarshal(queryResponse.Value, &point)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create price point object JSON: %v", err)
+		}
+
+		points = append(points, point)
+	}
+
+	return points, nil
+}
+
+// SetPriceBand ties auction clearing to a feed. Only the regulator sets the
+// band; an empty feed ID removes it
+func (s *SmartContract) SetPriceBand(ctx contractapi.TransactionContextInterface, feedID string, percent int) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if feedID == "" {
+		err = ctx.GetStub().DelState(priceBandKey)
+		if err != nil {
+			return fmt.Errorf("failed to delete state of smart contract for key %s: %v", priceBandKey, err)
+		}
+		return nil
+	}
+
+	if percent <= 0 || percent >= 100 {
+		return fmt.Errorf("band percentage must be between 1 and 99")
+	}
+
+	if _, err := getPriceFeed(ctx, feedID); err != nil {
+		return err
+	}
+
+	band := PriceBand{
+		FeedID:  feedID,
+		Percent: percent,
+	}
+
+	bandBytes, err := marshalCanonical(band)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(priceBandKey, bandBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", priceBandKey, err)
+	}
+
+	return nil
+}
+
+// enforcePriceBand voids the winner of a cleared auction when the clearing
+// price per KWh falls outside the configured band around the latest feed
+// price. A stale or empty feed skips enforcement with a receipt, so a dead
+// oracle cannot freeze the market
+func enforcePriceBand(ctx contractapi.TransactionContextInterface, auctionID string, auctionJSON *Auction) error {
+
+	if auctionJSON.Winner == "" {
+		return nil
+	}
+
+	bandBytes, err := ctx.GetStub().GetState(priceBandKey)
+	if err != nil {
+		return fmt.Errorf("failed to read price band from world state: %v", err)
+	}
+	if bandBytes == nil {
+		return nil
+	}
+
+	var band PriceBand
+	err = json.Unmarshal(bandBytes, &band)
+	if err != nil {
+		return fmt.Errorf("failed to create price band object JSON: %v", err)
+	}
+
+	point, feed, err := latestPricePoint(ctx, band.FeedID)
+	if err != nil {
+		return err
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	if point == nil || now.Sub(point.SubmittedAt) > time.Duration(feed.MaxAgeMin)*time.Minute {
+		return recordReceipt(ctx, priceFeedPrefix, auctionID, fmt.Sprintf("price band check skipped on auction %s, feed %s is stale", auctionID, band.FeedID))
+	}
+
+	// quantities are stored in Wh; the band compares per-KWh prices
+	kwh := auctionJSON.Amount / 1000
+	if kwh <= 0 {
+		return nil
+	}
+	clearingPerKWh := auctionJSON.Price / kwh
+
+	low := point.Price * (100 - band.Percent) / 100
+	high := point.Price * (100 + band.Percent) / 100
+
+	if clearingPerKWh < low || clearingPerKWh > high {
+		// the sale is voided: the auction ends with no winner and settling
+		// only releases the bidders' holds
+		auctionJSON.Winner = ""
+		auctionJSON.Price = kwh * auctionJSON.PricePerKWh
+
+		return recordReceipt(ctx, priceFeedPrefix, auctionID, fmt.Sprintf("sale on auction %s voided, clearing price %d per KWh is outside the %d%% band around feed %s at %d", auctionID, clearingPerKWh, band.Percent, band.FeedID, point.Price))
+	}
+
+	return nil
+}
+
+// getPriceFeed is an internal helper that reads a feed definition
+func getPriceFeed(ctx contractapi.TransactionContextInterface, feedID string) (*PriceFeed, error) {
+
+	feedKey, err := ctx.GetStub().CreateCompositeKey(priceFeedPrefix, []string{feedID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", priceFeedPrefix, err)
+	}
+
+	feedBytes, err := ctx.GetStub().GetState(feedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price feed from world state: %v", err)
+	}
+	if feedBytes == nil {
+		return nil, fmt.Errorf("no price feed %v exists", feedID)
+	}
+
+	var feed PriceFeed
+	err = json.Unmarshal(feedBytes, &feed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create price feed object JSON: %v", err)
+	}
+
+	return &feed, nil
+}
+
+// latestPricePoint is an internal helper that reads a feed's definition and
+// its latest point; a nil point means nothing has been submitted yet
+func latestPricePoint(ctx contractapi.TransactionContextInterface, feedID string) (*PricePoint, *PriceFeed, error) {
+
+	feed, err := getPriceFeed(ctx, feedID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	valueKey, err := ctx.GetStub().CreateCompositeKey(priceFeedValuePrefix, []string{feedID})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", priceFeedValuePrefix, err)
+	}
+
+	pointBytes, err := ctx.GetStub().GetState(valueKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read price point from world state: %v", err)
+	}
+	if pointBytes == nil {
+		return nil, feed, nil
+	}
+
+	var point PricePoint
+	err = json.Unmarshal(pointBytes, &point)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create price point object JSON: %v", err)
+	}
+
+	return &point, feed, nil
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const orderPrefix = "order"
+
+const stateExecuted = "Executed"
+const stateExpired = "Expired"
+
+// orders expire this many minutes after they are placed
+const orderTTLMin = 1440
+
+// Order is one mint or burn order under its own generated ID. Orders used to
+// live in a single map keyed by client, so a second order from the same
+// client silently overwrote the first; separate records keep every order and
+// its decision history
+type Order struct {
+	ID        string    `json:"id"`
+	Client    string    `json:"client"`
+	Type      string    `json:"type"`
+	Amount    int       `json:"amount"`
+	State     string    `json:"state"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	DecidedAt time.Time `json:"decidedAt"`
+}
+
+// placeOrder is an internal helper that records a new mint or burn order for
+// the submitting client. The transaction ID becomes the order ID
+func placeOrder(ctx contractapi.TransactionContextInterface, orderType string, amount int) (string, error) {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if amount <= 0 {
+		return "", fmt.Errorf("order amount must be a positive integer")
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("failed to get timestamp")
+	}
+
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	order := Order{
+		ID:        ctx.GetStub().GetTxID(),
+		Client:    clientID,
+		Type:      orderType,
+		Amount:    amount,
+		State:     stateOrder,
+		CreatedAt: now,
+		ExpiresAt: now.Add(orderTTLMin * time.Minute),
+	}
+
+	err = putOrder(ctx, &order)
+	if err != nil {
+		return "", err
+	}
+
+	return order.ID, nil
+}
+
+// decideOrder is an internal helper that moves an order of the expected type
+// from the ordered state into a decision state. The reason is recorded on
+// the order so a rejected client can see why
+func decideOrder(ctx contractapi.TransactionContextInterface, orderID string, orderType string, newState string, reason string) (*Order, error) {
+
+	order, err := getOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.Type != orderType {
+		return nil, fmt.Errorf("order %v is not a %v order", orderID, orderType)
+	}
+	if order.State != stateOrder {
+		return nil, fmt.Errorf("order %v is not in order stage", orderID)
+	}
+
+	// expired orders cannot be decided anymore
+	expired, err := orderExpired(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	if expired {
+		err = expireOrder(ctx, order)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("order %v has expired", orderID)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timestamp")
+	}
+
+	order.State = newState
+	order.Reason = reason
+	order.DecidedAt = time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	err = putOrder(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// listOrders is an internal helper that returns the orders of one type in
+// one state; an empty client matches every client
+func listOrders(ctx contractapi.TransactionContextInterface, orderType string, state string, client string) ([]Order, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(orderPrefix, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read orders from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	orders := []Order{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read orders from world state: %v", err)
+		}
+
+		var order Order
+		err = json.Unmarshal(queryResponse.Value, &order)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create order object JSON: %v", err)
+		}
+
+		if order.Type != orderType || order.State != state {
+			continue
+		}
+		if client != "" && order.Client != client {
+			continue
+		}
+
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
+// getOrder is an internal helper that reads one order
+func getOrder(ctx contractapi.TransactionContextInterface, orderID string) (*Order, error) {
+
+	orderKey, err := ctx.GetStub().CreateCompositeKey(orderPrefix, []string{orderID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", orderPrefix, err)
+	}
+
+	orderBytes, err := ctx.GetStub().GetState(orderKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read order from world state: %v", err)
+	}
+	if orderBytes == nil {
+		return nil, fmt.Errorf("order %v does not exist", orderID)
+	}
+
+	var order Order
+	err = json.Unmarshal(orderBytes, &order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order object JSON: %v", err)
+	}
+
+	return &order, nil
+}
+
+// putOrder is an internal helper that writes one order
+func putOrder(ctx contractapi.TransactionContextInterface, order *Order) error {
+
+	orderKey, err := ctx.GetStub().CreateCompositeKey(orderPrefix, []string{order.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", orderPrefix, err)
+	}
+
+	orderBytes, err := marshalCanonical(order)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(orderKey, orderBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", orderKey, err)
+	}
+
+	return nil
+}
+
+// orderExpired compares the current tx timestamp against the order's
+// expiry. Orders placed before the TTL existed have a zero ExpiresAt and
+// never expire
+func orderExpired(ctx contractapi.TransactionContextInterface, order *Order) (bool, error) {
+
+	if order.ExpiresAt.IsZero() {
+		return false, nil
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return false, fmt.Errorf("failed to get timestamp")
+	}
+
+	return time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).After(order.ExpiresAt), nil
+}
+
+// expireOrder is an internal helper that moves an order into the expired
+// state and emits the OrderExpired event
+func expireOrder(ctx contractapi.TransactionContextInterface, order *Order) error {
+
+	order.State = stateExpired
+
+	err := putOrder(ctx, order)
+	if err != nil {
+		return err
+	}
+
+	meta, err := eventMeta(ctx)
+	if err != nil {
+		return err
+	}
+	err = emitEvent(ctx, "OrderExpired", OrderExpiredEvent{EventMeta: meta, OrderID: order.ID, Client: order.Client, Type: order.Type, Amount: order.Amount})
+	if err != nil {
+		return err
+	}
+
+	return recordReceipt(ctx, orderPrefix, order.ID, fmt.Sprintf("%s order %s of %s expired", order.Type, order.ID, order.Client))
+}
+
+// PurgeExpiredOrders sweeps the order book and expires every open or
+// approved order past its TTL. Any client can run the sweep: the expiry
+// check only uses the tx timestamp, so all endorsers agree on the outcome.
+// The number of purged orders is returned
+func (s *SmartContract) PurgeExpiredOrders(ctx contractapi.TransactionContextInterface) (int, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(orderPrefix, []string{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read orders from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	purged := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read orders from world state: %v", err)
+		}
+
+		var order Order
+		err = json.Unmarshal(queryResponse.Value, &order)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create order object JSON: %v", err)
+		}
+
+		if order.State != stateOrder && order.State != stateApproved {
+			continue
+		}
+
+		expired, err := orderExpired(ctx, &order)
+		if err != nil {
+			return 0, err
+		}
+		if !expired {
+			continue
+		}
+
+		err = expireOrder(ctx, &order)
+		if err != nil {
+			return 0, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// OrderSnapshot is one historical revision of an order key, used by the
+// order audit trail
+type OrderSnapshot struct {
+	TxID      string    `json:"txID"`
+	Timestamp time.Time `json:"timestamp"`
+	IsDelete  bool      `json:"isDelete"`
+	Order     *Order    `json:"order,omitempty"`
+}
+
+// GetOrdersByState returns the mint and burn orders in one state. The
+// regulator sees every client's orders; other clients only see their own
+func (s *SmartContract) GetOrdersByState(ctx contractapi.TransactionContextInterface, state string) ([]Order, error) {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	regulator := requireRole(ctx, roleRegulator) == nil
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(orderPrefix, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read orders from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	orders := []Order{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read orders from world state: %v", err)
+		}
+
+		var order Order
+		err = json.Unmarshal(queryResponse.Value, &order)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create order object JSON: %v", err)
+		}
+
+		if order.State != state {
+			continue
+		}
+		if !regulator && order.Client != clientID {
+			continue
+		}
+
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
+// GetOrderHistory returns every ledger revision of an order, so regulators
+// can audit how a decision evolved
+func (s *SmartContract) GetOrderHistory(ctx contractapi.TransactionContextInterface, orderID string) ([]OrderSnapshot, error) {
+
+	orderKey, err := ctx.GetStub().CreateCompositeKey(orderPrefix, []string{orderID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", orderPrefix, err)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(orderKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history of order %s: %v", orderID, err)
+	}
+	defer resultsIterator.Close()
+
+	snapshots := []OrderSnapshot{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history of order %s: %v", orderID, err)
+		}
+
+		snapshot := OrderSnapshot{
+			TxID:      queryResponse.TxId,
+			Timestamp: time.Unix(queryResponse.Timestamp.Seconds, int64(queryResponse.Timestamp.Nanos)),
+			IsDelete:  queryResponse.IsDelete,
+		}
+
+		if !queryResponse.IsDelete {
+			var order Order
+			err = json.Unmarshal(queryResponse.Value, &order)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create order object JSON: %v", err)
+			}
+			snapshot.Order = &order
+		}
+
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, nil
+}
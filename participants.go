@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const participantPrefix = "participant"
+
+// Participant roles in the energy market
+const participantProducer = "producer"
+const participantConsumer = "consumer"
+const participantProsumer = "prosumer"
+
+// KYC statuses
+const kycPending = "pending"
+const kycApproved = "approved"
+const kycRejected = "rejected"
+
+// Participant is the registry profile of a market member: their market role,
+// the grid connection point they operate at, the meters they own, and the
+// KYC status the regulator maintains. Accounts, auctions and bids all
+// require a registered participant
+type Participant struct {
+	ID              string    `json:"ID"`
+	Role            string    `json:"role"`
+	ConnectionPoint string    `json:"connectionPoint"`
+	MeterIDs        []string  `json:"meterIDs"`
+	KYCStatus       string    `json:"kycStatus"`
+	RegisteredAt    time.Time `json:"registeredAt"`
+}
+
+// RegisterParticipant registers the calling client in the participant
+// registry with a pending KYC status; the regulator approves or rejects the
+// profile afterwards
+func (s *SmartContract) RegisterParticipant(ctx contractapi.TransactionContextInterface, role string, connectionPoint string, meterIDs []string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if role != participantProducer && role != participantConsumer && role != participantProsumer {
+		return fmt.Errorf("role must be %s, %s or %s", participantProducer, participantConsumer, participantProsumer)
+	}
+
+	existing, _ := getParticipant(ctx, clientID)
+	if existing != nil {
+		return fmt.Errorf("client is already registered")
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	participant := Participant{
+		ID:              clientID,
+		Role:            role,
+		ConnectionPoint: connectionPoint,
+		MeterIDs:        meterIDs,
+		KYCStatus:       kycPending,
+		RegisteredAt:    time.Unix(timestamp.Seconds, int64(timestamp.Nanos)),
+	}
+
+	return putParticipant(ctx, &participant)
+}
+
+// UpdateParticipant updates the calling client's own profile. Changing the
+// profile sends the KYC status back to pending, since the regulator verified
+// the old data
+func (s *SmartContract) UpdateParticipant(ctx contractapi.TransactionContextInterface, role string, connectionPoint string, meterIDs []string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if role != participantProducer && role != participantConsumer && role != participantProsumer {
+		return fmt.Errorf("role must be %s, %s or %s", participantProducer, participantConsumer, participantProsumer)
+	}
+
+	participant, err := getParticipant(ctx, clientID)
+	if err != nil {
+		return err
+	}
+
+	participant.Role = role
+	participant.ConnectionPoint = connectionPoint
+	participant.MeterIDs = meterIDs
+	participant.KYCStatus = kycPending
+
+	return putParticipant(ctx, participant)
+}
+
+// SetKYCStatus approves or rejects a participant's profile. Only the
+// regulator sets KYC statuses
+func (s *SmartContract) SetKYCStatus(ctx contractapi.TransactionContextInterface, participantID string, status string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if status != kycApproved && status != kycRejected && status != kycPending {
+		return fmt.Errorf("KYC status must be %s, %s or %s", kycApproved, kycRejected, kycPending)
+	}
+
+	participant, err := getParticipant(ctx, participantID)
+	if err != nil {
+		return err
+	}
+
+	participant.KYCStatus = status
+
+	return putParticipant(ctx, participant)
+}
+
+// GetParticipant returns the registry profile of a participant
+func (s *SmartContract) GetParticipant(ctx contractapi.TransactionContextInterface, participantID string) (*Participant, error) {
+	return getParticipant(ctx, participantID)
+}
+
+// ListParticipants returns every profile in the participant registry
+func (s *SmartContract) ListParticipants(ctx contractapi.TransactionContextInterface) ([]Participant, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(participantPrefix, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read participant registry from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	participants := []Participant{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read participant registry from world state: %v", err)
+		}
+
+		var participant Participant
+		err = json.Unmarshal(queryResponse.Value, &participant)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create participant object JSON: %v", err)
+		}
+
+		participants = append(participants, participant)
+	}
+
+	return participants, nil
+}
+
+// requireRegistered is an internal helper used by the account and trading
+// entry points: the calling client has to be in the participant registry and
+// must not have a rejected KYC status
+func requireRegistered(ctx contractapi.TransactionContextInterface) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	participant, err := getParticipant(ctx, clientID)
+	if err != nil {
+		return fmt.Errorf("client is not a registered participant, call RegisterParticipant first")
+	}
+
+	if participant.KYCStatus == kycRejected {
+		return fmt.Errorf("client's KYC status is rejected")
+	}
+
+	return nil
+}
+
+// getParticipant is an internal helper that reads a participant profile
+func getParticipant(ctx contractapi.TransactionContextInterface, participantID string) (*Participant, error) {
+
+	participantKey, err := ctx.GetStub().CreateCompositeKey(participantPrefix, []string{participantID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", participantPrefix, err)
+	}
+
+	participantBytes, err := ctx.GetStub().GetState(participantKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read participant from world state: %v", err)
+	}
+	if participantBytes == nil {
+		return nil, fmt.Errorf("no participant %v exists", participantID)
+	}
+
+	var participant Participant
+	err = json.Unmarshal(participantBytes, &participant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create participant object JSON: %v", err)
+	}
+
+	return &participant, nil
+}
+
+// putParticipant is an internal helper that writes a participant profile
+func putParticipant(ctx contractapi.TransactionContextInterface, participant *Participant) error {
+
+	participantKey, err := ctx.GetStub().CreateCompositeKey(participantPrefix, []string{participant.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", participantPrefix, err)
+	}
+
+	participantBytes, err := marshalCanonical(participant)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(participantKey, participantBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", participantKey, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define key names for options
+const pausedKey = "paused"
+
+// The pause switch lets the operator halt trading during incidents or
+// upgrades without taking the chaincode down: while the contract is paused
+// every state-changing transaction is rejected, but queries keep working
+
+// PauseContract halts all state-changing transactions. Only the regulator
+// can pause the contract
+func (s *SmartContract) PauseContract(ctx contractapi.TransactionContextInterface) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(pausedKey, []byte("true"))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", pausedKey, err)
+	}
+
+	return nil
+}
+
+// UnpauseContract resumes normal operation. Only the regulator can unpause
+// the contract
+func (s *SmartContract) UnpauseContract(ctx contractapi.TransactionContextInterface) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().DelState(pausedKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete state of smart contract for key %s: %v", pausedKey, err)
+	}
+
+	return nil
+}
+
+// IsPaused returns whether the contract is currently paused
+func (s *SmartContract) IsPaused(ctx contractapi.TransactionContextInterface) (bool, error) {
+
+	pausedBytes, err := ctx.GetStub().GetState(pausedKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read paused state from world state: %v", err)
+	}
+
+	return pausedBytes != nil, nil
+}
+
+// checkNotPaused is an internal helper that rejects state-changing
+// transactions while the contract is paused
+func checkNotPaused(ctx contractapi.TransactionContextInterface) error {
+
+	pausedBytes, err := ctx.GetStub().GetState(pausedKey)
+	if err != nil {
+		return fmt.Errorf("failed to read paused state from world state: %v", err)
+	}
+	if pausedBytes != nil {
+		return fmt.Errorf("the contract is paused")
+	}
+
+	return nil
+}
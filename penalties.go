@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const penaltyPrefix = "penalty"
+
+// Penalty statuses
+const penaltyCharged = "charged"
+const penaltyAppealed = "appealed"
+const penaltyUpheld = "upheld"
+const penaltyReversed = "reversed"
+
+// appeal window in minutes after a penalty is charged during which the
+// penalized party can file an appeal
+const appealWindowMin = 10080
+
+// Penalty is a shortfall or imbalance penalty charged against an account.
+// A reversal never edits the balance silently: the counter-posting is a
+// separate credit recorded with its own receipt that names this penalty
+type Penalty struct {
+	ID           string    `json:"id"`
+	Account      string    `json:"account"`
+	Amount       int       `json:"amount"`
+	Reason       string    `json:"reason"`
+	ChargedAt    time.Time `json:"chargedAt"`
+	AppealUntil  time.Time `json:"appealUntil"`
+	Evidence     string    `json:"evidence"`
+	Decision     string    `json:"decision"`
+	ReversalTxID string    `json:"reversalTxID"`
+	Status       string    `json:"status"`
+}
+
+// ChargePenalty debits a shortfall or imbalance penalty from an account and
+// opens the appeal window. Only the regulator may charge; the transaction ID
+// becomes the penalty ID
+func (s *SmartContract) ChargePenalty(ctx contractapi.TransactionContextInterface, account string, amount int, reason string) (string, error) {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return "", err
+	}
+
+	if amount <= 0 {
+		return "", fmt.Errorf("penalty amount must be a positive integer")
+	}
+
+	balanceBytes, err := getBalanceBytes(ctx, account)
+	if err != nil {
+		return "", fmt.Errorf("failed to read account %s from world state: %v", account, err)
+	}
+	if balanceBytes == nil {
+		return "", fmt.Errorf("the account %s does not exist", account)
+	}
+
+	balance, err := parseBalance(balanceBytes)
+	if err != nil {
+		return "", err
+	}
+
+	updatedBalance, err := subBalance(balance, amount)
+	if err != nil {
+		return "", fmt.Errorf("penalty of %d exceeds the balance of account %s", amount, account)
+	}
+
+	err = putBalanceBytes(ctx, account, formatBalance(updatedBalance))
+	if err != nil {
+		return "", fmt.Errorf("failed to update state of smart contract for key %s: %v", account, err)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("failed to get timestamp")
+	}
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	penalty := Penalty{
+		ID:          ctx.GetStub().GetTxID(),
+		Account:     account,
+		Amount:      amount,
+		Reason:      reason,
+		ChargedAt:   now,
+		AppealUntil: now.Add(appealWindowMin * time.Minute),
+		Status:      penaltyCharged,
+	}
+
+	err = putPenalty(ctx, &penalty)
+	if err != nil {
+		return "", err
+	}
+
+	err = recordReceipt(ctx, "penalty", penalty.ID, fmt.Sprintf("penalty of %d charged to %s: %s", amount, account, reason))
+	if err != nil {
+		return "", err
+	}
+
+	return penalty.ID, nil
+}
+
+// AppealPenalty files an appeal against a charged penalty. Only the penalized
+// party can appeal, and only within the appeal window; the evidence is
+// recorded on the penalty for the regulator to review
+func (s *SmartContract) AppealPenalty(ctx contractapi.TransactionContextInterface, penaltyID string, evidence string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	penalty, err := getPenalty(ctx, penaltyID)
+	if err != nil {
+		return err
+	}
+
+	if clientID != penalty.Account {
+		return fmt.Errorf("only the penalized party can appeal")
+	}
+
+	if penalty.Status != penaltyCharged {
+		return fmt.Errorf("penalty %v is not open for appeal", penaltyID)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+	if time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).After(penalty.AppealUntil) {
+		return fmt.Errorf("the appeal window has closed")
+	}
+
+	penalty.Evidence = evidence
+	penalty.Status = penaltyAppealed
+
+	return putPenalty(ctx, penalty)
+}
+
+// ResolveAppeal decides an appealed penalty. An upheld penalty stands as
+// charged; a reversal posts an explicit counter-credit linked to the original
+// penalty by its receipt. Only the regulator may resolve
+func (s *SmartContract) ResolveAppeal(ctx contractapi.TransactionContextInterface, penaltyID string, uphold bool, decision string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	penalty, err := getPenalty(ctx, penaltyID)
+	if err != nil {
+		return err
+	}
+
+	if penalty.Status != penaltyAppealed {
+		return fmt.Errorf("penalty %v has no open appeal", penaltyID)
+	}
+
+	penalty.Decision = decision
+
+	if uphold {
+		penalty.Status = penaltyUpheld
+		return putPenalty(ctx, penalty)
+	}
+
+	// the reversal is a counter-posting: the original debit stays in the
+	// history and an explicit credit of the same amount references it
+	balanceBytes, err := getBalanceBytes(ctx, penalty.Account)
+	if err != nil {
+		return fmt.Errorf("failed to read account %s from world state: %v", penalty.Account, err)
+	}
+	if balanceBytes == nil {
+		return fmt.Errorf("the account %s does not exist", penalty.Account)
+	}
+
+	balance, err := parseBalance(balanceBytes)
+	if err != nil {
+		return err
+	}
+
+	err = putBalanceBytes(ctx, penalty.Account, formatBalance(addBalance(balance, penalty.Amount)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", penalty.Account, err)
+	}
+
+	penalty.ReversalTxID = ctx.GetStub().GetTxID()
+	penalty.Status = penaltyReversed
+
+	err = putPenalty(ctx, penalty)
+	if err != nil {
+		return err
+	}
+
+	return recordReceipt(ctx, "penalty", penaltyID, fmt.Sprintf("penalty %s reversed, %d credited back to %s", penaltyID, penalty.Amount, penalty.Account))
+}
+
+// GetPenalty returns one penalty record
+func (s *SmartContract) GetPenalty(ctx contractapi.TransactionContextInterface, penaltyID string) (*Penalty, error) {
+	return getPenalty(ctx, penaltyID)
+}
+
+// getPenalty is an internal helper that reads a penalty record
+func getPenalty(ctx contractapi.TransactionContextInterface, penaltyID string) (*Penalty, error) {
+
+	penaltyKey, err := ctx.GetStub().CreateCompositeKey(penaltyPrefix, []string{penaltyID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", penaltyPrefix, err)
+	}
+
+	penaltyBytes, err := ctx.GetStub().GetState(penaltyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read penalty from world state: %v", err)
+	}
+	if penaltyBytes == nil {
+		return nil, fmt.Errorf("penalty %v does not exist", penaltyID)
+	}
+
+	var penalty Penalty
+	err = json.Unmarshal(penaltyBytes, &penalty)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create penalty object JSON: %v", err)
+	}
+
+	return &penalty, nil
+}
+
+// putPenalty is an internal helper that writes a penalty record
+func putPenalty(ctx contractapi.TransactionContextInterface, penalty *Penalty) error {
+
+	penaltyKey, err := ctx.GetStub().CreateCompositeKey(penaltyPrefix, []string{penalty.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", penaltyPrefix, err)
+	}
+
+	penaltyBytes, err := marshalCanonical(penalty)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(penaltyKey, penaltyBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", penaltyKey, err)
+	}
+
+	return nil
+}
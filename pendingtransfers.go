@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const pendingTransferPrefix = "pendingTransfer"
+
+// Pending transfer statuses
+const pendingOpen = "pending"
+const pendingAccepted = "accepted"
+const pendingRejected = "rejected"
+const pendingExpired = "expired"
+
+// window in minutes within which the recipient must accept or reject a
+// pending transfer; after it the sweep refunds the sender
+const acceptWindowMin = 1440
+
+// PendingTransfer is a two-step transfer for recipients whose compliance
+// rules forbid unsolicited incoming funds. The sender's amount goes on hold
+// at submission time and only moves to the recipient when they accept; a
+// rejection or an unanswered window returns it to the sender
+type PendingTransfer struct {
+	ID        string    `json:"id"`
+	Sender    string    `json:"sender"`
+	Recipient string    `json:"recipient"`
+	Amount    int       `json:"amount"`
+	CreatedAt time.Time `json:"createdAt"`
+	Expiry    time.Time `json:"expiry"`
+	Status    string    `json:"status"`
+}
+
+// TransferPending offers a transfer to a recipient who must explicitly
+// accept it. The amount moves onto the sender's hold so acceptance can never
+// fail on an empty account. The transfer ID is the transaction ID
+func (s *SmartContract) TransferPending(ctx contractapi.TransactionContextInterface, recipient string, amount int) (string, error) {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if recipient == clientID {
+		return "", fmt.Errorf("cannot offer a pending transfer to yourself")
+	}
+	if amount <= 0 {
+		return "", fmt.Errorf("transfer amount must be a positive integer")
+	}
+
+	// closed accounts take no part in transfers in either direction
+	if err := checkAccountOpen(ctx, recipient); err != nil {
+		return "", err
+	}
+
+	// the same island, maker-checker and spending-limit rules apply as on a
+	// plain Transfer, so the two-step route cannot bypass them
+	err = checkIslandTransfer(ctx, clientID, recipient, amount)
+	if err != nil {
+		return "", err
+	}
+	err = checkMakerChecker(ctx, amount)
+	if err != nil {
+		return "", err
+	}
+	err = checkSpendingLimits(ctx, clientID, amount)
+	if err != nil {
+		return "", err
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("failed to get timestamp")
+	}
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	transfer := PendingTransfer{
+		ID:        ctx.GetStub().GetTxID(),
+		Sender:    clientID,
+		Recipient: recipient,
+		Amount:    amount,
+		CreatedAt: now,
+		Expiry:    now.Add(acceptWindowMin * time.Minute),
+		Status:    pendingOpen,
+	}
+
+	balanceBytes, err := getBalanceBytes(ctx, clientID)
+	if err != nil {
+		return "", fmt.Errorf("failed to read client's account %s from world state: %v", clientID, err)
+	}
+	if balanceBytes == nil {
+		return "", fmt.Errorf("the account %s does not exist", clientID)
+	}
+
+	balance, err := parseBalance(balanceBytes)
+	if err != nil {
+		return "", err
+	}
+
+	// the offer is funded up front with a balance-checked hold record
+	// keyed by the transfer ID, so settlement moves exactly this amount
+	err = createHoldRecord(ctx, clientID, transfer.ID, amount, "pending-transfer", acceptWindowMin)
+	if err != nil {
+		return "", fmt.Errorf("cannot create hold: %v", err)
+	}
+
+	// the sender pays the configured platform fee at offer time like on a
+	// direct Transfer, debited against the balance the hold already reduced;
+	// it is not refunded if the offer is rejected or expires
+	postHold, err := subBalance(balance, amount)
+	if err != nil {
+		return "", fmt.Errorf("client account %s has insufficient funds", clientID)
+	}
+	_, err = chargeTransferFee(ctx, clientID, amount, postHold)
+	if err != nil {
+		return "", err
+	}
+
+	err = putPendingTransfer(ctx, &transfer)
+	if err != nil {
+		return "", err
+	}
+
+	err = recordReceipt(ctx, pendingTransferPrefix, transfer.ID, fmt.Sprintf("pending transfer of %d offered by %s to %s", amount, clientID, recipient))
+	if err != nil {
+		return "", err
+	}
+
+	return transfer.ID, nil
+}
+
+// AcceptTransfer accepts a pending transfer addressed to the submitting
+// client. The sender's held amount moves to the recipient's balance and the
+// usual Transfer event fires so downstream listeners see a normal payment
+func (s *SmartContract) AcceptTransfer(ctx contractapi.TransactionContextInterface, transferID string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	transfer, err := getPendingTransfer(ctx, clientID, transferID)
+	if err != nil {
+		return err
+	}
+
+	if transfer.Status != pendingOpen {
+		return fmt.Errorf("pending transfer %v is not open", transferID)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+	if time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).After(transfer.Expiry) {
+		return fmt.Errorf("pending transfer %v has expired, the sweep will refund the sender", transferID)
+	}
+
+	// execute exactly this transfer's hold record, paying the submitting
+	// client; holds backing the sender's other offers or bids are untouched
+	err = executeHoldRecord(ctx, clientID, transfer.Sender, transfer.ID, transfer.Amount)
+	if err != nil {
+		return fmt.Errorf("cannot execute hold: %v", err)
+	}
+
+	transfer.Status = pendingAccepted
+
+	err = putPendingTransfer(ctx, transfer)
+	if err != nil {
+		return err
+	}
+
+	err = recordReceipt(ctx, pendingTransferPrefix, transferID, fmt.Sprintf("pending transfer %s accepted by %s", transferID, clientID))
+	if err != nil {
+		return err
+	}
+
+	// Emit the Transfer event
+	meta, err := eventMeta(ctx)
+	if err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, "Transfer", TransferEvent{EventMeta: meta, From: transfer.Sender, To: transfer.Recipient, Value: transfer.Amount})
+}
+
+// RejectTransfer declines a pending transfer addressed to the submitting
+// client and returns the held amount to the sender
+func (s *SmartContract) RejectTransfer(ctx contractapi.TransactionContextInterface, transferID string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	transfer, err := getPendingTransfer(ctx, clientID, transferID)
+	if err != nil {
+		return err
+	}
+
+	if transfer.Status != pendingOpen {
+		return fmt.Errorf("pending transfer %v is not open", transferID)
+	}
+
+	err = refundPendingTransfer(ctx, transfer)
+	if err != nil {
+		return err
+	}
+
+	transfer.Status = pendingRejected
+
+	err = putPendingTransfer(ctx, transfer)
+	if err != nil {
+		return err
+	}
+
+	return recordReceipt(ctx, pendingTransferPrefix, transferID, fmt.Sprintf("pending transfer %s rejected by %s", transferID, clientID))
+}
+
+// SweepExpiredTransfers refunds all unanswered pending transfers of a
+// recipient whose acceptance window has passed. Anyone may run the sweep
+// since it only returns funds to their senders
+func (s *SmartContract) SweepExpiredTransfers(ctx contractapi.TransactionContextInterface, recipient string) (int, error) {
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get timestamp")
+	}
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(pendingTransferPrefix, []string{recipient})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read pending transfers from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	swept := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read pending transfers from world state: %v", err)
+		}
+
+		var transfer PendingTransfer
+		err = json.Unmarshal(queryResponse.Value, &transfer)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create pending transfer object JSON: %v", err)
+		}
+
+		if transfer.Status != pendingOpen || !now.After(transfer.Expiry) {
+			continue
+		}
+
+		err = refundPendingTransfer(ctx, &transfer)
+		if err != nil {
+			return 0, err
+		}
+
+		transfer.Status = pendingExpired
+
+		err = putPendingTransfer(ctx, &transfer)
+		if err != nil {
+			return 0, err
+		}
+
+		err = recordReceipt(ctx, pendingTransferPrefix, transfer.ID, fmt.Sprintf("pending transfer %s of %s expired unanswered and was refunded", transfer.ID, transfer.Sender))
+		if err != nil {
+			return 0, err
+		}
+		swept++
+	}
+
+	return swept, nil
+}
+
+// GetPendingTransfer returns one pending transfer of a recipient
+func (s *SmartContract) GetPendingTransfer(ctx contractapi.TransactionContextInterface, recipient string, transferID string) (*PendingTransfer, error) {
+	return getPendingTransfer(ctx, recipient, transferID)
+}
+
+// refundPendingTransfer is an internal helper that releases exactly this
+// transfer's hold record back to the sender; holds backing other offers or
+// bids are untouched
+func refundPendingTransfer(ctx contractapi.TransactionContextInterface, transfer *PendingTransfer) error {
+	return releaseHoldRecord(ctx, transfer.Sender, transfer.ID, holdReleased)
+}
+
+// getPendingTransfer is an internal helper that reads a pending transfer of
+// a recipient
+func getPendingTransfer(ctx contractapi.TransactionContextInterface, recipient string, transferID string) (*PendingTransfer, error) {
+
+	transferKey, err := ctx.GetStub().CreateCompositeKey(pendingTransferPrefix, []string{recipient, transferID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", pendingTransferPrefix, err)
+	}
+
+	transferBytes, err := ctx.GetStub().GetState(transferKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending transfer from world state: %v", err)
+	}
+	if transferBytes == nil {
+		return nil, fmt.Errorf("no pending transfer %v exists for recipient %v", transferID, recipient)
+	}
+
+	var transfer PendingTransfer
+	err = json.Unmarshal(transferBytes, &transfer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pending transfer object JSON: %v", err)
+	}
+
+	return &transfer, nil
+}
+
+// putPendingTransfer is an internal helper that writes a pending transfer
+func putPendingTransfer(ctx contractapi.TransactionContextInterface, transfer *PendingTransfer) error {
+
+	transferKey, err := ctx.GetStub().CreateCompositeKey(pendingTransferPrefix, []string{transfer.Recipient, transfer.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", pendingTransferPrefix, err)
+	}
+
+	transferBytes, err := marshalCanonical(transfer)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(transferKey, transferBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", transferKey, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const periodPrefix = "period"
+const conversionPrefix = "conversion"
+
+// currencyOfRecord is the currency every period statement is expressed in
+const currencyOfRecord = "EUR"
+
+// rateScale expresses conversion rates as integer basis points, so the
+// conversion stays deterministic across peers
+const rateScale = 10000
+
+// Period captures the official conversion rates at period close. Statements
+// and tax reports for the period must use exactly these rates
+type Period struct {
+	ID       string         `json:"id"`
+	ClosedAt time.Time      `json:"closedAt"`
+	Currency string         `json:"currency"`
+	Rates    map[string]int `json:"rates"`
+}
+
+// ConversionEntry is one audit line of a currency conversion performed with
+// the period-close rates
+type ConversionEntry struct {
+	PeriodID  string `json:"periodID"`
+	Currency  string `json:"currency"`
+	Amount    int    `json:"amount"`
+	Rate      int    `json:"rate"`
+	Converted int    `json:"converted"`
+	TxID      string `json:"txID"`
+}
+
+// ClosePeriod captures the official conversion rates to the currency of
+// record for a settlement period. Rates are passed as a JSON object mapping
+// currency codes to integer basis points (10000 = 1:1). Only the operator
+// may close a period
+func (s *SmartContract) ClosePeriod(ctx contractapi.TransactionContextInterface, periodID string, ratesJSON string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	periodKey, err := ctx.GetStub().CreateCompositeKey(periodPrefix, []string{periodID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", periodPrefix, err)
+	}
+
+	periodBytes, err := ctx.GetStub().GetState(periodKey)
+	if err != nil {
+		return fmt.Errorf("failed to read period from world state: %v", err)
+	}
+	if periodBytes != nil {
+		return fmt.Errorf("period %v is already closed", periodID)
+	}
+
+	rates := make(map[string]int)
+	err = json.Unmarshal([]byte(ratesJSON), &rates)
+	if err != nil {
+		return fmt.Errorf("failed to create rates object JSON: %v", err)
+	}
+
+	for currency, rate := range rates {
+		if rate <= 0 {
+			return fmt.Errorf("rate for currency %v must be a positive integer", currency)
+		}
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	period := Period{
+		ID:       periodID,
+		ClosedAt: time.Unix(timestamp.Seconds, int64(timestamp.Nanos)),
+		Currency: currencyOfRecord,
+		Rates:    rates,
+	}
+
+	periodBytes, err = marshalCanonical(period)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(periodKey, periodBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", periodKey, err)
+	}
+
+	return nil
+}
+
+// GetPeriod returns the captured rates of a closed period
+func (s *SmartContract) GetPeriod(ctx contractapi.TransactionContextInterface, periodID string) (*Period, error) {
+	return getPeriod(ctx, periodID)
+}
+
+// ConvertAtPeriodRate converts an amount into the currency of record at the
+// official period-close rate and records an audit line for the conversion
+func (s *SmartContract) ConvertAtPeriodRate(ctx contractapi.TransactionContextInterface, periodID string, currency string, amount int) (int, error) {
+
+	period, err := getPeriod(ctx, periodID)
+	if err != nil {
+		return 0, err
+	}
+
+	if currency == period.Currency {
+		return amount, nil
+	}
+
+	rate, exists := period.Rates[currency]
+	if !exists {
+		return 0, fmt.Errorf("no rate was captured for currency %v in period %v", currency, periodID)
+	}
+
+	converted := (amount * rate) / rateScale
+
+	entry := ConversionEntry{
+		PeriodID:  periodID,
+		Currency:  currency,
+		Amount:    amount,
+		Rate:      rate,
+		Converted: converted,
+		TxID:      ctx.GetStub().GetTxID(),
+	}
+
+	entryBytes, err := marshalCanonical(entry)
+	if err != nil {
+		return 0, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	entryKey, err := ctx.GetStub().CreateCompositeKey(conversionPrefix, []string{periodID, entry.TxID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create the composite key for prefix %s: %v", conversionPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(entryKey, entryBytes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update state of smart contract for key %s: %v", entryKey, err)
+	}
+
+	return converted, nil
+}
+
+// GetConversions returns the conversion audit trail of a period
+func (s *SmartContract) GetConversions(ctx contractapi.TransactionContextInterface, periodID string) ([]ConversionEntry, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(conversionPrefix, []string{periodID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read conversions from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	entries := []ConversionEntry{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read conversions from world state: %v", err)
+		}
+
+		var entry ConversionEntry
+		err = json.Unmarshal(queryResponse.Value, &entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create conversion object JSON: %v", err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// getPeriod is an internal helper that reads a closed period from state
+func getPeriod(ctx contractapi.TransactionContextInterface, periodID string) (*Period, error) {
+
+	periodKey, err := ctx.GetStub().CreateCompositeKey(periodPrefix, []string{periodID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", periodPrefix, err)
+	}
+
+	periodBytes, err := ctx.GetStub().GetState(periodKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read period from world state: %v", err)
+	}
+	if periodBytes == nil {
+		return nil, fmt.Errorf("period %v has not been closed", periodID)
+	}
+
+	var period Period
+	err = json.Unmarshal(periodBytes, &period)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create period object JSON: %v", err)
+	}
+
+	return &period, nil
+}
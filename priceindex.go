@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const priceIndexPrefix = "priceIndex"
+
+// Index series maintained by the contract
+const seriesAuctionAvg = "auctionAvg"
+const seriesVWAP = "vwap"
+const seriesImbalance = "imbalance"
+
+// IndexPoint is one stored aggregate bucket of a price index series. Each
+// sample lands in a daily bucket ("2026-08-29") and a weekly bucket
+// ("2026-W35"); Value is Sum divided by Weight, so auctionAvg and imbalance
+// average the sampled prices while vwap weighs each price by its quantity
+type IndexPoint struct {
+	Series string `json:"series"`
+	Bucket string `json:"bucket"`
+	Sum    int    `json:"sum"`
+	Weight int    `json:"weight"`
+	Count  int    `json:"count"`
+	Value  int    `json:"value"`
+}
+
+// RecordImbalancePrice posts the imbalance price of a settlement run into the
+// index. Only the operator posts imbalance prices
+func (s *SmartContract) RecordImbalancePrice(ctx contractapi.TransactionContextInterface, price int) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if price <= 0 {
+		return fmt.Errorf("imbalance price must be a positive integer")
+	}
+
+	return recordIndexSample(ctx, seriesImbalance, price, 1)
+}
+
+// GetPriceIndex returns the stored aggregates of a series between two bucket
+// labels inclusive. Date labels ("2026-08-01" to "2026-08-29") select the
+// daily buckets and week labels ("2026-W30" to "2026-W35") the weekly ones,
+// since both sort lexically within their own shape
+func (s *SmartContract) GetPriceIndex(ctx contractapi.TransactionContextInterface, series string, from string, to string) ([]IndexPoint, error) {
+
+	if from > to {
+		return nil, fmt.Errorf("from bucket %v is after to bucket %v", from, to)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(priceIndexPrefix, []string{series})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price index from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	points := []IndexPoint{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read price index from world state: %v", err)
+		}
+
+		var point IndexPoint
+		err = json.Unmarshal(queryResponse.Value, &point)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create index point object JSON: %v", err)
+		}
+
+		if point.Bucket < from || point.Bucket > to {
+			continue
+		}
+
+		points = append(points, point)
+	}
+
+	return points, nil
+}
+
+// recordIndexSample is an internal helper that folds one price sample into
+// the daily and weekly buckets of a series
+func recordIndexSample(ctx contractapi.TransactionContextInterface, series string, price int, weight int) error {
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).UTC()
+
+	year, week := now.ISOWeek()
+	buckets := []string{
+		now.Format("2006-01-02"),
+		fmt.Sprintf("%d-W%02d", year, week),
+	}
+
+	for _, bucket := range buckets {
+		indexKey, err := ctx.GetStub().CreateCompositeKey(priceIndexPrefix, []string{series, bucket})
+		if err != nil {
+			return fmt.Errorf("failed to create the composite key for prefix %s: %v", priceIndexPrefix, err)
+		}
+
+		point := IndexPoint{
+			Series: series,
+			Bucket: bucket,
+		}
+
+		pointBytes, err := ctx.GetStub().GetState(indexKey)
+		if err != nil {
+			return fmt.Errorf("failed to read price index from world state: %v", err)
+		}
+		if pointBytes != nil {
+			err = json.Unmarshal(pointBytes, &point)
+			if err != nil {
+				return fmt.Errorf("failed to create index point object JSON: %v", err)
+			}
+		}
+
+		point.Sum += price
+		point.Weight += weight
+		point.Count++
+		if point.Weight > 0 {
+			point.Value = point.Sum / point.Weight
+		}
+
+		newPointBytes, err := marshalCanonical(point)
+		if err != nil {
+			return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+		}
+
+		err = ctx.GetStub().PutState(indexKey, newPointBytes)
+		if err != nil {
+			return fmt.Errorf("failed to update state of smart contract for key %s: %v", indexKey, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const sellerIdentityPrefix = "sellerIdentity"
+
+// CreatePseudonymousAuction creates an auction that is listed under a
+// pseudonymous handle instead of the seller's clientID. The real identity is
+// kept in a separate state key and is only disclosed to the winner at
+// settlement or to the regulator on demand
+func (s *SmartContract) CreatePseudonymousAuction(ctx contractapi.TransactionContextInterface, auctionID string, priceperkwh int, amount int, time_rem int, pseudonym string) error {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	// get org of submitting client
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if pseudonym == "" {
+		return fmt.Errorf("pseudonym cannot be empty")
+	}
+
+	// Create auction
+	bidders := make(map[string]BidHash)
+	revealedBids := make(map[string]FullBid)
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	time := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	auction := Auction{
+		Type:           "auction",
+		ItemSold:       "energy(KWh)",
+		Amount:         amount,
+		PricePerKWh:    priceperkwh,
+		Time_started:   time,
+		Time_remaining: time_rem,
+		Price:          amount * priceperkwh,
+		Seller:         pseudonym,
+		Orgs:           []string{clientOrgID},
+		PrivateBids:    bidders,
+		RevealedBids:   revealedBids,
+		Winner:         "",
+		Status:         "open",
+	}
+
+	auctionBytes, err := marshalCanonical(auction)
+	if err != nil {
+		return err
+	}
+
+	// put auction into state
+	err = ctx.GetStub().PutState(auctionID, auctionBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put auction in public data: %v", err)
+	}
+
+	// keep the real seller identity in a separate key
+	identityKey, err := ctx.GetStub().CreateCompositeKey(sellerIdentityPrefix, []string{auctionID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", sellerIdentityPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(identityKey, []byte(clientID))
+	if err != nil {
+		return fmt.Errorf("failed to put seller identity in public data: %v", err)
+	}
+
+	// set the seller of the auction as an endorser
+	err = setAssetStateBasedEndorsement(ctx, auctionID, clientOrgID)
+	if err != nil {
+		return fmt.Errorf("failed setting state based endorsement for new organization: %v", err)
+	}
+
+	return nil
+}
+
+// RevealSeller discloses the real seller identity of a pseudonymous auction.
+// Only the winner of an ended auction or the regulator may ask for it
+func (s *SmartContract) RevealSeller(ctx contractapi.TransactionContextInterface, auctionID string) (string, error) {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	identityKey, err := ctx.GetStub().CreateCompositeKey(sellerIdentityPrefix, []string{auctionID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create the composite key for prefix %s: %v", sellerIdentityPrefix, err)
+	}
+
+	identityBytes, err := ctx.GetStub().GetState(identityKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to get seller identity for auction %v: %v", auctionID, err)
+	}
+	if identityBytes == nil {
+		return "", fmt.Errorf("auction %v is not pseudonymous", auctionID)
+	}
+
+	// the regulator can always see the real identity
+	if requireRole(ctx, roleRegulator) == nil {
+		return string(identityBytes), nil
+	}
+
+	auctionBytes, err := ctx.GetStub().GetState(auctionID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get auction %v: %v", auctionID, err)
+	}
+	if auctionBytes == nil {
+		return "", fmt.Errorf("Auction not found: %v", auctionID)
+	}
+
+	var auctionJSON Auction
+	err = json.Unmarshal(auctionBytes, &auctionJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to create auction object JSON: %v", err)
+	}
+
+	if auctionJSON.Status != "ended" {
+		return "", fmt.Errorf("seller identity is only revealed once the auction has ended")
+	}
+
+	if auctionJSON.Winner != clientID {
+		return "", fmt.Errorf("Permission denied, client id %v is not the winner of the auction", clientID)
+	}
+
+	return string(identityBytes), nil
+}
+
+// isAuctionSeller is an internal helper that checks whether the client is the
+// seller of the auction, either directly or behind a pseudonym
+func isAuctionSeller(ctx contractapi.TransactionContextInterface, auctionJSON Auction, auctionID string, clientID string) bool {
+	if auctionJSON.Seller == clientID {
+		return true
+	}
+
+	identityKey, err := ctx.GetStub().CreateCompositeKey(sellerIdentityPrefix, []string{auctionID})
+	if err != nil {
+		return false
+	}
+
+	identityBytes, _ := ctx.GetStub().GetState(identityKey)
+	if identityBytes == nil {
+		return false
+	}
+
+	return string(identityBytes) == clientID
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define key names for options
+const reconciliationKey = "Reconciliation"
+
+// Mismatch reports an account whose on-chain balance differs from the
+// external reconciliation dataset
+type Mismatch struct {
+	Account  string `json:"account"`
+	Expected int    `json:"expected"`
+	OnChain  int    `json:"onChain"`
+}
+
+// ReconciliationResult is what a bulk verification run returns
+type ReconciliationResult struct {
+	DatasetHash string     `json:"datasetHash"`
+	Checked     int        `json:"checked"`
+	Mismatches  []Mismatch `json:"mismatches"`
+}
+
+// Reconcile compares the balances of an external reconciliation dataset
+// (e.g. supplier billing system totals) against the on-chain balances and
+// reports per-account mismatches. The dataset is passed as a JSON object
+// mapping accounts to expected balances, together with the hash of the full
+// external file for the audit trail. Only the regulator may run this
+func (s *SmartContract) Reconcile(ctx contractapi.TransactionContextInterface, datasetJSON string, datasetHash string) (*ReconciliationResult, error) {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := make(map[string]int)
+	err = json.Unmarshal([]byte(datasetJSON), &expected)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reconciliation dataset JSON: %v", err)
+	}
+
+	result := ReconciliationResult{
+		DatasetHash: datasetHash,
+		Checked:     len(expected),
+		Mismatches:  []Mismatch{},
+	}
+
+	for account, expectedBalance := range expected {
+		// sandbox accounts are test data and excluded from reconciliation
+		sandbox, err := isSandbox(ctx, account)
+		if err != nil {
+			return nil, err
+		}
+		if sandbox {
+			result.Checked--
+			continue
+		}
+
+		balanceBytes, err := getBalanceBytes(ctx, account)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read account %s from world state: %v", account, err)
+		}
+
+		var balance int
+		if balanceBytes == nil {
+			balance = 0
+		} else {
+			balance, _ = strconv.Atoi(string(balanceBytes))
+		}
+
+		if balance != expectedBalance {
+			result.Mismatches = append(result.Mismatches, Mismatch{
+				Account:  account,
+				Expected: expectedBalance,
+				OnChain:  balance,
+			})
+		}
+	}
+
+	// record the run so the monthly reconciliation is auditable
+	resultBytes, err := marshalCanonical(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(reconciliationKey, resultBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update state %v", err)
+	}
+
+	return &result, nil
+}
+
+// GetLastReconciliation returns the result of the most recent reconciliation run
+func (s *SmartContract) GetLastReconciliation(ctx contractapi.TransactionContextInterface) (*ReconciliationResult, error) {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return nil, err
+	}
+
+	resultBytes, err := ctx.GetStub().GetState(reconciliationKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Reconciliation from world state: %v", err)
+	}
+	if resultBytes == nil {
+		return nil, fmt.Errorf("no reconciliation has been run")
+	}
+
+	var result ReconciliationResult
+	err = json.Unmarshal(resultBytes, &result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reconciliation object JSON: %v", err)
+	}
+
+	return &result, nil
+}
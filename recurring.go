@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const recurringAuctionPrefix = "recurringAuction"
+
+// RecurringAuction is a stored template from which auction instances are
+// stamped out on a fixed interval, so a utility can sell its surplus every
+// hour without submitting a CreateAuction each time. NextAt is the absolute
+// tx-timestamp-derived time the next instance becomes due, and Counter
+// numbers the instances
+type RecurringAuction struct {
+	ID          string    `json:"ID"`
+	Seller      string    `json:"seller"`
+	SellerOrg   string    `json:"sellerOrg"`
+	Amount      int       `json:"amount"`
+	PricePerKWh int       `json:"priceperkwh"`
+	DurationMin int       `json:"durationMin"`
+	IntervalMin int       `json:"intervalMin"`
+	NextAt      time.Time `json:"nextAt"`
+	Counter     int       `json:"counter"`
+	Active      bool      `json:"active"`
+}
+
+// ScheduleRecurringAuction stores an auction template owned by the calling
+// seller. The first instance becomes due immediately; every later one
+// becomes due one interval after the previous
+func (s *SmartContract) ScheduleRecurringAuction(ctx contractapi.TransactionContextInterface, templateID string, priceperkwh int, amount int, duration_min int, interval_min int) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+
+	if priceperkwh <= 0 || amount <= 0 || duration_min <= 0 || interval_min <= 0 {
+		return fmt.Errorf("price, amount, duration and interval must be positive integers")
+	}
+
+	existing, _ := getRecurringAuction(ctx, templateID)
+	if existing != nil {
+		return fmt.Errorf("recurring auction %v already exists", templateID)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	template := RecurringAuction{
+		ID:          templateID,
+		Seller:      clientID,
+		SellerOrg:   clientOrgID,
+		Amount:      amount,
+		PricePerKWh: priceperkwh,
+		DurationMin: duration_min,
+		IntervalMin: interval_min,
+		NextAt:      time.Unix(timestamp.Seconds, int64(timestamp.Nanos)),
+		Counter:     0,
+		Active:      true,
+	}
+
+	return putRecurringAuction(ctx, &template)
+}
+
+// TriggerScheduledAuctions instantiates the next due instance of a recurring
+// auction. Any client can trigger: the check against NextAt only uses the tx
+// timestamp and the instance is derived entirely from the stored template,
+// so every endorser produces the same write set regardless of who calls
+func (s *SmartContract) TriggerScheduledAuctions(ctx contractapi.TransactionContextInterface, templateID string) (string, error) {
+
+	template, err := getRecurringAuction(ctx, templateID)
+	if err != nil {
+		return "", err
+	}
+
+	if !template.Active {
+		return "", fmt.Errorf("recurring auction %v is cancelled", templateID)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("failed to get timestamp")
+	}
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	if now.Before(template.NextAt) {
+		return "", fmt.Errorf("next instance of recurring auction %v is not due until %v", templateID, template.NextAt)
+	}
+
+	template.Counter++
+	auctionID := fmt.Sprintf("%s-%d", template.ID, template.Counter)
+
+	err = instantiateScheduledAuction(ctx, template, auctionID, now)
+	if err != nil {
+		return "", err
+	}
+
+	// the next instance is due one interval after this one became due, so a
+	// late trigger does not drift the schedule
+	template.NextAt = template.NextAt.Add(time.Duration(template.IntervalMin) * time.Minute)
+
+	err = putRecurringAuction(ctx, template)
+	if err != nil {
+		return "", err
+	}
+
+	return auctionID, nil
+}
+
+// CancelRecurringAuction deactivates a template so no further instances are
+// stamped out. Only the seller cancels their template
+func (s *SmartContract) CancelRecurringAuction(ctx contractapi.TransactionContextInterface, templateID string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	template, err := getRecurringAuction(ctx, templateID)
+	if err != nil {
+		return err
+	}
+
+	if clientID != template.Seller {
+		return fmt.Errorf("recurring auction can only be cancelled by its seller")
+	}
+
+	template.Active = false
+
+	return putRecurringAuction(ctx, template)
+}
+
+// GetRecurringAuction returns a recurring auction template
+func (s *SmartContract) GetRecurringAuction(ctx contractapi.TransactionContextInterface, templateID string) (*RecurringAuction, error) {
+	return getRecurringAuction(ctx, templateID)
+}
+
+// instantiateScheduledAuction is an internal helper that creates one auction
+// instance from a template. It mirrors CreateAuction, except the seller comes
+// from the template rather than from the submitting client
+func instantiateScheduledAuction(ctx contractapi.TransactionContextInterface, template *RecurringAuction, auctionID string, now time.Time) error {
+
+	existingBytes, err := ctx.GetStub().GetState(auctionID)
+	if err != nil {
+		return fmt.Errorf("failed to read auction from world state: %v", err)
+	}
+	if existingBytes != nil {
+		return fmt.Errorf("auction %v already exists", auctionID)
+	}
+
+	deadline := now.Add(time.Duration(template.DurationMin) * time.Minute)
+
+	unit, err := marketPrecision(ctx, defaultMarket)
+	if err != nil {
+		return err
+	}
+	amountWh, err := toWh(template.Amount, unit)
+	if err != nil {
+		return err
+	}
+
+	auction := Auction{
+		Type:           "auction",
+		ItemSold:       "energy(Wh)",
+		Amount:         amountWh,
+		PricePerKWh:    template.PricePerKWh,
+		Time_started:   now,
+		Time_remaining: template.DurationMin,
+		Deadline:       deadline,
+		Price:          template.Amount * template.PricePerKWh,
+		Seller:         template.Seller,
+		Orgs:           []string{template.SellerOrg},
+		PrivateBids:    make(map[string]BidHash),
+		RevealedBids:   make(map[string]FullBid),
+		Winner:         "",
+		Vickrey:        false,
+		Unit:           unit,
+		Status:         "open",
+	}
+
+	auctionBytes, err := marshalCanonical(auction)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(auctionID, auctionBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put auction in public data: %v", err)
+	}
+
+	// the seller's org endorses the instance, same as a hand-made auction
+	err = setAssetStateBasedEndorsement(ctx, auctionID, template.SellerOrg)
+	if err != nil {
+		return fmt.Errorf("failed setting state based endorsement for new organization: %v", err)
+	}
+
+	err = recordReceipt(ctx, "auction", auctionID, fmt.Sprintf("auction %s created from recurring template %s", auctionID, template.ID))
+	if err != nil {
+		return err
+	}
+
+	// Emit the AuctionCreated event
+	meta, err := eventMeta(ctx)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, "AuctionCreated", AuctionCreatedEvent{EventMeta: meta, AuctionID: auctionID, Seller: template.Seller, Amount: template.Amount, PricePerKWh: template.PricePerKWh})
+}
+
+// getRecurringAuction is an internal helper that reads a recurring auction
+// template
+func getRecurringAuction(ctx contractapi.TransactionContextInterface, templateID string) (*RecurringAuction, error) {
+
+	templateKey, err := ctx.GetStub().CreateCompositeKey(recurringAuctionPrefix, []string{templateID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", recurringAuctionPrefix, err)
+	}
+
+	templateBytes, err := ctx.GetStub().GetState(templateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recurring auction from world state: %v", err)
+	}
+	if templateBytes == nil {
+		return nil, fmt.Errorf("no recurring auction %v exists", templateID)
+	}
+
+	var template RecurringAuction
+	err = json.Unmarshal(templateBytes, &template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recurring auction object JSON: %v", err)
+	}
+
+	return &template, nil
+}
+
+// putRecurringAuction is an internal helper that writes a recurring auction
+// template
+func putRecurringAuction(ctx contractapi.TransactionContextInterface, template *RecurringAuction) error {
+
+	templateKey, err := ctx.GetStub().CreateCompositeKey(recurringAuctionPrefix, []string{template.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", recurringAuctionPrefix, err)
+	}
+
+	templateBytes, err := marshalCanonical(template)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(templateKey, templateBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", templateKey, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const reverseAuctionPrefix = "reverseAuction"
+
+// Reverse auction statuses
+const reverseOpen = "open"
+const reverseEnded = "ended"
+const reverseNoSale = "no sale"
+
+// ReverseAuction is a buyer-initiated procurement auction: the consumer posts
+// the KWh they need and the most they will pay, sellers undercut each other
+// with descending offers, and the lowest offer wins. The buyer's hold funds
+// the payment, so the winning seller receives tokens instead of paying them
+type ReverseAuction struct {
+	ID        string                  `json:"ID"`
+	Buyer     string                  `json:"buyer"`
+	KWh       int                     `json:"kwh"`
+	MaxPrice  int                     `json:"maxPrice"`
+	Deadline  time.Time               `json:"deadline"`
+	Offers    map[string]ReverseOffer `json:"offers"`
+	Winner    string                  `json:"winner"`
+	Price     int                     `json:"price"`
+	Status    string                  `json:"status"`
+	CreatedAt time.Time               `json:"createdAt"`
+}
+
+// ReverseOffer is one seller's descending offer in a reverse auction
+type ReverseOffer struct {
+	Seller      string    `json:"seller"`
+	Price       int       `json:"price"`
+	SubmittedAt time.Time `json:"submittedAt"`
+}
+
+// CreateReverseAuction posts a procurement request: the calling consumer
+// becomes the buyer and their hold covers the maximum price, so the winning
+// offer is always funded
+func (s *SmartContract) CreateReverseAuction(ctx contractapi.TransactionContextInterface, auctionID string, kwh int, maxPrice int, time_rem int) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if kwh <= 0 || maxPrice <= 0 || time_rem <= 0 {
+		return fmt.Errorf("kwh, maximum price and duration must be positive integers")
+	}
+
+	existing, _ := getReverseAuction(ctx, auctionID)
+	if existing != nil {
+		return fmt.Errorf("reverse auction %v already exists", auctionID)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	auction := ReverseAuction{
+		ID:        auctionID,
+		Buyer:     clientID,
+		KWh:       kwh,
+		MaxPrice:  maxPrice,
+		Deadline:  now.Add(time.Duration(time_rem) * time.Minute),
+		Offers:    make(map[string]ReverseOffer),
+		Winner:    "",
+		Price:     0,
+		Status:    reverseOpen,
+		CreatedAt: now,
+	}
+
+	err = putReverseAuction(ctx, &auction)
+	if err != nil {
+		return err
+	}
+
+	// the buyer's hold record for this auction guarantees the winning
+	// seller gets paid
+	err = createHoldRecord(ctx, clientID, auctionID, maxPrice, "reverse-auction", time_rem+disputeWindowMin)
+	if err != nil {
+		return fmt.Errorf("cannot create hold: %v", err)
+	}
+
+	return recordReceipt(ctx, reverseAuctionPrefix, auctionID, fmt.Sprintf("reverse auction %s created for %d KWh at max price %d", auctionID, kwh, maxPrice))
+}
+
+// SubmitOffer adds or lowers the calling seller's offer in a reverse auction.
+// Offers descend: a new offer has to be at or below the maximum price and
+// below the seller's own previous offer
+func (s *SmartContract) SubmitOffer(ctx contractapi.TransactionContextInterface, auctionID string, price int) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if price <= 0 {
+		return fmt.Errorf("offer price must be a positive integer")
+	}
+
+	auction, err := getReverseAuction(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+
+	if auction.Status != reverseOpen {
+		return fmt.Errorf("reverse auction %v is not open", auctionID)
+	}
+
+	expired, err := reverseAuctionExpired(ctx, auction)
+	if err != nil {
+		return err
+	}
+	if expired {
+		return fmt.Errorf("time is up")
+	}
+
+	if clientID == auction.Buyer {
+		return fmt.Errorf("the buyer cannot offer into their own reverse auction")
+	}
+
+	if price > auction.MaxPrice {
+		return fmt.Errorf("offer of %d exceeds the maximum price of %d", price, auction.MaxPrice)
+	}
+
+	if previous, ok := auction.Offers[clientID]; ok && price >= previous.Price {
+		return fmt.Errorf("offer of %d does not undercut the previous offer of %d", price, previous.Price)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	auction.Offers[clientID] = ReverseOffer{
+		Seller:      clientID,
+		Price:       price,
+		SubmittedAt: time.Unix(timestamp.Seconds, int64(timestamp.Nanos)),
+	}
+
+	return putReverseAuction(ctx, auction)
+}
+
+// EndReverseAuction picks the lowest offer and settles the procurement: the
+// winning amount moves from the buyer's hold into escrow for the winning
+// seller and the rest of the hold returns to the buyer. Only the buyer ends
+// their reverse auction
+func (s *SmartContract) EndReverseAuction(ctx contractapi.TransactionContextInterface, auctionID string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	auction, err := getReverseAuction(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+
+	if clientID != auction.Buyer {
+		return fmt.Errorf("reverse auction can only be ended by the buyer")
+	}
+
+	if auction.Status != reverseOpen {
+		return fmt.Errorf("reverse auction %v is not open", auctionID)
+	}
+
+	if len(auction.Offers) == 0 {
+		// nobody offered; the buyer gets their full hold back
+		auction.Status = reverseNoSale
+		err = releaseHoldRecord(ctx, auction.Buyer, auctionID, holdReleased)
+		if err != nil {
+			return fmt.Errorf("cannot return hold: %v", err)
+		}
+		return putReverseAuction(ctx, auction)
+	}
+
+	// order the offers deterministically before picking the winner: lowest
+	// price first, then earliest offer, then lexicographic seller ID
+	offers := make([]ReverseOffer, 0, len(auction.Offers))
+	for _, offer := range auction.Offers {
+		offers = append(offers, offer)
+	}
+	sort.Slice(offers, func(i, j int) bool {
+		if offers[i].Price != offers[j].Price {
+			return offers[i].Price < offers[j].Price
+		}
+		if !offers[i].SubmittedAt.Equal(offers[j].SubmittedAt) {
+			return offers[i].SubmittedAt.Before(offers[j].SubmittedAt)
+		}
+		return offers[i].Seller < offers[j].Seller
+	})
+
+	auction.Winner = offers[0].Seller
+	auction.Price = offers[0].Price
+	auction.Status = reverseEnded
+
+	// the winning amount moves into escrow until delivery is confirmed; the
+	// roles mirror a forward auction, with the offering seller being paid.
+	// Consuming the hold also returns whatever the buyer held beyond the
+	// winning price
+	err = createEscrow(ctx, auctionID, auction.Buyer, auction.Winner, auction.Price)
+	if err != nil {
+		return fmt.Errorf("cannot escrow buyer's hold: %v", err)
+	}
+
+	err = putReverseAuction(ctx, auction)
+	if err != nil {
+		return err
+	}
+
+	settlement := settlementEvent{
+		AuctionID: auctionID,
+		Winner:    auction.Winner,
+		Price:     auction.Price,
+	}
+	settlementJSON, err := json.Marshal(settlement)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("Settlement", settlementJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
+
+// GetReverseAuction returns a reverse auction
+func (s *SmartContract) GetReverseAuction(ctx contractapi.TransactionContextInterface, auctionID string) (*ReverseAuction, error) {
+	return getReverseAuction(ctx, auctionID)
+}
+
+// reverseAuctionExpired compares the current tx timestamp against the
+// reverse auction's absolute deadline
+func reverseAuctionExpired(ctx contractapi.TransactionContextInterface, auction *ReverseAuction) (bool, error) {
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return false, fmt.Errorf("failed to get timestamp")
+	}
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	return !now.Before(auction.Deadline), nil
+}
+
+// getReverseAuction is an internal helper that reads a reverse auction
+func getReverseAuction(ctx contractapi.TransactionContextInterface, auctionID string) (*ReverseAuction, error) {
+
+	auctionKey, err := ctx.GetStub().CreateCompositeKey(reverseAuctionPrefix, []string{auctionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", reverseAuctionPrefix, err)
+	}
+
+	auctionBytes, err := ctx.GetStub().GetState(auctionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reverse auction from world state: %v", err)
+	}
+	if auctionBytes == nil {
+		return nil, fmt.Errorf("no reverse auction %v exists", auctionID)
+	}
+
+	var auction ReverseAuction
+	err = json.Unmarshal(auctionBytes, &auction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reverse auction object JSON: %v", err)
+	}
+
+	return &auction, nil
+}
+
+// putReverseAuction is an internal helper that writes a reverse auction with
+// a canonical encoding, since the offers live in a map
+func putReverseAuction(ctx contractapi.TransactionContextInterface, auction *ReverseAuction) error {
+
+	auctionKey, err := ctx.GetStub().CreateCompositeKey(reverseAuctionPrefix, []string{auction.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", reverseAuctionPrefix, err)
+	}
+
+	auctionBytes, err := marshalCanonical(auction)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(auctionKey, auctionBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", auctionKey, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const sandboxPrefix = "sandbox"
+
+// MarkSandbox flags an account or auction as test data. Sandbox entries stay
+// usable for end-to-end rehearsals on the production channel but are excluded
+// from market statistics, reconciliation and tax reports. Only the operator
+// may flag entries
+func (s *SmartContract) MarkSandbox(ctx contractapi.TransactionContextInterface, id string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	sandboxKey, err := ctx.GetStub().CreateCompositeKey(sandboxPrefix, []string{id})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", sandboxPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(sandboxKey, []byte("true"))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", sandboxKey, err)
+	}
+
+	return nil
+}
+
+// UnmarkSandbox removes the test data flag from an account or auction
+func (s *SmartContract) UnmarkSandbox(ctx contractapi.TransactionContextInterface, id string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	sandboxKey, err := ctx.GetStub().CreateCompositeKey(sandboxPrefix, []string{id})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", sandboxPrefix, err)
+	}
+
+	err = ctx.GetStub().DelState(sandboxKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete sandbox flag: %v", err)
+	}
+
+	return nil
+}
+
+// IsSandbox returns whether an account or auction is flagged as test data
+func (s *SmartContract) IsSandbox(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+	return isSandbox(ctx, id)
+}
+
+// isSandbox is an internal helper used by reports to exclude test data
+func isSandbox(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+	sandboxKey, err := ctx.GetStub().CreateCompositeKey(sandboxPrefix, []string{id})
+	if err != nil {
+		return false, fmt.Errorf("failed to create the composite key for prefix %s: %v", sandboxPrefix, err)
+	}
+
+	sandboxBytes, err := ctx.GetStub().GetState(sandboxKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read sandbox flag from world state: %v", err)
+	}
+
+	return sandboxBytes != nil, nil
+}
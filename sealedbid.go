@@ -0,0 +1,272 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// bidInput is the shape of the transient bid submitted by the client
+type bidInput struct {
+	Price int `json:"price"`
+}
+
+// SubmitSealedBid stores a bid in the bidder org's implicit private data
+// collection. The bid is passed through the transient map under the "bid" key
+// so it never appears in the transaction proposal. The transaction ID is
+// returned and identifies the bid
+func (s *SmartContract) SubmitSealedBid(ctx contractapi.TransactionContextInterface, auctionID string) (string, error) {
+
+	// the bid must come through the transient map so it stays off the ledger
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return "", fmt.Errorf("error getting transient: %v", err)
+	}
+
+	BidJSON, ok := transientMap["bid"]
+	if !ok {
+		return "", fmt.Errorf("bid key not found in the transient map")
+	}
+
+	// the bid is only stored on the peers of the bidder's org
+	err = verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return "", fmt.Errorf("Cannot store bid on this peer, not a member of this org: %v", err)
+	}
+
+	collection, err := getCollectionName(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get implicit collection name: %v", err)
+	}
+
+	// the transaction ID is used as a unique index for the bid
+	txID := ctx.GetStub().GetTxID()
+
+	bidKey, err := ctx.GetStub().CreateCompositeKey(bidKeyType, []string{auctionID, txID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	err = ctx.GetStub().PutPrivateData(collection, bidKey, BidJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to input price into collection: %v", err)
+	}
+
+	return txID, nil
+}
+
+// AddSealedBid records the hash of a sealed bid on the public auction, so the
+// commitment is binding without disclosing the price. The transaction ID
+// returned by SubmitSealedBid identifies the bid
+func (s *SmartContract) AddSealedBid(ctx contractapi.TransactionContextInterface, auctionID string, txID string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	// get the MSP ID of the bidder's org
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+
+	// get the auction from state
+	auctionBytes, err := ctx.GetStub().GetState(auctionID)
+	if err != nil {
+		return fmt.Errorf("couldn't get auction from global state")
+	}
+
+	if auctionBytes == nil {
+		return fmt.Errorf("Auction not found: %v", auctionID)
+	}
+
+	var auctionJSON Auction
+	err = json.Unmarshal(auctionBytes, &auctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to create auction object JSON: %v", err)
+	}
+
+	// the auction needs to be open for users to add their bid
+	Status := auctionJSON.Status
+	if Status != "open" {
+		return fmt.Errorf("cannot join closed or ended auction")
+	}
+
+	collection, err := getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get implicit collection name: %v", err)
+	}
+
+	bidKey, err := ctx.GetStub().CreateCompositeKey(bidKeyType, []string{auctionID, txID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	// the on-chain hash is read from the private data collection, so the
+	// commitment matches exactly what the bidder stored
+	bidHash, err := ctx.GetStub().GetPrivateDataHash(collection, bidKey)
+	if err != nil {
+		return fmt.Errorf("failed to read bid hash from collection: %v", err)
+	}
+	if bidHash == nil {
+		return fmt.Errorf("bid hash does not exist: %s", bidKey)
+	}
+
+	NewHash := BidHash{
+		Org:    clientOrgID,
+		Hash:   hex.EncodeToString(bidHash),
+		Bidder: clientID,
+	}
+
+	bidders := auctionJSON.PrivateBids
+	bidders[bidKey] = NewHash
+	auctionJSON.PrivateBids = bidders
+
+	newAuctionBytes, _ := marshalCanonical(auctionJSON)
+
+	err = ctx.GetStub().PutState(auctionID, newAuctionBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update auction: %v", err)
+	}
+
+	// Add the bidding organization to the list of participating organizations if it is not already
+	Orgs := auctionJSON.Orgs
+	if !(contains(Orgs, clientOrgID)) {
+		newOrgs := append(Orgs, clientOrgID)
+		auctionJSON.Orgs = newOrgs
+
+		err = addAssetStateBasedEndorsement(ctx, auctionID, clientOrgID)
+		if err != nil {
+			return fmt.Errorf("failed setting state based endorsement for new organization: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// RevealBid discloses a sealed bid once the auction is closed. The bid is
+// passed again through the transient map and is verified against the hash
+// recorded on-chain before it is added to RevealedBids
+func (s *SmartContract) RevealBid(ctx contractapi.TransactionContextInterface, auctionID string, txID string) error {
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("error getting transient: %v", err)
+	}
+
+	transientBidJSON, ok := transientMap["bid"]
+	if !ok {
+		return fmt.Errorf("bid key not found in the transient map")
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	// get the MSP ID of the bidder's org
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+
+	// get the auction from state
+	auctionBytes, err := ctx.GetStub().GetState(auctionID)
+	if err != nil {
+		return fmt.Errorf("couldn't get auction from global state")
+	}
+
+	if auctionBytes == nil {
+		return fmt.Errorf("Auction not found: %v", auctionID)
+	}
+
+	var auctionJSON Auction
+	err = json.Unmarshal(auctionBytes, &auctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to create auction object JSON: %v", err)
+	}
+
+	// bids are revealed once the auction is closed
+	Status := auctionJSON.Status
+	if Status != "closed" {
+		return fmt.Errorf("cannot reveal bid for open or ended auction")
+	}
+
+	bidKey, err := ctx.GetStub().CreateCompositeKey(bidKeyType, []string{auctionID, txID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	committed, exists := auctionJSON.PrivateBids[bidKey]
+	if !exists {
+		return fmt.Errorf("no sealed bid was added for key %v", bidKey)
+	}
+
+	if committed.Bidder != clientID {
+		return fmt.Errorf("Permission denied, client id %v is not the owner of the bid", clientID)
+	}
+
+	// verify the revealed bid against the hash committed on-chain
+	sum := sha256.Sum256(transientBidJSON)
+	if hex.EncodeToString(sum[:]) != committed.Hash {
+		return fmt.Errorf("hash %x of revealed bid does not match the committed hash %s", sum, committed.Hash)
+	}
+
+	var input bidInput
+	err = json.Unmarshal(transientBidJSON, &input)
+	if err != nil {
+		return fmt.Errorf("failed to create bid object JSON: %v", err)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+
+	NewBid := FullBid{
+		Type:        auctionJSON.ItemSold,
+		Price:       input.Price,
+		Org:         clientOrgID,
+		Bidder:      clientID,
+		SubmittedAt: time.Unix(timestamp.Seconds, int64(timestamp.Nanos)),
+	}
+
+	revealedBids := auctionJSON.RevealedBids
+	revealedBids[bidKey] = NewBid
+	auctionJSON.RevealedBids = revealedBids
+
+	newAuctionBytes, _ := marshalCanonical(auctionJSON)
+
+	err = ctx.GetStub().PutState(auctionID, newAuctionBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update auction: %v", err)
+	}
+
+	// a revealed bid competes in settlement like an open bid, so it is
+	// funded the same way: a hold record keyed by this auction, covering
+	// the zone-adjusted price. A re-reveal replaces the bidder's previous
+	// hold for this auction
+	held, err := applyZoneMultiplier(ctx, auctionJSON.Zone, input.Price)
+	if err != nil {
+		return err
+	}
+
+	if existingHold, _, err := getHoldRecord(ctx, clientID, auctionID); err == nil && existingHold.Status == holdActive {
+		err = releaseHoldRecord(ctx, clientID, auctionID, holdReleased)
+		if err != nil {
+			return fmt.Errorf("cannot release previous hold: %v", err)
+		}
+	}
+
+	err = createHoldRecord(ctx, clientID, auctionID, held, "bid", auctionJSON.Time_remaining+disputeWindowMin)
+	if err != nil {
+		return fmt.Errorf("cannot create hold: %v", err)
+	}
+
+	return nil
+}
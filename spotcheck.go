@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const spotCheckPrefix = "spotCheck"
+const inspectionPrefix = "inspection"
+
+// SpotCheckSelection is the recorded sample of meters picked for physical
+// inspection in one quarter. The selection is deterministic given the
+// published salt, so anyone can re-run it and verify no meter was quietly
+// added or removed
+type SpotCheckSelection struct {
+	Quarter    string    `json:"quarter"`
+	Salt       string    `json:"salt"`
+	Meters     []string  `json:"meters"`
+	SelectedAt time.Time `json:"selectedAt"`
+}
+
+// Inspection is the outcome of one physical meter inspection
+type Inspection struct {
+	Quarter   string `json:"quarter"`
+	MeterID   string `json:"meterID"`
+	Outcome   string `json:"outcome"`
+	Notes     string `json:"notes"`
+	Inspector string `json:"inspector"`
+}
+
+// SelectSpotChecks draws the quarterly inspection sample. The salt should be
+// derived from a block hash published after the quarter closed so nobody
+// could predict the draw; each meter is scored by sha256(salt|meterID) and
+// the lowest sampleSize scores are selected. Only the regulator may draw
+func (s *SmartContract) SelectSpotChecks(ctx contractapi.TransactionContextInterface, quarter string, salt string, sampleSize int) (*SpotCheckSelection, error) {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return nil, err
+	}
+
+	if salt == "" {
+		return nil, fmt.Errorf("a published salt is required")
+	}
+	if sampleSize <= 0 {
+		return nil, fmt.Errorf("sample size must be a positive integer")
+	}
+
+	selectionKey, err := ctx.GetStub().CreateCompositeKey(spotCheckPrefix, []string{quarter})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", spotCheckPrefix, err)
+	}
+
+	existing, err := ctx.GetStub().GetState(selectionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spot check selection from world state: %v", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("the selection for quarter %v is already drawn", quarter)
+	}
+
+	// score every registered meter; the iteration order does not matter
+	// because the scores impose their own deterministic order
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(meterPrefix, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read meters from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	type scoredMeter struct {
+		id    string
+		score string
+	}
+	scored := []scoredMeter{}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read meters from world state: %v", err)
+		}
+
+		var meter Meter
+		err = json.Unmarshal(queryResponse.Value, &meter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create meter object JSON: %v", err)
+		}
+
+		digest := sha256.Sum256([]byte(salt + "|" + meter.ID))
+		scored = append(scored, scoredMeter{id: meter.ID, score: hex.EncodeToString(digest[:])})
+	}
+
+	if len(scored) == 0 {
+		return nil, fmt.Errorf("there are no registered meters to sample")
+	}
+
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].score != scored[j].score {
+			return scored[i].score < scored[j].score
+		}
+		return scored[i].id < scored[j].id
+	})
+
+	if sampleSize > len(scored) {
+		sampleSize = len(scored)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timestamp")
+	}
+
+	selection := SpotCheckSelection{
+		Quarter:    quarter,
+		Salt:       salt,
+		Meters:     []string{},
+		SelectedAt: time.Unix(timestamp.Seconds, int64(timestamp.Nanos)),
+	}
+	for _, meter := range scored[:sampleSize] {
+		selection.Meters = append(selection.Meters, meter.id)
+	}
+
+	selectionBytes, err := marshalCanonical(selection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(selectionKey, selectionBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update state of smart contract for key %s: %v", selectionKey, err)
+	}
+
+	return &selection, nil
+}
+
+// RecordInspection records the outcome of a physical inspection of a meter
+// drawn in the quarter's selection
+func (s *SmartContract) RecordInspection(ctx contractapi.TransactionContextInterface, quarter string, meterID string, outcome string, notes string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	selection, err := s.GetSpotChecks(ctx, quarter)
+	if err != nil {
+		return err
+	}
+
+	if !contains(selection.Meters, meterID) {
+		return fmt.Errorf("meter %v is not part of the %v selection", meterID, quarter)
+	}
+
+	inspection := Inspection{
+		Quarter:   quarter,
+		MeterID:   meterID,
+		Outcome:   outcome,
+		Notes:     notes,
+		Inspector: clientID,
+	}
+
+	inspectionBytes, err := marshalCanonical(inspection)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	inspectionKey, err := ctx.GetStub().CreateCompositeKey(inspectionPrefix, []string{quarter, meterID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", inspectionPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(inspectionKey, inspectionBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", inspectionKey, err)
+	}
+
+	return nil
+}
+
+// GetSpotChecks returns the drawn selection of a quarter
+func (s *SmartContract) GetSpotChecks(ctx contractapi.TransactionContextInterface, quarter string) (*SpotCheckSelection, error) {
+
+	selectionKey, err := ctx.GetStub().CreateCompositeKey(spotCheckPrefix, []string{quarter})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", spotCheckPrefix, err)
+	}
+
+	selectionBytes, err := ctx.GetStub().GetState(selectionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spot check selection from world state: %v", err)
+	}
+	if selectionBytes == nil {
+		return nil, fmt.Errorf("no selection drawn for quarter %v", quarter)
+	}
+
+	var selection SpotCheckSelection
+	err = json.Unmarshal(selectionBytes, &selection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spot check selection object JSON: %v", err)
+	}
+
+	return &selection, nil
+}
+
+// GetInspection returns the recorded outcome of one inspection
+func (s *SmartContract) GetInspection(ctx contractapi.TransactionContextInterface, quarter string, meterID string) (*Inspection, error) {
+
+	inspectionKey, err := ctx.GetStub().CreateCompositeKey(inspectionPrefix, []string{quarter, meterID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", inspectionPrefix, err)
+	}
+
+	inspectionBytes, err := ctx.GetStub().GetState(inspectionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inspection from world state: %v", err)
+	}
+	if inspectionBytes == nil {
+		return nil, fmt.Errorf("no inspection recorded for meter %v in quarter %v", meterID, quarter)
+	}
+
+	var inspection Inspection
+	err = json.Unmarshal(inspectionBytes, &inspection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create inspection object JSON: %v", err)
+	}
+
+	return &inspection, nil
+}
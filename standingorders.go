@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const standingOrderPrefix = "standingOrder"
+
+// StandingOrder is a stored payment instruction: the payer authorizes a
+// fixed amount to a recipient on a fixed interval, so flat-rate energy
+// subscriptions settle without a signed transfer each period. NextAt is the
+// absolute tx-timestamp-derived time the next payment becomes due
+type StandingOrder struct {
+	ID          string    `json:"ID"`
+	Payer       string    `json:"payer"`
+	Recipient   string    `json:"recipient"`
+	Amount      int       `json:"amount"`
+	IntervalMin int       `json:"intervalMin"`
+	NextAt      time.Time `json:"nextAt"`
+	Payments    int       `json:"payments"`
+	Missed      int       `json:"missed"`
+	Active      bool      `json:"active"`
+}
+
+// CreateStandingOrder stores a payment instruction of the calling client.
+// The first payment becomes due immediately; every later one becomes due one
+// interval after the previous. The order ID is the transaction ID
+func (s *SmartContract) CreateStandingOrder(ctx contractapi.TransactionContextInterface, recipient string, amount int, intervalMin int) (string, error) {
+
+	// only registered participants set up subscriptions
+	if err := requireRegistered(ctx); err != nil {
+		return "", err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if recipient == clientID {
+		return "", fmt.Errorf("cannot set up a standing order to yourself")
+	}
+	if amount <= 0 || intervalMin <= 0 {
+		return "", fmt.Errorf("amount and interval must be positive integers")
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("failed to get timestamp")
+	}
+
+	order := StandingOrder{
+		ID:          ctx.GetStub().GetTxID(),
+		Payer:       clientID,
+		Recipient:   recipient,
+		Amount:      amount,
+		IntervalMin: intervalMin,
+		NextAt:      time.Unix(timestamp.Seconds, int64(timestamp.Nanos)),
+		Active:      true,
+	}
+
+	err = putStandingOrder(ctx, &order)
+	if err != nil {
+		return "", err
+	}
+
+	return order.ID, nil
+}
+
+// CancelStandingOrder deactivates a standing order. Only the payer cancels
+// their own subscription
+func (s *SmartContract) CancelStandingOrder(ctx contractapi.TransactionContextInterface, orderID string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	order, err := getStandingOrder(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	if clientID != order.Payer {
+		return fmt.Errorf("only the payer can cancel the standing order")
+	}
+
+	if !order.Active {
+		return fmt.Errorf("standing order %v is already cancelled", orderID)
+	}
+
+	order.Active = false
+
+	return putStandingOrder(ctx, order)
+}
+
+// ExecuteDueStandingOrders pays out every standing order that has become
+// due and returns how many payments were made. A payer whose transfer is
+// refused — insufficient funds, a frozen account, a spending limit — misses
+// the period: the payment is skipped and recorded, the schedule advances,
+// and the subscription stays active for the recipient to follow up
+func (s *SmartContract) ExecuteDueStandingOrders(ctx contractapi.TransactionContextInterface) (int, error) {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get timestamp")
+	}
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(standingOrderPrefix, []string{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read standing orders from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	executed := 0
+	touched := make(map[string]bool)
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read standing orders from world state: %v", err)
+		}
+
+		var order StandingOrder
+		err = json.Unmarshal(queryResponse.Value, &order)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create standing order object JSON: %v", err)
+		}
+
+		if !order.Active || now.Before(order.NextAt) {
+			continue
+		}
+
+		// an account a payment in this run already touched is deferred to
+		// the next run: the earlier payment's balance write is not visible
+		// to reads in the same transaction, so a second payment would build
+		// on a stale balance. NextAt stays put, so the order is still due
+		if touched[order.Payer] || touched[order.Recipient] {
+			err = recordReceipt(ctx, standingOrderPrefix, order.ID, fmt.Sprintf("standing order %s deferred to the next run, an earlier payment touched the same account", order.ID))
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		balanceBytes, err := getBalanceBytes(ctx, order.Payer)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read account %s from world state: %v", order.Payer, err)
+		}
+
+		balance, err := parseBalance(balanceBytes)
+		if err != nil {
+			return 0, err
+		}
+
+		if int(balance.Int64()) < order.Amount {
+			// a missed period is recorded but does not fail the whole run
+			order.Missed++
+			err = recordReceipt(ctx, standingOrderPrefix, order.ID, fmt.Sprintf("standing order %s skipped, %s has insufficient funds", order.ID, order.Payer))
+			if err != nil {
+				return 0, err
+			}
+		} else if _, err = transferHelper(ctx, order.Payer, order.Recipient, order.Amount); err != nil {
+			// any refused transfer — a frozen account, a spending limit, an
+			// island rule — misses the period like insufficient funds does,
+			// so one bad order cannot stall everyone else's payments
+			order.Missed++
+			err = recordReceipt(ctx, standingOrderPrefix, order.ID, fmt.Sprintf("standing order %s skipped, transfer refused: %v", order.ID, err))
+			if err != nil {
+				return 0, err
+			}
+		} else {
+			order.Payments++
+			executed++
+			touched[order.Payer] = true
+			touched[order.Recipient] = true
+
+			err = recordReceipt(ctx, standingOrderPrefix, order.ID, fmt.Sprintf("standing order %s paid %d from %s to %s", order.ID, order.Amount, order.Payer, order.Recipient))
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		// the next payment is due one interval after this one became due,
+		// so a late run does not drift the schedule
+		order.NextAt = order.NextAt.Add(time.Duration(order.IntervalMin) * time.Minute)
+
+		err = putStandingOrder(ctx, &order)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return executed, nil
+}
+
+// GetStandingOrder returns a standing order
+func (s *SmartContract) GetStandingOrder(ctx contractapi.TransactionContextInterface, orderID string) (*StandingOrder, error) {
+	return getStandingOrder(ctx, orderID)
+}
+
+// getStandingOrder is an internal helper that reads a standing order
+func getStandingOrder(ctx contractapi.TransactionContextInterface, orderID string) (*StandingOrder, error) {
+
+	orderKey, err := ctx.GetStub().CreateCompositeKey(standingOrderPrefix, []string{orderID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", standingOrderPrefix, err)
+	}
+
+	orderBytes, err := ctx.GetStub().GetState(orderKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read standing order from world state: %v", err)
+	}
+	if orderBytes == nil {
+		return nil, fmt.Errorf("no standing order %v exists", orderID)
+	}
+
+	var order StandingOrder
+	err = json.Unmarshal(orderBytes, &order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create standing order object JSON: %v", err)
+	}
+
+	return &order, nil
+}
+
+// putStandingOrder is an internal helper that writes a standing order
+func putStandingOrder(ctx contractapi.TransactionContextInterface, order *StandingOrder) error {
+
+	orderKey, err := ctx.GetStub().CreateCompositeKey(standingOrderPrefix, []string{order.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", standingOrderPrefix, err)
+	}
+
+	orderBytes, err := marshalCanonical(order)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(orderKey, orderBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", orderKey, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const tariffPrefix = "tariff"
+
+// minimum notice in minutes between announcing a tariff change and the
+// change taking effect
+const tariffNoticeMin = 10080
+
+// TariffChange is one announced value of a tariff or fee parameter together
+// with the moment it takes effect
+type TariffChange struct {
+	Value         int       `json:"value"`
+	EffectiveFrom time.Time `json:"effectiveFrom"`
+	AnnouncedAt   time.Time `json:"announcedAt"`
+}
+
+// TariffSchedule keeps every announced change of one parameter. The change
+// whose effective-from has most recently passed is the current value; later
+// entries are the announced future values
+type TariffSchedule struct {
+	Name    string         `json:"name"`
+	Changes []TariffChange `json:"changes"`
+}
+
+// TariffView is the query result for one parameter: the value in force now
+// and the published future changes, so suppliers and apps can prepare
+type TariffView struct {
+	Name         string         `json:"name"`
+	Current      int            `json:"current"`
+	CurrentSince time.Time      `json:"currentSince"`
+	Announced    []TariffChange `json:"announced"`
+}
+
+// ScheduleTariff announces a new value of a tariff or fee parameter. The
+// effective-from time is passed in RFC3339 format and must honour the
+// minimum notice period; a change can never take effect by surprise. Only
+// the operator maintains the tariff schedule
+func (s *SmartContract) ScheduleTariff(ctx contractapi.TransactionContextInterface, name string, value int, effectiveFrom string) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if value < 0 {
+		return fmt.Errorf("tariff value cannot be negative")
+	}
+
+	effective, err := time.Parse(time.RFC3339, effectiveFrom)
+	if err != nil {
+		return fmt.Errorf("failed to parse effective-from time: %v", err)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get timestamp")
+	}
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	if effective.Before(now.Add(tariffNoticeMin * time.Minute)) {
+		return fmt.Errorf("tariff changes need at least %d minutes notice", tariffNoticeMin)
+	}
+
+	schedule, tariffKey, err := getTariffSchedule(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	schedule.Name = name
+	schedule.Changes = append(schedule.Changes, TariffChange{
+		Value:         value,
+		EffectiveFrom: effective,
+		AnnouncedAt:   now,
+	})
+
+	scheduleBytes, err := marshalCanonical(schedule)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(tariffKey, scheduleBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", tariffKey, err)
+	}
+
+	return nil
+}
+
+// GetTariff returns the value of a parameter in force now together with the
+// announced future changes
+func (s *SmartContract) GetTariff(ctx contractapi.TransactionContextInterface, name string) (*TariffView, error) {
+
+	schedule, _, err := getTariffSchedule(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(schedule.Changes) == 0 {
+		return nil, fmt.Errorf("no tariff has been scheduled for %v", name)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timestamp")
+	}
+	now := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
+
+	view := TariffView{
+		Name:      name,
+		Announced: []TariffChange{},
+	}
+
+	// the change with the latest effective-from that has passed is current;
+	// everything still in the future is announced
+	for _, change := range schedule.Changes {
+		if change.EffectiveFrom.After(now) {
+			view.Announced = append(view.Announced, change)
+			continue
+		}
+		if change.EffectiveFrom.After(view.CurrentSince) || view.CurrentSince.IsZero() {
+			view.Current = change.Value
+			view.CurrentSince = change.EffectiveFrom
+		}
+	}
+
+	if view.CurrentSince.IsZero() {
+		return nil, fmt.Errorf("no change of tariff %v is in force yet", name)
+	}
+
+	return &view, nil
+}
+
+// currentTariff is an internal helper that resolves the value of a parameter
+// in force at the current tx timestamp for use on settlement paths
+func currentTariff(ctx contractapi.TransactionContextInterface, name string) (int, error) {
+
+	view, err := (&SmartContract{}).GetTariff(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	return view.Current, nil
+}
+
+// getTariffSchedule is an internal helper that reads the schedule of a
+// parameter together with its state key. A parameter with no schedule yet
+// decodes as an empty schedule
+func getTariffSchedule(ctx contractapi.TransactionContextInterface, name string) (*TariffSchedule, string, error) {
+
+	tariffKey, err := ctx.GetStub().CreateCompositeKey(tariffPrefix, []string{name})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create the composite key for prefix %s: %v", tariffPrefix, err)
+	}
+
+	scheduleBytes, err := ctx.GetStub().GetState(tariffKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read tariff schedule from world state: %v", err)
+	}
+
+	schedule := TariffSchedule{
+		Changes: []TariffChange{},
+	}
+	if scheduleBytes != nil {
+		err = json.Unmarshal(scheduleBytes, &schedule)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create tariff schedule object JSON: %v", err)
+		}
+	}
+
+	return &schedule, tariffKey, nil
+}
@@ -1,11 +1,12 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"math/big"
 	"strconv"
+	"time"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
@@ -18,7 +19,6 @@ const allowancePrefix = "allowance"
 
 const holdPrefix = "hold"
 
-const MintBurnKey = "MintBurn"
 const BurnKey = "Burn"
 
 const stateOrder = "Ordered"
@@ -30,53 +30,82 @@ type SmartContract struct {
 	contractapi.Contract
 }
 
-// event provides an organized struct for emitting events
-type event struct {
-	from  string
-	to    string
-	value int
-}
-
 type Account struct {
 	ClientID string `json:"clientID"`
 	Active   int    `json:"active"`
 	OnHold   int    `json:"hold"`
 }
 
-type MintBurn struct {
-	State map[string]St_am `json:"state"`
-}
+// CreateAccount opens an account for the calling client with a zero balance
+// and the given metadata. Repeated calls are idempotent and return the
+// existing account, so clients no longer have to special-case an "already
+// exist" error
+func (S *SmartContract) CreateAccount(ctx contractapi.TransactionContextInterface, displayName string, org string, meterIDs []string) (*AccountInfo, error) {
 
-type St_am struct {
-	MintBurn string `json:"mintburn"`
-	Amount   int    `json:"amount"`
-	State    string `json:"state"`
-}
-
-func (S *SmartContract) CreateAccount(ctx contractapi.TransactionContextInterface) error {
+	// accounts are only opened for registered participants
+	err := requireRegistered(ctx)
+	if err != nil {
+		return nil, err
+	}
 	// Get ID of client identity
 	clientID, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
-		return fmt.Errorf("failed to get client id: %v", err)
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	// a closed account stays closed; off-boarded participants cannot reopen
+	err = checkAccountOpen(ctx, clientID)
+	if err != nil {
+		return nil, err
 	}
 
-	balanceBytes, err := ctx.GetStub().GetState(clientID)
-	if err != nil || balanceBytes == nil {
+	info, err := getAccountInfo(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if info != nil {
+		return info, nil
+	}
+
+	balanceBytes, err := getBalanceBytes(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if balanceBytes == nil {
 		initBalance := 0
 
-		err = ctx.GetStub().PutState(clientID, []byte(strconv.Itoa(initBalance)))
+		err = putBalanceBytes(ctx, clientID, []byte(strconv.Itoa(initBalance)))
 		if err != nil {
-			return err
+			return nil, err
 		}
-	} else {
-		return fmt.Errorf("account %s already exist", clientID)
 	}
-	return nil
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timestamp")
+	}
+
+	info = &AccountInfo{
+		ClientID:    clientID,
+		DisplayName: displayName,
+		Org:         org,
+		MeterIDs:    meterIDs,
+		CreatedAt:   time.Unix(timestamp.Seconds, int64(timestamp.Nanos)),
+	}
+
+	err = putAccountInfo(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
 }
 
-// Mint creates new tokens and adds them to minter's account balance
-// This function triggers a Transfer event
-func Mint(ctx contractapi.TransactionContextInterface, amount int) error {
+// mint is an internal helper that creates new tokens and adds them to the
+// minter's account balance. Minting is only reachable through the order
+// lifecycle: OrderMint, an ApproveMint decision and ExecuteMint
+// This function triggers a Mint event
+func mint(ctx contractapi.TransactionContextInterface, amount int) error {
 
 	// Get ID of submitting client identity
 	minter, err := ctx.GetClientIdentity().GetID()
@@ -88,23 +117,20 @@ func Mint(ctx contractapi.TransactionContextInterface, amount int) error {
 		return fmt.Errorf("mint amount must be a positive integer")
 	}
 
-	currentBalanceBytes, err := ctx.GetStub().GetState(minter)
+	currentBalanceBytes, err := getBalanceBytes(ctx, minter)
 	if err != nil {
 		return fmt.Errorf("failed to read minter account %s from world state: %v", minter, err)
 	}
 
-	var currentBalance int
-
-	// If minter current balance doesn't yet exist, we'll create it with a current balance of 0
-	if currentBalanceBytes == nil {
-		currentBalance = 0
-	} else {
-		currentBalance, _ = strconv.Atoi(string(currentBalanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+	// If minter current balance doesn't yet exist, it decodes as 0
+	currentBalance, err := parseBalance(currentBalanceBytes)
+	if err != nil {
+		return err
 	}
 
-	updatedBalance := currentBalance + amount
+	updatedBalance := addBalance(currentBalance, amount)
 
-	err = ctx.GetStub().PutState(minter, []byte(strconv.Itoa(updatedBalance)))
+	err = putBalanceBytes(ctx, minter, formatBalance(updatedBalance))
 	if err != nil {
 		return err
 	}
@@ -115,49 +141,50 @@ func Mint(ctx contractapi.TransactionContextInterface, amount int) error {
 		return fmt.Errorf("failed to retrieve total token supply: %v", err)
 	}
 
-	var totalSupply int
-
-	// If no tokens have been minted, initialize the totalSupply
-	if totalSupplyBytes == nil {
-		totalSupply = 0
-	} else {
-		totalSupply, _ = strconv.Atoi(string(totalSupplyBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
+	// If no tokens have been minted, the totalSupply decodes as 0
+	totalSupply, err := parseBalance(totalSupplyBytes)
+	if err != nil {
+		return err
 	}
 
 	// Add the mint amount to the total supply and update the state
-	totalSupply += amount
-	err = ctx.GetStub().PutState(totalSupplyKey, []byte(strconv.Itoa(totalSupply)))
+	totalSupply = addBalance(totalSupply, amount)
+	err = ctx.GetStub().PutState(totalSupplyKey, formatBalance(totalSupply))
 	if err != nil {
 		return err
 	}
 
-	// Emit the Transfer event
-	transferEvent := event{"0x0", minter, amount}
-	transferEventJSON, err := json.Marshal(transferEvent)
+	// Emit the Mint event
+	meta, err := eventMeta(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+		return err
 	}
-	err = ctx.GetStub().SetEvent("Transfer", transferEventJSON)
+	err = emitEvent(ctx, "Mint", MintEvent{EventMeta: meta, Minter: minter, Amount: amount})
 	if err != nil {
-		return fmt.Errorf("failed to set event: %v", err)
+		return err
 	}
 
 	log.Printf("minter account %s balance updated from %d to %d", minter, currentBalance, updatedBalance)
 
+	// evaluate the rate-of-change monitors on the supply write path
+	err = checkSupplyAlarm(ctx, amount)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-// Burn redeems tokens the minter's account balance
-// This function triggers a Transfer event
-func Burn(ctx contractapi.TransactionContextInterface, amount int) error {
+// burn is an internal helper that redeems tokens from the burner's account
+// balance. Burning is only reachable through the order lifecycle: OrderBurn,
+// an ApproveBurn decision and ExecuteBurn
+// This function triggers a Burn event
+func burn(ctx contractapi.TransactionContextInterface, amount int) error {
 
-	// Check minter authorization - this sample assumes Org1 is the central banker with privilege to burn new tokens
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	// Check burner authorization - burning requires the minter role
+	err := requireRole(ctx, roleMinter)
 	if err != nil {
-		return fmt.Errorf("failed to get MSPID: %v", err)
-	}
-	if clientMSPID != "Org1MSP" {
-		return fmt.Errorf("client is not authorized to mint new tokens")
+		return err
 	}
 
 	// Get ID of submitting client identity
@@ -170,23 +197,28 @@ func Burn(ctx contractapi.TransactionContextInterface, amount int) error {
 		return errors.New("burn amount must be a positive integer")
 	}
 
-	currentBalanceBytes, err := ctx.GetStub().GetState(burner)
+	currentBalanceBytes, err := getBalanceBytes(ctx, burner)
 	if err != nil {
 		return fmt.Errorf("failed to read burner account %s from world state: %v", burner, err)
 	}
 
-	var currentBalance int
-
 	// Check if burner current balance exists
 	if currentBalanceBytes == nil {
 		return errors.New("the balance does not exist")
 	}
 
-	currentBalance, _ = strconv.Atoi(string(currentBalanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+	currentBalance, err := parseBalance(currentBalanceBytes)
+	if err != nil {
+		return err
+	}
 
-	updatedBalance := currentBalance - amount
+	// a burn must be covered by the account's active balance
+	updatedBalance, err := subBalance(currentBalance, amount)
+	if err != nil {
+		return fmt.Errorf("burn amount %d exceeds the balance of account %s", amount, burner)
+	}
 
-	err = ctx.GetStub().PutState(burner, []byte(strconv.Itoa(updatedBalance)))
+	err = putBalanceBytes(ctx, burner, formatBalance(updatedBalance))
 	if err != nil {
 		return err
 	}
@@ -202,28 +234,154 @@ func Burn(ctx contractapi.TransactionContextInterface, amount int) error {
 		return errors.New("totalSupply does not exist")
 	}
 
-	totalSupply, _ := strconv.Atoi(string(totalSupplyBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
+	totalSupply, err := parseBalance(totalSupplyBytes)
+	if err != nil {
+		return err
+	}
 
-	// Subtract the burn amount to the total supply and update the state
-	totalSupply -= amount
-	err = ctx.GetStub().PutState(totalSupplyKey, []byte(strconv.Itoa(totalSupply)))
+	// Subtract the burn amount from the total supply and update the state.
+	// The supply invariant must hold: totalSupply never goes negative
+	totalSupply, err = subBalance(totalSupply, amount)
+	if err != nil {
+		return fmt.Errorf("burn amount %d would drive the total supply negative", amount)
+	}
+	err = ctx.GetStub().PutState(totalSupplyKey, formatBalance(totalSupply))
 	if err != nil {
 		return err
 	}
 
-	// Emit the Transfer event
-	transferEvent := event{burner, "0x0", amount}
-	transferEventJSON, err := json.Marshal(transferEvent)
+	// Emit the Burn event
+	meta, err := eventMeta(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+		return err
 	}
-	err = ctx.GetStub().SetEvent("Transfer", transferEventJSON)
+	err = emitEvent(ctx, "Burn", BurnEvent{EventMeta: meta, Burner: burner, Amount: amount})
 	if err != nil {
-		return fmt.Errorf("failed to set event: %v", err)
+		return err
 	}
 
 	log.Printf("burner account %s balance updated from %d to %d", burner, currentBalance, updatedBalance)
 
+	// evaluate the rate-of-change monitors on the supply write path
+	err = checkSupplyAlarm(ctx, amount)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// BurnFrom redeems tokens from another account, for off-boarding
+// participants who cash out. The regulator can always burn; anyone else must
+// hold an allowance from the account, which is consumed like a TransferFrom.
+// The totalSupply shrinks accordingly
+// This function triggers a Transfer event to the 0x0 address
+func (s *SmartContract) BurnFrom(ctx contractapi.TransactionContextInterface, account string, amount int) error {
+
+	// Get ID of submitting client identity
+	spender, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if amount <= 0 {
+		return errors.New("burn amount must be a positive integer")
+	}
+
+	// the regulator burns without an allowance; anyone else consumes one
+	if requireRole(ctx, roleRegulator) != nil {
+
+		allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{account, spender})
+		if err != nil {
+			return fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
+		}
+
+		allowanceBytes, err := ctx.GetStub().GetState(allowanceKey)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve the allowance for %s from world state: %v", allowanceKey, err)
+		}
+
+		// a missing allowance key is reported as such instead of silently
+		// decoding to an allowance of 0
+		if allowanceBytes == nil {
+			return fmt.Errorf("no allowance exists for spender %s from owner %s, call Approve first", spender, account)
+		}
+
+		allowance, _ := strconv.Atoi(string(allowanceBytes))
+
+		if allowance < amount {
+			return fmt.Errorf("spender does not have enough allowance to burn")
+		}
+
+		err = ctx.GetStub().PutState(allowanceKey, []byte(strconv.Itoa(allowance-amount)))
+		if err != nil {
+			return fmt.Errorf("failed to update state of smart contract for key %s: %v", allowanceKey, err)
+		}
+
+		err = putAllowanceIndex(ctx, account, spender, allowance-amount)
+		if err != nil {
+			return err
+		}
+	}
+
+	currentBalanceBytes, err := getBalanceBytes(ctx, account)
+	if err != nil {
+		return fmt.Errorf("failed to read account %s from world state: %v", account, err)
+	}
+	if currentBalanceBytes == nil {
+		return errors.New("the balance does not exist")
+	}
+
+	currentBalance, err := parseBalance(currentBalanceBytes)
+	if err != nil {
+		return err
+	}
+
+	updatedBalance, err := subBalance(currentBalance, amount)
+	if err != nil {
+		return fmt.Errorf("burn amount %d exceeds the balance of account %s", amount, account)
+	}
+
+	err = putBalanceBytes(ctx, account, formatBalance(updatedBalance))
+	if err != nil {
+		return err
+	}
+
+	// Update the totalSupply
+	totalSupplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve total token supply: %v", err)
+	}
+	if totalSupplyBytes == nil {
+		return errors.New("totalSupply does not exist")
+	}
+
+	totalSupply, err := parseBalance(totalSupplyBytes)
+	if err != nil {
+		return err
+	}
+
+	totalSupply, err = subBalance(totalSupply, amount)
+	if err != nil {
+		return fmt.Errorf("burn amount %d would drive the total supply negative", amount)
+	}
+	err = ctx.GetStub().PutState(totalSupplyKey, formatBalance(totalSupply))
+	if err != nil {
+		return err
+	}
+
+	// Emit the Transfer event to the 0x0 address
+	meta, err := eventMeta(ctx)
+	if err != nil {
+		return err
+	}
+	err = emitEvent(ctx, "Transfer", TransferEvent{EventMeta: meta, From: account, To: "0x0", Value: amount})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("account %s balance updated from %d to %d after burn by %s", account, currentBalance, updatedBalance, spender)
+
 	return nil
 }
 
@@ -241,7 +399,7 @@ func (s *SmartContract) GetAccount(ctx contractapi.TransactionContextInterface)
 		return &account, fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	currentBalanceBytes, err := ctx.GetStub().GetState(clientID)
+	currentBalanceBytes, err := getBalanceBytes(ctx, clientID)
 	if err != nil {
 		return &account, fmt.Errorf("failed to read client's account %s from world state: %v", clientID, err)
 	}
@@ -277,6 +435,7 @@ func (s *SmartContract) GetAccount(ctx contractapi.TransactionContextInterface)
 }
 
 func (s *SmartContract) CreateHold(ctx contractapi.TransactionContextInterface, amount int) error {
+
 	clientID, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
 		return fmt.Errorf("failed to get client id: %v", err)
@@ -286,7 +445,7 @@ func (s *SmartContract) CreateHold(ctx contractapi.TransactionContextInterface,
 		return errors.New("hold amount must be a positive integer")
 	}
 
-	currentBalanceBytes, err := ctx.GetStub().GetState(clientID)
+	currentBalanceBytes, err := getBalanceBytes(ctx, clientID)
 	if err != nil {
 		return fmt.Errorf("failed to read client's account %s from world state: %v", clientID, err)
 	}
@@ -302,7 +461,7 @@ func (s *SmartContract) CreateHold(ctx contractapi.TransactionContextInterface,
 
 	updatedBalance := currentBalance - amount
 
-	err = ctx.GetStub().PutState(clientID, []byte(strconv.Itoa(updatedBalance)))
+	err = putBalanceBytes(ctx, clientID, []byte(strconv.Itoa(updatedBalance)))
 	if err != nil {
 		return fmt.Errorf("failed to update state of smart contract for key %s: %v", clientID, err)
 	}
@@ -330,10 +489,29 @@ func (s *SmartContract) CreateHold(ctx contractapi.TransactionContextInterface,
 	if err != nil {
 		return fmt.Errorf("failed to update state of smart contract for key %s: %v", holdkey, err)
 	}
+
+	// Emit the HoldCreated event
+	meta, err := eventMeta(ctx)
+	if err != nil {
+		return err
+	}
+	err = emitEvent(ctx, "HoldCreated", HoldCreatedEvent{EventMeta: meta, Holder: clientID, Amount: amount})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
-func ExecuteHold(ctx contractapi.TransactionContextInterface, holder string, amount int) error {
+// ExecuteHold pays the submitting client out of a holder's aggregate hold;
+// the remainder of the hold goes back to the holder's balance
+func (s *SmartContract) ExecuteHold(ctx contractapi.TransactionContextInterface, holder string, amount int) error {
+	return executeHold(ctx, holder, amount)
+}
+
+// executeHold pays the caller part of an aggregate hold and returns the
+// remainder to the holder, it is shared by ExecuteHold and the V2 settlement
+func executeHold(ctx contractapi.TransactionContextInterface, holder string, amount int) error {
 	clientID, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
 		return fmt.Errorf("failed to get client id: %v", err)
@@ -362,7 +540,7 @@ func ExecuteHold(ctx contractapi.TransactionContextInterface, holder string, amo
 		return fmt.Errorf("error with hold amount")
 	}
 
-	currentBalanceBytes, err := ctx.GetStub().GetState(clientID)
+	currentBalanceBytes, err := getBalanceBytes(ctx, clientID)
 	if err != nil {
 		return fmt.Errorf("failed to read client's account %s from world state: %v", clientID, err)
 	}
@@ -378,12 +556,12 @@ func ExecuteHold(ctx contractapi.TransactionContextInterface, holder string, amo
 
 	updatedBalance := currentBalance + amount
 
-	err = ctx.GetStub().PutState(clientID, []byte(strconv.Itoa(updatedBalance)))
+	err = putBalanceBytes(ctx, clientID, []byte(strconv.Itoa(updatedBalance)))
 	if err != nil {
 		return fmt.Errorf("failed to update state of smart contract for key %s: %v", clientID, err)
 	}
 
-	currentBalanceBytes_h, err := ctx.GetStub().GetState(holder)
+	currentBalanceBytes_h, err := getBalanceBytes(ctx, holder)
 	if err != nil {
 		return fmt.Errorf("failed to read client's account %s from world state: %v", clientID, err)
 	}
@@ -399,11 +577,14 @@ func ExecuteHold(ctx contractapi.TransactionContextInterface, holder string, amo
 
 	updatedBalance_h := currentBalance_h + hold_amount - amount
 
-	err = ctx.GetStub().PutState(holder, []byte(strconv.Itoa(updatedBalance_h)))
+	err = putBalanceBytes(ctx, holder, []byte(strconv.Itoa(updatedBalance_h)))
 	if err != nil {
 		return fmt.Errorf("failed to update state of smart contract for key %s: %v", clientID, err)
 	}
 
+	// the hold is fully consumed: the executed amount went to the caller and
+	// the remainder back to the holder
+	hold_amount = 0
 	err = ctx.GetStub().PutState(holdkey, []byte(strconv.Itoa(hold_amount)))
 	if err != nil {
 		return fmt.Errorf("failed to update state of smart contract for key %s: %v", holdkey, err)
@@ -413,6 +594,12 @@ func ExecuteHold(ctx contractapi.TransactionContextInterface, holder string, amo
 }
 
 func (s *SmartContract) ReturnHold(ctx contractapi.TransactionContextInterface, holder string) error {
+	return returnHold(ctx, holder)
+}
+
+// returnHold gives a holder their held amount back, it is shared by
+// ReturnHold and the auction settlement
+func returnHold(ctx contractapi.TransactionContextInterface, holder string) error {
 	holdkey, err := ctx.GetStub().CreateCompositeKey(holdPrefix, []string{holder})
 	if err != nil {
 		return fmt.Errorf("failed to create the composite key for prefix %s: %v", holdPrefix, err)
@@ -429,7 +616,7 @@ func (s *SmartContract) ReturnHold(ctx contractapi.TransactionContextInterface,
 	}
 	hold_amount, _ = strconv.Atoi(string(holdBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
 
-	currentBalanceBytes, err := ctx.GetStub().GetState(holder)
+	currentBalanceBytes, err := getBalanceBytes(ctx, holder)
 	if err != nil {
 		return fmt.Errorf("failed to read client's account %s from world state: %v", holder, err)
 	}
@@ -445,7 +632,7 @@ func (s *SmartContract) ReturnHold(ctx contractapi.TransactionContextInterface,
 
 	updatedBalance := currentBalance + hold_amount
 
-	err = ctx.GetStub().PutState(holder, []byte(strconv.Itoa(updatedBalance)))
+	err = putBalanceBytes(ctx, holder, []byte(strconv.Itoa(updatedBalance)))
 	if err != nil {
 		return fmt.Errorf("failed to update state of smart contract for key %s: %v", holder, err)
 	}
@@ -470,20 +657,38 @@ func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface, re
 		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	err = transferHelper(ctx, clientID, recipient, amount)
+	// while a participant is islanded only intra-island trades settle
+	err = checkIslandTransfer(ctx, clientID, recipient, amount)
+	if err != nil {
+		return err
+	}
+
+	// transfers over the configured threshold need a second identity
+	err = checkMakerChecker(ctx, amount)
+	if err != nil {
+		return err
+	}
+
+	senderBalance, err := transferHelper(ctx, clientID, recipient, amount)
 	if err != nil {
 		return fmt.Errorf("failed to transfer: %v", err)
 	}
 
+	// the sender pays the configured platform fee into the treasury on top
+	// of the transferred amount
+	_, err = chargeTransferFee(ctx, clientID, amount, senderBalance)
+	if err != nil {
+		return err
+	}
+
 	// Emit the Transfer event
-	transferEvent := event{clientID, recipient, amount}
-	transferEventJSON, err := json.Marshal(transferEvent)
+	meta, err := eventMeta(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+		return err
 	}
-	err = ctx.GetStub().SetEvent("Transfer", transferEventJSON)
+	err = emitEvent(ctx, "Transfer", TransferEvent{EventMeta: meta, From: clientID, To: recipient, Value: amount})
 	if err != nil {
-		return fmt.Errorf("failed to set event: %v", err)
+		return err
 	}
 
 	return nil
@@ -491,7 +696,7 @@ func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface, re
 
 // BalanceOf returns the balance of the given account
 func (s *SmartContract) BalanceOf(ctx contractapi.TransactionContextInterface, account string) (int, error) {
-	balanceBytes, err := ctx.GetStub().GetState(account)
+	balanceBytes, err := getBalanceBytes(ctx, account)
 	if err != nil {
 		return 0, fmt.Errorf("failed to read from world state: %v", err)
 	}
@@ -513,7 +718,7 @@ func (s *SmartContract) ClientAccountBalance(ctx contractapi.TransactionContextI
 		return 0, fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	balanceBytes, err := ctx.GetStub().GetState(clientID)
+	balanceBytes, err := getBalanceBytes(ctx, clientID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to read from world state: %v", err)
 	}
@@ -586,15 +791,19 @@ func (s *SmartContract) Approve(ctx contractapi.TransactionContextInterface, spe
 		return fmt.Errorf("failed to update state of smart contract for key %s: %v", allowanceKey, err)
 	}
 
+	err = putAllowanceIndex(ctx, owner, spender, value)
+	if err != nil {
+		return err
+	}
+
 	// Emit the Approval event
-	approvalEvent := event{owner, spender, value}
-	approvalEventJSON, err := json.Marshal(approvalEvent)
+	meta, err := eventMeta(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+		return err
 	}
-	err = ctx.GetStub().SetEvent("Approval", approvalEventJSON)
+	err = emitEvent(ctx, "Approval", ApprovalEvent{EventMeta: meta, Owner: owner, Spender: spender, Value: value})
 	if err != nil {
-		return fmt.Errorf("failed to set event: %v", err)
+		return err
 	}
 
 	log.Printf("client %s approved a withdrawal allowance of %d for spender %s", owner, value, spender)
@@ -602,6 +811,77 @@ func (s *SmartContract) Approve(ctx contractapi.TransactionContextInterface, spe
 	return nil
 }
 
+// IncreaseAllowance raises the spender's allowance by the given delta. Unlike
+// Approve it adjusts the stored value instead of overwriting it, so two
+// in-flight adjustments cannot race each other into a double spend
+// This function triggers an Approval event with the new value
+func (s *SmartContract) IncreaseAllowance(ctx contractapi.TransactionContextInterface, spender string, delta int) error {
+	return adjustAllowance(ctx, spender, delta)
+}
+
+// DecreaseAllowance lowers the spender's allowance by the given delta. The
+// allowance can never go below zero
+// This function triggers an Approval event with the new value
+func (s *SmartContract) DecreaseAllowance(ctx contractapi.TransactionContextInterface, spender string, delta int) error {
+	return adjustAllowance(ctx, spender, -delta)
+}
+
+// adjustAllowance is an internal helper that applies a signed delta to the
+// stored allowance of a spender
+func adjustAllowance(ctx contractapi.TransactionContextInterface, spender string, delta int) error {
+
+	// Get ID of submitting client identity
+	owner, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	// Create allowanceKey
+	allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{owner, spender})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
+	}
+
+	allowanceBytes, err := ctx.GetStub().GetState(allowanceKey)
+	if err != nil {
+		return fmt.Errorf("failed to read allowance for %s from world state: %v", allowanceKey, err)
+	}
+
+	var allowance int
+	if allowanceBytes != nil {
+		allowance, _ = strconv.Atoi(string(allowanceBytes))
+	}
+
+	allowance += delta
+	if allowance < 0 {
+		return fmt.Errorf("allowance cannot be decreased below zero")
+	}
+
+	err = ctx.GetStub().PutState(allowanceKey, []byte(strconv.Itoa(allowance)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", allowanceKey, err)
+	}
+
+	err = putAllowanceIndex(ctx, owner, spender, allowance)
+	if err != nil {
+		return err
+	}
+
+	// Emit the Approval event with the new value
+	meta, err := eventMeta(ctx)
+	if err != nil {
+		return err
+	}
+	err = emitEvent(ctx, "Approval", ApprovalEvent{EventMeta: meta, Owner: owner, Spender: spender, Value: allowance})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("client %s adjusted the withdrawal allowance of spender %s to %d", owner, spender, allowance)
+
+	return nil
+}
+
 // Allowance returns the amount still available for the spender to withdraw from the owner
 func (s *SmartContract) Allowance(ctx contractapi.TransactionContextInterface, owner string, spender string) (int, error) {
 
@@ -641,6 +921,24 @@ func (s *SmartContract) TransferFrom(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
+	// an owner moving their own funds needs no allowance; the call is a
+	// plain transfer
+	if spender == from {
+		return s.Transfer(ctx, to, value)
+	}
+
+	// a delegated transfer obeys the same island and maker-checker rules
+	// as a direct Transfer by the owner
+	err = checkIslandTransfer(ctx, from, to, value)
+	if err != nil {
+		return err
+	}
+
+	err = checkMakerChecker(ctx, value)
+	if err != nil {
+		return err
+	}
+
 	// Create allowanceKey
 	allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{from, spender})
 	if err != nil {
@@ -653,8 +951,13 @@ func (s *SmartContract) TransferFrom(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("failed to retrieve the allowance for %s from world state: %v", allowanceKey, err)
 	}
 
-	var currentAllowance int
-	currentAllowance, _ = strconv.Atoi(string(currentAllowanceBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
+	// a missing allowance key is reported as such instead of silently
+	// decoding to an allowance of 0
+	if currentAllowanceBytes == nil {
+		return fmt.Errorf("no allowance exists for spender %s from owner %s, call Approve first", spender, from)
+	}
+
+	currentAllowance, _ := strconv.Atoi(string(currentAllowanceBytes)) // Error handling not needed since Itoa() was used when setting the allowance, guaranteeing it was an integer.
 
 	// Check if transferred value is less than allowance
 	if currentAllowance < value {
@@ -662,11 +965,17 @@ func (s *SmartContract) TransferFrom(ctx contractapi.TransactionContextInterface
 	}
 
 	// Initiate the transfer
-	err = transferHelper(ctx, from, to, value)
+	ownerBalance, err := transferHelper(ctx, from, to, value)
 	if err != nil {
 		return fmt.Errorf("failed to transfer: %v", err)
 	}
 
+	// the from account pays the configured platform fee into the treasury
+	_, err = chargeTransferFee(ctx, from, value, ownerBalance)
+	if err != nil {
+		return err
+	}
+
 	// Decrease the allowance
 	updatedAllowance := currentAllowance - value
 	err = ctx.GetStub().PutState(allowanceKey, []byte(strconv.Itoa(updatedAllowance)))
@@ -674,15 +983,19 @@ func (s *SmartContract) TransferFrom(ctx contractapi.TransactionContextInterface
 		return err
 	}
 
+	err = putAllowanceIndex(ctx, from, spender, updatedAllowance)
+	if err != nil {
+		return err
+	}
+
 	// Emit the Transfer event
-	transferEvent := event{from, to, value}
-	transferEventJSON, err := json.Marshal(transferEvent)
+	meta, err := eventMeta(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+		return err
 	}
-	err = ctx.GetStub().SetEvent("Transfer", transferEventJSON)
+	err = emitEvent(ctx, "Transfer", TransferEvent{EventMeta: meta, From: from, To: to, Value: value})
 	if err != nil {
-		return fmt.Errorf("failed to set event: %v", err)
+		return err
 	}
 
 	log.Printf("spender %s allowance updated from %d to %d", spender, currentAllowance, updatedAllowance)
@@ -690,77 +1003,18 @@ func (s *SmartContract) TransferFrom(ctx contractapi.TransactionContextInterface
 	return nil
 }
 
-func (s *SmartContract) OrderMint(ctx contractapi.TransactionContextInterface, amount int) error {
-	_, err := s.ClientAccountBalance(ctx)
-	if err != nil {
-		return fmt.Errorf("account does not exist: %v", err)
-	}
+func (s *SmartContract) OrderMint(ctx contractapi.TransactionContextInterface, amount int) (string, error) {
 
-	clientID, err := ctx.GetClientIdentity().GetID()
+	_, err := s.ClientAccountBalance(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get client id: %v", err)
+		return "", fmt.Errorf("account does not exist: %v", err)
 	}
 
-	mintburnBytes, err := ctx.GetStub().GetState(MintBurnKey)
-	if err != nil {
-		return fmt.Errorf("failed to read MintBurn from world state: %v", err)
-	} else if mintburnBytes == nil {
-		state := make(map[string]St_am)
-		var table St_am
-
-		table.MintBurn = "Mint"
-		table.Amount = amount
-		table.State = stateOrder
-
-		state[clientID] = table
-
-		mintburn := MintBurn{
-			State: state,
-		}
-
-		mintburnBytes, err := json.Marshal(mintburn)
-		if err != nil {
-			return fmt.Errorf("here lies the error: %v", err)
-		}
-
-		err = ctx.GetStub().PutState(MintBurnKey, mintburnBytes)
-		if err != nil {
-			return fmt.Errorf("failed to update MintBurn: %v", err)
-		}
-
-		return nil
-
-	} else {
-
-		var mintburn MintBurn
-		err = json.Unmarshal(mintburnBytes, &mintburn)
-		if err != nil {
-			return fmt.Errorf("failed to get json")
-		}
-
-		var table St_am
-
-		table.MintBurn = "Mint"
-		table.Amount = amount
-		table.State = stateOrder
-
-		mintburn.State[clientID] = table
-
-		upd_mintburnBytes, err := json.Marshal(mintburn)
-		if err != nil {
-			return fmt.Errorf("failed to get bytes")
-		}
-
-		err = ctx.GetStub().PutState(MintBurnKey, upd_mintburnBytes)
-		if err != nil {
-			return fmt.Errorf("failed to update state %v", err)
-		}
-
-		return nil
-	}
+	return placeOrder(ctx, "Mint", amount)
 }
 
-func (s *SmartContract) ExecuteMint(ctx contractapi.TransactionContextInterface, amount int) error {
+func (s *SmartContract) ExecuteMint(ctx contractapi.TransactionContextInterface, orderID string) error {
+
 	_, err := s.ClientAccountBalance(ctx)
 	if err != nil {
 		return fmt.Errorf("account does not exist: %v", err)
@@ -771,75 +1025,76 @@ func (s *SmartContract) ExecuteMint(ctx contractapi.TransactionContextInterface,
 		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	mintburnBytes, err := ctx.GetStub().GetState(MintBurnKey)
+	order, err := getOrder(ctx, orderID)
 	if err != nil {
-		return fmt.Errorf("failed to read MintBurn from world state: %v", err)
+		return err
 	}
 
-	var mintburn MintBurn
-	err = json.Unmarshal(mintburnBytes, &mintburn)
-	if err != nil {
-		return fmt.Errorf("failed to get json")
+	if order.Client != clientID {
+		return fmt.Errorf("order %v does not belong to the submitting client", orderID)
 	}
-
-	table := mintburn.State[clientID]
-	if (table.State != stateApproved) || (table.Amount != amount) || (table.MintBurn != "Mint") {
-		return fmt.Errorf("mint is not approved or amount is different than amount ordered")
+	if (order.State != stateApproved) || (order.Type != "Mint") {
+		return fmt.Errorf("mint is not approved")
 	}
 
-	err = Mint(ctx, amount)
+	// approved orders still expire if they sit unexecuted past their TTL
+	expired, err := orderExpired(ctx, order)
 	if err != nil {
-		return fmt.Errorf("error minting amount")
+		return err
 	}
-
-	delete(mintburn.State, clientID)
-
-	upd_mintburnBytes, err := json.Marshal(mintburn)
-	if err != nil {
-		return fmt.Errorf("failed to get bytes")
+	if expired {
+		err = expireOrder(ctx, order)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("order %v has expired", orderID)
 	}
 
-	err = ctx.GetStub().PutState(MintBurnKey, upd_mintburnBytes)
+	err = mint(ctx, order.Amount)
 	if err != nil {
-		return fmt.Errorf("failed to update state %v", err)
+		return fmt.Errorf("error minting amount")
 	}
 
-	return nil
+	order.State = stateExecuted
+
+	return putOrder(ctx, order)
 }
 
-func (s *SmartContract) GetMintOrder(ctx contractapi.TransactionContextInterface) (St_am, error) {
-	var mo St_am
+// GetMintOrder returns the submitting client's pending mint orders
+func (s *SmartContract) GetMintOrder(ctx contractapi.TransactionContextInterface) ([]Order, error) {
 	_, err := s.ClientAccountBalance(ctx)
 	if err != nil {
-		return mo, fmt.Errorf("account does not exist: %v", err)
+		return nil, fmt.Errorf("account does not exist: %v", err)
 	}
 
 	clientID, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
-		return mo, fmt.Errorf("failed to get client id: %v", err)
+		return nil, fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	mintburnBytes, err := ctx.GetStub().GetState(MintBurnKey)
+	orders, err := listOrders(ctx, "Mint", stateOrder, clientID)
 	if err != nil {
-		return mo, fmt.Errorf("failed to read MintBurn from world state: %v", err)
+		return nil, err
 	}
-
-	var mintburn MintBurn
-	err = json.Unmarshal(mintburnBytes, &mintburn)
-	if err != nil {
-		return mo, fmt.Errorf("failed to get json")
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("there is no mint order")
 	}
 
-	mo = mintburn.State[clientID]
+	return orders, nil
+}
+
+func (s *SmartContract) OrderBurn(ctx contractapi.TransactionContextInterface, amount int) (string, error) {
 
-	if mo.MintBurn != "Mint" {
-		return mo, fmt.Errorf("there is no mint order")
+	_, err := s.ClientAccountBalance(ctx)
+	if err != nil {
+		return "", fmt.Errorf("account does not exist: %v", err)
 	}
 
-	return mo, nil
+	return placeOrder(ctx, "Burn", amount)
 }
 
-func (s *SmartContract) OrderBurn(ctx contractapi.TransactionContextInterface, amount int) error {
+func (s *SmartContract) ExecuteBurn(ctx contractapi.TransactionContextInterface, orderID string) error {
+
 	_, err := s.ClientAccountBalance(ctx)
 	if err != nil {
 		return fmt.Errorf("account does not exist: %v", err)
@@ -850,197 +1105,170 @@ func (s *SmartContract) OrderBurn(ctx contractapi.TransactionContextInterface, a
 		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	mintburnBytes, err := ctx.GetStub().GetState(MintBurnKey)
+	order, err := getOrder(ctx, orderID)
 	if err != nil {
-		return fmt.Errorf("failed to read MintBurn from world state: %v", err)
-	} else if mintburnBytes == nil {
-		state := make(map[string]St_am)
-		var table St_am
-
-		table.MintBurn = "Burn"
-		table.Amount = amount
-		table.State = stateOrder
-
-		state[clientID] = table
-
-		mintburn := MintBurn{
-			State: state,
-		}
-
-		mintburnBytes, err := json.Marshal(mintburn)
-		if err != nil {
-			return fmt.Errorf("here lies the error: %v", err)
-		}
-
-		err = ctx.GetStub().PutState(MintBurnKey, mintburnBytes)
-		if err != nil {
-			return fmt.Errorf("failed to update MintBurn: %v", err)
-		}
-
-		return nil
+		return err
+	}
 
-	} else {
+	if order.Client != clientID {
+		return fmt.Errorf("order %v does not belong to the submitting client", orderID)
+	}
+	if (order.State != stateApproved) || (order.Type != "Burn") {
+		return fmt.Errorf("burn is not approved")
+	}
 
-		var mintburn MintBurn
-		err = json.Unmarshal(mintburnBytes, &mintburn)
+	// approved orders still expire if they sit unexecuted past their TTL
+	expired, err := orderExpired(ctx, order)
+	if err != nil {
+		return err
+	}
+	if expired {
+		err = expireOrder(ctx, order)
 		if err != nil {
-			return fmt.Errorf("failed to get json")
+			return err
 		}
+		return fmt.Errorf("order %v has expired", orderID)
+	}
 
-		var table St_am
-
-		table.MintBurn = "Mint"
-		table.Amount = amount
-		table.State = stateOrder
-
-		mintburn.State[clientID] = table
+	err = burn(ctx, order.Amount)
+	if err != nil {
+		return err
+	}
 
-		upd_mintburnBytes, err := json.Marshal(mintburn)
-		if err != nil {
-			return fmt.Errorf("failed to get bytes")
-		}
+	order.State = stateExecuted
 
-		err = ctx.GetStub().PutState(MintBurnKey, upd_mintburnBytes)
-		if err != nil {
-			return fmt.Errorf("failed to update state %v", err)
-		}
-
-		return nil
-	}
+	return putOrder(ctx, order)
 }
 
-func (s *SmartContract) ExecuteBurn(ctx contractapi.TransactionContextInterface, amount int) error {
+// GetBurnOrder returns the submitting client's pending burn orders
+func (s *SmartContract) GetBurnOrder(ctx contractapi.TransactionContextInterface) ([]Order, error) {
 	_, err := s.ClientAccountBalance(ctx)
 	if err != nil {
-		return fmt.Errorf("account does not exist: %v", err)
+		return nil, fmt.Errorf("account does not exist: %v", err)
 	}
 
 	clientID, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
-		return fmt.Errorf("failed to get client id: %v", err)
+		return nil, fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	mintburnBytes, err := ctx.GetStub().GetState(MintBurnKey)
+	orders, err := listOrders(ctx, "Burn", stateOrder, clientID)
 	if err != nil {
-		return fmt.Errorf("failed to read MintBurn from world state: %v", err)
+		return nil, err
 	}
-
-	var mintburn MintBurn
-	err = json.Unmarshal(mintburnBytes, &mintburn)
-	if err != nil {
-		return fmt.Errorf("failed to get json")
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("there is no burn order")
 	}
 
-	table := mintburn.State[clientID]
-	if (table.State != stateApproved) || (table.Amount != amount) || (table.MintBurn != "Burn") {
-		return fmt.Errorf("burn is not approved or amount is different than amount ordered")
-	}
+	return orders, nil
+}
 
-	err = Burn(ctx, amount)
-	if err != nil {
-		return err
+// transferHelper moves value between two accounts and returns the sender's
+// balance after the debit, so callers that charge a fee on top can build on
+// the updated figure instead of re-reading a balance the ledger has not
+// committed yet
+func transferHelper(ctx contractapi.TransactionContextInterface, from string, to string, value int) (*big.Int, error) {
+
+	if value < 0 { // transfer of 0 is allowed in ERC-20, so just validate against negative amounts
+		return nil, fmt.Errorf("transfer amount cannot be negative")
 	}
 
-	delete(mintburn.State, clientID)
+	// closed accounts take no part in transfers in either direction
+	if err := checkAccountOpen(ctx, from); err != nil {
+		return nil, err
+	}
+	if err := checkAccountOpen(ctx, to); err != nil {
+		return nil, err
+	}
 
-	upd_mintburnBytes, err := json.Marshal(mintburn)
+	// the sender's configured spending limits cap the payment; the rolled
+	// outflow window is only written below, once the whole transfer has
+	// validated, so a refused transfer leaves no partial writes behind
+	windowKey, windowBytes, err := validateSpendingLimits(ctx, from, value)
 	if err != nil {
-		return fmt.Errorf("failed to get bytes")
+		return nil, err
 	}
 
-	err = ctx.GetStub().PutState(MintBurnKey, upd_mintburnBytes)
+	fromCurrentBalanceBytes, err := getBalanceBytes(ctx, from)
 	if err != nil {
-		return fmt.Errorf("failed to update state %v", err)
+		return nil, fmt.Errorf("failed to read client account %s from world state: %v", from, err)
 	}
 
-	return nil
-}
-
-func (s *SmartContract) GetBurnOrder(ctx contractapi.TransactionContextInterface) (St_am, error) {
-	var mo St_am
-	_, err := s.ClientAccountBalance(ctx)
-	if err != nil {
-		return mo, fmt.Errorf("account does not exist: %v", err)
+	if fromCurrentBalanceBytes == nil {
+		return nil, fmt.Errorf("client account %s has no balance", from)
 	}
 
-	clientID, err := ctx.GetClientIdentity().GetID()
+	fromCurrentBalance, err := parseBalance(fromCurrentBalanceBytes)
 	if err != nil {
-		return mo, fmt.Errorf("failed to get client id: %v", err)
+		return nil, err
 	}
 
-	mintburnBytes, err := ctx.GetStub().GetState(MintBurnKey)
+	toCurrentBalanceBytes, err := getBalanceBytes(ctx, to)
 	if err != nil {
-		return mo, fmt.Errorf("failed to read MintBurn from world state: %v", err)
+		return nil, fmt.Errorf("failed to read recipient account %s from world state: %v", to, err)
 	}
 
-	var mintburn MintBurn
-	err = json.Unmarshal(mintburnBytes, &mintburn)
+	// If recipient current balance doesn't yet exist, it decodes as 0
+	toCurrentBalance, err := parseBalance(toCurrentBalanceBytes)
 	if err != nil {
-		return mo, fmt.Errorf("failed to get json")
+		return nil, err
 	}
 
-	mo = mintburn.State[clientID]
-
-	if mo.MintBurn != "Burn" {
-		return mo, fmt.Errorf("there is no burn order")
+	// a transfer past the balance would go negative, which subBalance rejects
+	fromUpdatedBalance, err := subBalance(fromCurrentBalance, value)
+	if err != nil {
+		return nil, fmt.Errorf("client account %s has insufficient funds", from)
 	}
+	toUpdatedBalance := addBalance(toCurrentBalance, value)
 
-	return mo, nil
-}
-
-// Helper Functions
-
-// transferHelper is a helper function that transfers tokens from the "from" address to the "to" address
-// Dependant functions include Transfer and TransferFrom
-func transferHelper(ctx contractapi.TransactionContextInterface, from string, to string, value int) error {
-
-	if value < 0 { // transfer of 0 is allowed in ERC-20, so just validate against negative amounts
-		return fmt.Errorf("transfer amount cannot be negative")
+	// every check has passed; the payment rolls into the outflow window
+	if windowKey != "" {
+		err = ctx.GetStub().PutState(windowKey, windowBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update state of smart contract for key %s: %v", windowKey, err)
+		}
 	}
 
-	fromCurrentBalanceBytes, err := ctx.GetStub().GetState(from)
+	err = putBalanceBytes(ctx, from, formatBalance(fromUpdatedBalance))
 	if err != nil {
-		return fmt.Errorf("failed to read client account %s from world state: %v", from, err)
-	}
-
-	if fromCurrentBalanceBytes == nil {
-		return fmt.Errorf("client account %s has no balance", from)
+		return nil, err
 	}
 
-	fromCurrentBalance, _ := strconv.Atoi(string(fromCurrentBalanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
-
-	if fromCurrentBalance < value {
-		return fmt.Errorf("client account %s has insufficient funds", from)
+	err = putBalanceBytes(ctx, to, formatBalance(toUpdatedBalance))
+	if err != nil {
+		return nil, err
 	}
 
-	toCurrentBalanceBytes, err := ctx.GetStub().GetState(to)
+	// both sides of the transfer reset their demurrage idle clocks
+	err = touchActivity(ctx, from)
 	if err != nil {
-		return fmt.Errorf("failed to read recipient account %s from world state: %v", to, err)
+		return nil, err
 	}
-
-	var toCurrentBalance int
-	// If recipient current balance doesn't yet exist, we'll create it with a current balance of 0
-	if toCurrentBalanceBytes == nil {
-		toCurrentBalance = 0
-	} else {
-		toCurrentBalance, _ = strconv.Atoi(string(toCurrentBalanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+	err = touchActivity(ctx, to)
+	if err != nil {
+		return nil, err
 	}
 
-	fromUpdatedBalance := fromCurrentBalance - value
-	toUpdatedBalance := toCurrentBalance + value
+	log.Printf("client %s balance updated from %d to %d", from, fromCurrentBalance, fromUpdatedBalance)
+	log.Printf("recipient %s balance updated from %d to %d", to, toCurrentBalance, toUpdatedBalance)
 
-	err = ctx.GetStub().PutState(from, []byte(strconv.Itoa(fromUpdatedBalance)))
+	// record the payment for the transaction explorer
+	err = recordReceipt(ctx, "payment", to, fmt.Sprintf("transferred %d from %s to %s", value, from, to))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = ctx.GetStub().PutState(to, []byte(strconv.Itoa(toUpdatedBalance)))
+	// notify the sender if the payment dropped them below their threshold
+	err = checkLowBalanceNotice(ctx, from, int(fromUpdatedBalance.Int64()))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	log.Printf("client %s balance updated from %d to %d", from, fromCurrentBalance, fromUpdatedBalance)
-	log.Printf("recipient %s balance updated from %d to %d", to, toCurrentBalance, toUpdatedBalance)
+	// evaluate the rate-of-change monitors on the receiving account
+	err = checkInflowAlarm(ctx, to, value)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil
+	return fromUpdatedBalance, nil
 }
@@ -0,0 +1,643 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// setupContract initializes the token on a fresh mock ledger and returns the
+// contract together with the stub and an Org1 context that passes every role
+// check, mirroring the bootstrap an operator runs after deployment
+func setupContract(t *testing.T) (*SmartContract, *mockStub, *mockContext) {
+	t.Helper()
+
+	// queryAllBids resolves the peer's MSP ID from the environment
+	t.Setenv("CORE_PEER_LOCALMSPID", "Org1MSP")
+
+	contract := &SmartContract{}
+	stub := newMockStub()
+	org1 := testContext(stub, "org1-admin", "Org1MSP")
+
+	stub.tick()
+	err := contract.Initialize(org1, "energytoken", "ET", 0)
+	if err != nil {
+		t.Fatalf("failed to initialize contract: %v", err)
+	}
+
+	return contract, stub, org1
+}
+
+// registerAccount walks a client through the onboarding flow: participant
+// registration followed by account creation
+func registerAccount(t *testing.T, contract *SmartContract, stub *mockStub, ctx *mockContext) {
+	t.Helper()
+
+	stub.tick()
+	err := contract.RegisterParticipant(ctx, participantProsumer, "cp-1", nil)
+	if err != nil {
+		t.Fatalf("failed to register participant: %v", err)
+	}
+
+	stub.tick()
+	_, err = contract.CreateAccount(ctx, ctx.identity.id, ctx.identity.mspID, nil)
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+}
+
+// fundAccount runs the full mint order lifecycle to credit a client's account:
+// the client orders, the regulator approves and the client executes
+func fundAccount(t *testing.T, contract *SmartContract, stub *mockStub, ctx *mockContext, regulator *mockContext, amount int) {
+	t.Helper()
+
+	stub.tick()
+	orderID, err := contract.OrderMint(ctx, amount)
+	if err != nil {
+		t.Fatalf("failed to order mint: %v", err)
+	}
+
+	stub.tick()
+	err = contract.ApproveMint(regulator, orderID)
+	if err != nil {
+		t.Fatalf("failed to approve mint: %v", err)
+	}
+
+	stub.tick()
+	err = contract.ExecuteMint(ctx, orderID)
+	if err != nil {
+		t.Fatalf("failed to execute mint: %v", err)
+	}
+}
+
+// requireBalance asserts an account's balance through the contract's own query
+func requireBalance(t *testing.T, contract *SmartContract, ctx *mockContext, account string, want int) {
+	t.Helper()
+
+	balance, err := contract.BalanceOf(ctx, account)
+	if err != nil {
+		t.Fatalf("failed to read balance of %s: %v", account, err)
+	}
+	if balance != want {
+		t.Fatalf("balance of %s is %d, want %d", account, balance, want)
+	}
+}
+
+func TestInitialize(t *testing.T) {
+	contract := &SmartContract{}
+	stub := newMockStub()
+
+	stub.tick()
+	err := contract.Initialize(testContext(stub, "org2-user", "Org2MSP"), "energytoken", "ET", 0)
+	if err == nil {
+		t.Fatal("expected initialization by a non-issuer org to fail")
+	}
+
+	org1 := testContext(stub, "org1-admin", "Org1MSP")
+	stub.tick()
+	err = contract.Initialize(org1, "energytoken", "ET", 0)
+	if err != nil {
+		t.Fatalf("failed to initialize contract: %v", err)
+	}
+
+	stub.tick()
+	err = contract.Initialize(org1, "energytoken", "ET", 0)
+	if err == nil {
+		t.Fatal("expected a second initialization to fail")
+	}
+}
+
+func TestMintOrderLifecycle(t *testing.T) {
+	contract, stub, org1 := setupContract(t)
+
+	client := testContext(stub, "client-1", "Org2MSP")
+	registerAccount(t, contract, stub, client)
+
+	stub.tick()
+	orderID, err := contract.OrderMint(client, 100)
+	if err != nil {
+		t.Fatalf("failed to order mint: %v", err)
+	}
+
+	// executing before the regulator decides must fail
+	stub.tick()
+	err = contract.ExecuteMint(client, orderID)
+	if err == nil {
+		t.Fatal("expected executing an undecided mint order to fail")
+	}
+
+	// a client outside Org1 without the regulator role cannot approve
+	stub.tick()
+	err = contract.ApproveMint(client, orderID)
+	if err == nil {
+		t.Fatal("expected approval by a non-regulator to fail")
+	}
+
+	stub.tick()
+	err = contract.ApproveMint(org1, orderID)
+	if err != nil {
+		t.Fatalf("failed to approve mint: %v", err)
+	}
+
+	stub.tick()
+	err = contract.ExecuteMint(client, orderID)
+	if err != nil {
+		t.Fatalf("failed to execute mint: %v", err)
+	}
+
+	stub.tick()
+	requireBalance(t, contract, org1, "client-1", 100)
+
+	supply, err := contract.TotalSupply(org1)
+	if err != nil {
+		t.Fatalf("failed to read total supply: %v", err)
+	}
+	if supply != 100 {
+		t.Fatalf("total supply is %d, want 100", supply)
+	}
+}
+
+func TestRejectedMintOrderCannotExecute(t *testing.T) {
+	contract, stub, org1 := setupContract(t)
+
+	client := testContext(stub, "client-1", "Org2MSP")
+	registerAccount(t, contract, stub, client)
+
+	stub.tick()
+	orderID, err := contract.OrderMint(client, 100)
+	if err != nil {
+		t.Fatalf("failed to order mint: %v", err)
+	}
+
+	stub.tick()
+	err = contract.RejectMint(org1, orderID, "insufficient collateral")
+	if err != nil {
+		t.Fatalf("failed to reject mint: %v", err)
+	}
+
+	stub.tick()
+	err = contract.ExecuteMint(client, orderID)
+	if err == nil {
+		t.Fatal("expected executing a rejected mint order to fail")
+	}
+
+	requireBalance(t, contract, org1, "client-1", 0)
+}
+
+func TestBurnOrderLifecycle(t *testing.T) {
+	contract, stub, org1 := setupContract(t)
+
+	client := testContext(stub, "client-1", "Org2MSP")
+	registerAccount(t, contract, stub, client)
+	fundAccount(t, contract, stub, client, org1, 100)
+
+	// burning requires the minter role
+	stub.tick()
+	err := contract.GrantRole(org1, "client-1", roleMinter)
+	if err != nil {
+		t.Fatalf("failed to grant minter role: %v", err)
+	}
+
+	stub.tick()
+	orderID, err := contract.OrderBurn(client, 40)
+	if err != nil {
+		t.Fatalf("failed to order burn: %v", err)
+	}
+
+	stub.tick()
+	err = contract.ApproveBurn(org1, orderID)
+	if err != nil {
+		t.Fatalf("failed to approve burn: %v", err)
+	}
+
+	stub.tick()
+	err = contract.ExecuteBurn(client, orderID)
+	if err != nil {
+		t.Fatalf("failed to execute burn: %v", err)
+	}
+
+	stub.tick()
+	requireBalance(t, contract, org1, "client-1", 60)
+
+	supply, err := contract.TotalSupply(org1)
+	if err != nil {
+		t.Fatalf("failed to read total supply: %v", err)
+	}
+	if supply != 60 {
+		t.Fatalf("total supply is %d, want 60", supply)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	contract, stub, org1 := setupContract(t)
+
+	alice := testContext(stub, "alice", "Org2MSP")
+	bob := testContext(stub, "bob", "Org2MSP")
+	registerAccount(t, contract, stub, alice)
+	registerAccount(t, contract, stub, bob)
+	fundAccount(t, contract, stub, alice, org1, 100)
+
+	stub.tick()
+	err := contract.Transfer(alice, "bob", 30)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+
+	stub.tick()
+	requireBalance(t, contract, org1, "alice", 70)
+	requireBalance(t, contract, org1, "bob", 30)
+
+	if stub.lastEventName != "Transfer" {
+		t.Fatalf("last event is %q, want Transfer", stub.lastEventName)
+	}
+}
+
+func TestTransferInsufficientFunds(t *testing.T) {
+	contract, stub, org1 := setupContract(t)
+
+	alice := testContext(stub, "alice", "Org2MSP")
+	bob := testContext(stub, "bob", "Org2MSP")
+	registerAccount(t, contract, stub, alice)
+	registerAccount(t, contract, stub, bob)
+	fundAccount(t, contract, stub, alice, org1, 100)
+
+	stub.tick()
+	err := contract.Transfer(alice, "bob", 1000)
+	if err == nil {
+		t.Fatal("expected a transfer over the balance to fail")
+	}
+
+	requireBalance(t, contract, org1, "alice", 100)
+	requireBalance(t, contract, org1, "bob", 0)
+}
+
+func TestTransferFrom(t *testing.T) {
+	contract, stub, org1 := setupContract(t)
+
+	alice := testContext(stub, "alice", "Org2MSP")
+	bob := testContext(stub, "bob", "Org2MSP")
+	carol := testContext(stub, "carol", "Org2MSP")
+	registerAccount(t, contract, stub, alice)
+	registerAccount(t, contract, stub, bob)
+	registerAccount(t, contract, stub, carol)
+	fundAccount(t, contract, stub, alice, org1, 100)
+
+	// without an Approve there is no allowance key at all
+	stub.tick()
+	err := contract.TransferFrom(bob, "alice", "carol", 10)
+	if err == nil || !strings.Contains(err.Error(), "no allowance exists") {
+		t.Fatalf("expected a missing-allowance error, got %v", err)
+	}
+
+	stub.tick()
+	err = contract.Approve(alice, "bob", 30)
+	if err != nil {
+		t.Fatalf("failed to approve: %v", err)
+	}
+
+	stub.tick()
+	err = contract.TransferFrom(bob, "alice", "carol", 20)
+	if err != nil {
+		t.Fatalf("failed to transfer from: %v", err)
+	}
+
+	stub.tick()
+	requireBalance(t, contract, org1, "alice", 80)
+	requireBalance(t, contract, org1, "carol", 20)
+
+	allowance, err := contract.Allowance(org1, "alice", "bob")
+	if err != nil {
+		t.Fatalf("failed to read allowance: %v", err)
+	}
+	if allowance != 10 {
+		t.Fatalf("allowance is %d, want 10", allowance)
+	}
+
+	// the remaining allowance does not cover another 20
+	stub.tick()
+	err = contract.TransferFrom(bob, "alice", "carol", 20)
+	if err == nil {
+		t.Fatal("expected a transfer over the allowance to fail")
+	}
+
+	// an owner moving their own funds needs no allowance
+	stub.tick()
+	err = contract.TransferFrom(alice, "alice", "carol", 5)
+	if err != nil {
+		t.Fatalf("failed to transfer own funds via TransferFrom: %v", err)
+	}
+
+	stub.tick()
+	requireBalance(t, contract, org1, "alice", 75)
+	requireBalance(t, contract, org1, "carol", 25)
+}
+
+func TestPendingTransferLifecycle(t *testing.T) {
+	contract, stub, org1 := setupContract(t)
+
+	alice := testContext(stub, "alice", "Org2MSP")
+	bob := testContext(stub, "bob", "Org2MSP")
+	registerAccount(t, contract, stub, alice)
+	registerAccount(t, contract, stub, bob)
+	fundAccount(t, contract, stub, alice, org1, 100)
+
+	// the offered amount leaves the sender's balance at submission time
+	stub.tick()
+	acceptedID, err := contract.TransferPending(alice, "bob", 30)
+	if err != nil {
+		t.Fatalf("failed to offer pending transfer: %v", err)
+	}
+
+	stub.tick()
+	requireBalance(t, contract, org1, "alice", 70)
+	requireBalance(t, contract, org1, "bob", 0)
+
+	// only the named recipient can answer the offer
+	stub.tick()
+	err = contract.AcceptTransfer(alice, acceptedID)
+	if err == nil {
+		t.Fatal("expected accepting someone else's pending transfer to fail")
+	}
+
+	stub.tick()
+	err = contract.AcceptTransfer(bob, acceptedID)
+	if err != nil {
+		t.Fatalf("failed to accept pending transfer: %v", err)
+	}
+
+	stub.tick()
+	requireBalance(t, contract, org1, "bob", 30)
+
+	// an answered transfer cannot be answered again
+	stub.tick()
+	err = contract.AcceptTransfer(bob, acceptedID)
+	if err == nil {
+		t.Fatal("expected accepting an answered pending transfer to fail")
+	}
+
+	// a rejection returns the amount to the sender
+	stub.tick()
+	rejectedID, err := contract.TransferPending(alice, "bob", 20)
+	if err != nil {
+		t.Fatalf("failed to offer pending transfer: %v", err)
+	}
+
+	stub.tick()
+	err = contract.RejectTransfer(bob, rejectedID)
+	if err != nil {
+		t.Fatalf("failed to reject pending transfer: %v", err)
+	}
+
+	stub.tick()
+	requireBalance(t, contract, org1, "alice", 70)
+	requireBalance(t, contract, org1, "bob", 30)
+}
+
+func TestPendingTransferSweep(t *testing.T) {
+	contract, stub, org1 := setupContract(t)
+
+	alice := testContext(stub, "alice", "Org2MSP")
+	bob := testContext(stub, "bob", "Org2MSP")
+	registerAccount(t, contract, stub, alice)
+	registerAccount(t, contract, stub, bob)
+	fundAccount(t, contract, stub, alice, org1, 100)
+
+	stub.tick()
+	transferID, err := contract.TransferPending(alice, "bob", 25)
+	if err != nil {
+		t.Fatalf("failed to offer pending transfer: %v", err)
+	}
+
+	// inside the window the sweep refunds nothing
+	stub.tick()
+	swept, err := contract.SweepExpiredTransfers(org1, "bob")
+	if err != nil {
+		t.Fatalf("failed to sweep pending transfers: %v", err)
+	}
+	if swept != 0 {
+		t.Fatalf("swept %d transfers inside the window, want 0", swept)
+	}
+
+	stub.advance(25 * time.Hour)
+
+	// past the window the recipient can no longer accept
+	stub.tick()
+	err = contract.AcceptTransfer(bob, transferID)
+	if err == nil {
+		t.Fatal("expected accepting an expired pending transfer to fail")
+	}
+
+	stub.tick()
+	swept, err = contract.SweepExpiredTransfers(org1, "bob")
+	if err != nil {
+		t.Fatalf("failed to sweep pending transfers: %v", err)
+	}
+	if swept != 1 {
+		t.Fatalf("swept %d transfers, want 1", swept)
+	}
+
+	stub.tick()
+	requireBalance(t, contract, org1, "alice", 100)
+	requireBalance(t, contract, org1, "bob", 0)
+
+	transfer, err := contract.GetPendingTransfer(org1, "bob", transferID)
+	if err != nil {
+		t.Fatalf("failed to get pending transfer: %v", err)
+	}
+	if transfer.Status != pendingExpired {
+		t.Fatalf("pending transfer is %s, want %s", transfer.Status, pendingExpired)
+	}
+}
+
+func TestTransferWithNonce(t *testing.T) {
+	contract, stub, org1 := setupContract(t)
+
+	alice := testContext(stub, "alice", "Org2MSP")
+	bob := testContext(stub, "bob", "Org2MSP")
+	registerAccount(t, contract, stub, alice)
+	registerAccount(t, contract, stub, bob)
+	fundAccount(t, contract, stub, alice, org1, 100)
+
+	stub.tick()
+	err := contract.TransferWithNonce(alice, "bob", 30, "n-1")
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+
+	// a gateway retry replays the same nonce and must not apply twice
+	stub.tick()
+	err = contract.TransferWithNonce(alice, "bob", 30, "n-1")
+	if err == nil {
+		t.Fatal("expected a replayed nonce to fail")
+	}
+
+	requireBalance(t, contract, org1, "alice", 70)
+	requireBalance(t, contract, org1, "bob", 30)
+
+	// a fresh nonce goes through, and another client may reuse the value
+	stub.tick()
+	err = contract.TransferWithNonce(alice, "bob", 10, "n-2")
+	if err != nil {
+		t.Fatalf("failed to transfer with a fresh nonce: %v", err)
+	}
+
+	stub.tick()
+	err = contract.TransferWithNonce(bob, "alice", 5, "n-1")
+	if err != nil {
+		t.Fatalf("failed to transfer with another client's nonce value: %v", err)
+	}
+
+	stub.tick()
+	requireBalance(t, contract, org1, "alice", 65)
+	requireBalance(t, contract, org1, "bob", 35)
+}
+
+func TestAccountLimits(t *testing.T) {
+	contract, stub, org1 := setupContract(t)
+
+	alice := testContext(stub, "alice", "Org2MSP")
+	bob := testContext(stub, "bob", "Org2MSP")
+	registerAccount(t, contract, stub, alice)
+	registerAccount(t, contract, stub, bob)
+	fundAccount(t, contract, stub, alice, org1, 100)
+
+	// only the regulator sets limits
+	stub.tick()
+	err := contract.SetAccountLimits(bob, "alice", 20, 30)
+	if err == nil {
+		t.Fatal("expected setting limits by a non-regulator to fail")
+	}
+
+	stub.tick()
+	err = contract.SetAccountLimits(org1, "alice", 20, 30)
+	if err != nil {
+		t.Fatalf("failed to set account limits: %v", err)
+	}
+
+	stub.tick()
+	limits, err := contract.GetAccountLimits(org1, "alice")
+	if err != nil {
+		t.Fatalf("failed to get account limits: %v", err)
+	}
+	if limits.MaxTransfer != 20 || limits.MaxDailyOutflow != 30 {
+		t.Fatalf("limits are %d/%d, want 20/30", limits.MaxTransfer, limits.MaxDailyOutflow)
+	}
+
+	// a single transfer over the per-transfer cap is rejected
+	stub.tick()
+	err = contract.Transfer(alice, "bob", 25)
+	if err == nil {
+		t.Fatal("expected a transfer over the per-transfer limit to fail")
+	}
+
+	stub.tick()
+	err = contract.Transfer(alice, "bob", 20)
+	if err != nil {
+		t.Fatalf("failed to transfer within the limits: %v", err)
+	}
+
+	// the next payment would push the daily outflow past 30
+	stub.tick()
+	err = contract.Transfer(alice, "bob", 15)
+	if err == nil {
+		t.Fatal("expected a transfer over the daily outflow limit to fail")
+	}
+
+	stub.tick()
+	err = contract.Transfer(alice, "bob", 10)
+	if err != nil {
+		t.Fatalf("failed to transfer within the limits: %v", err)
+	}
+
+	stub.tick()
+	requireBalance(t, contract, org1, "alice", 70)
+	requireBalance(t, contract, org1, "bob", 30)
+
+	// once the window ages out the counter starts over
+	stub.advance(25 * time.Hour)
+	stub.tick()
+	err = contract.Transfer(alice, "bob", 15)
+	if err != nil {
+		t.Fatalf("failed to transfer after the window reset: %v", err)
+	}
+
+	stub.tick()
+	requireBalance(t, contract, org1, "alice", 55)
+	requireBalance(t, contract, org1, "bob", 45)
+}
+
+func TestHoldLifecycle(t *testing.T) {
+	contract, stub, org1 := setupContract(t)
+
+	alice := testContext(stub, "alice", "Org2MSP")
+	bob := testContext(stub, "bob", "Org2MSP")
+	registerAccount(t, contract, stub, alice)
+	registerAccount(t, contract, stub, bob)
+	fundAccount(t, contract, stub, alice, org1, 100)
+
+	// a hold over the balance never leaves the balance short
+	stub.tick()
+	err := contract.CreateHoldByID(alice, "h-big", 500, "test", 60)
+	if err == nil {
+		t.Fatal("expected a hold over the balance to fail")
+	}
+
+	stub.tick()
+	err = contract.CreateHoldByID(alice, "h1", 40, "test", 60)
+	if err != nil {
+		t.Fatalf("failed to create hold: %v", err)
+	}
+
+	stub.tick()
+	requireBalance(t, contract, org1, "alice", 60)
+
+	hold, err := contract.GetHold(org1, "alice", "h1")
+	if err != nil {
+		t.Fatalf("failed to get hold: %v", err)
+	}
+	if hold.Status != holdActive || hold.Amount != 40 {
+		t.Fatalf("hold is %s with %d, want %s with 40", hold.Status, hold.Amount, holdActive)
+	}
+
+	// a partial execution pays the payee and leaves the remainder on hold
+	stub.tick()
+	err = contract.ExecuteHoldByID(bob, "alice", "h1", 15)
+	if err != nil {
+		t.Fatalf("failed to execute hold: %v", err)
+	}
+
+	stub.tick()
+	requireBalance(t, contract, org1, "bob", 15)
+
+	// executing more than the remainder must fail
+	stub.tick()
+	err = contract.ExecuteHoldByID(bob, "alice", "h1", 30)
+	if err == nil {
+		t.Fatal("expected executing more than the hold remainder to fail")
+	}
+
+	// the holder releases the remainder back to their balance
+	stub.tick()
+	err = contract.ReleaseHoldByID(alice, "h1")
+	if err != nil {
+		t.Fatalf("failed to release hold: %v", err)
+	}
+
+	stub.tick()
+	requireBalance(t, contract, org1, "alice", 85)
+
+	hold, err = contract.GetHold(org1, "alice", "h1")
+	if err != nil {
+		t.Fatalf("failed to get hold: %v", err)
+	}
+	if hold.Status != holdReleased || hold.Amount != 0 {
+		t.Fatalf("hold is %s with %d, want %s with 0", hold.Status, hold.Amount, holdReleased)
+	}
+
+	// a released hold cannot be released again
+	stub.tick()
+	err = contract.ReleaseHoldByID(alice, "h1")
+	if err == nil {
+		t.Fatal("expected releasing an inactive hold to fail")
+	}
+}
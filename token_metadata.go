@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define key names for options
+const nameKey = "name"
+const symbolKey = "symbol"
+const decimalsKey = "decimals"
+
+// Initialize stores the token metadata (name, symbol, decimals) and marks the
+// contract as initialized. It can only run once and only by the authorized
+// org; every other transaction fails until it has run
+func (s *SmartContract) Initialize(ctx contractapi.TransactionContextInterface, name string, symbol string, decimals int) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if name == "" || symbol == "" {
+		return fmt.Errorf("a token name and symbol are required")
+	}
+
+	if decimals < 0 {
+		return fmt.Errorf("decimals cannot be negative")
+	}
+
+	// the name doubles as the one-time initialization flag
+	nameBytes, err := ctx.GetStub().GetState(nameKey)
+	if err != nil {
+		return fmt.Errorf("failed to read token name from world state: %v", err)
+	}
+	if nameBytes != nil {
+		return fmt.Errorf("contract is already initialized as %s", string(nameBytes))
+	}
+
+	err = ctx.GetStub().PutState(nameKey, []byte(name))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", nameKey, err)
+	}
+
+	err = ctx.GetStub().PutState(symbolKey, []byte(symbol))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", symbolKey, err)
+	}
+
+	err = ctx.GetStub().PutState(decimalsKey, []byte(strconv.Itoa(decimals)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", decimalsKey, err)
+	}
+
+	return nil
+}
+
+// Name returns the name of the token
+func (s *SmartContract) Name(ctx contractapi.TransactionContextInterface) (string, error) {
+
+	nameBytes, err := ctx.GetStub().GetState(nameKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token name from world state: %v", err)
+	}
+
+	return string(nameBytes), nil
+}
+
+// Symbol returns the symbol of the token
+func (s *SmartContract) Symbol(ctx contractapi.TransactionContextInterface) (string, error) {
+
+	symbolBytes, err := ctx.GetStub().GetState(symbolKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token symbol from world state: %v", err)
+	}
+
+	return string(symbolBytes), nil
+}
+
+// Decimals returns the number of decimals of the token
+func (s *SmartContract) Decimals(ctx contractapi.TransactionContextInterface) (int, error) {
+
+	decimalsBytes, err := ctx.GetStub().GetState(decimalsKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read token decimals from world state: %v", err)
+	}
+
+	decimals, _ := strconv.Atoi(string(decimalsBytes))
+
+	return decimals, nil
+}
+
+// checkInitialized verifies that Initialize has run. Transactions that move
+// or create value call this first so nothing happens on an unconfigured token
+func checkInitialized(ctx contractapi.TransactionContextInterface) error {
+
+	nameBytes, err := ctx.GetStub().GetState(nameKey)
+	if err != nil {
+		return fmt.Errorf("failed to read token name from world state: %v", err)
+	}
+	if nameBytes == nil {
+		return fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize the contract")
+	}
+
+	return nil
+}
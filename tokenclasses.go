@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const classBalancePrefix = "balance"
+const classSupplyPrefix = "supply"
+
+// defaultClass is the token class the pre-existing single-token API operates
+// on; its balances and supply stay under the original keys so existing
+// accounts keep working unchanged
+const defaultClass = "default"
+
+// Token classes give distinct energy products their own fungible balances in
+// the same contract - peak KWh, off-peak KWh and carbon credits do not mix.
+// Class balances live under balance~class~account composite keys; the
+// "default" class is an alias for the original single-token balances
+
+// MintClass creates new tokens of a class in the calling minter's account.
+// Only the minter role mints, same as the single-token Mint
+// This function triggers a Mint event
+func (s *SmartContract) MintClass(ctx contractapi.TransactionContextInterface, class string, amount int) error {
+
+	err := requireRole(ctx, roleMinter)
+	if err != nil {
+		return err
+	}
+
+	minter, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if class == "" {
+		return fmt.Errorf("token class must not be empty")
+	}
+	if amount <= 0 {
+		return fmt.Errorf("mint amount must be a positive integer")
+	}
+
+	currentBalanceBytes, err := getClassBalanceBytes(ctx, class, minter)
+	if err != nil {
+		return fmt.Errorf("failed to read minter account %s from world state: %v", minter, err)
+	}
+
+	currentBalance, err := parseBalance(currentBalanceBytes)
+	if err != nil {
+		return err
+	}
+
+	err = putClassBalanceBytes(ctx, class, minter, formatBalance(addBalance(currentBalance, amount)))
+	if err != nil {
+		return err
+	}
+
+	// update the class supply
+	supply, err := classTotalSupply(ctx, class)
+	if err != nil {
+		return err
+	}
+	err = putClassSupply(ctx, class, supply+amount)
+	if err != nil {
+		return err
+	}
+
+	// Emit the Mint event
+	meta, err := eventMeta(ctx)
+	if err != nil {
+		return err
+	}
+	err = emitEvent(ctx, "Mint", MintEvent{EventMeta: meta, Minter: minter, Amount: amount})
+	if err != nil {
+		return err
+	}
+
+	return recordReceipt(ctx, classBalancePrefix, class, fmt.Sprintf("minted %d of class %s to %s", amount, class, minter))
+}
+
+// TransferClass moves tokens of a class from the calling client to a
+// recipient
+// This function triggers a Transfer event
+func (s *SmartContract) TransferClass(ctx contractapi.TransactionContextInterface, class string, recipient string, amount int) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if class == "" {
+		return fmt.Errorf("token class must not be empty")
+	}
+	if amount < 0 {
+		return fmt.Errorf("transfer amount cannot be negative")
+	}
+	if clientID == recipient {
+		return fmt.Errorf("cannot transfer to and from same client account")
+	}
+
+	senderBalanceBytes, err := getClassBalanceBytes(ctx, class, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to read client account %s from world state: %v", clientID, err)
+	}
+	if senderBalanceBytes == nil {
+		return fmt.Errorf("client account %s has no balance of class %s", clientID, class)
+	}
+
+	senderBalance, err := parseBalance(senderBalanceBytes)
+	if err != nil {
+		return err
+	}
+
+	newSenderBalance, err := subBalance(senderBalance, amount)
+	if err != nil {
+		return fmt.Errorf("transfer amount %d exceeds the class %s balance of account %s", amount, class, clientID)
+	}
+
+	recipientBalanceBytes, err := getClassBalanceBytes(ctx, class, recipient)
+	if err != nil {
+		return fmt.Errorf("failed to read recipient account %s from world state: %v", recipient, err)
+	}
+
+	recipientBalance, err := parseBalance(recipientBalanceBytes)
+	if err != nil {
+		return err
+	}
+
+	err = putClassBalanceBytes(ctx, class, clientID, formatBalance(newSenderBalance))
+	if err != nil {
+		return err
+	}
+
+	err = putClassBalanceBytes(ctx, class, recipient, formatBalance(addBalance(recipientBalance, amount)))
+	if err != nil {
+		return err
+	}
+
+	// Emit the Transfer event
+	meta, err := eventMeta(ctx)
+	if err != nil {
+		return err
+	}
+	err = emitEvent(ctx, "Transfer", TransferEvent{EventMeta: meta, From: clientID, To: recipient, Value: amount})
+	if err != nil {
+		return err
+	}
+
+	return recordReceipt(ctx, classBalancePrefix, class, fmt.Sprintf("transferred %d of class %s from %s to %s", amount, class, clientID, recipient))
+}
+
+// BalanceOfClass returns the balance of an account in one token class
+func (s *SmartContract) BalanceOfClass(ctx contractapi.TransactionContextInterface, class string, account string) (int, error) {
+
+	balanceBytes, err := getClassBalanceBytes(ctx, class, account)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read account %s from world state: %v", account, err)
+	}
+	if balanceBytes == nil {
+		return 0, nil
+	}
+
+	balance, err := parseBalance(balanceBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(balance.Int64()), nil
+}
+
+// TotalSupplyOf returns the total supply of one token class
+func (s *SmartContract) TotalSupplyOf(ctx contractapi.TransactionContextInterface, class string) (int, error) {
+	return classTotalSupply(ctx, class)
+}
+
+// getClassBalanceBytes is an internal helper that reads a class balance. The
+// default class reads the original single-token balance keys
+func getClassBalanceBytes(ctx contractapi.TransactionContextInterface, class string, account string) ([]byte, error) {
+
+	if class == defaultClass {
+		return getBalanceBytes(ctx, account)
+	}
+
+	balanceKey, err := ctx.GetStub().CreateCompositeKey(classBalancePrefix, []string{class, account})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", classBalancePrefix, err)
+	}
+
+	return ctx.GetStub().GetState(balanceKey)
+}
+
+// putClassBalanceBytes is an internal helper that writes a class balance.
+// The default class writes the original single-token balance keys
+func putClassBalanceBytes(ctx contractapi.TransactionContextInterface, class string, account string, value []byte) error {
+
+	if class == defaultClass {
+		return putBalanceBytes(ctx, account, value)
+	}
+
+	balanceKey, err := ctx.GetStub().CreateCompositeKey(classBalancePrefix, []string{class, account})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", classBalancePrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(balanceKey, value)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", balanceKey, err)
+	}
+
+	return nil
+}
+
+// classTotalSupply is an internal helper that reads the total supply of a
+// class. The default class reads the original totalSupply key
+func classTotalSupply(ctx contractapi.TransactionContextInterface, class string) (int, error) {
+
+	var supplyBytes []byte
+	var err error
+
+	if class == defaultClass {
+		supplyBytes, err = ctx.GetStub().GetState(totalSupplyKey)
+		if err != nil {
+			return 0, fmt.Errorf("failed to retrieve total token supply: %v", err)
+		}
+	} else {
+		supplyKey, err := ctx.GetStub().CreateCompositeKey(classSupplyPrefix, []string{class})
+		if err != nil {
+			return 0, fmt.Errorf("failed to create the composite key for prefix %s: %v", classSupplyPrefix, err)
+		}
+		supplyBytes, err = ctx.GetStub().GetState(supplyKey)
+		if err != nil {
+			return 0, fmt.Errorf("failed to retrieve total token supply: %v", err)
+		}
+	}
+
+	supply, err := parseBalance(supplyBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(supply.Int64()), nil
+}
+
+// putClassSupply is an internal helper that writes the total supply of a
+// class. The default class writes the original totalSupply key
+func putClassSupply(ctx contractapi.TransactionContextInterface, class string, supply int) error {
+
+	if class == defaultClass {
+		err := ctx.GetStub().PutState(totalSupplyKey, formatBalance(addBalance(big.NewInt(0), supply)))
+		if err != nil {
+			return fmt.Errorf("failed to update state of smart contract for key %s: %v", totalSupplyKey, err)
+		}
+		return nil
+	}
+
+	supplyKey, err := ctx.GetStub().CreateCompositeKey(classSupplyPrefix, []string{class})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", classSupplyPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(supplyKey, formatBalance(addBalance(big.NewInt(0), supply)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", supplyKey, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const topologyPrefix = "topology"
+
+// Topology node types, from root to leaf
+const nodeSubstation = "substation"
+const nodeFeeder = "feeder"
+const nodeConnection = "connection"
+
+// TopologyNode is one element of the grid hierarchy: substations contain
+// feeders, feeders contain connection points. Zones and loss factors resolve
+// through the parent chain instead of flat zone strings
+type TopologyNode struct {
+	ID         string `json:"id"`
+	NodeType   string `json:"nodeType"`
+	Parent     string `json:"parent"`
+	Zone       string `json:"zone"`
+	CapacityKW int    `json:"capacityKW"`
+	LossFactor int    `json:"lossFactor"` // basis points per level
+}
+
+// RegisterTopologyNode adds or updates a node of the grid topology. Only the
+// regulator maintains the topology. Substations have no parent; feeders hang
+// off substations and connection points off feeders
+func (s *SmartContract) RegisterTopologyNode(ctx contractapi.TransactionContextInterface, id string, nodeType string, parent string, zone string, capacityKW int, lossFactor int) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if capacityKW < 0 {
+		return fmt.Errorf("capacity cannot be negative")
+	}
+
+	if lossFactor < 0 {
+		return fmt.Errorf("loss factor cannot be negative")
+	}
+
+	switch nodeType {
+	case nodeSubstation:
+		if parent != "" {
+			return fmt.Errorf("a substation cannot have a parent")
+		}
+	case nodeFeeder, nodeConnection:
+		parentNode, err := getTopologyNode(ctx, parent)
+		if err != nil {
+			return fmt.Errorf("parent of %v: %v", id, err)
+		}
+		if nodeType == nodeFeeder && parentNode.NodeType != nodeSubstation {
+			return fmt.Errorf("a feeder must hang off a substation")
+		}
+		if nodeType == nodeConnection && parentNode.NodeType != nodeFeeder {
+			return fmt.Errorf("a connection point must hang off a feeder")
+		}
+	default:
+		return fmt.Errorf("unknown node type %v", nodeType)
+	}
+
+	node := TopologyNode{
+		ID:         id,
+		NodeType:   nodeType,
+		Parent:     parent,
+		Zone:       zone,
+		CapacityKW: capacityKW,
+		LossFactor: lossFactor,
+	}
+
+	nodeBytes, err := marshalCanonical(node)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	nodeKey, err := ctx.GetStub().CreateCompositeKey(topologyPrefix, []string{id})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", topologyPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(nodeKey, nodeBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", nodeKey, err)
+	}
+
+	return nil
+}
+
+// GetTopologyNode returns one node of the grid topology
+func (s *SmartContract) GetTopologyNode(ctx contractapi.TransactionContextInterface, id string) (*TopologyNode, error) {
+	return getTopologyNode(ctx, id)
+}
+
+// ResolveZone walks up the parent chain of a node until it finds a zone, so
+// zonal logic does not depend on every leaf carrying its own zone string
+func (s *SmartContract) ResolveZone(ctx contractapi.TransactionContextInterface, id string) (string, error) {
+
+	node, err := getTopologyNode(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		if node.Zone != "" {
+			return node.Zone, nil
+		}
+		if node.Parent == "" {
+			return "", fmt.Errorf("no zone is set anywhere above node %v", id)
+		}
+		node, err = getTopologyNode(ctx, node.Parent)
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// ResolveLossFactor sums the loss factors (in basis points) along the path
+// from a node up to its substation
+func (s *SmartContract) ResolveLossFactor(ctx contractapi.TransactionContextInterface, id string) (int, error) {
+
+	node, err := getTopologyNode(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	lossFactor := node.LossFactor
+	for node.Parent != "" {
+		node, err = getTopologyNode(ctx, node.Parent)
+		if err != nil {
+			return 0, err
+		}
+		lossFactor += node.LossFactor
+	}
+
+	return lossFactor, nil
+}
+
+// CheckCapacity verifies that a load in kW fits within the capacity of a node
+// and of every node above it
+func (s *SmartContract) CheckCapacity(ctx contractapi.TransactionContextInterface, id string, loadKW int) (bool, error) {
+
+	if loadKW < 0 {
+		return false, fmt.Errorf("load cannot be negative")
+	}
+
+	node, err := getTopologyNode(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	for {
+		if node.CapacityKW > 0 && loadKW > node.CapacityKW {
+			return false, nil
+		}
+		if node.Parent == "" {
+			return true, nil
+		}
+		node, err = getTopologyNode(ctx, node.Parent)
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// getTopologyNode is an internal helper that reads a topology node from state
+func getTopologyNode(ctx contractapi.TransactionContextInterface, id string) (*TopologyNode, error) {
+
+	nodeKey, err := ctx.GetStub().CreateCompositeKey(topologyPrefix, []string{id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", topologyPrefix, err)
+	}
+
+	nodeBytes, err := ctx.GetStub().GetState(nodeKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read topology node from world state: %v", err)
+	}
+	if nodeBytes == nil {
+		return nil, fmt.Errorf("topology node %v does not exist", id)
+	}
+
+	var node TopologyNode
+	err = json.Unmarshal(nodeBytes, &node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create topology node object JSON: %v", err)
+	}
+
+	return &node, nil
+}
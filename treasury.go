@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define key names for options
+const transferFeeKey = "transferFee"
+
+// TransferFee is the configured platform fee on transfers: a flat part plus
+// a percentage of the transferred amount. A zero config means transfers are
+// free. Collected fees accumulate in the same treasury that receives slashed
+// bid bonds and fund platform operation
+type TransferFee struct {
+	Flat    int `json:"flat"`
+	Percent int `json:"percent"`
+}
+
+// SetTransferFee configures the platform fee charged on transfers. Only the
+// regulator sets fees; setting both parts to zero disables the fee
+func (s *SmartContract) SetTransferFee(ctx contractapi.TransactionContextInterface, flat int, percent int) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if flat < 0 || percent < 0 || percent > 100 {
+		return fmt.Errorf("flat fee cannot be negative and percentage must be between 0 and 100")
+	}
+
+	fee := TransferFee{
+		Flat:    flat,
+		Percent: percent,
+	}
+
+	feeBytes, err := marshalCanonical(fee)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(transferFeeKey, feeBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", transferFeeKey, err)
+	}
+
+	return nil
+}
+
+// GetTreasuryBalance returns the fees accumulated in the treasury
+func (s *SmartContract) GetTreasuryBalance(ctx contractapi.TransactionContextInterface) (int, error) {
+
+	treasuryBytes, err := ctx.GetStub().GetState(treasuryKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read treasury from world state: %v", err)
+	}
+
+	treasury, err := parseBalance(treasuryBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(treasury.Int64()), nil
+}
+
+// WithdrawTreasury moves accumulated fees from the treasury into a
+// recipient's account. Only the regulator withdraws
+func (s *SmartContract) WithdrawTreasury(ctx contractapi.TransactionContextInterface, recipient string, amount int) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if amount <= 0 {
+		return fmt.Errorf("withdrawal amount must be a positive integer")
+	}
+
+	treasuryBytes, err := ctx.GetStub().GetState(treasuryKey)
+	if err != nil {
+		return fmt.Errorf("failed to read treasury from world state: %v", err)
+	}
+
+	treasury, err := parseBalance(treasuryBytes)
+	if err != nil {
+		return err
+	}
+
+	newTreasury, err := subBalance(treasury, amount)
+	if err != nil {
+		return fmt.Errorf("withdrawal amount %d exceeds the treasury balance", amount)
+	}
+
+	balanceBytes, err := getBalanceBytes(ctx, recipient)
+	if err != nil {
+		return fmt.Errorf("failed to read account %s from world state: %v", recipient, err)
+	}
+	if balanceBytes == nil {
+		return fmt.Errorf("the account %s does not exist", recipient)
+	}
+
+	balance, err := parseBalance(balanceBytes)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(treasuryKey, formatBalance(newTreasury))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", treasuryKey, err)
+	}
+
+	err = putBalanceBytes(ctx, recipient, formatBalance(addBalance(balance, amount)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", recipient, err)
+	}
+
+	return recordReceipt(ctx, treasuryKey, recipient, fmt.Sprintf("withdrew %d from the treasury to %s", amount, recipient))
+}
+
+// chargeTransferFee is an internal helper that debits the configured fee
+// from the payer into the treasury. The caller passes the payer's balance as
+// it stands after the transfer's own debit: reads during simulation never see
+// the transaction's earlier writes, so re-reading the balance here would
+// silently undo the transfer. It returns the charged fee; with no fee
+// configured it is a no-op
+func chargeTransferFee(ctx contractapi.TransactionContextInterface, payer string, amount int, balance *big.Int) (int, error) {
+
+	feeBytes, err := ctx.GetStub().GetState(transferFeeKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read transfer fee from world state: %v", err)
+	}
+	if feeBytes == nil {
+		return 0, nil
+	}
+
+	var feeConfig TransferFee
+	err = json.Unmarshal(feeBytes, &feeConfig)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create transfer fee object JSON: %v", err)
+	}
+
+	fee := feeConfig.Flat + amount*feeConfig.Percent/100
+	if fee == 0 {
+		return 0, nil
+	}
+
+	newBalance, err := subBalance(balance, fee)
+	if err != nil {
+		return 0, fmt.Errorf("transfer fee of %d exceeds the balance of account %s", fee, payer)
+	}
+
+	treasuryBytes, err := ctx.GetStub().GetState(treasuryKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read treasury from world state: %v", err)
+	}
+
+	treasury, err := parseBalance(treasuryBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	err = putBalanceBytes(ctx, payer, formatBalance(newBalance))
+	if err != nil {
+		return 0, fmt.Errorf("failed to update state of smart contract for key %s: %v", payer, err)
+	}
+
+	err = ctx.GetStub().PutState(treasuryKey, formatBalance(addBalance(treasury, fee)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to update state of smart contract for key %s: %v", treasuryKey, err)
+	}
+
+	return fee, nil
+}
@@ -5,6 +5,7 @@ SPDX-License-Identifier: Apache-2.0
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
@@ -64,6 +65,20 @@ func addAssetStateBasedEndorsement(ctx contractapi.TransactionContextInterface,
 	return nil
 }
 
+// removeAssetStateBasedEndorsement clears the key-level endorsement policy of
+// a finished auction, so the archived state does not keep requiring every
+// historical bidder org to endorse future writes. Setting a nil validation
+// parameter falls back to the chaincode-level endorsement policy
+func removeAssetStateBasedEndorsement(ctx contractapi.TransactionContextInterface, auctionID string) error {
+
+	err := ctx.GetStub().SetStateValidationParameter(auctionID, nil)
+	if err != nil {
+		return fmt.Errorf("failed to remove validation parameter on auction: %v", err)
+	}
+
+	return nil
+}
+
 // getCollectionName is an internal helper function to get collection of submitting client identity.
 func getCollectionName(ctx contractapi.TransactionContextInterface) (string, error) {
 
@@ -97,6 +112,32 @@ func verifyClientOrgMatchesPeerOrg(ctx contractapi.TransactionContextInterface)
 	return nil
 }
 
+// deprecationEvent is the payload of the Deprecated event emitted by shims
+// that keep renamed transactions callable under their old name
+type deprecationEvent struct {
+	OldName string `json:"oldName"`
+	NewName string `json:"newName"`
+}
+
+// emitDeprecationEvent signals that a client invoked a transaction through its
+// deprecated name, so operators can track who still needs to migrate
+func emitDeprecationEvent(ctx contractapi.TransactionContextInterface, oldName string, newName string) error {
+	deprecated := deprecationEvent{
+		OldName: oldName,
+		NewName: newName,
+	}
+	deprecatedJSON, err := json.Marshal(deprecated)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("Deprecated", deprecatedJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
+
 func contains(sli []string, str string) bool {
 	for _, a := range sli {
 		if a == str {
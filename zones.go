@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const zonePrefix = "zone"
+
+// Zone is a grid pricing zone defined by the grid operator. The congestion
+// percentage is a settlement multiplier: 100 is neutral, 120 makes buyers in
+// the zone pay 20% on top of the clearing price, so prices reflect local
+// grid constraints
+type Zone struct {
+	ID                string `json:"ID"`
+	Name              string `json:"name"`
+	CongestionPercent int    `json:"congestionPercent"`
+}
+
+// CreateZone defines a new pricing zone
+func (s *SmartContract) CreateZone(ctx contractapi.TransactionContextInterface, zoneID string, name string, congestionPercent int) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if congestionPercent <= 0 {
+		return fmt.Errorf("congestion percentage must be a positive integer")
+	}
+
+	existing, _ := getZone(ctx, zoneID)
+	if existing != nil {
+		return fmt.Errorf("zone %v already exists", zoneID)
+	}
+
+	zone := Zone{
+		ID:                zoneID,
+		Name:              name,
+		CongestionPercent: congestionPercent,
+	}
+
+	return putZone(ctx, &zone)
+}
+
+// SetZoneCongestion updates the congestion multiplier of a zone as grid
+// conditions change
+func (s *SmartContract) SetZoneCongestion(ctx contractapi.TransactionContextInterface, zoneID string, congestionPercent int) error {
+
+	err := requireRole(ctx, roleRegulator)
+	if err != nil {
+		return err
+	}
+
+	if congestionPercent <= 0 {
+		return fmt.Errorf("congestion percentage must be a positive integer")
+	}
+
+	zone, err := getZone(ctx, zoneID)
+	if err != nil {
+		return err
+	}
+
+	zone.CongestionPercent = congestionPercent
+
+	return putZone(ctx, zone)
+}
+
+// GetZone returns a pricing zone
+func (s *SmartContract) GetZone(ctx contractapi.TransactionContextInterface, zoneID string) (*Zone, error) {
+	return getZone(ctx, zoneID)
+}
+
+// ListZones returns every defined pricing zone
+func (s *SmartContract) ListZones(ctx contractapi.TransactionContextInterface) ([]Zone, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(zonePrefix, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zones from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	zones := []Zone{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zones from world state: %v", err)
+		}
+
+		var zone Zone
+		err = json.Unmarshal(queryResponse.Value, &zone)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zone object JSON: %v", err)
+		}
+
+		zones = append(zones, zone)
+	}
+
+	return zones, nil
+}
+
+// applyZoneMultiplier is an internal helper that scales an amount by the
+// congestion multiplier of a zone. An auction without a zone settles at the
+// unscaled amount
+func applyZoneMultiplier(ctx contractapi.TransactionContextInterface, zoneID string, amount int) (int, error) {
+
+	if zoneID == "" {
+		return amount, nil
+	}
+
+	zone, err := getZone(ctx, zoneID)
+	if err != nil {
+		return 0, err
+	}
+
+	return amount * zone.CongestionPercent / 100, nil
+}
+
+// getZone is an internal helper that reads a pricing zone
+func getZone(ctx contractapi.TransactionContextInterface, zoneID string) (*Zone, error) {
+
+	zoneKey, err := ctx.GetStub().CreateCompositeKey(zonePrefix, []string{zoneID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", zonePrefix, err)
+	}
+
+	zoneBytes, err := ctx.GetStub().GetState(zoneKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zone from world state: %v", err)
+	}
+	if zoneBytes == nil {
+		return nil, fmt.Errorf("no zone %v exists", zoneID)
+	}
+
+	var zone Zone
+	err = json.Unmarshal(zoneBytes, &zone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zone object JSON: %v", err)
+	}
+
+	return &zone, nil
+}
+
+// putZone is an internal helper that writes a pricing zone
+func putZone(ctx contractapi.TransactionContextInterface, zone *Zone) error {
+
+	zoneKey, err := ctx.GetStub().CreateCompositeKey(zonePrefix, []string{zone.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", zonePrefix, err)
+	}
+
+	zoneBytes, err := marshalCanonical(zone)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(zoneKey, zoneBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", zoneKey, err)
+	}
+
+	return nil
+}